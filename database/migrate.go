@@ -0,0 +1,307 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// فایل‌های مایگریشن با فرمت NNNN_name.up.sql و NNNN_name.down.sql داخل باینری قرار می‌گیرند
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// کلید قفل advisory؛ تا دو نسخه‌ی ربات همزمان مایگریشن اجرا نکنند
+const migrationLockKey int64 = 7_420_519_003
+
+// Migration - یک مایگریشن شماره‌دار
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus - وضعیت یک مایگریشن در دیتابیس
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt sql.NullTime
+}
+
+// LoadMigrations خواندن و مرتب‌سازی مایگریشن‌های embed شده
+func LoadMigrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("خطا در خواندن مایگریشن‌ها: %v", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		fileName := entry.Name()
+
+		var direction string
+		switch {
+		case strings.HasSuffix(fileName, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(fileName, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+
+		base := strings.TrimSuffix(fileName, "."+direction+".sql")
+		parts := strings.SplitN(base, "_", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("نام فایل مایگریشن نامعتبر است: %s", fileName)
+		}
+
+		version, err := strconv.Atoi(parts[0])
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("شماره مایگریشن نامعتبر است: %s", fileName)
+		}
+
+		content, err := migrationFiles.ReadFile(path.Join("migrations", fileName))
+		if err != nil {
+			return nil, fmt.Errorf("خطا در خواندن %s: %v", fileName, err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: parts[1]}
+			byVersion[version] = m
+		} else if m.Name != parts[1] {
+			return nil, fmt.Errorf("مایگریشن %d دو نام متفاوت دارد: %s و %s", version, m.Name, parts[1])
+		}
+
+		if direction == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("مایگریشن %04d_%s فایل up ندارد", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// MigrateUp اعمال همه مایگریشن‌های اعمال‌نشده به ترتیب
+func MigrateUp(db *sql.DB) ([]Migration, error) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	err = withMigrationLock(db, func(conn *sql.Conn) error {
+		done, err := appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range migrations {
+			if _, ok := done[m.Version]; ok {
+				continue
+			}
+
+			if err := runMigration(conn, m, "up"); err != nil {
+				return err
+			}
+			applied = append(applied, m)
+			log.Printf("⬆️ مایگریشن %04d_%s اعمال شد", m.Version, m.Name)
+		}
+		return nil
+	})
+
+	return applied, err
+}
+
+// MigrateDown بازگرداندن آخرین مایگریشن‌ها به تعداد steps
+func MigrateDown(db *sql.DB, steps int) ([]Migration, error) {
+	if steps <= 0 {
+		return nil, fmt.Errorf("تعداد مراحل باید بزرگتر از صفر باشد")
+	}
+
+	migrations, err := LoadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var reverted []Migration
+	err = withMigrationLock(db, func(conn *sql.Conn) error {
+		done, err := appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			m := migrations[i]
+			if _, ok := done[m.Version]; !ok {
+				continue
+			}
+
+			if m.Down == "" {
+				return fmt.Errorf("مایگریشن %04d_%s فایل down ندارد", m.Version, m.Name)
+			}
+
+			if err := runMigration(conn, m, "down"); err != nil {
+				return err
+			}
+			reverted = append(reverted, m)
+			log.Printf("⬇️ مایگریشن %04d_%s بازگردانده شد", m.Version, m.Name)
+		}
+		return nil
+	})
+
+	return reverted, err
+}
+
+// GetMigrationStatus وضعیت همه مایگریشن‌ها (اعمال‌شده یا در انتظار)
+func GetMigrationStatus(db *sql.DB) ([]MigrationStatus, error) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := ensureMigrationsTable(conn); err != nil {
+		return nil, err
+	}
+
+	done, err := appliedVersions(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		status := MigrationStatus{Version: m.Version, Name: m.Name}
+		if appliedAt, ok := done[m.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = sql.NullTime{Time: appliedAt, Valid: true}
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// withMigrationLock اجرای fn روی یک اتصال اختصاصی در حالی که قفل advisory گرفته شده است
+func withMigrationLock(db *sql.DB, fn func(conn *sql.Conn) error) error {
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("خطا در دریافت اتصال برای مایگریشن: %v", err)
+	}
+	defer conn.Close()
+
+	// قفل advisory به session وابسته است، پس باید روی همان اتصال گرفته و آزاد شود
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockKey); err != nil {
+		return fmt.Errorf("خطا در گرفتن قفل مایگریشن: %v", err)
+	}
+	defer func() {
+		if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, migrationLockKey); err != nil {
+			log.Printf("⚠️ خطا در آزادسازی قفل مایگریشن: %v", err)
+		}
+	}()
+
+	if err := ensureMigrationsTable(conn); err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+// ensureMigrationsTable ایجاد جدول schema_migrations در صورت نبود
+func ensureMigrationsTable(conn *sql.Conn) error {
+	_, err := conn.ExecContext(context.Background(), `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)
+	`)
+	if err != nil {
+		return fmt.Errorf("خطا در ایجاد جدول schema_migrations: %v", err)
+	}
+	return nil
+}
+
+// appliedVersions نسخه‌های اعمال‌شده به همراه زمان اعمال
+func appliedVersions(conn *sql.Conn) (map[int]time.Time, error) {
+	rows, err := conn.QueryContext(context.Background(), `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("خطا در خواندن schema_migrations: %v", err)
+	}
+	defer rows.Close()
+
+	done := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		done[version] = appliedAt
+	}
+
+	return done, rows.Err()
+}
+
+// runMigration اجرای یک مایگریشن و ثبت آن در یک تراکنش
+func runMigration(conn *sql.Conn, m Migration, direction string) error {
+	ctx := context.Background()
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	script := m.Up
+	if direction == "down" {
+		script = m.Down
+	}
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return fmt.Errorf("خطا در اجرای مایگریشن %04d_%s (%s): %v", m.Version, m.Name, direction, err)
+	}
+
+	if direction == "up" {
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, NOW())`,
+			m.Version, m.Name)
+	} else {
+		_, err = tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1`, m.Version)
+	}
+	if err != nil {
+		return fmt.Errorf("خطا در ثبت مایگریشن %04d_%s: %v", m.Version, m.Name, err)
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_prompts_is_favorite;
+UPDATE prompts SET title = '' WHERE title IS NULL;
+ALTER TABLE prompts ALTER COLUMN title SET NOT NULL;
+ALTER TABLE prompts ALTER COLUMN title DROP DEFAULT;
+ALTER TABLE prompts DROP COLUMN IF EXISTS is_favorite;
+ALTER TABLE prompts DROP COLUMN IF EXISTS response;
@@ -0,0 +1,7 @@
+-- models/prompt.go پاسخ و علاقه‌مندی را ذخیره می‌کند ولی جدول اولیه این ستون‌ها را نداشت.
+ALTER TABLE prompts ADD COLUMN IF NOT EXISTS response TEXT;
+ALTER TABLE prompts ADD COLUMN IF NOT EXISTS is_favorite BOOLEAN DEFAULT FALSE;
+ALTER TABLE prompts ALTER COLUMN title SET DEFAULT '';
+ALTER TABLE prompts ALTER COLUMN title DROP NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_prompts_is_favorite ON prompts(user_id, is_favorite);
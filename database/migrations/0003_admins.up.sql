@@ -0,0 +1,14 @@
+-- ادمین‌های ربات و نقش آن‌ها (owner, finance, support, moderator)
+CREATE TABLE IF NOT EXISTS admins (
+	id SERIAL PRIMARY KEY,
+	telegram_id BIGINT UNIQUE NOT NULL,
+	role VARCHAR(20) NOT NULL,
+	added_by BIGINT,
+	is_active BOOLEAN DEFAULT TRUE,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	CONSTRAINT check_admin_role CHECK (role IN ('owner', 'finance', 'support', 'moderator'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_admins_telegram_id ON admins(telegram_id);
+CREATE INDEX IF NOT EXISTS idx_admins_role ON admins(role);
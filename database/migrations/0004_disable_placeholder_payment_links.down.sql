@@ -0,0 +1,3 @@
+UPDATE payment_links
+SET is_active = TRUE
+WHERE link LIKE 'https://example.com/%';
@@ -0,0 +1,4 @@
+-- لینک‌های نمونه‌ی example.com قابل پرداخت نیستند؛ تا تنظیم لینک واقعی توسط ادمین غیرفعال می‌مانند
+UPDATE payment_links
+SET is_active = FALSE
+WHERE link LIKE 'https://example.com/%';
@@ -0,0 +1,4 @@
+ALTER TABLE api_keys DROP CONSTRAINT IF EXISTS check_api_key_provider;
+ALTER TABLE api_keys DROP COLUMN IF EXISTS model;
+ALTER TABLE api_keys DROP COLUMN IF EXISTS base_url;
+ALTER TABLE api_keys DROP COLUMN IF EXISTS provider;
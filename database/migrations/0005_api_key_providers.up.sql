@@ -0,0 +1,7 @@
+-- هر کلید API به یک Provider تعلق دارد (openai، anthropic یا local سازگار با OpenAI)
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS provider VARCHAR(20) NOT NULL DEFAULT 'openai';
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS base_url TEXT;
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS model VARCHAR(100);
+
+ALTER TABLE api_keys DROP CONSTRAINT IF EXISTS check_api_key_provider;
+ALTER TABLE api_keys ADD CONSTRAINT check_api_key_provider CHECK (provider IN ('openai', 'anthropic', 'local'));
@@ -0,0 +1,26 @@
+-- رشته‌های گفتگوی چت خصوصی (تاریخچه کامل؛ رشته فعال در Redis هم نگهداری می‌شود)
+CREATE TABLE IF NOT EXISTS conversations (
+	id SERIAL PRIMARY KEY,
+	user_id BIGINT NOT NULL,
+	title VARCHAR(255) NOT NULL DEFAULT '',
+	is_active BOOLEAN DEFAULT TRUE,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_conversations_user_id ON conversations(user_id, updated_at DESC);
+
+-- هر کاربر حداکثر یک رشته فعال دارد
+CREATE UNIQUE INDEX IF NOT EXISTS idx_conversations_user_active ON conversations(user_id) WHERE is_active;
+
+CREATE TABLE IF NOT EXISTS conversation_messages (
+	id SERIAL PRIMARY KEY,
+	conversation_id INTEGER NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+	role VARCHAR(20) NOT NULL,
+	content TEXT NOT NULL,
+	tokens INTEGER DEFAULT 0,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	CONSTRAINT check_conversation_role CHECK (role IN ('user', 'assistant'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_conversation_messages_conversation_id ON conversation_messages(conversation_id, id);
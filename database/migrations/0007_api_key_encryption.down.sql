@@ -0,0 +1,13 @@
+-- ردیف‌های رمز‌شده بدون کلید اصلی قابل بازگردانی نیستند؛ به جای حذف بی‌صدا، بازگردانی متوقف می‌شود.
+-- اگر از دست رفتن کلیدها پذیرفتنی است، ابتدا آن‌ها را دستی حذف کنید:
+--   DELETE FROM api_keys WHERE key_version <> 0;
+DO $$
+BEGIN
+	IF EXISTS (SELECT 1 FROM api_keys WHERE key_version <> 0) THEN
+		RAISE EXCEPTION 'api_keys شامل کلیدهای رمز‌شده است و بازگردانی 0007 آن‌ها را غیرقابل استفاده می‌کند؛ کلیدهای رمز‌شده را پیش از بازگردانی دستی حذف کنید';
+	END IF;
+END $$;
+
+DROP INDEX IF EXISTS idx_api_keys_key_version;
+ALTER TABLE api_keys DROP COLUMN IF EXISTS key_version;
+ALTER TABLE api_keys DROP COLUMN IF EXISTS encrypted_dek;
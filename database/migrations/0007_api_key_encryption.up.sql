@@ -0,0 +1,7 @@
+-- رمزنگاری envelope کلیدهای API:
+-- api_key متن رمز‌شده با کلید داده هر ردیف، encrypted_dek کلید داده رمز‌شده با کلید اصلی
+-- و key_version نسخه کلید اصلی است (۰ یعنی ردیف قدیمی رمز‌نشده که هنگام راه‌اندازی رمز می‌شود)
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS encrypted_dek TEXT;
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS key_version INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_key_version ON api_keys(key_version);
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_api_keys_last_checked_at;
+ALTER TABLE api_keys DROP CONSTRAINT IF EXISTS check_api_key_status;
+ALTER TABLE api_keys DROP COLUMN IF EXISTS last_error;
+ALTER TABLE api_keys DROP COLUMN IF EXISTS last_checked_at;
+ALTER TABLE api_keys DROP COLUMN IF EXISTS organization;
+ALTER TABLE api_keys DROP COLUMN IF EXISTS available_models;
+ALTER TABLE api_keys DROP COLUMN IF EXISTS status;
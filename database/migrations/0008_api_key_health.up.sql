@@ -0,0 +1,12 @@
+-- نتیجه اعتبارسنجی کلید API نزد Provider
+-- status: valid، invalid (کلید نامعتبر)، quota_exceeded (اعتبار تمام شده) یا unchecked
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'unchecked';
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS available_models TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS organization VARCHAR(255);
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS last_checked_at TIMESTAMP;
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS last_error TEXT;
+
+ALTER TABLE api_keys DROP CONSTRAINT IF EXISTS check_api_key_status;
+ALTER TABLE api_keys ADD CONSTRAINT check_api_key_status CHECK (status IN ('valid', 'invalid', 'quota_exceeded', 'unchecked'));
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_last_checked_at ON api_keys(last_checked_at);
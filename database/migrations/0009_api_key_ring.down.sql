@@ -0,0 +1,9 @@
+ALTER TABLE users DROP CONSTRAINT IF EXISTS check_key_strategy;
+ALTER TABLE users DROP COLUMN IF EXISTS key_strategy;
+
+DROP TABLE IF EXISTS api_key_usage;
+
+DROP INDEX IF EXISTS idx_api_keys_user_priority;
+ALTER TABLE api_keys DROP COLUMN IF EXISTS monthly_budget;
+ALTER TABLE api_keys DROP COLUMN IF EXISTS priority;
+ALTER TABLE api_keys DROP COLUMN IF EXISTS label;
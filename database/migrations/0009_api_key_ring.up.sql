@@ -0,0 +1,22 @@
+-- هر کاربر می‌تواند چند کلید داشته باشد (حلقه کلید)
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS label VARCHAR(50) NOT NULL DEFAULT '';
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS priority INTEGER NOT NULL DEFAULT 1;
+-- سقف هزینه ماهانه کلید به دلار (NULL یعنی بدون سقف)
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS monthly_budget NUMERIC(10, 2);
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_user_priority ON api_keys(user_id, priority, id);
+
+-- مصرف ماهانه هر کلید برای کنترل بودجه
+CREATE TABLE IF NOT EXISTS api_key_usage (
+	api_key_id INTEGER NOT NULL REFERENCES api_keys(id) ON DELETE CASCADE,
+	month DATE NOT NULL,
+	tokens_used BIGINT NOT NULL DEFAULT 0,
+	cost DECIMAL(10, 6) NOT NULL DEFAULT 0,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (api_key_id, month)
+);
+
+-- روش انتخاب کلید: priority (به ترتیب اولویت) یا round_robin (چرخشی)
+ALTER TABLE users ADD COLUMN IF NOT EXISTS key_strategy VARCHAR(20) NOT NULL DEFAULT 'priority';
+ALTER TABLE users DROP CONSTRAINT IF EXISTS check_key_strategy;
+ALTER TABLE users ADD CONSTRAINT check_key_strategy CHECK (key_strategy IN ('priority', 'round_robin'));
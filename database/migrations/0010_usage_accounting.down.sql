@@ -0,0 +1,8 @@
+ALTER TABLE token_usage ALTER COLUMN cost TYPE DECIMAL(10, 4);
+ALTER TABLE token_usage DROP COLUMN IF EXISTS request_count;
+ALTER TABLE token_usage DROP COLUMN IF EXISTS completion_tokens;
+ALTER TABLE token_usage DROP COLUMN IF EXISTS prompt_tokens;
+
+DROP TABLE IF EXISTS usage_events;
+DROP TABLE IF EXISTS app_settings;
+DROP TABLE IF EXISTS model_prices;
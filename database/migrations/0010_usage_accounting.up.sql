@@ -0,0 +1,58 @@
+-- قیمت مدل‌ها به دلار برای هر یک میلیون توکن (قابل ویرایش توسط ادمین)
+-- مدل درخواست با طولانی‌ترین پیشوند منطبق قیمت‌گذاری می‌شود و در نبود آن ردیف default استفاده می‌شود
+CREATE TABLE IF NOT EXISTS model_prices (
+	model VARCHAR(100) PRIMARY KEY,
+	input_price DECIMAL(10, 4) NOT NULL DEFAULT 0,
+	output_price DECIMAL(10, 4) NOT NULL DEFAULT 0,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO model_prices (model, input_price, output_price) VALUES
+	('default', 2.00, 2.00),
+	('gpt-3.5-turbo', 0.50, 1.50),
+	('gpt-4', 30.00, 60.00),
+	('gpt-4-turbo', 10.00, 30.00),
+	('gpt-4o', 2.50, 10.00),
+	('gpt-4o-mini', 0.15, 0.60),
+	('gpt-4.1', 2.00, 8.00),
+	('gpt-4.1-mini', 0.40, 1.60),
+	('claude-3-5-haiku', 0.80, 4.00),
+	('claude-3-5-sonnet', 3.00, 15.00),
+	('claude-3-7-sonnet', 3.00, 15.00),
+	('claude-sonnet-4', 3.00, 15.00),
+	('claude-3-opus', 15.00, 75.00),
+	('claude-opus-4', 15.00, 75.00)
+ON CONFLICT (model) DO NOTHING;
+
+-- تنظیمات عمومی قابل ویرایش از پنل مدیریت
+CREATE TABLE IF NOT EXISTS app_settings (
+	key VARCHAR(100) PRIMARY KEY,
+	value TEXT NOT NULL,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- نرخ تبدیل دلار به تومان برای نمایش هزینه‌ها
+INSERT INTO app_settings (key, value) VALUES ('usd_to_toman', '30000')
+ON CONFLICT (key) DO NOTHING;
+
+-- ثبت هر درخواست با مصرف واقعی گزارش‌شده توسط Provider
+CREATE TABLE IF NOT EXISTS usage_events (
+	id BIGSERIAL PRIMARY KEY,
+	user_id BIGINT NOT NULL REFERENCES users(telegram_id) ON DELETE CASCADE,
+	api_key_id INTEGER REFERENCES api_keys(id) ON DELETE SET NULL,
+	provider VARCHAR(20) NOT NULL DEFAULT '',
+	model VARCHAR(100) NOT NULL DEFAULT '',
+	prompt_tokens INTEGER NOT NULL DEFAULT 0,
+	completion_tokens INTEGER NOT NULL DEFAULT 0,
+	cost DECIMAL(12, 6) NOT NULL DEFAULT 0,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_usage_events_user_created ON usage_events(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_usage_events_created ON usage_events(created_at);
+
+-- تفکیک توکن‌های ورودی و خروجی در جمع روزانه و دقت بیشتر برای هزینه
+ALTER TABLE token_usage ADD COLUMN IF NOT EXISTS prompt_tokens INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE token_usage ADD COLUMN IF NOT EXISTS completion_tokens INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE token_usage ADD COLUMN IF NOT EXISTS request_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE token_usage ALTER COLUMN cost TYPE DECIMAL(12, 6);
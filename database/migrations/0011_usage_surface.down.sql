@@ -0,0 +1 @@
+ALTER TABLE usage_events DROP COLUMN IF EXISTS surface;
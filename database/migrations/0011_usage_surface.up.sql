@@ -0,0 +1,2 @@
+-- محل مصرف هر درخواست: private، group یا channel
+ALTER TABLE usage_events ADD COLUMN IF NOT EXISTS surface VARCHAR(20) NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+-- پلن خریداری‌شده کاربر VIP برای تعیین سهمیه روزانه (NULL یعنی VIP بدون پلن، مثلاً افزوده‌شده توسط ادمین)
+ALTER TABLE users ADD COLUMN IF NOT EXISTS vip_plan VARCHAR(20);
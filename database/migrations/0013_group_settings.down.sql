@@ -0,0 +1,3 @@
+ALTER TABLE groups DROP COLUMN IF EXISTS system_prompt;
+ALTER TABLE groups DROP COLUMN IF EXISTS allowed_members;
+ALTER TABLE groups DROP COLUMN IF EXISTS trigger_prefix;
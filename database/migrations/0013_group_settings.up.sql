@@ -0,0 +1,7 @@
+-- تنظیمات هر گروه که از چت خصوصی توسط مالک گروه مدیریت می‌شود
+-- پیشوند فعال‌سازی پاسخ (مثلاً * یا ؟)
+ALTER TABLE groups ADD COLUMN IF NOT EXISTS trigger_prefix VARCHAR(10) NOT NULL DEFAULT '*';
+-- اعضای مجاز به پرسش؛ آرایه خالی یعنی همه اعضا
+ALTER TABLE groups ADD COLUMN IF NOT EXISTS allowed_members BIGINT[] NOT NULL DEFAULT '{}';
+-- پرامپت سیستمی پیش‌فرض گروه برای اعضایی که پرامپت فعال ندارند
+ALTER TABLE groups ADD COLUMN IF NOT EXISTS system_prompt TEXT;
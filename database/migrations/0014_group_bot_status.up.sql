@@ -0,0 +1,3 @@
+-- وضعیت ربات در گروه بر اساس رویدادهای my_chat_member:
+-- member، administrator، restricted، left یا kicked
+ALTER TABLE groups ADD COLUMN IF NOT EXISTS bot_status VARCHAR(20) NOT NULL DEFAULT 'member';
@@ -0,0 +1,3 @@
+ALTER TABLE groups DROP COLUMN IF EXISTS admins_only;
+ALTER TABLE groups DROP COLUMN IF EXISTS trigger_keywords;
+ALTER TABLE groups DROP COLUMN IF EXISTS trigger_modes;
@@ -0,0 +1,6 @@
+-- روش‌های فعال‌سازی پاسخ در گروه: prefix، reply، mention، command و keyword
+ALTER TABLE groups ADD COLUMN IF NOT EXISTS trigger_modes TEXT[] NOT NULL DEFAULT '{prefix}';
+-- کلمات کلیدی حالت keyword
+ALTER TABLE groups ADD COLUMN IF NOT EXISTS trigger_keywords TEXT[] NOT NULL DEFAULT '{}';
+-- پاسخ فقط به ادمین‌های گروه
+ALTER TABLE groups ADD COLUMN IF NOT EXISTS admins_only BOOLEAN NOT NULL DEFAULT FALSE;
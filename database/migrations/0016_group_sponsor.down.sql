@@ -0,0 +1,12 @@
+ALTER TABLE token_usage DROP COLUMN IF EXISTS sponsored_cost;
+ALTER TABLE token_usage DROP COLUMN IF EXISTS sponsored_tokens;
+
+DROP INDEX IF EXISTS idx_usage_events_group_created;
+ALTER TABLE usage_events DROP COLUMN IF EXISTS sponsor_id;
+ALTER TABLE usage_events DROP COLUMN IF EXISTS group_id;
+
+ALTER TABLE groups DROP CONSTRAINT IF EXISTS check_billing_mode;
+ALTER TABLE groups DROP COLUMN IF EXISTS monthly_budget;
+ALTER TABLE groups DROP COLUMN IF EXISTS sponsor_daily_limit;
+ALTER TABLE groups DROP COLUMN IF EXISTS sponsor_key_id;
+ALTER TABLE groups DROP COLUMN IF EXISTS billing_mode;
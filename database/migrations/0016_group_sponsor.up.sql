@@ -0,0 +1,19 @@
+-- پرداخت هزینه پرسش‌های گروه با کلید مالک گروه (کلید اسپانسر)
+-- billing_mode: member (هر عضو با کلید خودش)، fallback (کلید اسپانسر برای اعضای بدون کلید)، sponsor (همه با کلید اسپانسر)
+ALTER TABLE groups ADD COLUMN IF NOT EXISTS billing_mode VARCHAR(20) NOT NULL DEFAULT 'member';
+ALTER TABLE groups ADD COLUMN IF NOT EXISTS sponsor_key_id INTEGER REFERENCES api_keys(id) ON DELETE SET NULL;
+-- سقف پرسش روزانه هر عضو با کلید اسپانسر (صفر یعنی نامحدود)
+ALTER TABLE groups ADD COLUMN IF NOT EXISTS sponsor_daily_limit INTEGER NOT NULL DEFAULT 0;
+-- سقف هزینه ماهانه گروه به دلار (NULL یعنی بدون سقف)
+ALTER TABLE groups ADD COLUMN IF NOT EXISTS monthly_budget NUMERIC(10, 2);
+ALTER TABLE groups DROP CONSTRAINT IF EXISTS check_billing_mode;
+ALTER TABLE groups ADD CONSTRAINT check_billing_mode CHECK (billing_mode IN ('member', 'fallback', 'sponsor'));
+
+-- گروه محل پرسش و کاربری که هزینه را پرداخته (در صورت استفاده از کلید اسپانسر)
+ALTER TABLE usage_events ADD COLUMN IF NOT EXISTS group_id BIGINT;
+ALTER TABLE usage_events ADD COLUMN IF NOT EXISTS sponsor_id BIGINT;
+CREATE INDEX IF NOT EXISTS idx_usage_events_group_created ON usage_events(group_id, created_at) WHERE group_id IS NOT NULL;
+
+-- هزینه‌ای که کاربر با کلید خود برای اعضای گروه‌هایش پرداخته است
+ALTER TABLE token_usage ADD COLUMN IF NOT EXISTS sponsored_tokens INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE token_usage ADD COLUMN IF NOT EXISTS sponsored_cost DECIMAL(12, 6) NOT NULL DEFAULT 0;
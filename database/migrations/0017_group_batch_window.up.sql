@@ -0,0 +1,3 @@
+-- پنجره تجمیع پرسش‌های گروه به ثانیه؛ صفر یعنی پاسخ فوری به هر پرسش
+ALTER TABLE groups ADD COLUMN IF NOT EXISTS batch_window INT NOT NULL DEFAULT 0
+    CHECK (batch_window >= 0 AND batch_window <= 30);
@@ -0,0 +1,18 @@
+ALTER TABLE channels ADD COLUMN IF NOT EXISTS schedule_time VARCHAR(5)
+    CONSTRAINT check_schedule_time CHECK (schedule_time ~ '^([0-1][0-9]|2[0-3]):[0-5][0-9]$');
+
+UPDATE channels SET schedule_time = schedule_slots[1]
+WHERE schedule_kind = 'daily' AND cardinality(schedule_slots) > 0;
+
+DROP INDEX IF EXISTS idx_channels_next_run_at;
+
+ALTER TABLE channels
+    DROP COLUMN IF EXISTS schedule_kind,
+    DROP COLUMN IF EXISTS schedule_slots,
+    DROP COLUMN IF EXISTS schedule_weekdays,
+    DROP COLUMN IF EXISTS schedule_interval,
+    DROP COLUMN IF EXISTS schedule_cron,
+    DROP COLUMN IF EXISTS timezone,
+    DROP COLUMN IF EXISTS next_run_at;
+
+CREATE INDEX IF NOT EXISTS idx_channels_schedule_time ON channels(schedule_time);
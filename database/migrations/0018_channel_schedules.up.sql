@@ -0,0 +1,19 @@
+-- زمان‌بندی چندحالته کانال: چند نوبت روزانه (با روزهای هفته)، فاصله ثابت یا عبارت cron
+ALTER TABLE channels
+    ADD COLUMN IF NOT EXISTS schedule_kind VARCHAR(10) NOT NULL DEFAULT 'daily'
+        CHECK (schedule_kind IN ('daily', 'interval', 'cron')),
+    ADD COLUMN IF NOT EXISTS schedule_slots TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN IF NOT EXISTS schedule_weekdays SMALLINT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN IF NOT EXISTS schedule_interval INT NOT NULL DEFAULT 0
+        CHECK (schedule_interval >= 0),
+    ADD COLUMN IF NOT EXISTS schedule_cron TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS timezone VARCHAR(64) NOT NULL DEFAULT 'Asia/Tehran',
+    -- نوبت بعدی انتشار؛ NULL یعنی زمان‌بند باید آن را محاسبه کند
+    ADD COLUMN IF NOT EXISTS next_run_at TIMESTAMPTZ;
+
+UPDATE channels SET schedule_slots = ARRAY[schedule_time]
+WHERE schedule_time IS NOT NULL;
+
+ALTER TABLE channels DROP COLUMN IF EXISTS schedule_time;
+
+CREATE INDEX IF NOT EXISTS idx_channels_next_run_at ON channels(next_run_at) WHERE is_active;
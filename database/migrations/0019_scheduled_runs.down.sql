@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS scheduled_runs;
+ALTER TABLE channels DROP COLUMN IF EXISTS fencing_token;
@@ -0,0 +1,20 @@
+-- آخرین توکن حصار (fencing token) نمونه‌ای که انتشار کانال را در دست گرفته است
+ALTER TABLE channels ADD COLUMN IF NOT EXISTS fencing_token BIGINT NOT NULL DEFAULT 0;
+
+-- هر اجرای نوبت انتشار کانال؛ هر نوبت حداکثر یک بار اجرا می‌شود
+CREATE TABLE IF NOT EXISTS scheduled_runs (
+    id BIGSERIAL PRIMARY KEY,
+    channel_id INTEGER NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+    slot_at TIMESTAMPTZ NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'running'
+        CHECK (status IN ('running', 'succeeded', 'partial', 'failed', 'fenced')),
+    fencing_token BIGINT NOT NULL,
+    instance VARCHAR(100) NOT NULL,
+    posts INTEGER NOT NULL DEFAULT 0,
+    error TEXT,
+    started_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    finished_at TIMESTAMPTZ,
+    UNIQUE (channel_id, slot_at)
+);
+
+CREATE INDEX IF NOT EXISTS idx_scheduled_runs_started_at ON scheduled_runs(started_at);
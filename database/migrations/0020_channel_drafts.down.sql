@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS channel_drafts;
+ALTER TABLE channels DROP COLUMN IF EXISTS auto_publish;
@@ -0,0 +1,21 @@
+-- انتشار مستقیم محتوای تولیدشده؛ در حالت خاموش پست‌ها پیش از انتشار به تأیید مالک می‌رسند
+ALTER TABLE channels ADD COLUMN IF NOT EXISTS auto_publish BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- کانال‌هایی که پیش از این نسخه فعال بوده‌اند مثل قبل مستقیم منتشر می‌کنند
+UPDATE channels SET auto_publish = TRUE WHERE is_active;
+
+-- صف پیش‌نویس پست‌های کانال
+CREATE TABLE IF NOT EXISTS channel_drafts (
+    id BIGSERIAL PRIMARY KEY,
+    channel_id INTEGER NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+    content TEXT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'approved', 'published', 'discarded')),
+    run_id BIGINT REFERENCES scheduled_runs(id) ON DELETE SET NULL,
+    published_run_id BIGINT REFERENCES scheduled_runs(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    published_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_channel_drafts_queue ON channel_drafts(channel_id, status, id);
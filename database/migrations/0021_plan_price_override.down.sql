@@ -0,0 +1 @@
+ALTER TABLE payment_links DROP COLUMN IF EXISTS price_overridden;
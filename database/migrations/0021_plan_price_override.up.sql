@@ -0,0 +1,5 @@
+-- نشانه صریح ویرایش قیمت از پنل ادمین (به جای مقایسه updated_at و created_at)
+ALTER TABLE payment_links ADD COLUMN IF NOT EXISTS price_overridden BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- پلن‌هایی که تا کنون از پنل ویرایش شده‌اند قیمت دستی خود را حفظ می‌کنند
+UPDATE payment_links SET price_overridden = TRUE WHERE updated_at <> created_at;
@@ -0,0 +1,2 @@
+ALTER TABLE usage_events ALTER COLUMN created_at TYPE TIMESTAMP
+	USING created_at AT TIME ZONE current_setting('TimeZone');
@@ -0,0 +1,4 @@
+-- زمان رویدادهای مصرف با منطقه زمانی ذخیره می‌شود تا مقایسه با شروع روز و ماه سهمیه
+-- (مثلاً نیمه‌شب Asia/Tehran) درست انجام شود؛ مقادیر فعلی با منطقه زمانی سرور دیتابیس تفسیر می‌شوند
+ALTER TABLE usage_events ALTER COLUMN created_at TYPE TIMESTAMPTZ
+	USING created_at AT TIME ZONE current_setting('TimeZone');
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"math/rand"
+	"strconv"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -12,11 +14,11 @@ import (
 var RDB *redis.Client
 var ctx = context.Background()
 
-func InitRedis(redisURL, password string) error {
+func InitRedis(redisURL, password string, db int) error {
 	RDB = redis.NewClient(&redis.Options{
 		Addr:     redisURL,
 		Password: password,
-		DB:       0, // use default DB
+		DB:       db,
 	})
 
 	// تست اتصال
@@ -31,36 +33,121 @@ func InitRedis(redisURL, password string) error {
 
 // توابع کمکی برای مدیریت داده‌های موقت
 
-// ذخیره rate limit برای گروه
-func SetGroupRateLimit(groupID string, count int, expiration time.Duration) error {
-	key := fmt.Sprintf("rate_limit:%s", groupID)
-	return RDB.Set(ctx, key, count, expiration).Err()
+// دامنه محدودیت‌های نرخ درخواست
+const (
+	RateScopeGroup  = "group"  // همه پرسش‌های یک گروه
+	RateScopeMember = "member" // پرسش‌های یک عضو در یک گروه
+	RateScopeUser   = "user"   // همه درخواست‌های یک کاربر (چت خصوصی و همه گروه‌ها)
+)
+
+// RateLimit - یک محدودیت نرخ با پنجره لغزان
+type RateLimit struct {
+	Scope  string
+	Key    string
+	Limit  int // حداکثر درخواست در پنجره؛ صفر یعنی بدون محدودیت
+	Window time.Duration
 }
 
-// دریافت rate limit برای گروه
-func GetGroupRateLimit(groupID string) (int, error) {
-	key := fmt.Sprintf("rate_limit:%s", groupID)
-	val, err := RDB.Get(ctx, key).Int()
-	if err == redis.Nil {
-		return 0, nil // اگر وجود نداشته باشد
-	}
-	return val, err
+// RateLimitResult - نتیجه بررسی هم‌زمان چند محدودیت
+type RateLimitResult struct {
+	Allowed    bool
+	Remaining  int           // کمترین ظرفیت باقیمانده میان محدودیت‌ها پس از این درخواست
+	RetryAfter time.Duration // زمان تا آزاد شدن ظرفیت (فقط وقتی Allowed=false)
+	Exceeded   *RateLimit    // محدودیتی که بیشترین زمان انتظار را دارد (فقط وقتی Allowed=false)
 }
 
-// افزایش rate limit برای گروه
-func IncrementGroupRateLimit(groupID string, expiration time.Duration) (int, error) {
-	key := fmt.Sprintf("rate_limit:%s", groupID)
-	val, err := RDB.Incr(ctx, key).Result()
+// محدودیت سوال کل گروه
+func GroupRate(groupID int64, limit int, window time.Duration) RateLimit {
+	return RateLimit{Scope: RateScopeGroup, Key: fmt.Sprintf("rate:group:%d", groupID), Limit: limit, Window: window}
+}
+
+// محدودیت سوال هر عضو در یک گروه
+func MemberRate(groupID, userID int64, limit int, window time.Duration) RateLimit {
+	return RateLimit{Scope: RateScopeMember, Key: fmt.Sprintf("rate:member:%d:%d", groupID, userID), Limit: limit, Window: window}
+}
+
+// محدودیت سراسری درخواست‌های کاربر
+func UserRate(userID int64, limit int, window time.Duration) RateLimit {
+	return RateLimit{Scope: RateScopeUser, Key: fmt.Sprintf("rate:user:%d", userID), Limit: limit, Window: window}
+}
+
+// اسکریپت پنجره لغزان: هر درخواست یک عضو sorted set با امتیاز زمان (میلی‌ثانیه) است
+//
+// KEYS: کلیدهای محدودیت؛ ARGV[1]: زمان فعلی؛ ARGV[2]: شناسه یکتای درخواست؛
+// سپس برای هر کلید به ترتیب سقف و طول پنجره (میلی‌ثانیه).
+// درخواست فقط وقتی ثبت می‌شود که هیچ محدودیتی پر نباشد؛ خروجی: {مجاز، باقیمانده، انتظار، شماره محدودیت پر}
+var slidingWindowScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local remaining = -1
+local retry, exceeded = 0, 0
+for i, key in ipairs(KEYS) do
+	local limit = tonumber(ARGV[2 * i + 1])
+	local window = tonumber(ARGV[2 * i + 2])
+	redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window)
+	local count = redis.call('ZCARD', key)
+	if count >= limit then
+		-- ظرفیت با خروج درخواست شماره count-limit (از قدیمی‌ترین) آزاد می‌شود
+		local entry = redis.call('ZRANGE', key, count - limit, count - limit, 'WITHSCORES')
+		local wait = window
+		if entry[2] then
+			wait = tonumber(entry[2]) + window - now
+		end
+		if wait > retry or exceeded == 0 then
+			retry, exceeded = wait, i
+		end
+	end
+	local left = limit - count - 1
+	if remaining < 0 or left < remaining then
+		remaining = left
+	end
+end
+if exceeded > 0 then
+	return {0, 0, retry, exceeded}
+end
+for i, key in ipairs(KEYS) do
+	redis.call('ZADD', key, now, ARGV[2])
+	redis.call('PEXPIRE', key, tonumber(ARGV[2 * i + 2]))
+end
+return {1, remaining, 0, 0}
+`)
+
+// AllowRate بررسی و ثبت اتمی یک درخواست در همه محدودیت‌ها
+//
+// اگر هر یک از محدودیت‌ها پر باشد درخواست در هیچ‌کدام ثبت نمی‌شود.
+// محدودیت‌های با سقف صفر یا منفی نادیده گرفته می‌شوند.
+func AllowRate(limits ...RateLimit) (RateLimitResult, error) {
+	var active []RateLimit
+	for _, l := range limits {
+		if l.Limit > 0 {
+			active = append(active, l)
+		}
+	}
+	if len(active) == 0 {
+		return RateLimitResult{Allowed: true, Remaining: -1}, nil
+	}
+
+	now := time.Now()
+	keys := make([]string, len(active))
+	args := []interface{}{now.UnixMilli(), fmt.Sprintf("%d-%d", now.UnixNano(), rand.Int63())}
+	for i, l := range active {
+		keys[i] = l.Key
+		args = append(args, l.Limit, l.Window.Milliseconds())
+	}
+
+	values, err := slidingWindowScript.Run(ctx, RDB, keys, args...).Int64Slice()
 	if err != nil {
-		return 0, err
+		return RateLimitResult{}, err
 	}
-	
-	// تنظیم expiration اگر اولین بار است
-	if val == 1 {
-		RDB.Expire(ctx, key, expiration)
+
+	result := RateLimitResult{
+		Allowed:    values[0] == 1,
+		Remaining:  int(values[1]),
+		RetryAfter: time.Duration(values[2]) * time.Millisecond,
 	}
-	
-	return int(val), nil
+	if i := values[3]; i > 0 {
+		result.Exceeded = &active[i-1]
+	}
+	return result, nil
 }
 
 // ذخیره پرامپت فعال کاربر
@@ -79,16 +166,14 @@ func GetUserActivePrompt(userID int64) (int, error) {
 	return val, err
 }
 
-// مدیریت هشدارهای ارسال شده
-func SetWarningSent(groupID string) error {
-	key := fmt.Sprintf("warning_sent:%s", groupID)
-	return RDB.Set(ctx, key, true, time.Minute).Err()
+// مدیریت هشدارهای ارسال شده (key معمولاً کلید محدودیتی است که پر شده)
+func SetWarningSent(key string, ttl time.Duration) error {
+	return RDB.Set(ctx, "warning_sent:"+key, true, ttl).Err()
 }
 
 // بررسی اینکه آیا هشدار ارسال شده
-func IsWarningSent(groupID string) (bool, error) {
-	key := fmt.Sprintf("warning_sent:%s", groupID)
-	val, err := RDB.Exists(ctx, key).Result()
+func IsWarningSent(key string) (bool, error) {
+	val, err := RDB.Exists(ctx, "warning_sent:"+key).Result()
 	if err != nil {
 		return false, err
 	}
@@ -139,3 +224,205 @@ func IncrementUserInvitationCount(userID int64) (int, error) {
 	
 	return int(val), nil
 }
+
+// مدیریت رشته فعال گفتگو (هر پیام به صورت JSON در یک لیست)
+const conversationTTL = 24 * time.Hour
+
+// دریافت پیام‌های کش‌شده رشته؛ found=false یعنی کش وجود ندارد و باید از دیتابیس خوانده شود
+func GetConversationCache(conversationID int) ([]string, bool, error) {
+	key := fmt.Sprintf("conversation:%d", conversationID)
+	exists, err := RDB.Exists(ctx, key).Result()
+	if err != nil || exists == 0 {
+		return nil, false, err
+	}
+	messages, err := RDB.LRange(ctx, key, 0, -1).Result()
+	if err != nil {
+		return nil, false, err
+	}
+	return messages, true, nil
+}
+
+// جایگزینی کامل کش رشته (حداکثر maxLen پیام آخر نگه داشته می‌شود)
+func SetConversationCache(conversationID int, messages []string, maxLen int) error {
+	key := fmt.Sprintf("conversation:%d", conversationID)
+	_, err := RDB.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, key)
+		if len(messages) == 0 {
+			return nil
+		}
+		values := make([]interface{}, len(messages))
+		for i, m := range messages {
+			values[i] = m
+		}
+		pipe.RPush(ctx, key, values...)
+		pipe.LTrim(ctx, key, int64(-maxLen), -1)
+		pipe.Expire(ctx, key, conversationTTL)
+		return nil
+	})
+	return err
+}
+
+// افزودن پیام به کش رشته؛ اگر کش وجود نداشته باشد کاری انجام نمی‌شود تا بار بعد از دیتابیس ساخته شود
+func AppendConversationCache(conversationID int, maxLen int, messages ...string) error {
+	key := fmt.Sprintf("conversation:%d", conversationID)
+	exists, err := RDB.Exists(ctx, key).Result()
+	if err != nil || exists == 0 {
+		return err
+	}
+
+	values := make([]interface{}, len(messages))
+	for i, m := range messages {
+		values[i] = m
+	}
+	_, err = RDB.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.RPush(ctx, key, values...)
+		pipe.LTrim(ctx, key, int64(-maxLen), -1)
+		pipe.Expire(ctx, key, conversationTTL)
+		return nil
+	})
+	return err
+}
+
+// حذف کش رشته
+func DeleteConversationCache(conversationID int) error {
+	key := fmt.Sprintf("conversation:%d", conversationID)
+	return RDB.Del(ctx, key).Err()
+}
+
+// شمارنده نوبت برای انتخاب چرخشی کلیدهای API کاربر
+func NextKeyTurn(userID int64) (int64, error) {
+	key := fmt.Sprintf("key_turn:%d", userID)
+	val, err := RDB.Incr(ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+	RDB.Expire(ctx, key, 30*24*time.Hour)
+	return val, nil
+}
+
+// شمارنده مصرف روزانه کاربر برای بررسی سریع سهمیه (day به صورت 2006-01-02 در منطقه زمانی سهمیه)
+func quotaUsageKey(userID int64, day string) string {
+	return fmt.Sprintf("quota:%d:%s", userID, day)
+}
+
+// دریافت شمارنده مصرف روز؛ found=false یعنی شمارنده وجود ندارد و باید از دیتابیس ساخته شود
+func GetQuotaUsage(userID int64, day string) (messages, tokens int, found bool, err error) {
+	values, err := RDB.HMGet(ctx, quotaUsageKey(userID, day), "messages", "tokens").Result()
+	if err != nil || values[0] == nil || values[1] == nil {
+		return 0, 0, false, err
+	}
+	messages, _ = strconv.Atoi(fmt.Sprint(values[0]))
+	tokens, _ = strconv.Atoi(fmt.Sprint(values[1]))
+	return messages, tokens, true, nil
+}
+
+// ساخت شمارنده روز از مقادیر دیتابیس (اگر در این فاصله ساخته شده باشد تغییری نمی‌کند)
+func InitQuotaUsage(userID int64, day string, messages, tokens int, ttl time.Duration) error {
+	key := quotaUsageKey(userID, day)
+	_, err := RDB.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSetNX(ctx, key, "messages", messages)
+		pipe.HSetNX(ctx, key, "tokens", tokens)
+		pipe.Expire(ctx, key, ttl)
+		return nil
+	})
+	return err
+}
+
+// افزایش شمارنده مصرف فقط در صورت وجود آن؛ بررسی و افزایش باید اتمی باشد تا شمارنده‌ای که
+// بین این دو منقضی شده به صورت ناقص و بدون TTL دوباره ساخته نشود
+var incrementQuotaScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return 0
+end
+redis.call("HINCRBY", KEYS[1], "messages", ARGV[1])
+redis.call("HINCRBY", KEYS[1], "tokens", ARGV[2])
+return 1
+`)
+
+// افزودن مصرف یک درخواست به شمارنده روز؛ اگر شمارنده وجود نداشته باشد در بررسی بعدی از دیتابیس ساخته می‌شود
+func IncrementQuotaUsage(userID int64, day string, messages, tokens int) error {
+	return incrementQuotaScript.Run(ctx, RDB, []string{quotaUsageKey(userID, day)}, messages, tokens).Err()
+}
+
+// صف پرسش‌های در انتظار پنجره تجمیع گروه (هر پرسش به صورت JSON در یک لیست)
+func groupBatchKey(groupID int64) string {
+	return fmt.Sprintf("group_batch:%d", groupID)
+}
+
+// مجموعه مرتب گروه‌هایی که پنجره تجمیع باز دارند؛ امتیاز هر گروه زمان پایان پنجره (میلی‌ثانیه) است
+// تا پس از راه‌اندازی دوباره ربات، صف‌های مانده هم پاسخ داده شوند
+const groupBatchDueKey = "group_batch:due"
+
+// افزودن پرسش و باز کردن پنجره در صورت نبودن پنجره باز؛ TTL صف فقط هنگام باز شدن پنجره تنظیم می‌شود
+var pushGroupBatchScript = redis.NewScript(`
+redis.call("RPUSH", KEYS[1], ARGV[1])
+if redis.call("ZADD", KEYS[2], "NX", ARGV[2], ARGV[3]) == 0 then
+	return 0
+end
+redis.call("PEXPIRE", KEYS[1], ARGV[4])
+return 1
+`)
+
+// افزودن پرسش به صف تجمیع گروه؛ opened یعنی این پرسش پنجره جدیدی با پایان deadline باز کرده است
+func PushGroupBatch(groupID int64, item string, deadline time.Time, ttl time.Duration) (bool, error) {
+	keys := []string{groupBatchKey(groupID), groupBatchDueKey}
+	opened, err := pushGroupBatchScript.Run(ctx, RDB, keys, item, deadline.UnixMilli(), groupID, ttl.Milliseconds()).Int()
+	return opened == 1, err
+}
+
+// گروه‌هایی که پنجره تجمیع آن‌ها تا now به پایان رسیده است
+func DueGroupBatches(now time.Time) ([]int64, error) {
+	members, err := RDB.ZRangeByScore(ctx, groupBatchDueKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(now.UnixMilli(), 10),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int64, 0, len(members))
+	for _, m := range members {
+		if id, err := strconv.ParseInt(m, 10, 64); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// برداشتن همه پرسش‌های صف تجمیع گروه به ترتیب ورود، خالی کردن صف و بستن پنجره
+func TakeGroupBatch(groupID int64) ([]string, error) {
+	key := groupBatchKey(groupID)
+	var items *redis.StringSliceCmd
+	_, err := RDB.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		items = pipe.LRange(ctx, key, 0, -1)
+		pipe.Del(ctx, key)
+		pipe.ZRem(ctx, groupBatchDueKey, groupID)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return items.Val(), nil
+}
+
+// قفل توزیع‌شده؛ مقدار قفل شناسه یکتای نگه‌دارنده است تا فقط خود او بتواند آن را آزاد کند
+//
+// قفل به تنهایی نگه‌دارنده‌ای را که قفلش منقضی شده از نوشتن باز نمی‌دارد؛ توکن حصار
+// برای این کار در دیتابیس صادر می‌شود تا با پاک شدن Redis هم از بین نرود.
+func AcquireLock(name string, ttl time.Duration) (owner string, ok bool, err error) {
+	owner = fmt.Sprintf("%d-%d", time.Now().UnixNano(), rand.Int63())
+	ok, err = RDB.SetNX(ctx, "lock:"+name, owner, ttl).Result()
+	return owner, ok, err
+}
+
+// حذف قفل فقط در صورت برابری مقدار آن با شناسه نگه‌دارنده
+var releaseLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// آزاد کردن قفل فقط اگر هنوز در دست همین نگه‌دارنده باشد
+func ReleaseLock(name, owner string) error {
+	return releaseLockScript.Run(ctx, RDB, []string{"lock:" + name}, owner).Err()
+}
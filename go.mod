@@ -3,12 +3,15 @@ module telegram-bot-manager
 go 1.21
 
 require (
-    github.com/go-redis/redis/v8 v8.11.5
-    github.com/lib/pq v1.10.9
-    gopkg.in/telebot.v3 v3.1.3
+	github.com/BurntSushi/toml v1.3.2
+	github.com/go-redis/redis/v8 v8.11.5
+	github.com/lib/pq v1.10.9
+	github.com/robfig/cron/v3 v3.0.1
+	gopkg.in/telebot.v3 v3.1.3
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
-    github.com/cespare/xxhash/v2 v2.1.2 // indirect
-    github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+	github.com/cespare/xxhash/v2 v2.1.2 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
 )
@@ -1,69 +1,195 @@
 package handlers
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
 	"log"
+	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"gopkg.in/telebot.v3"
 
-	"telegram-bot-manager/database"
 	"telegram-bot-manager/models"
+	"telegram-bot-manager/utils"
 )
 
-// HandleAdminPanel - مدیریت پنل ادمین
-func HandleAdminPanel(c telebot.Context, db *sql.DB) error {
-	// بررسی دسترسی
-	if c.Sender().ID != 269758292 {
-		return c.Send("⛔ دسترسی denied")
-	}
+// وضعیت‌های ورودی متنی پنل مدیریت (در Redis نگهداری می‌شوند)
+const (
+	adminStateSearchUser = "admin:search_user"
+	adminStateAddVIP     = "admin:add_vip"
+	adminStateRemoveVIP  = "admin:remove_vip"
+	adminStateAddAdmin   = "admin:add_admin"
+	// ویرایش فیلد پلن: admin:edit_plan:<plan>:<field>
+	adminStateEditPlan = "admin:edit_plan:"
 
-	menu := &telebot.ReplyMarkup{ResizeKeyboard: true}
+	adminStateTTL = 10 * time.Minute
+)
 
-	// دکمه‌های پنل مدیریت
-	btnStats := menu.Text("📊 آمار کامل")
-	btnSearch := menu.Text("🔍 جستجوی کاربر")
-	btnVIP := menu.Text("👑 مدیریت VIP")
-	btnPayments := menu.Text("💳 درخواست‌های پرداخت")
-	btnLinks := menu.Text("🔗 تنظیم لینک‌ها")
-	btnInvites := menu.Text("📋 گزارش دعوت‌ها")
-	btnBack := menu.Text("🔙 بازگشت")
+// adminButton - دکمه پنل مدیریت به همراه مجوز لازم
+type adminButton struct {
+	text string
+	perm models.Permission
+}
 
-	menu.Reply(
-		menu.Row(btnStats),
-		menu.Row(btnSearch, btnVIP),
-		menu.Row(btnPayments, btnLinks),
-		menu.Row(btnInvites),
-		menu.Row(btnBack),
-	)
+var adminPanelButtons = []adminButton{
+	{"📊 آمار کامل", models.PermViewStats},
+	{"🔍 جستجوی کاربر", models.PermSearchUsers},
+	{"👑 مدیریت VIP", models.PermManageVIP},
+	{"💳 درخواست‌های پرداخت", models.PermManagePayments},
+	{"🔗 تنظیم لینک‌ها", models.PermManageLinks},
+	{"📋 گزارش دعوت‌ها", models.PermViewReports},
+	{"👮 مدیریت ادمین‌ها", models.PermManageAdmins},
+	{"💲 قیمت مدل‌ها", models.PermManagePricing},
+	{"🔐 رمزنگاری کلیدها", models.PermManageEncryption},
+}
+
+// RegisterAdminHandlers ثبت دکمه‌ها و callbackهای پنل مدیریت همراه با middleware دسترسی
+func RegisterAdminHandlers(bot *telebot.Bot, db *sql.DB) {
+	bot.Handle("/admin", func(c telebot.Context) error {
+		return HandleAdminPanel(c, db)
+	})
 
-	// هندلرهای پنل مدیریت
+	// دکمه‌های منوی اصلی پنل
 	bot.Handle("📊 آمار کامل", func(c telebot.Context) error {
 		return handleAdminStats(c, db)
-	})
+	}, requireAdmin(db, models.PermViewStats))
 
 	bot.Handle("🔍 جستجوی کاربر", func(c telebot.Context) error {
 		return handleUserSearch(c, db)
-	})
+	}, requireAdmin(db, models.PermSearchUsers))
 
 	bot.Handle("👑 مدیریت VIP", func(c telebot.Context) error {
 		return handleVIPManagement(c, db)
-	})
+	}, requireAdmin(db, models.PermManageVIP))
 
 	bot.Handle("💳 درخواست‌های پرداخت", func(c telebot.Context) error {
 		return handlePaymentRequests(c, db)
-	})
+	}, requireAdmin(db, models.PermManagePayments))
 
 	bot.Handle("🔗 تنظیم لینک‌ها", func(c telebot.Context) error {
 		return handlePaymentLinks(c, db)
-	})
+	}, requireAdmin(db, models.PermManageLinks))
 
 	bot.Handle("📋 گزارش دعوت‌ها", func(c telebot.Context) error {
 		return handleInvitationReports(c, db)
-	})
+	}, requireAdmin(db, models.PermViewReports))
+
+	bot.Handle("👮 مدیریت ادمین‌ها", func(c telebot.Context) error {
+		return handleAdminManagement(c, db)
+	}, requireAdmin(db, models.PermManageAdmins))
+
+	// زیرمنوی VIP
+	bot.Handle("⭐ افزودن VIP", func(c telebot.Context) error {
+		return handleAddVIP(c, db)
+	}, requireAdmin(db, models.PermManageVIP))
+
+	bot.Handle("🗑️ حذف VIP", func(c telebot.Context) error {
+		return handleRemoveVIP(c, db)
+	}, requireAdmin(db, models.PermManageVIP))
+
+	bot.Handle("📋 لیست کاربران VIP", func(c telebot.Context) error {
+		return handleListVIPUsers(c, db)
+	}, requireAdmin(db, models.PermManageVIP))
+
+	// زیرمنوی لینک‌های پرداخت
+	bot.Handle("⭐ ۱ ماه", func(c telebot.Context) error {
+		return handleSetPaymentLink(c, db, "1month")
+	}, requireAdmin(db, models.PermManageLinks))
+
+	bot.Handle("⭐⭐ ۳ ماه", func(c telebot.Context) error {
+		return handleSetPaymentLink(c, db, "3months")
+	}, requireAdmin(db, models.PermManageLinks))
+
+	bot.Handle("⭐⭐⭐ ۶ ماه", func(c telebot.Context) error {
+		return handleSetPaymentLink(c, db, "6months")
+	}, requireAdmin(db, models.PermManageLinks))
+
+	bot.Handle("💎 ۱ سال", func(c telebot.Context) error {
+		return handleSetPaymentLink(c, db, "1year")
+	}, requireAdmin(db, models.PermManageLinks))
+
+	bot.Handle(&telebot.Btn{Unique: "plan_field"}, func(c telebot.Context) error {
+		return handlePlanFieldCallback(c, db)
+	}, requireAdmin(db, models.PermManageLinks))
+
+	bot.Handle(&telebot.Btn{Unique: "plan_toggle"}, func(c telebot.Context) error {
+		return handlePlanToggleCallback(c, db)
+	}, requireAdmin(db, models.PermManageLinks))
+
+	// callbackهای اطلاعات کاربر
+	bot.Handle(&telebot.Btn{Unique: "add_vip"}, func(c telebot.Context) error {
+		return handleAddVIPCallback(c, db)
+	}, requireAdmin(db, models.PermManageVIP))
+
+	bot.Handle(&telebot.Btn{Unique: "remove_vip"}, func(c telebot.Context) error {
+		return handleRemoveVIPCallback(c, db)
+	}, requireAdmin(db, models.PermManageVIP))
+
+	// callbackهای مدیریت ادمین‌ها
+	bot.Handle(&telebot.Btn{Unique: "admin_add"}, func(c telebot.Context) error {
+		return handleAddAdminCallback(c, db)
+	}, requireAdmin(db, models.PermManageAdmins))
+
+	bot.Handle(&telebot.Btn{Unique: "admin_role"}, func(c telebot.Context) error {
+		return handleAdminRoleCallback(c, db)
+	}, requireAdmin(db, models.PermManageAdmins))
+
+	bot.Handle(&telebot.Btn{Unique: "admin_setrole"}, func(c telebot.Context) error {
+		return handleAdminSetRoleCallback(c, db)
+	}, requireAdmin(db, models.PermManageAdmins))
+
+	bot.Handle(&telebot.Btn{Unique: "admin_remove"}, func(c telebot.Context) error {
+		return handleAdminRemoveCallback(c, db)
+	}, requireAdmin(db, models.PermManageAdmins))
+
+	// قیمت مدل‌ها و نرخ دلار
+	registerPricingHandlers(bot, db)
+
+	// رمزنگاری دوباره کلیدهای API پس از چرخش کلید اصلی
+	registerEncryptionHandlers(bot, db)
+}
+
+// HandleAdminPanel - مدیریت پنل ادمین
+func HandleAdminPanel(c telebot.Context, db *sql.DB) error {
+	// بررسی دسترسی
+	admin, err := models.GetAdmin(db, c.Sender().ID)
+	if err != nil {
+		log.Printf("خطا در بررسی دسترسی ادمین: %v", err)
+		return c.Send("❌ خطا در بررسی دسترسی")
+	}
+	if admin == nil {
+		return c.Send("⛔ دسترسی denied")
+	}
+
+	menu := &telebot.ReplyMarkup{ResizeKeyboard: true}
+
+	// فقط دکمه‌هایی که نقش ادمین اجازه‌ی آن‌ها را دارد نمایش داده می‌شوند
+	var rows []telebot.Row
+	var row []telebot.Btn
+	for _, b := range adminPanelButtons {
+		if !admin.Can(b.perm) {
+			continue
+		}
+		row = append(row, menu.Text(b.text))
+		if len(row) == 2 {
+			rows = append(rows, menu.Row(row...))
+			row = nil
+		}
+	}
+	if len(row) > 0 {
+		rows = append(rows, menu.Row(row...))
+	}
+	rows = append(rows, menu.Row(menu.Text("🔙 بازگشت")))
+
+	menu.Reply(rows...)
 
-	return c.Send("🛠️ پنل مدیریت سازنده\n\nاز گزینه‌های زیر انتخاب کنید:", menu)
+	return c.Send(fmt.Sprintf(
+		"🛠️ پنل مدیریت سازنده\n\nنقش شما: %s\n\nاز گزینه‌های زیر انتخاب کنید:",
+		models.RoleNames[admin.Role],
+	), menu)
 }
 
 // آمار کامل سیستم
@@ -74,20 +200,25 @@ func handleAdminStats(c telebot.Context, db *sql.DB) error {
 		return c.Send("❌ خطا در دریافت آمار کاربران")
 	}
 
-	// آمار مصرف امروز
-	var dailyUsage int
-	err = db.QueryRow(`
-		SELECT COALESCE(SUM(tokens_used), 0) 
-		FROM token_usage 
-		WHERE date = CURRENT_DATE
-	`).Scan(&dailyUsage)
+	// آمار مصرف امروز بر اساس مصرف واقعی گزارش‌شده توسط Providerها
+	usage, err := models.GetTodayUsage(db)
+	if err != nil {
+		log.Printf("خطا در دریافت مصرف امروز: %v", err)
+	}
+	rate, err := models.GetUSDToTomanRate(db)
 	if err != nil {
-		dailyUsage = 0
+		log.Printf("خطا در دریافت نرخ دلار: %v", err)
 	}
 
-	// آمار گروه‌ها و کانال‌ها
-	var groupCount, channelCount int
-	// این بخش بعداً با جدول گروه‌ها و کانال‌ها تکمیل می‌شود
+	// آمار گروه‌ها و کانال‌های فعال
+	groupCount, err := models.CountActiveGroups(db)
+	if err != nil {
+		log.Printf("خطا در شمارش گروه‌ها: %v", err)
+	}
+	channelCount, err := models.CountActiveChannels(db)
+	if err != nil {
+		log.Printf("خطا در شمارش کانال‌ها: %v", err)
+	}
 
 	message := fmt.Sprintf(
 		"📊 آمار کامل سیستم\n\n"+
@@ -96,13 +227,16 @@ func handleAdminStats(c telebot.Context, db *sql.DB) error {
 			"• کاربران VIP: %d\n"+
 			"• کاربران عادی: %d\n\n"+
 			"📈 مصرف امروز:\n"+
-			"• توکن مصرف شده: %d\n"+
-			"• هزینه تقریبی: %.2f تومان\n\n"+
+			"• درخواست‌ها: %d\n"+
+			"• توکن ورودی: %d\n"+
+			"• توکن خروجی: %d\n"+
+			"• هزینه: $%.4f (%s تومان)\n\n"+
 			"💬 محیط‌ها:\n"+
 			"• گروه‌ها: %d\n"+
 			"• کانال‌ها: %d",
 		totalUsers, vipUsers, totalUsers-vipUsers,
-		dailyUsage, float64(dailyUsage)*0.002*30000, // تقریب هزینه
+		usage.Requests, usage.PromptTokens, usage.CompletionTokens,
+		usage.Cost, formatPrice(usage.Cost*rate),
 		groupCount, channelCount,
 	)
 
@@ -111,6 +245,9 @@ func handleAdminStats(c telebot.Context, db *sql.DB) error {
 
 // جستجوی کاربر
 func handleUserSearch(c telebot.Context, db *sql.DB) error {
+	if err := setAdminState(c, adminStateSearchUser); err != nil {
+		return c.Send("❌ خطای سیستمی. لطفاً مجدد تلاش کنید.")
+	}
 	return c.Send("لطفاً آیدی عددی کاربر را وارد کنید:")
 }
 
@@ -129,29 +266,22 @@ func handleVIPManagement(c telebot.Context, db *sql.DB) error {
 		menu.Row(btnBack),
 	)
 
-	// هندلرهای مدیریت VIP
-	bot.Handle("⭐ افزودن VIP", func(c telebot.Context) error {
-		return handleAddVIP(c, db)
-	})
-
-	bot.Handle("🗑️ حذف VIP", func(c telebot.Context) error {
-		return handleRemoveVIP(c, db)
-	})
-
-	bot.Handle("📋 لیست کاربران VIP", func(c telebot.Context) error {
-		return handleListVIPUsers(c, db)
-	})
-
 	return c.Send("👑 مدیریت کاربران VIP\n\nاز گزینه‌های زیر انتخاب کنید:", menu)
 }
 
 // افزودن کاربر به VIP
 func handleAddVIP(c telebot.Context, db *sql.DB) error {
+	if err := setAdminState(c, adminStateAddVIP); err != nil {
+		return c.Send("❌ خطای سیستمی. لطفاً مجدد تلاش کنید.")
+	}
 	return c.Send("لطفاً آیدی کاربر و مدت VIP (به روز) را وارد کنید:\n\nفرمت: آیدی مدت\nمثال: 123456789 30")
 }
 
 // حذف کاربر از VIP
 func handleRemoveVIP(c telebot.Context, db *sql.DB) error {
+	if err := setAdminState(c, adminStateRemoveVIP); err != nil {
+		return c.Send("❌ خطای سیستمی. لطفاً مجدد تلاش کنید.")
+	}
 	return c.Send("لطفاً آیدی کاربری که می‌خواهید از VIP حذف کنید را وارد کنید:")
 }
 
@@ -184,12 +314,6 @@ func handleListVIPUsers(c telebot.Context, db *sql.DB) error {
 	return c.Send(message.String())
 }
 
-// مدیریت درخواست‌های پرداخت
-func handlePaymentRequests(c telebot.Context, db *sql.DB) error {
-	// این بخش بعداً با جدول پرداخت‌ها تکمیل می‌شود
-	return c.Send("💳 سیستم درخواست‌های پرداخت\n\nبه زودی فعال خواهد شد...")
-}
-
 // تنظیم لینک‌های پرداخت
 func handlePaymentLinks(c telebot.Context, db *sql.DB) error {
 	menu := &telebot.ReplyMarkup{ResizeKeyboard: true}
@@ -206,38 +330,147 @@ func handlePaymentLinks(c telebot.Context, db *sql.DB) error {
 		menu.Row(btnBack),
 	)
 
-	// هندلرهای تنظیم لینک پرداخت
-	bot.Handle("⭐ ۱ ماه", func(c telebot.Context) error {
-		return handleSetPaymentLink(c, "1month")
-	})
+	return c.Send("🔗 تنظیم پلن‌ها و لینک‌های پرداخت\n\nکدام پلن را می‌خواهید ویرایش کنید؟", menu)
+}
 
-	bot.Handle("⭐⭐ ۳ ماه", func(c telebot.Context) error {
-		return handleSetPaymentLink(c, "3months")
-	})
+func handleSetPaymentLink(c telebot.Context, db *sql.DB, plan string) error {
+	return showPlanEditor(c, db, plan, false)
+}
 
-	bot.Handle("⭐⭐⭐ ۶ ماه", func(c telebot.Context) error {
-		return handleSetPaymentLink(c, "6months")
-	})
+// فیلدهای قابل ویرایش پلن و متن درخواست ورودی
+var planFieldPrompts = map[string]string{
+	"link":        "🔗 لینک پرداخت جدید را وارد کنید (با https:// شروع شود):",
+	"price":       "💰 قیمت جدید را به تومان وارد کنید (مثال: 50000):",
+	"duration":    "📅 مدت اشتراک را به روز وارد کنید (مثال: 30):",
+	"description": "📝 توضیحات پلن را وارد کنید (برای حذف توضیحات - بفرستید):",
+}
 
-	bot.Handle("💎 ۱ سال", func(c telebot.Context) error {
-		return handleSetPaymentLink(c, "1year")
-	})
+// نمایش ویرایشگر پلن همراه با پیش‌نمایش کارت کاربر
+func showPlanEditor(c telebot.Context, db *sql.DB, plan string, edit bool) error {
+	link, err := models.GetPaymentLink(db, plan)
+	if err != nil || link == nil {
+		return c.Send("❌ پلن یافت نشد")
+	}
+
+	status := "🟢 فعال"
+	if !link.IsActive {
+		status = "🔴 غیرفعال"
+	}
+
+	message := fmt.Sprintf(
+		"🛠️ ویرایش پلن «%s»\n\n"+
+			"🔸 وضعیت: %s\n"+
+			"🔗 لینک: %s\n",
+		planNames[plan], status, link.Link,
+	)
+	if link.IsPlaceholder() {
+		message += "⚠️ لینک هنوز لینک نمونه است و پلن به کاربران نمایش داده نمی‌شود.\n"
+	}
+	message += "\n👁️ پیش‌نمایش کارت کاربر:\n━━━━━━━━━━━━\n" + planCardText(link)
+
+	menu := &telebot.ReplyMarkup{}
+	menu.Inline(
+		menu.Row(
+			menu.Data("🔗 لینک", "plan_field", plan+"_link"),
+			menu.Data("💰 قیمت", "plan_field", plan+"_price"),
+		),
+		menu.Row(
+			menu.Data("📅 مدت", "plan_field", plan+"_duration"),
+			menu.Data("📝 توضیحات", "plan_field", plan+"_description"),
+		),
+		menu.Row(menu.Data("🔄 فعال/غیرفعال", "plan_toggle", plan)),
+	)
 
-	return c.Send("🔗 تنظیم لینک‌های پرداخت\n\nلینک پرداخت کدام پلن را می‌خواهید تنظیم کنید؟", menu)
+	if edit {
+		return c.Edit(message, menu)
+	}
+	return c.Send(message, menu)
 }
 
-func handleSetPaymentLink(c telebot.Context, plan string) error {
-	planNames := map[string]string{
-		"1month":  "۱ ماه",
-		"3months": "۳ ماه",
-		"6months": "۶ ماه",
-		"1year":   "۱ سال",
+// callback انتخاب فیلد پلن برای ویرایش (داده: پلن_فیلد)
+func handlePlanFieldCallback(c telebot.Context, db *sql.DB) error {
+	parts := strings.SplitN(c.Data(), "_", 2)
+	if len(parts) != 2 || planNames[parts[0]] == "" || planFieldPrompts[parts[1]] == "" {
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ داده نامعتبر"})
 	}
 
-	return c.Send(fmt.Sprintf(
-		"لطفاً لینک پرداخت برای پلن «%s» را وارد کنید:",
-		planNames[plan],
-	))
+	if err := setAdminState(c, adminStateEditPlan+parts[0]+":"+parts[1]); err != nil {
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ خطای سیستمی"})
+	}
+	c.Respond()
+
+	return c.Send(fmt.Sprintf("پلن «%s»\n%s", planNames[parts[0]], planFieldPrompts[parts[1]]))
+}
+
+// callback فعال/غیرفعال کردن پلن
+func handlePlanToggleCallback(c telebot.Context, db *sql.DB) error {
+	link, err := models.GetPaymentLink(db, c.Data())
+	if err != nil || link == nil {
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ پلن یافت نشد"})
+	}
+
+	if !link.IsActive && link.IsPlaceholder() {
+		return c.Respond(&telebot.CallbackResponse{
+			Text:      "⚠️ ابتدا لینک پرداخت واقعی این پلن را تنظیم کنید",
+			ShowAlert: true,
+		})
+	}
+
+	if err := models.UpdatePaymentLinkStatus(db, link.Plan, !link.IsActive); err != nil {
+		log.Printf("خطا در تغییر وضعیت پلن: %v", err)
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ خطا در تغییر وضعیت"})
+	}
+
+	c.Respond(&telebot.CallbackResponse{Text: "✅ وضعیت پلن تغییر کرد"})
+	return showPlanEditor(c, db, link.Plan, true)
+}
+
+// ذخیره مقدار جدید فیلد پلن
+func processPlanEdit(c telebot.Context, db *sql.DB, plan, field, value string) error {
+	if planNames[plan] == "" {
+		return c.Send("❌ پلن نامعتبر است")
+	}
+
+	var err error
+	switch field {
+	case "link":
+		u, parseErr := url.Parse(value)
+		if parseErr != nil || u.Scheme != "https" || u.Host == "" {
+			return c.Send("❌ لینک نامعتبر است. لینک باید با https:// شروع شود.")
+		}
+		err = models.UpdatePaymentLinkURL(db, plan, value)
+
+	case "price":
+		price, parseErr := strconv.ParseFloat(utils.NormalizeDigits(value), 64)
+		if parseErr != nil || price <= 0 || price >= 100000000 {
+			return c.Send("❌ قیمت نامعتبر است. یک عدد مثبت به تومان وارد کنید.")
+		}
+		err = models.UpdatePaymentLinkPrice(db, plan, price)
+
+	case "duration":
+		days, parseErr := strconv.Atoi(utils.NormalizeDigits(value))
+		if parseErr != nil || days < 1 || days > 3650 {
+			return c.Send("❌ مدت نامعتبر است. عددی بین ۱ تا ۳۶۵۰ روز وارد کنید.")
+		}
+		err = models.UpdatePaymentLinkDuration(db, plan, days)
+
+	case "description":
+		if value == "-" {
+			value = ""
+		}
+		err = models.UpdatePaymentLinkDescription(db, plan, value)
+
+	default:
+		return c.Send("❌ فیلد نامعتبر است")
+	}
+
+	if err != nil {
+		log.Printf("خطا در ویرایش پلن %s (%s): %v", plan, field, err)
+		return c.Send("❌ خطا در ذخیره تغییرات")
+	}
+
+	c.Send("✅ تغییرات ذخیره شد.")
+	return showPlanEditor(c, db, plan, false)
 }
 
 // گزارش دعوت‌ها
@@ -290,27 +523,105 @@ func handleInvitationReports(c telebot.Context, db *sql.DB) error {
 }
 
 // پردازش دستورات متنی در پنل مدیریت
+//
+// ورودی بر اساس وضعیتی که دکمه‌ی انتخاب‌شده در Redis ثبت کرده تفسیر می‌شود.
 func HandleAdminText(c telebot.Context, db *sql.DB) error {
-	text := c.Text()
+	text := strings.TrimSpace(c.Text())
+	ctx := context.Background()
 
-	// اگر عدد است، احتمالاً آیدی کاربر است
-	if _, err := strconv.ParseInt(text, 10, 64); err == nil {
-		return handleUserInfo(c, db, text)
+	state, err := utils.State.GetState(ctx, c.Sender().ID)
+	if err != nil || !strings.HasPrefix(state, "admin:") {
+		return c.Send("❌ دستور نامعتبر. لطفاً از منوی پنل مدیریت استفاده کنید.")
 	}
 
-	// اگر شامل فاصله است، احتمالاً افزودن VIP است
-	if strings.Contains(text, " ") {
-		parts := strings.Split(text, " ")
-		if len(parts) == 2 {
-			if _, err := strconv.Atoi(parts[1]); err == nil {
-				return processAddVIP(c, db, parts[0], parts[1])
-			}
+	admin, err := models.GetAdmin(db, c.Sender().ID)
+	if err != nil || admin == nil {
+		utils.State.ClearState(ctx, c.Sender().ID)
+		return c.Send("⛔ دسترسی denied")
+	}
+
+	if strings.HasPrefix(state, adminStateRejectPayment) {
+		if !admin.Can(models.PermManagePayments) {
+			return c.Send("⛔ دسترسی denied")
 		}
+		utils.State.ClearState(ctx, c.Sender().ID)
+		return processRejectPayment(c, db, admin, strings.TrimPrefix(state, adminStateRejectPayment), text)
 	}
 
+	if strings.HasPrefix(state, adminStateEditPlan) {
+		if !admin.Can(models.PermManageLinks) {
+			return c.Send("⛔ دسترسی denied")
+		}
+		parts := strings.SplitN(strings.TrimPrefix(state, adminStateEditPlan), ":", 2)
+		utils.State.ClearState(ctx, c.Sender().ID)
+		if len(parts) != 2 {
+			return c.Send("❌ دستور نامعتبر. لطفاً دوباره تلاش کنید.")
+		}
+		return processPlanEdit(c, db, parts[0], parts[1], text)
+	}
+
+	if strings.HasPrefix(state, adminStatePricing) {
+		if !admin.Can(models.PermManagePricing) {
+			return c.Send("⛔ دسترسی denied")
+		}
+		utils.State.ClearState(ctx, c.Sender().ID)
+		return processPricingInput(c, db, state, text)
+	}
+
+	switch state {
+	case adminStateSearchUser:
+		if !admin.Can(models.PermSearchUsers) {
+			return c.Send("⛔ دسترسی denied")
+		}
+		if _, err := strconv.ParseInt(text, 10, 64); err != nil {
+			return c.Send("❌ آیدی کاربر نامعتبر است. یک عدد وارد کنید:")
+		}
+		utils.State.ClearState(ctx, c.Sender().ID)
+		return handleUserInfo(c, db, text)
+
+	case adminStateAddVIP:
+		if !admin.Can(models.PermManageVIP) {
+			return c.Send("⛔ دسترسی denied")
+		}
+		parts := strings.Fields(text)
+		if len(parts) != 2 {
+			return c.Send("❌ فرمت نامعتبر. مثال: 123456789 30")
+		}
+		utils.State.ClearState(ctx, c.Sender().ID)
+		return processAddVIP(c, db, parts[0], parts[1])
+
+	case adminStateRemoveVIP:
+		if !admin.Can(models.PermManageVIP) {
+			return c.Send("⛔ دسترسی denied")
+		}
+		utils.State.ClearState(ctx, c.Sender().ID)
+		return processRemoveVIP(c, db, text)
+
+	case adminStateAddAdmin:
+		if !admin.Can(models.PermManageAdmins) {
+			return c.Send("⛔ دسترسی denied")
+		}
+		parts := strings.Fields(text)
+		if len(parts) != 2 {
+			return c.Send("❌ فرمت نامعتبر. مثال: 123456789 finance")
+		}
+		utils.State.ClearState(ctx, c.Sender().ID)
+		return processAddAdmin(c, db, admin, parts[0], parts[1])
+	}
+
+	utils.State.ClearState(ctx, c.Sender().ID)
 	return c.Send("❌ دستور نامعتبر. لطفاً دوباره تلاش کنید.")
 }
 
+// setAdminState ثبت وضعیت انتظار ورودی متنی برای ادمین
+func setAdminState(c telebot.Context, state string) error {
+	err := utils.State.SetState(context.Background(), c.Sender().ID, state, adminStateTTL)
+	if err != nil {
+		log.Printf("خطا در ذخیره وضعیت ادمین: %v", err)
+	}
+	return err
+}
+
 // نمایش اطلاعات کاربر
 func handleUserInfo(c telebot.Context, db *sql.DB, userIDStr string) error {
 	userID, err := strconv.ParseInt(userIDStr, 10, 64)
@@ -372,7 +683,7 @@ func processAddVIP(c telebot.Context, db *sql.DB, userIDStr, daysStr string) err
 		return c.Send("❌ تعداد روز نامعتبر است")
 	}
 
-	err = models.ActivateVIP(db, userID, days)
+	err = models.GrantVIP(db, userID, days)
 	if err != nil {
 		return c.Send("❌ خطا در فعال‌سازی VIP")
 	}
@@ -383,6 +694,176 @@ func processAddVIP(c telebot.Context, db *sql.DB, userIDStr, daysStr string) err
 	))
 }
 
+// حذف VIP کاربر
+func processRemoveVIP(c telebot.Context, db *sql.DB, userIDStr string) error {
+	userID, err := strconv.ParseInt(strings.TrimSpace(userIDStr), 10, 64)
+	if err != nil {
+		return c.Send("❌ آیدی کاربر نامعتبر است")
+	}
+
+	if err := models.DeactivateVIP(db, userID); err != nil {
+		return c.Send("❌ خطا در حذف VIP")
+	}
+
+	return c.Send(fmt.Sprintf("✅ VIP کاربر با آیدی %d حذف شد", userID))
+}
+
+// callback افزودن VIP از کارت اطلاعات کاربر (داده: آیدی_روز)
+func handleAddVIPCallback(c telebot.Context, db *sql.DB) error {
+	parts := strings.Split(c.Data(), "_")
+	if len(parts) != 2 {
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ داده نامعتبر"})
+	}
+	c.Respond()
+	return processAddVIP(c, db, parts[0], parts[1])
+}
+
+// callback حذف VIP از کارت اطلاعات کاربر
+func handleRemoveVIPCallback(c telebot.Context, db *sql.DB) error {
+	c.Respond()
+	return processRemoveVIP(c, db, c.Data())
+}
+
+// مدیریت ادمین‌ها
+func handleAdminManagement(c telebot.Context, db *sql.DB) error {
+	admins, err := models.ListAdmins(db)
+	if err != nil {
+		return c.Send("❌ خطا در دریافت لیست ادمین‌ها")
+	}
+
+	var message strings.Builder
+	message.WriteString("👮 مدیریت ادمین‌ها\n\n")
+
+	menu := &telebot.ReplyMarkup{}
+	var rows []telebot.Row
+
+	for i, a := range admins {
+		message.WriteString(fmt.Sprintf("%d. %d — %s\n", i+1, a.TelegramID, models.RoleNames[a.Role]))
+
+		id := strconv.FormatInt(a.TelegramID, 10)
+		rows = append(rows, menu.Row(
+			menu.Data(fmt.Sprintf("🔁 نقش %s", id), "admin_role", id),
+			menu.Data(fmt.Sprintf("🗑️ حذف %s", id), "admin_remove", id),
+		))
+	}
+
+	message.WriteString("\nمجوز نقش‌ها:\n" +
+		"• مالک: همه بخش‌ها\n" +
+		"• مالی: آمار، کاربران، پرداخت‌ها، لینک‌ها، گزارش‌ها\n" +
+		"• پشتیبانی: آمار، کاربران، گزارش‌ها\n" +
+		"• ناظر: جستجوی کاربر")
+
+	rows = append(rows, menu.Row(menu.Data("➕ افزودن ادمین", "admin_add")))
+	menu.Inline(rows...)
+
+	return c.Send(message.String(), menu)
+}
+
+// callback افزودن ادمین جدید
+func handleAddAdminCallback(c telebot.Context, db *sql.DB) error {
+	c.Respond()
+	if err := setAdminState(c, adminStateAddAdmin); err != nil {
+		return c.Send("❌ خطای سیستمی. لطفاً مجدد تلاش کنید.")
+	}
+	return c.Send("لطفاً آیدی عددی و نقش ادمین جدید را وارد کنید:\n\n" +
+		"فرمت: آیدی نقش\n" +
+		"نقش‌ها: owner, finance, support, moderator\n" +
+		"مثال: 123456789 finance")
+}
+
+// افزودن ادمین
+func processAddAdmin(c telebot.Context, db *sql.DB, admin *models.Admin, userIDStr, role string) error {
+	userID, err := strconv.ParseInt(userIDStr, 10, 64)
+	if err != nil || userID <= 0 {
+		return c.Send("❌ آیدی کاربر نامعتبر است")
+	}
+
+	role = strings.ToLower(role)
+	if !models.IsValidRole(role) {
+		return c.Send("❌ نقش نامعتبر است. نقش‌ها: owner, finance, support, moderator")
+	}
+
+	if userID == admin.TelegramID {
+		return c.Send("❌ نمی‌توانید نقش خودتان را تغییر دهید")
+	}
+
+	if err := models.SaveAdmin(db, userID, role, admin.TelegramID); err != nil {
+		log.Printf("خطا در ذخیره ادمین: %v", err)
+		return c.Send("❌ خطا در ذخیره ادمین")
+	}
+
+	c.Bot().Send(&telebot.User{ID: userID}, fmt.Sprintf(
+		"🛠️ شما به عنوان ادمین (%s) اضافه شدید.\nبرای ورود به پنل: /admin",
+		models.RoleNames[role],
+	))
+
+	return c.Send(fmt.Sprintf("✅ کاربر %d با نقش %s به ادمین‌ها اضافه شد", userID, models.RoleNames[role]))
+}
+
+// callback انتخاب نقش جدید برای ادمین
+func handleAdminRoleCallback(c telebot.Context, db *sql.DB) error {
+	id := c.Data()
+
+	menu := &telebot.ReplyMarkup{}
+	var rows []telebot.Row
+	for _, role := range models.Roles {
+		rows = append(rows, menu.Row(menu.Data(models.RoleNames[role], "admin_setrole", id+"_"+role)))
+	}
+	menu.Inline(rows...)
+
+	c.Respond()
+	return c.Send(fmt.Sprintf("نقش جدید ادمین %s را انتخاب کنید:", id), menu)
+}
+
+// callback اعمال نقش جدید (داده: آیدی_نقش)
+func handleAdminSetRoleCallback(c telebot.Context, db *sql.DB) error {
+	admin := currentAdmin(c)
+
+	parts := strings.SplitN(c.Data(), "_", 2)
+	if len(parts) != 2 {
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ داده نامعتبر"})
+	}
+
+	userID, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || !models.IsValidRole(parts[1]) {
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ داده نامعتبر"})
+	}
+
+	if userID == admin.TelegramID {
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ نمی‌توانید نقش خودتان را تغییر دهید", ShowAlert: true})
+	}
+
+	if err := models.SaveAdmin(db, userID, parts[1], admin.TelegramID); err != nil {
+		log.Printf("خطا در تغییر نقش ادمین: %v", err)
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ خطا در تغییر نقش"})
+	}
+
+	c.Respond(&telebot.CallbackResponse{Text: "✅ نقش تغییر کرد"})
+	return c.Edit(fmt.Sprintf("✅ نقش ادمین %d به %s تغییر کرد", userID, models.RoleNames[parts[1]]))
+}
+
+// callback حذف ادمین
+func handleAdminRemoveCallback(c telebot.Context, db *sql.DB) error {
+	admin := currentAdmin(c)
+
+	userID, err := strconv.ParseInt(c.Data(), 10, 64)
+	if err != nil {
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ داده نامعتبر"})
+	}
+
+	if userID == admin.TelegramID {
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ نمی‌توانید خودتان را حذف کنید", ShowAlert: true})
+	}
+
+	if err := models.RemoveAdmin(db, userID); err != nil {
+		log.Printf("خطا در حذف ادمین: %v", err)
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ خطا در حذف ادمین"})
+	}
+
+	c.Respond(&telebot.CallbackResponse{Text: "✅ ادمین حذف شد"})
+	return c.Send(fmt.Sprintf("🗑️ ادمین %d حذف شد", userID))
+}
+
 // تابع کمکی برای نمایش یوزرنیم
 func getUsername(username string) string {
 	if username == "" {
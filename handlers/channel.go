@@ -1,6 +1,9 @@
 package handlers
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"strconv"
@@ -9,35 +12,168 @@ import (
 
 	"gopkg.in/telebot.v3"
 
-	"telegram-bot-manager/database"
 	"telegram-bot-manager/models"
-	"telegram-bot-manager/services"
+	"telegram-bot-manager/utils"
 )
 
-// ChannelConfig - تنظیمات کانال
-type ChannelConfig struct {
-	ID           int64     `json:"id"`
-	OwnerID      int64     `json:"owner_id"`
-	ChannelID    string    `json:"channel_id"`
-	ChannelTitle string    `json:"channel_title"`
-	Prompt       string    `json:"prompt"`
-	ScheduleTime string    `json:"schedule_time"`
-	PostsPerBatch int      `json:"posts_per_batch"`
-	IsActive     bool      `json:"is_active"`
-	CreatedAt    time.Time `json:"created_at"`
+// وضعیت‌های ورودی متنی تنظیمات کانال (به همراه آیدی کانال)
+const (
+	channelStatePrefix = "channel:"
+	channelStateID     = "channel:id"
+	channelStatePrompt = "channel:prompt:"
+	channelStateTime   = "channel:time:"
+	channelStateTZ     = "channel:tz:"
+	channelStateDraft  = "channel:draft:"
+	channelStateTTL    = 10 * time.Minute
+
+	// حداکثر طول پرامپت کانال
+	channelPromptMaxLength = 2000
+	// حداکثر طول متن ویرایش‌شده پیش‌نویس
+	channelDraftMaxLength = 4000
+)
+
+// نمایش وضعیت اجرای نوبت‌های انتشار
+var runStatusNames = map[string]string{
+	models.RunRunning:   "⏳ در حال اجرا",
+	models.RunSucceeded: "✅ موفق",
+	models.RunPartial:   "⚠️ ناقص",
+	models.RunFailed:    "❌ ناموفق",
+	models.RunFenced:    "⛔ متوقف‌شده",
+}
+
+// تعدادهای پیشنهادی پست هر نوبت
+var channelPostPresets = []int{1, 2, 3, 5}
+
+// RegisterChannelHandlers ثبت منوی «📢 مدیریت کانال» و دکمه‌های آن (مخصوص کاربران VIP)
+func RegisterChannelHandlers(bot *telebot.Bot, db *sql.DB) {
+	openSettings := func(c telebot.Context) error {
+		return HandleChannelSettings(c, db)
+	}
+	bot.Handle("/channel", openSettings)
+	bot.Handle("📢 مدیریت کانال", openSettings)
+
+	vip := requireChannelVIP(db)
+
+	bot.Handle(&telebot.Btn{Unique: "channels_list"}, func(c telebot.Context) error {
+		c.Respond()
+		return showChannelList(c, db, true)
+	}, vip)
+
+	bot.Handle(&telebot.Btn{Unique: "channel_add"}, func(c telebot.Context) error {
+		return handleChannelAdd(c, db)
+	}, vip)
+
+	bot.Handle(&telebot.Btn{Unique: "channel_open"}, func(c telebot.Context) error {
+		return withOwnedChannel(c, db, func(ch *models.ChannelConfig) error {
+			c.Respond()
+			return showChannelDetails(c, db, ch, true)
+		})
+	}, vip)
+
+	bot.Handle(&telebot.Btn{Unique: "channel_prompt"}, func(c telebot.Context) error {
+		return withOwnedChannel(c, db, func(ch *models.ChannelConfig) error {
+			return askChannelInput(c, channelStatePrompt, ch,
+				"📝 پرامپت مخصوص «"+ch.ChannelTitle+"» را بفرستید:\n\n"+
+					"مثال:\n"+
+					"«تو یک تولیدکننده محتوای آموزشی هستی. روزانه یک نکته آموزشی در مورد برنامه‌نویسی تولید کن. محتوا باید کاربردی و قابل فهم باشد.»")
+		})
+	}, vip)
+
+	bot.Handle(&telebot.Btn{Unique: "channel_times"}, func(c telebot.Context) error {
+		return withOwnedChannel(c, db, func(ch *models.ChannelConfig) error {
+			c.Respond()
+			return showChannelSchedule(c, ch)
+		})
+	}, vip)
+
+	bot.Handle(&telebot.Btn{Unique: "channel_postsmenu"}, func(c telebot.Context) error {
+		return withOwnedChannel(c, db, func(ch *models.ChannelConfig) error {
+			c.Respond()
+			return showChannelPosts(c, ch)
+		})
+	}, vip)
+
+	bot.Handle(&telebot.Btn{Unique: "channel_posts"}, func(c telebot.Context) error {
+		return withOwnedChannel(c, db, func(ch *models.ChannelConfig) error {
+			posts, err := strconv.Atoi(c.Args()[len(c.Args())-1])
+			if err != nil {
+				return c.Respond(&telebot.CallbackResponse{Text: "❌ داده نامعتبر"})
+			}
+			if err := models.UpdateChannelPosts(db, ch.OwnerID, ch.ID, posts); err != nil {
+				return replyChannelError(c, err, "❌ خطا در ذخیره تعداد پست")
+			}
+			ch.PostsPerBatch = posts
+			c.Respond(&telebot.CallbackResponse{Text: fmt.Sprintf("✅ تعداد پست %d تنظیم شد", posts)})
+			return showChannelDetails(c, db, ch, true)
+		})
+	}, vip)
+
+	bot.Handle(&telebot.Btn{Unique: "channel_toggle"}, func(c telebot.Context) error {
+		return withOwnedChannel(c, db, func(ch *models.ChannelConfig) error { return handleChannelToggle(c, db, ch) })
+	}, vip)
+
+	bot.Handle(&telebot.Btn{Unique: "channel_clone"}, func(c telebot.Context) error {
+		return withOwnedChannel(c, db, func(ch *models.ChannelConfig) error { return showCloneSources(c, db, ch) })
+	}, vip)
+
+	bot.Handle(&telebot.Btn{Unique: "channel_clonefrom"}, func(c telebot.Context) error {
+		return withOwnedChannel(c, db, func(ch *models.ChannelConfig) error { return handleChannelClone(c, db, ch) })
+	}, vip)
+
+	bot.Handle(&telebot.Btn{Unique: "channel_delete"}, func(c telebot.Context) error {
+		return withOwnedChannel(c, db, func(ch *models.ChannelConfig) error {
+			c.Respond()
+			id := strconv.Itoa(ch.ID)
+			menu := &telebot.ReplyMarkup{}
+			menu.Inline(
+				menu.Row(menu.Data("🗑️ بله، حذف شود", "channel_delok", id)),
+				menu.Row(menu.Data("🔙 انصراف", "channel_open", id)),
+			)
+			return c.Edit(fmt.Sprintf("⚠️ کانال «%s» و همه تنظیمات آن حذف شود؟", ch.ChannelTitle), menu)
+		})
+	}, vip)
+
+	bot.Handle(&telebot.Btn{Unique: "channel_delok"}, func(c telebot.Context) error {
+		return withOwnedChannel(c, db, func(ch *models.ChannelConfig) error {
+			if err := models.DeleteChannel(db, ch.OwnerID, ch.ID); err != nil {
+				return replyChannelError(c, err, "❌ خطا در حذف کانال")
+			}
+			c.Respond(&telebot.CallbackResponse{Text: "🗑️ کانال حذف شد"})
+			return showChannelList(c, db, true)
+		})
+	}, vip)
+
+	registerChannelScheduleHandlers(bot, db, vip)
+	registerChannelDraftHandlers(bot, db, vip)
+}
+
+// requireChannelVIP محدود کردن دکمه‌های کانال به کاربران VIP
+func requireChannelVIP(db *sql.DB) telebot.MiddlewareFunc {
+	return func(next telebot.HandlerFunc) telebot.HandlerFunc {
+		return func(c telebot.Context) error {
+			user, err := models.GetUserByTelegramID(db, c.Sender().ID)
+			if err != nil || !user.HasActiveVIP() {
+				c.Respond(&telebot.CallbackResponse{Text: "⛔ این قابلیت مخصوص کاربران VIP است"})
+				return HandleChannelSettings(c, db)
+			}
+			return next(c)
+		}
+	}
 }
 
 // HandleChannelSettings - مدیریت تنظیمات کانال
 func HandleChannelSettings(c telebot.Context, db *sql.DB) error {
-	userID := c.Sender().ID
-	
+	if c.Chat().Type != telebot.ChatPrivate {
+		return c.Reply("🔒 تنظیمات کانال فقط در چت خصوصی با ربات قابل مدیریت است.")
+	}
+
 	// بررسی VIP بودن کاربر
-	user, err := models.GetUserByTelegramID(db, userID)
-	if err != nil || user == nil || !user.IsVIP {
+	user, err := models.GetUserByTelegramID(db, c.Sender().ID)
+	if err != nil || !user.HasActiveVIP() {
 		menu := &telebot.ReplyMarkup{}
 		btnVIP := menu.URL("🎯 ارتقاء به VIP", "https://t.me/gpt_yourbot?start=vip_request")
 		menu.Inline(menu.Row(btnVIP))
-		
+
 		return c.Send(
 			"⛔ این قابلیت مخصوص کاربران VIP است\n\n"+
 				"با ارتقاء به VIP می‌توانید:\n"+
@@ -48,285 +184,345 @@ func HandleChannelSettings(c telebot.Context, db *sql.DB) error {
 		)
 	}
 
-	menu := &telebot.ReplyMarkup{ResizeKeyboard: true}
+	return showChannelList(c, db, false)
+}
 
-	// دریافت تنظیمات کانال کاربر
-	channelConfig, err := getChannelConfig(db, userID)
+// withOwnedChannel اجرای fn برای کانالی از کاربر که آیدی آن در داده دکمه آمده است
+func withOwnedChannel(c telebot.Context, db *sql.DB, fn func(ch *models.ChannelConfig) error) error {
+	args := c.Args()
+	if len(args) == 0 {
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ داده نامعتبر"})
+	}
+	id, err := strconv.Atoi(args[0])
 	if err != nil {
-		log.Printf("خطا در دریافت تنظیمات کانال: %v", err)
-	}
-
-	// دکمه‌های منوی کانال
-	btnSetChannel := menu.Text("📢 تنظیم آیدی کانال")
-	btnSetPrompt := menu.Text("📝 تنظیم پرامپت")
-	btnSetSchedule := menu.Text("⏰ تنظیم زمان انتشار")
-	btnSetPosts := menu.Text("🔢 تنظیم تعداد پست")
-	btnToggle := menu.Text("🔄 فعال/غیرفعال")
-	btnStatus := menu.Text("📊 وضعیت کانال")
-	btnBack := menu.Text("🔙 بازگشت")
-
-	menu.Reply(
-		menu.Row(btnSetChannel, btnSetPrompt),
-		menu.Row(btnSetSchedule, btnSetPosts),
-		menu.Row(btnToggle, btnStatus),
-		menu.Row(btnBack),
-	)
-
-	// هندلرهای منوی کانال
-	bot.Handle("📢 تنظیم آیدی کانال", func(c telebot.Context) error {
-		return handleSetChannelID(c, db, userID)
-	})
-
-	bot.Handle("📝 تنظیم پرامپت", func(c telebot.Context) error {
-		return handleSetChannelPrompt(c, db, userID)
-	})
-
-	bot.Handle("⏰ تنظیم زمان انتشار", func(c telebot.Context) error {
-		return handleSetScheduleTime(c, db, userID)
-	})
-
-	bot.Handle("🔢 تنظیم تعداد پست", func(c telebot.Context) error {
-		return handleSetPostsPerBatch(c, db, userID)
-	})
-
-	bot.Handle("🔄 فعال/غیرفعال", func(c telebot.Context) error {
-		return handleToggleChannel(c, db, userID, channelConfig)
-	})
-
-	bot.Handle("📊 وضعیت کانال", func(c telebot.Context) error {
-		return handleChannelStatus(c, db, userID, channelConfig)
-	})
-
-	// پیام خوش‌آمد
-	message := "📢 مدیریت کانال VIP\n\n"
-	if channelConfig != nil {
-		status := "🔴 غیرفعال"
-		if channelConfig.IsActive {
-			status = "🟢 فعال"
-		}
-		
-		message += fmt.Sprintf(
-			"کانال: %s\n"+
-				"وضعیت: %s\n"+
-				"زمان انتشار: %s\n"+
-				"تعداد پست: %d\n\n",
-			channelConfig.ChannelTitle, status,
-			channelConfig.ScheduleTime, channelConfig.PostsPerBatch,
-		)
-	} else {
-		message += "هنوز کانالی تنظیم نکرده‌اید.\n\n"
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ داده نامعتبر"})
 	}
-	
-	message += "از گزینه‌های زیر انتخاب کنید:"
-
-	return c.Send(message, menu)
-}
-
-// تنظیم آیدی کانال
-func handleSetChannelID(c telebot.Context, db *sql.DB, userID int64) error {
-	return c.Send("لطفاً آیدی کانال خود را وارد کنید:\n\n" +
-		"فرمت: @channel_username\n" +
-		"یا: https://t.me/channel_username\n\n" +
-		"⚠️注意: ابتدا ربات را در کانال ادمین کنید")
-}
-
-// تنظیم پرامپت کانال
-func handleSetChannelPrompt(c telebot.Context, db *sql.DB, userID int64) error {
-	return c.Send("لطفاً پرامپت مخصوص کانال خود را وارد کنید:\n\n" +
-		"مثال:\n" +
-		"«تو یک تولیدکننده محتوای آموزشی هستی. روزانه یک نکته آموزشی در مورد برنامه‌نویسی تولید کن. محتوا باید کاربردی و قابل فهم باشد.»")
+	ch, err := models.GetOwnedChannel(db, c.Sender().ID, id)
+	if err != nil || ch == nil {
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ کانال یافت نشد"})
+	}
+	return fn(ch)
 }
 
-// تنظیم زمان انتشار
-func handleSetScheduleTime(c telebot.Context, db *sql.DB, userID int64) error {
-	menu := &telebot.ReplyMarkup{ResizeKeyboard: true}
-
-	btn9AM := menu.Text("⏰ ۹:۰۰ صبح")
-	btn12PM := menu.Text("⏰ ۱۲:۰۰ ظهر")
-	btn6PM := menu.Text("⏰ ۱۸:۰۰ عصر")
-	btn9PM := menu.Text("⏰ ۲۱:۰۰ شب")
-	btnCustom := menu.Text("⏰ زمان دلخواه")
-	btnBack := menu.Text("🔙 بازگشت")
-
-	menu.Reply(
-		menu.Row(btn9AM, btn12PM),
-		menu.Row(btn6PM, btn9PM),
-		menu.Row(btnCustom),
-		menu.Row(btnBack),
-	)
-
-	// هندلرهای زمان‌بندی
-	bot.Handle("⏰ ۹:۰۰ صبح", func(c telebot.Context) error {
-		return saveScheduleTime(c, db, userID, "09:00")
-	})
-
-	bot.Handle("⏰ ۱۲:۰۰ ظهر", func(c telebot.Context) error {
-		return saveScheduleTime(c, db, userID, "12:00")
-	})
-
-	bot.Handle("⏰ ۱۸:۰۰ عصر", func(c telebot.Context) error {
-		return saveScheduleTime(c, db, userID, "18:00")
-	})
+// showChannelList نمایش کانال‌های کاربر با خلاصه وضعیت هر کانال
+func showChannelList(c telebot.Context, db *sql.DB, edit bool) error {
+	userID := c.Sender().ID
 
-	bot.Handle("⏰ ۲۱:۰۰ شب", func(c telebot.Context) error {
-		return saveScheduleTime(c, db, userID, "21:00")
-	})
+	user, err := models.GetUserByTelegramID(db, userID)
+	if err != nil {
+		log.Printf("خطا در دریافت کاربر %d: %v", userID, err)
+		return c.Send("❌ خطا در دریافت اطلاعات کاربر.")
+	}
+	channels, err := models.ListOwnedChannels(db, userID)
+	if err != nil {
+		log.Printf("خطا در دریافت کانال‌های کاربر %d: %v", userID, err)
+		return c.Send("❌ خطا در دریافت کانال‌ها.")
+	}
+	limit := models.ChannelLimitForUser(user)
 
-	bot.Handle("⏰ زمان دلخواه", func(c telebot.Context) error {
-		return c.Send("لطفاً زمان مورد نظر را به فرمت HH:MM وارد کنید:\n\nمثال: 08:30 یا 14:45")
-	})
+	var b strings.Builder
+	fmt.Fprintf(&b, "📢 کانال‌های شما (%d از %d)\n", len(channels), limit)
+	if len(channels) == 0 {
+		b.WriteString("\nهنوز کانالی ثبت نکرده‌اید.\n")
+	}
+	menu := &telebot.ReplyMarkup{}
+	var rows []telebot.Row
+	for i := range channels {
+		ch := &channels[i]
+		fmt.Fprintf(&b, "\n%d. %s — %s\n⏰ %s · 🔢 %d پست · 📨 %d پست منتشرشده\n",
+			i+1, ch.ChannelTitle, channelStateName(ch), channelScheduleLabel(ch.Schedule), ch.PostsPerBatch, ch.TotalPosts)
+		rows = append(rows, menu.Row(menu.Data(fmt.Sprintf("⚙️ %d. %s", i+1, ch.ChannelTitle), "channel_open", strconv.Itoa(ch.ID))))
+	}
+	if len(channels) < limit {
+		rows = append(rows, menu.Row(menu.Data("➕ افزودن کانال", "channel_add")))
+	}
+	menu.Inline(rows...)
 
-	return c.Send("⏰ تنظیم زمان انتشار\n\nزمان مورد نظر برای انتشار خودکار پست‌ها را انتخاب کنید:", menu)
+	if edit {
+		return c.Edit(b.String(), menu)
+	}
+	return c.Send(b.String(), menu)
 }
 
-// تنظیم تعداد پست
-func handleSetPostsPerBatch(c telebot.Context, db *sql.DB, userID int64) error {
-	menu := &telebot.ReplyMarkup{ResizeKeyboard: true}
-
-	btn1 := menu.Text("1️⃣ ۱ پست")
-	btn2 := menu.Text("2️⃣ ۲ پست")
-	btn3 := menu.Text("3️⃣ ۳ پست")
-	btn5 := menu.Text("5️⃣ ۵ پست")
-	btnBack := menu.Text("🔙 بازگشت")
+// showChannelDetails نمایش وضعیت و دکمه‌های مدیریت یک کانال
+func showChannelDetails(c telebot.Context, db *sql.DB, ch *models.ChannelConfig, edit bool) error {
+	// بررسی ادمین بودن ربات
+	isAdmin, err := checkBotAdminStatus(c.Bot(), ch.ChannelID)
+	if err != nil {
+		log.Printf("خطا در بررسی وضعیت ادمین در %s: %v", ch.ChannelID, err)
+	}
+	adminStatus := "❌ نیست"
+	if isAdmin {
+		adminStatus = "✅ هست"
+	}
 
-	menu.Reply(
-		menu.Row(btn1, btn2),
-		menu.Row(btn3, btn5),
-		menu.Row(btnBack),
-	)
+	lastPost := "هنوز پستی منتشر نشده"
+	if ch.LastPostAt.Valid {
+		lastPost = ch.LastPostAt.Time.Format("2006-01-02 15:04")
+	}
 
-	// هندلرهای تعداد پست
-	bot.Handle("1️⃣ ۱ پست", func(c telebot.Context) error {
-		return savePostsPerBatch(c, db, userID, 1)
-	})
+	var b strings.Builder
+	fmt.Fprintf(&b, "📢 %s — %s\n\n", ch.ChannelTitle, channelStateName(ch))
+	fmt.Fprintf(&b, "🔗 آیدی: %s\n", ch.ChannelID)
+	fmt.Fprintf(&b, "🤖 ربات ادمین: %s\n", adminStatus)
+	fmt.Fprintf(&b, "⏰ زمان‌بندی: %s\n", channelScheduleLabel(ch.Schedule))
+	fmt.Fprintf(&b, "🌐 منطقه زمانی: %s\n", ch.Schedule.Timezone)
+	if ch.IsActive && ch.NextRunAt.Valid {
+		fmt.Fprintf(&b, "⏭️ انتشار بعدی: %s\n", channelLocalTime(ch, ch.NextRunAt.Time))
+	}
+	fmt.Fprintf(&b, "🔢 تعداد پست: %d\n", ch.PostsPerBatch)
+	if ch.AutoPublish {
+		b.WriteString("🤖 انتشار: مستقیم و بدون تأیید\n")
+	} else if pending, approved, err := models.CountQueuedDrafts(db, ch.ID); err != nil {
+		log.Printf("خطا در شمارش پیش‌نویس‌های کانال %d: %v", ch.ID, err)
+	} else {
+		fmt.Fprintf(&b, "📥 انتشار: پس از تأیید (%d در انتظار بررسی، %d تأییدشده)\n", pending, approved)
+	}
+	if prompt := truncateRunes(ch.Prompt, 100); prompt != "" {
+		if prompt != ch.Prompt {
+			prompt += "…"
+		}
+		fmt.Fprintf(&b, "📝 پرامپت: %s\n", prompt)
+	} else {
+		b.WriteString("📝 پرامپت: تنظیم نشده\n")
+	}
+	fmt.Fprintf(&b, "📨 پست‌های منتشرشده: %d\n", ch.TotalPosts)
+	fmt.Fprintf(&b, "🕒 آخرین انتشار: %s\n", lastPost)
+	if run, err := models.LastScheduledRun(db, ch.ID); err != nil {
+		log.Printf("خطا در دریافت آخرین نوبت کانال %d: %v", ch.ID, err)
+	} else if run != nil {
+		fmt.Fprintf(&b, "🧾 آخرین نوبت: %s — %s (%d پست)\n", channelLocalTime(ch, run.SlotAt), runStatusNames[run.Status], run.Posts)
+	}
+	if !isAdmin {
+		b.WriteString("\n⚠️ برای فعال‌سازی، ربات را در کانال ادمین کنید.")
+	}
 
-	bot.Handle("2️⃣ ۲ پست", func(c telebot.Context) error {
-		return savePostsPerBatch(c, db, userID, 2)
-	})
+	toggle := "⛔ غیرفعال کردن"
+	if !ch.IsActive {
+		toggle = "✅ فعال کردن"
+	}
+	autoPublish := "🤖 انتشار مستقیم: خاموش"
+	if ch.AutoPublish {
+		autoPublish = "🤖 انتشار مستقیم: روشن"
+	}
 
-	bot.Handle("3️⃣ ۳ پست", func(c telebot.Context) error {
-		return savePostsPerBatch(c, db, userID, 3)
-	})
+	id := strconv.Itoa(ch.ID)
+	menu := &telebot.ReplyMarkup{}
+	menu.Inline(
+		menu.Row(menu.Data("📝 پرامپت", "channel_prompt", id), menu.Data("⏰ زمان‌بندی", "channel_times", id)),
+		menu.Row(menu.Data("🔢 تعداد پست", "channel_postsmenu", id), menu.Data("📋 کپی تنظیمات", "channel_clone", id)),
+		menu.Row(menu.Data(autoPublish, "channel_auto", id), menu.Data("📥 پیش‌نویس‌ها", "channel_drafts", id)),
+		menu.Row(menu.Data(toggle, "channel_toggle", id)),
+		menu.Row(menu.Data("🗑️ حذف کانال", "channel_delete", id)),
+		menu.Row(menu.Data("🔙 بازگشت", "channels_list")),
+	)
 
-	bot.Handle("5️⃣ ۵ پست", func(c telebot.Context) error {
-		return savePostsPerBatch(c, db, userID, 5)
-	})
+	if edit {
+		return c.Edit(b.String(), menu)
+	}
+	return c.Send(b.String(), menu)
+}
 
-	return c.Send("🔢 تنظیم تعداد پست\n\nتعداد پست‌هایی که در هر نوبت منتشر شوند را انتخاب کنید:", menu)
+// showChannelPosts نمایش تعدادهای پیشنهادی پست هر نوبت
+func showChannelPosts(c telebot.Context, ch *models.ChannelConfig) error {
+	id := strconv.Itoa(ch.ID)
+	menu := &telebot.ReplyMarkup{}
+	var buttons []telebot.Btn
+	for _, n := range channelPostPresets {
+		buttons = append(buttons, menu.Data(fmt.Sprintf("%d پست", n), "channel_posts", id, strconv.Itoa(n)))
+	}
+	menu.Inline(
+		menu.Row(buttons...),
+		menu.Row(menu.Data("🔙 بازگشت", "channel_open", id)),
+	)
+	return c.Edit(fmt.Sprintf("🔢 تعداد پست‌هایی که در هر نوبت در «%s» منتشر شوند را انتخاب کنید:\nتعداد فعلی: %d",
+		ch.ChannelTitle, ch.PostsPerBatch), menu)
 }
 
-// فعال/غیرفعال کردن کانال
-func handleToggleChannel(c telebot.Context, db *sql.DB, userID int64, config *ChannelConfig) error {
-	if config == nil {
-		return c.Send("❌ ابتدا باید کانال خود را تنظیم کنید.")
+// handleChannelToggle فعال یا غیرفعال کردن انتشار خودکار یک کانال
+func handleChannelToggle(c telebot.Context, db *sql.DB, ch *models.ChannelConfig) error {
+	newStatus := !ch.IsActive
+	if newStatus {
+		// بررسی ادمین بودن ربات در کانال
+		isAdmin, err := checkBotAdminStatus(c.Bot(), ch.ChannelID)
+		if err != nil {
+			return c.Respond(&telebot.CallbackResponse{Text: "❌ خطا در بررسی وضعیت ربات در کانال", ShowAlert: true})
+		}
+		if !isAdmin {
+			return c.Respond(&telebot.CallbackResponse{Text: "❌ ربات در کانال ادمین نیست. لطفاً ابتدا ربات را ادمین کنید.", ShowAlert: true})
+		}
+		if ch.Schedule.IsZero() || ch.Prompt == "" {
+			return c.Respond(&telebot.CallbackResponse{Text: "❌ پیش از فعال‌سازی، پرامپت و زمان‌بندی انتشار کانال را تنظیم کنید.", ShowAlert: true})
+		}
 	}
 
-	// بررسی ادمین بودن ربات در کانال
-	isAdmin, err := checkBotAdminStatus(c.Bot(), config.ChannelID)
-	if err != nil {
-		return c.Send("❌ خطا در بررسی وضعیت ربات در کانال")
+	if err := models.UpdateChannelStatus(db, ch.OwnerID, ch.ID, newStatus); err != nil {
+		return replyChannelError(c, err, "❌ خطا در تغییر وضعیت کانال")
 	}
 
-	if !isAdmin {
-		return c.Send("❌ ربات در کانال ادمین نیست. لطفاً ابتدا ربات را ادمین کنید.")
+	ch.IsActive = newStatus
+	if newStatus {
+		c.Respond(&telebot.CallbackResponse{Text: "✅ انتشار خودکار فعال شد"})
+	} else {
+		c.Respond(&telebot.CallbackResponse{Text: "⛔ انتشار خودکار متوقف شد"})
 	}
+	return showChannelDetails(c, db, ch, true)
+}
 
-	newStatus := !config.IsActive
-	err = updateChannelStatus(db, userID, newStatus)
+// showCloneSources نمایش کانال‌های دیگر کاربر برای کپی تنظیمات
+func showCloneSources(c telebot.Context, db *sql.DB, ch *models.ChannelConfig) error {
+	channels, err := models.ListOwnedChannels(db, ch.OwnerID)
 	if err != nil {
-		return c.Send("❌ خطا در تغییر وضعیت کانال")
+		log.Printf("خطا در دریافت کانال‌های کاربر %d: %v", ch.OwnerID, err)
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ خطا در دریافت کانال‌ها"})
 	}
 
-	statusText := "غیرفعال"
-	if newStatus {
-		statusText = "فعال"
+	id := strconv.Itoa(ch.ID)
+	menu := &telebot.ReplyMarkup{}
+	var rows []telebot.Row
+	for i := range channels {
+		if channels[i].ID == ch.ID {
+			continue
+		}
+		rows = append(rows, menu.Row(menu.Data("📋 "+channels[i].ChannelTitle, "channel_clonefrom", id, strconv.Itoa(channels[i].ID))))
+	}
+	if len(rows) == 0 {
+		return c.Respond(&telebot.CallbackResponse{Text: "ℹ️ کانال دیگری برای کپی تنظیمات ندارید", ShowAlert: true})
 	}
+	rows = append(rows, menu.Row(menu.Data("🔙 بازگشت", "channel_open", id)))
+	menu.Inline(rows...)
 
-	return c.Send(fmt.Sprintf("✅ وضعیت کانال به «%s» تغییر یافت.", statusText))
+	c.Respond()
+	return c.Edit(fmt.Sprintf("📋 تنظیمات (پرامپت، زمان‌بندی و تعداد پست) از کدام کانال به «%s» کپی شود؟", ch.ChannelTitle), menu)
 }
 
-// نمایش وضعیت کانال
-func handleChannelStatus(c telebot.Context, db *sql.DB, userID int64, config *ChannelConfig) error {
-	if config == nil {
-		return c.Send("❌ هنوز کانالی تنظیم نکرده‌اید.")
+// handleChannelClone کپی تنظیمات کانال انتخاب‌شده به کانال جاری
+func handleChannelClone(c telebot.Context, db *sql.DB, ch *models.ChannelConfig) error {
+	args := c.Args()
+	if len(args) < 2 {
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ داده نامعتبر"})
 	}
-
-	// بررسی ادمین بودن ربات
-	isAdmin, err := checkBotAdminStatus(c.Bot(), config.ChannelID)
+	fromID, err := strconv.Atoi(args[1])
 	if err != nil {
-		log.Printf("خطا در بررسی وضعیت ادمین: %v", err)
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ داده نامعتبر"})
 	}
 
-	adminStatus := "❌ نیست"
-	if isAdmin {
-		adminStatus = "✅ هست"
+	if err := models.CloneChannelSettings(db, ch.OwnerID, fromID, ch.ID); err != nil {
+		return replyChannelError(c, err, "❌ خطا در کپی تنظیمات")
 	}
 
-	channelStatus := "🔴 غیرفعال"
-	if config.IsActive {
-		channelStatus = "🟢 فعال"
+	updated, err := models.GetOwnedChannel(db, ch.OwnerID, ch.ID)
+	if err != nil || updated == nil {
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ کانال یافت نشد"})
 	}
+	c.Respond(&telebot.CallbackResponse{Text: "✅ تنظیمات کپی شد"})
+	return showChannelDetails(c, db, updated, true)
+}
 
-	message := fmt.Sprintf(
-		"📊 وضعیت کانال\n\n"+
-			"📢 کانال: %s\n"+
-			"🔸 وضعیت: %s\n"+
-			"🔸 ربات ادمین: %s\n"+
-			"⏰ زمان انتشار: %s\n"+
-			"🔢 تعداد پست: %d\n"+
-			"📝 طول پرامپت: %d کاراکتر\n\n",
-		config.ChannelTitle, channelStatus, adminStatus,
-		config.ScheduleTime, config.PostsPerBatch, len(config.Prompt),
-	)
+// handleChannelAdd درخواست آیدی کانال جدید تا سقف پلن کاربر
+func handleChannelAdd(c telebot.Context, db *sql.DB) error {
+	userID := c.Sender().ID
 
-	if !isAdmin {
-		message += "⚠️ برای فعال‌سازی، ربات را در کانال ادمین کنید."
+	user, err := models.GetUserByTelegramID(db, userID)
+	if err != nil {
+		log.Printf("خطا در دریافت کاربر %d: %v", userID, err)
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ خطا، دوباره تلاش کنید"})
+	}
+	channels, err := models.ListOwnedChannels(db, userID)
+	if err != nil {
+		log.Printf("خطا در دریافت کانال‌های کاربر %d: %v", userID, err)
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ خطا، دوباره تلاش کنید"})
+	}
+	if limit := models.ChannelLimitForUser(user); len(channels) >= limit {
+		return c.Respond(&telebot.CallbackResponse{
+			Text:      fmt.Sprintf("❌ %s (%d کانال)", models.ErrChannelLimitReached.Error(), limit),
+			ShowAlert: true,
+		})
 	}
 
-	return c.Send(message)
+	if err := utils.State.SetState(context.Background(), userID, channelStateID, channelStateTTL); err != nil {
+		log.Printf("خطا در ذخیره وضعیت کاربر: %v", err)
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ خطا، دوباره تلاش کنید"})
+	}
+	c.Respond()
+	return c.Send("لطفاً آیدی کانال خود را وارد کنید:\n\n" +
+		"فرمت: @channel_username\n" +
+		"یا: https://t.me/channel_username\n\n" +
+		"⚠️ توجه: ابتدا ربات را در کانال ادمین کنید")
 }
 
-// ذخیره زمان انتشار
-func saveScheduleTime(c telebot.Context, db *sql.DB, userID int64, scheduleTime string) error {
-	err := updateChannelSchedule(db, userID, scheduleTime)
+// askChannelInput پرسیدن ورودی متنی برای یک کانال
+func askChannelInput(c telebot.Context, statePrefix string, ch *models.ChannelConfig, prompt string) error {
+	err := utils.State.SetState(context.Background(), c.Sender().ID, statePrefix+strconv.Itoa(ch.ID), channelStateTTL)
 	if err != nil {
-		return c.Send("❌ خطا در ذخیره زمان انتشار")
+		log.Printf("خطا در ذخیره وضعیت کاربر: %v", err)
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ خطا، دوباره تلاش کنید"})
 	}
-
-	return c.Send(fmt.Sprintf("✅ زمان انتشار به «%s» تنظیم شد.", scheduleTime))
+	c.Respond()
+	return c.Send(prompt)
 }
 
-// ذخیره تعداد پست
-func savePostsPerBatch(c telebot.Context, db *sql.DB, userID int64, posts int) error {
-	err := updateChannelPosts(db, userID, posts)
-	if err != nil {
-		return c.Send("❌ خطا در ذخیره تعداد پست")
+// channelStateName نمایش وضعیت انتشار کانال
+func channelStateName(ch *models.ChannelConfig) string {
+	if ch.IsActive {
+		return "🟢 فعال"
 	}
+	return "🔴 غیرفعال"
+}
 
-	return c.Send(fmt.Sprintf("✅ تعداد پست به «%d» تنظیم شد.", posts))
+// replyChannelError پیام خطای ذخیره تنظیمات کانال (برای دکمه‌ها به شکل اعلان)
+func replyChannelError(c telebot.Context, err error, fallback string) error {
+	msg := fallback
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		msg = "❌ کانال یافت نشد."
+	case errors.Is(err, models.ErrInvalidScheduleTime), errors.Is(err, models.ErrInvalidPostsPerBatch),
+		errors.Is(err, models.ErrChannelTaken), errors.Is(err, models.ErrChannelLimitReached),
+		errors.Is(err, models.ErrInvalidSchedule), errors.Is(err, models.ErrInvalidCron),
+		errors.Is(err, models.ErrInvalidTimezone), errors.Is(err, models.ErrTooManySlots),
+		errors.Is(err, models.ErrScheduleTooFrequent), errors.Is(err, models.ErrNoWeekdays):
+		msg = "❌ " + err.Error()
+	default:
+		log.Printf("خطا در ذخیره تنظیمات کانال کاربر %d: %v", c.Sender().ID, err)
+	}
+	if c.Callback() != nil {
+		return c.Respond(&telebot.CallbackResponse{Text: msg, ShowAlert: true})
+	}
+	return c.Send(msg)
 }
 
-// پردازش پیام‌های متنی برای تنظیمات کانال
-func HandleChannelText(c telebot.Context, db *sql.DB) error {
-	text := c.Text()
+// HandleChannelText پردازش ورودی متنی تنظیمات کانال
+func HandleChannelText(c telebot.Context, db *sql.DB, state string) error {
+	text := strings.TrimSpace(c.Text())
 	userID := c.Sender().ID
+	utils.State.ClearState(context.Background(), userID)
 
-	// بررسی اینکه کاربر در حال تنظیم کانال است
-	if strings.HasPrefix(text, "@") || strings.Contains(text, "t.me/") {
+	if state == channelStateID {
 		return processChannelID(c, db, userID, text)
 	}
 
-	// بررسی زمان دلخواه
-	if strings.Contains(text, ":") && len(text) == 5 {
-		_, err := time.Parse("15:04", text)
-		if err == nil {
-			return saveScheduleTime(c, db, userID, text)
-		}
+	// جدا کردن نوع تنظیم و آیدی کانال از وضعیت
+	idx := strings.LastIndex(state, ":")
+	id, err := strconv.Atoi(state[idx+1:])
+	if err != nil {
+		return nil
 	}
 
-	// اگر متن طولانی است، احتمالاً پرامپت کانال است
-	if len(text) > 20 {
-		return processChannelPrompt(c, db, userID, text)
+	switch state[:idx+1] {
+	case channelStateTime, channelStateTZ:
+		return handleChannelScheduleText(c, db, state[:idx+1], id, text)
+
+	case channelStatePrompt:
+		if text == "" || len([]rune(text)) > channelPromptMaxLength {
+			return c.Send(fmt.Sprintf("❌ پرامپت کانال باید بین ۱ تا %d کاراکتر باشد.", channelPromptMaxLength))
+		}
+		if err := models.UpdateChannelPrompt(db, userID, id, text); err != nil {
+			return replyChannelError(c, err, "❌ خطا در ذخیره پرامپت")
+		}
+		return c.Send("✅ پرامپت کانال با موفقیت ذخیره شد. /channel")
+
+	case channelStateDraft:
+		return handleDraftText(c, db, int64(id), text)
 	}
 
 	return c.Send("❌ دستور نامعتبر. لطفاً از منو استفاده کنید.")
@@ -356,52 +552,46 @@ func processChannelID(c telebot.Context, db *sql.DB, userID int64, channelInput
 		channelTitle = channelID
 	}
 
-	// ذخیره تنظیمات کانال
-	err = saveChannelConfig(db, userID, channelID, channelTitle)
+	user, err := models.GetUserByTelegramID(db, userID)
 	if err != nil {
-		return c.Send("❌ خطا در ذخیره تنظیمات کانال")
+		log.Printf("خطا در دریافت کاربر %d: %v", userID, err)
+		return c.Send("❌ خطا در دریافت اطلاعات کاربر.")
 	}
 
-	return c.Send(fmt.Sprintf(
-		"✅ کانال «%s» با موفقیت تنظیم شد.\n\n"+
-			"حالا می‌توانید:\n"+
-			"• پرامپت مخصوص کانال را تنظیم کنید\n"+
-			"• زمان انتشار را مشخص کنید\n"+
-			"• کانال را فعال کنید",
-		channelTitle,
-	))
-}
-
-// پردازش پرامپت کانال
-func processChannelPrompt(c telebot.Context, db *sql.DB, userID int64, prompt string) error {
-	err := updateChannelPrompt(db, userID, prompt)
+	// ثبت کانال تا سقف پلن کاربر
+	ch, err := models.AddChannel(db, userID, channelID, channelTitle, models.ChannelLimitForUser(user))
 	if err != nil {
-		return c.Send("❌ خطا در ذخیره پرامپت")
+		return replyChannelError(c, err, "❌ خطا در ذخیره تنظیمات کانال")
 	}
 
-	return c.Send("✅ پرامپت کانال با موفقیت ذخیره شد.\n\nاکنون می‌توانید کانال را فعال کنید.")
+	c.Send(fmt.Sprintf(
+		"✅ کانال «%s» با موفقیت ثبت شد.\n\n"+
+			"حالا می‌توانید پرامپت و زمان‌بندی انتشار را تنظیم و کانال را فعال کنید.",
+		channelTitle,
+	))
+	return showChannelDetails(c, db, ch, false)
 }
 
 // استخراج آیدی کانال از متن ورودی
 func extractChannelID(input string) string {
 	input = strings.TrimSpace(input)
-	
+
 	// اگر با @ شروع شده
 	if strings.HasPrefix(input, "@") {
 		return input
 	}
-	
+
 	// اگر لینک است
 	if strings.Contains(input, "t.me/") {
 		parts := strings.Split(input, "t.me/")
 		if len(parts) > 1 {
 			channel := strings.Trim(parts[1], "/")
-			if !strings.Contains(channel, "/") {
+			if channel != "" && !strings.Contains(channel, "/") {
 				return "@" + channel
 			}
 		}
 	}
-	
+
 	return ""
 }
 
@@ -428,42 +618,3 @@ func getChannelTitle(bot *telebot.Bot, channelID string) (string, error) {
 	}
 	return chat.Title, nil
 }
-
-// توابع دیتابیس برای مدیریت کانال‌ها
-func getChannelConfig(db *sql.DB, userID int64) (*ChannelConfig, error) {
-	// این تابع بعداً با جدول کانال‌ها تکمیل می‌شود
-	return nil, nil
-}
-
-func saveChannelConfig(db *sql.DB, userID int64, channelID, channelTitle string) error {
-	// این تابع بعداً با جدول کانال‌ها تکمیل می‌شود
-	return nil
-}
-
-func updateChannelPrompt(db *sql.DB, userID int64, prompt string) error {
-	// این تابع بعداً با جدول کانال‌ها تکمیل می‌شود
-	return nil
-}
-
-func updateChannelSchedule(db *sql.DB, userID int64, scheduleTime string) error {
-	// این تابع بعداً با جدول کانال‌ها تکمیل می‌شود
-	return nil
-}
-
-func updateChannelPosts(db *sql.DB, userID int64, posts int) error {
-	// این تابع بعداً با جدول کانال‌ها تکمیل می‌شود
-	return nil
-}
-
-func updateChannelStatus(db *sql.DB, userID int64, isActive bool) error {
-	// این تابع بعداً با جدول کانال‌ها تکمیل می‌شود
-	return nil
-}
-
-// تولید و انتشار محتوا در کانال
-func GenerateAndPostChannelContent(bot *telebot.Bot, db *sql.DB) {
-	// این تابع توسط scheduler فراخوانی می‌شود
-	// دریافت تمام کانال‌های فعال
-	// تولید محتوا برای هر کانال
-	// انتشار در کانال‌ها
-}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+
+	"gopkg.in/telebot.v3"
+
+	"telegram-bot-manager/models"
+	"telegram-bot-manager/services"
+	"telegram-bot-manager/utils"
+)
+
+// registerChannelDraftHandlers ثبت دکمه‌های صف تأیید پیش‌نویس‌ها و انتشار مستقیم کانال
+func registerChannelDraftHandlers(bot *telebot.Bot, db *sql.DB, vip telebot.MiddlewareFunc) {
+	bot.Handle(&telebot.Btn{Unique: "draft_approve"}, func(c telebot.Context) error {
+		return withOwnedDraft(c, db, func(d *models.ChannelDraft) error {
+			return setDraftStatus(c, db, d, models.DraftApproved, "✅ در نوبت بعدی منتشر می‌شود")
+		})
+	}, vip)
+
+	bot.Handle(&telebot.Btn{Unique: "draft_discard"}, func(c telebot.Context) error {
+		return withOwnedDraft(c, db, func(d *models.ChannelDraft) error {
+			return setDraftStatus(c, db, d, models.DraftDiscarded, "🗑 پیش‌نویس حذف شد")
+		})
+	}, vip)
+
+	bot.Handle(&telebot.Btn{Unique: "draft_regen"}, func(c telebot.Context) error {
+		return withOwnedDraft(c, db, func(d *models.ChannelDraft) error {
+			return regenerateDraft(c, db, d)
+		})
+	}, vip)
+
+	bot.Handle(&telebot.Btn{Unique: "draft_edit"}, func(c telebot.Context) error {
+		return withOwnedDraft(c, db, func(d *models.ChannelDraft) error {
+			state := channelStateDraft + strconv.FormatInt(d.ID, 10)
+			if err := utils.State.SetState(context.Background(), c.Sender().ID, state, channelStateTTL); err != nil {
+				log.Printf("خطا در ذخیره وضعیت کاربر: %v", err)
+				return c.Respond(&telebot.CallbackResponse{Text: "❌ خطا، دوباره تلاش کنید"})
+			}
+			c.Respond()
+			return c.Send(fmt.Sprintf("✏️ متن جدید پیش‌نویس #%d را بفرستید (حداکثر %d کاراکتر):", d.ID, channelDraftMaxLength))
+		})
+	}, vip)
+
+	bot.Handle(&telebot.Btn{Unique: "channel_auto"}, func(c telebot.Context) error {
+		return withOwnedChannel(c, db, func(ch *models.ChannelConfig) error {
+			if err := models.UpdateChannelAutoPublish(db, ch.OwnerID, ch.ID, !ch.AutoPublish); err != nil {
+				return replyChannelError(c, err, "❌ خطا در تغییر حالت انتشار")
+			}
+			ch.AutoPublish = !ch.AutoPublish
+			msg := "📥 پست‌ها پیش از انتشار برای تأیید شما فرستاده می‌شوند"
+			if ch.AutoPublish {
+				msg = "🤖 پست‌ها بدون تأیید منتشر می‌شوند"
+			}
+			c.Respond(&telebot.CallbackResponse{Text: msg})
+			return showChannelDetails(c, db, ch, true)
+		})
+	}, vip)
+
+	bot.Handle(&telebot.Btn{Unique: "channel_drafts"}, func(c telebot.Context) error {
+		return withOwnedChannel(c, db, func(ch *models.ChannelConfig) error {
+			drafts, err := models.ListPendingDrafts(db, ch.ID)
+			if err != nil {
+				log.Printf("خطا در دریافت پیش‌نویس‌های کانال %d: %v", ch.ID, err)
+				return c.Respond(&telebot.CallbackResponse{Text: "❌ خطا در دریافت پیش‌نویس‌ها"})
+			}
+			if len(drafts) == 0 {
+				return c.Respond(&telebot.CallbackResponse{Text: "📭 پیش‌نویسی در انتظار بررسی نیست", ShowAlert: true})
+			}
+			c.Respond()
+			for i := range drafts {
+				text, menu := services.DraftReviewMessage(&drafts[i])
+				if err := c.Send(text, menu); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}, vip)
+}
+
+// withOwnedDraft اجرای fn برای پیش‌نویسی از کانال‌های کاربر که آیدی آن در داده دکمه آمده است
+func withOwnedDraft(c telebot.Context, db *sql.DB, fn func(d *models.ChannelDraft) error) error {
+	args := c.Args()
+	if len(args) == 0 {
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ داده نامعتبر"})
+	}
+	id, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ داده نامعتبر"})
+	}
+	d, err := models.GetOwnedDraft(db, c.Sender().ID, id)
+	if err != nil || d == nil {
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ پیش‌نویس یافت نشد"})
+	}
+	return fn(d)
+}
+
+// setDraftStatus تغییر وضعیت پیش‌نویس و به‌روزرسانی پیام بررسی آن
+func setDraftStatus(c telebot.Context, db *sql.DB, d *models.ChannelDraft, status, done string) error {
+	if err := models.SetDraftStatus(db, c.Sender().ID, d.ID, status); err != nil {
+		return replyDraftError(c, db, d, err)
+	}
+	d.Status = status
+	c.Respond(&telebot.CallbackResponse{Text: done})
+	text, menu := services.DraftReviewMessage(d)
+	return c.Edit(text, menu)
+}
+
+// regenerateDraft تولید دوباره متن پیش‌نویس با پرامپت فعلی کانال
+func regenerateDraft(c telebot.Context, db *sql.DB, d *models.ChannelDraft) error {
+	if d.Status != models.DraftPending {
+		return c.Respond(&telebot.CallbackResponse{Text: "ℹ️ فقط پیش‌نویس‌های در انتظار بررسی دوباره تولید می‌شوند", ShowAlert: true})
+	}
+	ch, err := models.GetOwnedChannel(db, c.Sender().ID, d.ChannelID)
+	if err != nil || ch == nil {
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ کانال یافت نشد"})
+	}
+
+	c.Respond(&telebot.CallbackResponse{Text: "⏳ در حال تولید دوباره..."})
+	content, err := services.GenerateChannelPost(db, ch.OwnerID, ch.Prompt)
+	if err != nil {
+		if !errors.Is(err, services.ErrNoChannelKeys) && !errors.Is(err, services.ErrChannelQuotaExceeded) {
+			log.Printf("خطا در تولید دوباره پیش‌نویس %d: %v", d.ID, err)
+		}
+		return c.Send("❌ خطا در تولید دوباره پیش‌نویس: " + err.Error())
+	}
+	if err := models.UpdateDraftContent(db, ch.OwnerID, d.ID, content); err != nil {
+		return replyDraftError(c, db, d, err)
+	}
+
+	d.Content = content
+	text, menu := services.DraftReviewMessage(d)
+	return c.Edit(text, menu)
+}
+
+// handleDraftText ذخیره متن ویرایش‌شده پیش‌نویس
+func handleDraftText(c telebot.Context, db *sql.DB, id int64, text string) error {
+	if text == "" || len([]rune(text)) > channelDraftMaxLength {
+		return c.Send(fmt.Sprintf("❌ متن پیش‌نویس باید بین ۱ تا %d کاراکتر باشد.", channelDraftMaxLength))
+	}
+	userID := c.Sender().ID
+	if err := models.UpdateDraftContent(db, userID, id, text); err != nil {
+		return replyDraftError(c, db, nil, err)
+	}
+
+	d, err := models.GetOwnedDraft(db, userID, id)
+	if err != nil || d == nil {
+		return c.Send("✅ پیش‌نویس ذخیره شد.")
+	}
+	msg, menu := services.DraftReviewMessage(d)
+	return c.Send(msg, menu)
+}
+
+// replyDraftError پیام خطای تغییر پیش‌نویس؛ پیش‌نویس منتشر یا حذف‌شده دیگر قابل تغییر نیست
+func replyDraftError(c telebot.Context, db *sql.DB, d *models.ChannelDraft, err error) error {
+	msg := "❌ خطا در ذخیره پیش‌نویس"
+	if errors.Is(err, sql.ErrNoRows) {
+		msg = "ℹ️ این پیش‌نویس منتشر یا حذف شده است"
+	} else {
+		log.Printf("خطا در ذخیره پیش‌نویس کاربر %d: %v", c.Sender().ID, err)
+	}
+	if c.Callback() == nil {
+		return c.Send(msg)
+	}
+	c.Respond(&telebot.CallbackResponse{Text: msg, ShowAlert: true})
+	// به‌روزرسانی پیام بررسی با وضعیت فعلی پیش‌نویس
+	if d != nil {
+		if cur, err := models.GetOwnedDraft(db, c.Sender().ID, d.ID); err == nil && cur != nil {
+			text, menu := services.DraftReviewMessage(cur)
+			return c.Edit(text, menu)
+		}
+	}
+	return nil
+}
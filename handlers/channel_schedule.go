@@ -0,0 +1,302 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/telebot.v3"
+
+	"telegram-bot-manager/models"
+	"telegram-bot-manager/utils"
+)
+
+// زمان‌های پیشنهادی انتشار
+var channelTimePresets = []string{"09:00", "12:00", "18:00", "21:00"}
+
+// نام روزهای هفته به ترتیب time.Weekday و ترتیب نمایش از شنبه
+var (
+	weekdayNames = [7]string{"یکشنبه", "دوشنبه", "سه‌شنبه", "چهارشنبه", "پنجشنبه", "جمعه", "شنبه"}
+	weekdayOrder = []int{6, 0, 1, 2, 3, 4, 5}
+)
+
+// الگوی فاصله ثابت، مثل «هر 3 ساعت» یا «every 90m»
+var channelIntervalPattern = regexp.MustCompile(`^(?:هر|every)\s*(\d+)\s*(ساعت|دقیقه|h|hours?|m|min|minutes?)$`)
+
+// registerChannelScheduleHandlers ثبت دکمه‌های زمان‌بندی انتشار کانال
+func registerChannelScheduleHandlers(bot *telebot.Bot, db *sql.DB, vip telebot.MiddlewareFunc) {
+	bot.Handle(&telebot.Btn{Unique: "channel_time"}, func(c telebot.Context) error {
+		return withOwnedChannel(c, db, func(ch *models.ChannelConfig) error {
+			slot := c.Args()[len(c.Args())-1]
+			s := ch.Schedule
+			s.Kind, s.Slots, s.Interval, s.Cron = models.ScheduleDaily, []string{slot}, 0, ""
+			return saveChannelSchedule(c, db, ch, s, "✅ انتشار روزانه در "+slot+" تنظیم شد")
+		})
+	}, vip)
+
+	bot.Handle(&telebot.Btn{Unique: "channel_ctime"}, func(c telebot.Context) error {
+		return withOwnedChannel(c, db, func(ch *models.ChannelConfig) error {
+			return askChannelInput(c, channelStateTime, ch, fmt.Sprintf(
+				"⏰ زمان‌بندی دلخواه را بفرستید (منطقه زمانی: %s):\n\n"+
+					"• یک یا چند ساعت در روز: 09:00 14:30 21:00 (حداکثر %d نوبت)\n"+
+					"• فاصله ثابت از نیمه‌شب: هر 3 ساعت یا هر 90 دقیقه\n"+
+					"• عبارت cron: cron 0 9 * * 1-5\n\n"+
+					"فاصله دو انتشار باید حداقل %d دقیقه باشد.",
+				ch.Schedule.Timezone, models.ChannelSlotsMax, models.ChannelIntervalMin))
+		})
+	}, vip)
+
+	bot.Handle(&telebot.Btn{Unique: "channel_days"}, func(c telebot.Context) error {
+		return withOwnedChannel(c, db, func(ch *models.ChannelConfig) error {
+			if ch.Schedule.Kind == models.ScheduleCron {
+				return c.Respond(&telebot.CallbackResponse{Text: "ℹ️ روزهای اجرای cron در خود عبارت تعیین می‌شوند", ShowAlert: true})
+			}
+			c.Respond()
+			return showChannelWeekdays(c, ch)
+		})
+	}, vip)
+
+	bot.Handle(&telebot.Btn{Unique: "channel_day"}, func(c telebot.Context) error {
+		return withOwnedChannel(c, db, func(ch *models.ChannelConfig) error {
+			day, err := strconv.Atoi(c.Args()[len(c.Args())-1])
+			if err != nil || day < 0 || day > 6 {
+				return c.Respond(&telebot.CallbackResponse{Text: "❌ داده نامعتبر"})
+			}
+			s := ch.Schedule
+			s.Weekdays = toggleWeekday(s.Weekdays, day)
+			if len(s.Weekdays) == 0 {
+				return c.Respond(&telebot.CallbackResponse{Text: "❌ " + models.ErrNoWeekdays.Error(), ShowAlert: true})
+			}
+			if err := models.UpdateChannelSchedule(db, ch.OwnerID, ch.ID, s); err != nil {
+				return replyChannelError(c, err, "❌ خطا در ذخیره روزهای انتشار")
+			}
+			ch.Schedule = s
+			c.Respond()
+			return showChannelWeekdays(c, ch)
+		})
+	}, vip)
+
+	bot.Handle(&telebot.Btn{Unique: "channel_tz"}, func(c telebot.Context) error {
+		return withOwnedChannel(c, db, func(ch *models.ChannelConfig) error {
+			return askChannelInput(c, channelStateTZ, ch, fmt.Sprintf(
+				"🌐 منطقه زمانی کانال را بفرستید، مثلاً Asia/Tehran یا Europe/Berlin.\nمنطقه فعلی: %s",
+				ch.Schedule.Timezone))
+		})
+	}, vip)
+}
+
+// showChannelSchedule نمایش زمان‌بندی کانال و زمان‌های پیشنهادی
+func showChannelSchedule(c telebot.Context, ch *models.ChannelConfig) error {
+	id := strconv.Itoa(ch.ID)
+	menu := &telebot.ReplyMarkup{}
+	var buttons []telebot.Btn
+	for _, t := range channelTimePresets {
+		buttons = append(buttons, menu.Data("⏰ "+t, "channel_time", id, t))
+	}
+	menu.Inline(
+		menu.Row(buttons[:2]...),
+		menu.Row(buttons[2:]...),
+		menu.Row(menu.Data("✏️ زمان‌بندی دلخواه", "channel_ctime", id)),
+		menu.Row(menu.Data("📅 روزهای هفته", "channel_days", id), menu.Data("🌐 منطقه زمانی", "channel_tz", id)),
+		menu.Row(menu.Data("🔙 بازگشت", "channel_open", id)),
+	)
+	return c.Edit(fmt.Sprintf(
+		"⏰ زمان‌بندی انتشار «%s»\n\n"+
+			"فعلی: %s\n"+
+			"🌐 منطقه زمانی: %s\n\n"+
+			"یکی از ساعت‌های پیشنهادی را انتخاب کنید یا زمان‌بندی دلخواه (چند نوبت، فاصله ثابت یا cron) بفرستید.",
+		ch.ChannelTitle, channelScheduleLabel(ch.Schedule), ch.Schedule.Timezone), menu)
+}
+
+// showChannelWeekdays نمایش روزهای انتشار با امکان روشن و خاموش کردن هر روز
+func showChannelWeekdays(c telebot.Context, ch *models.ChannelConfig) error {
+	id := strconv.Itoa(ch.ID)
+	menu := &telebot.ReplyMarkup{}
+	var rows []telebot.Row
+	var row []telebot.Btn
+	for _, d := range weekdayOrder {
+		mark := "▫️ "
+		if ch.Schedule.OnWeekday(time.Weekday(d)) {
+			mark = "✅ "
+		}
+		row = append(row, menu.Data(mark+weekdayNames[d], "channel_day", id, strconv.Itoa(d)))
+		if len(row) == 3 {
+			rows = append(rows, menu.Row(row...))
+			row = nil
+		}
+	}
+	if len(row) > 0 {
+		rows = append(rows, menu.Row(row...))
+	}
+	rows = append(rows, menu.Row(menu.Data("🔙 بازگشت", "channel_times", id)))
+	menu.Inline(rows...)
+
+	return c.Edit(fmt.Sprintf("📅 روزهای انتشار «%s»\nزمان‌بندی: %s", ch.ChannelTitle, channelScheduleLabel(ch.Schedule)), menu)
+}
+
+// saveChannelSchedule ذخیره زمان‌بندی از دکمه‌ها و نمایش دوباره منوی زمان‌بندی
+func saveChannelSchedule(c telebot.Context, db *sql.DB, ch *models.ChannelConfig, s models.ChannelSchedule, success string) error {
+	if err := models.UpdateChannelSchedule(db, ch.OwnerID, ch.ID, s); err != nil {
+		return replyChannelError(c, err, "❌ خطا در ذخیره زمان‌بندی")
+	}
+	ch.Schedule = s
+	c.Respond(&telebot.CallbackResponse{Text: success})
+	return showChannelSchedule(c, ch)
+}
+
+// handleChannelScheduleText پردازش زمان‌بندی دلخواه یا منطقه زمانی ارسالی کاربر
+func handleChannelScheduleText(c telebot.Context, db *sql.DB, prefix string, id int, text string) error {
+	ch, err := models.GetOwnedChannel(db, c.Sender().ID, id)
+	if err != nil {
+		log.Printf("خطا در دریافت کانال %d: %v", id, err)
+		return c.Send("❌ خطا در دریافت تنظیمات کانال.")
+	}
+	if ch == nil {
+		return c.Send("❌ کانال یافت نشد.")
+	}
+
+	s := ch.Schedule
+	if prefix == channelStateTZ {
+		s.Timezone = text
+	} else if s, err = parseChannelSchedule(text, s); err != nil {
+		return c.Send(err.Error())
+	}
+	if err := models.UpdateChannelSchedule(db, ch.OwnerID, ch.ID, s); err != nil {
+		return replyChannelError(c, err, "❌ خطا در ذخیره زمان‌بندی")
+	}
+
+	msg := fmt.Sprintf("✅ زمان‌بندی ذخیره شد: %s\n🌐 منطقه زمانی: %s", channelScheduleLabel(s), s.Timezone)
+	if next, err := s.Next(time.Now()); err == nil && !next.IsZero() {
+		ch.Schedule = s
+		msg += "\n⏭️ نوبت بعدی: " + channelLocalTime(ch, next)
+	}
+	return c.Send(msg + " /channel")
+}
+
+// parseChannelSchedule تبدیل ورودی کاربر به زمان‌بندی (منطقه زمانی و روزهای هفته از base حفظ می‌شوند)
+func parseChannelSchedule(text string, base models.ChannelSchedule) (models.ChannelSchedule, error) {
+	text = strings.TrimSpace(utils.NormalizeDigits(text))
+	lower := strings.ToLower(text)
+	s := base
+	s.Slots, s.Interval, s.Cron = nil, 0, ""
+
+	switch {
+	case strings.HasPrefix(lower, "cron "):
+		s.Kind = models.ScheduleCron
+		s.Cron = strings.TrimSpace(text[len("cron "):])
+		s.Weekdays = nil
+		return s, nil
+
+	case strings.HasPrefix(lower, "@"):
+		s.Kind = models.ScheduleCron
+		s.Cron = lower
+		s.Weekdays = nil
+		return s, nil
+	}
+
+	if m := channelIntervalPattern.FindStringSubmatch(lower); m != nil {
+		n, err := strconv.Atoi(m[1])
+		if err != nil || n < 1 {
+			return s, errors.New("❌ فاصله انتشار نامعتبر است.")
+		}
+		if m[2] == "ساعت" || strings.HasPrefix(m[2], "h") {
+			n *= 60
+		}
+		s.Kind = models.ScheduleInterval
+		s.Interval = n
+		return s, nil
+	}
+
+	fields := strings.FieldsFunc(text, func(r rune) bool {
+		return r == ' ' || r == ',' || r == '،' || r == '\n'
+	})
+	seen := make(map[string]bool)
+	for _, f := range fields {
+		t, err := time.Parse("15:04", f)
+		if err != nil {
+			return s, fmt.Errorf("❌ «%s» زمان معتبری نیست. فرمت درست: HH:MM (مثال: 08:30)", f)
+		}
+		slot := t.Format("15:04")
+		if !seen[slot] {
+			seen[slot] = true
+			s.Slots = append(s.Slots, slot)
+		}
+	}
+	if len(s.Slots) == 0 {
+		return s, errors.New("❌ هیچ زمانی وارد نشده است.")
+	}
+	sort.Strings(s.Slots)
+	s.Kind = models.ScheduleDaily
+	return s, nil
+}
+
+// toggleWeekday روشن یا خاموش کردن یک روز؛ فهرست خالی یعنی همه روزها و همه روزها دوباره خالی ذخیره می‌شود
+func toggleWeekday(weekdays []int, day int) []int {
+	on := make(map[int]bool)
+	if len(weekdays) == 0 {
+		for d := 0; d < 7; d++ {
+			on[d] = true
+		}
+	}
+	for _, d := range weekdays {
+		on[d] = true
+	}
+	on[day] = !on[day]
+
+	var result []int
+	for d := 0; d < 7; d++ {
+		if on[d] {
+			result = append(result, d)
+		}
+	}
+	if len(result) == 7 {
+		return nil
+	}
+	return result
+}
+
+// channelScheduleLabel نمایش خلاصه زمان‌بندی (در نبود آن «تنظیم نشده»)
+func channelScheduleLabel(s models.ChannelSchedule) string {
+	if s.IsZero() {
+		return "تنظیم نشده"
+	}
+
+	var label string
+	switch s.Kind {
+	case models.ScheduleCron:
+		return "cron " + s.Cron
+	case models.ScheduleInterval:
+		if s.Interval%60 == 0 {
+			label = fmt.Sprintf("هر %d ساعت", s.Interval/60)
+		} else {
+			label = fmt.Sprintf("هر %d دقیقه", s.Interval)
+		}
+	default:
+		label = strings.Join(s.Slots, "، ")
+	}
+
+	if len(s.Weekdays) == 0 {
+		return label + " (هر روز)"
+	}
+	var days []string
+	for _, d := range weekdayOrder {
+		if s.OnWeekday(time.Weekday(d)) {
+			days = append(days, weekdayNames[d])
+		}
+	}
+	return label + " (" + strings.Join(days, "، ") + ")"
+}
+
+// channelLocalTime نمایش زمان در منطقه زمانی کانال
+func channelLocalTime(ch *models.ChannelConfig, t time.Time) string {
+	if loc, err := ch.Schedule.Location(); err == nil {
+		t = t.In(loc)
+	}
+	return t.Format("2006-01-02 15:04")
+}
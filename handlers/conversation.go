@@ -0,0 +1,269 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"gopkg.in/telebot.v3"
+	"telegram-bot-manager/database"
+	"telegram-bot-manager/models"
+	"telegram-bot-manager/services"
+)
+
+const (
+	// حداکثر پیام نگه‌داشته‌شده از هر رشته در کش و بارگذاری از دیتابیس
+	conversationHistoryLimit = 50
+	// تعداد رشته در هر صفحه /history
+	conversationsPerPage = 5
+	// تعداد پیام‌های نمایش داده‌شده از یک رشته قدیمی
+	conversationPreviewMessages = 6
+	// حداکثر طول عنوان رشته (از اولین پیام کاربر)
+	conversationTitleLength = 60
+)
+
+// RegisterConversationHandlers ثبت دستورات رشته‌های گفتگو
+func RegisterConversationHandlers(bot *telebot.Bot, db *sql.DB) {
+	bot.Handle("/new", func(c telebot.Context) error {
+		return handleNewConversation(c, db)
+	})
+
+	bot.Handle("/history", func(c telebot.Context) error {
+		return showConversationHistory(c, db, 0, false)
+	})
+
+	bot.Handle(&telebot.Btn{Unique: "conv_page"}, func(c telebot.Context) error {
+		page, _ := strconv.Atoi(c.Data())
+		c.Respond()
+		return showConversationHistory(c, db, page, true)
+	})
+
+	bot.Handle(&telebot.Btn{Unique: "conv_open"}, func(c telebot.Context) error {
+		return handleOpenConversation(c, db)
+	})
+
+	bot.Handle(&telebot.Btn{Unique: "conv_resume"}, func(c telebot.Context) error {
+		return handleResumeConversation(c, db)
+	})
+}
+
+// /new - شروع رشته گفتگوی جدید
+func handleNewConversation(c telebot.Context, db *sql.DB) error {
+	if c.Chat().Type != telebot.ChatPrivate {
+		return nil
+	}
+
+	if err := models.CloseActiveConversation(db, c.Sender().ID); err != nil {
+		log.Printf("خطا در بستن رشته گفتگو: %v", err)
+		return c.Send("❌ خطا در شروع گفتگوی جدید.")
+	}
+
+	return c.Send("🆕 گفتگوی جدید شروع شد. پیام بعدی شما بدون سابقه گفتگوی قبلی ارسال می‌شود.\n📜 گفتگوهای قبلی: /history")
+}
+
+// /history - لیست رشته‌های قبلی کاربر
+func showConversationHistory(c telebot.Context, db *sql.DB, page int, edit bool) error {
+	userID := c.Sender().ID
+
+	total, err := models.CountConversations(db, userID)
+	if err != nil {
+		log.Printf("خطا در شمارش گفتگوها: %v", err)
+		return c.Send("❌ خطا در دریافت تاریخچه گفتگوها.")
+	}
+	if total == 0 {
+		return c.Send("📭 هنوز گفتگویی ثبت نشده است.")
+	}
+
+	pages := (total + conversationsPerPage - 1) / conversationsPerPage
+	if page < 0 || page >= pages {
+		page = 0
+	}
+
+	conversations, err := models.ListConversations(db, userID, conversationsPerPage, page*conversationsPerPage)
+	if err != nil {
+		log.Printf("خطا در دریافت گفتگوها: %v", err)
+		return c.Send("❌ خطا در دریافت تاریخچه گفتگوها.")
+	}
+
+	menu := &telebot.ReplyMarkup{}
+	var rows []telebot.Row
+	for _, conv := range conversations {
+		label := fmt.Sprintf("💬 %s (%d پیام)", conversationTitle(conv), conv.MessageCount)
+		if conv.IsActive {
+			label = "🟢 " + label
+		}
+		rows = append(rows, menu.Row(menu.Data(label, "conv_open", strconv.Itoa(conv.ID))))
+	}
+
+	var nav []telebot.Btn
+	if page > 0 {
+		nav = append(nav, menu.Data("⬅️ قبلی", "conv_page", strconv.Itoa(page-1)))
+	}
+	if page < pages-1 {
+		nav = append(nav, menu.Data("بعدی ➡️", "conv_page", strconv.Itoa(page+1)))
+	}
+	if len(nav) > 0 {
+		rows = append(rows, menu.Row(nav...))
+	}
+	menu.Inline(rows...)
+
+	text := fmt.Sprintf("📜 گفتگوهای شما (صفحه %d از %d)\n🟢 گفتگوی فعال\n\n🆕 شروع گفتگوی جدید: /new", page+1, pages)
+	if edit {
+		return c.Edit(text, menu)
+	}
+	return c.Send(text, menu)
+}
+
+// callback نمایش آخرین پیام‌های یک رشته
+func handleOpenConversation(c telebot.Context, db *sql.DB) error {
+	id, err := strconv.Atoi(c.Data())
+	if err != nil {
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ داده نامعتبر"})
+	}
+
+	conv, err := models.GetConversation(db, c.Sender().ID, id)
+	if err != nil || conv == nil {
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ گفتگو یافت نشد", ShowAlert: true})
+	}
+
+	messages, err := models.GetConversationMessages(db, conv.ID, conversationPreviewMessages)
+	if err != nil {
+		log.Printf("خطا در دریافت پیام‌های گفتگو %d: %v", conv.ID, err)
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ خطا در دریافت پیام‌ها", ShowAlert: true})
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "💬 %s\n📅 %s — %d پیام\n", conversationTitle(*conv), conv.CreatedAt.Format("2006-01-02 15:04"), conv.MessageCount)
+	if conv.MessageCount > len(messages) {
+		fmt.Fprintf(&b, "(آخرین %d پیام)\n", len(messages))
+	}
+	for _, m := range messages {
+		icon := "👤"
+		if m.Role == services.RoleAssistant {
+			icon = "🤖"
+		}
+		fmt.Fprintf(&b, "\n%s %s\n", icon, truncateRunes(m.Content, 300))
+	}
+
+	menu := &telebot.ReplyMarkup{}
+	var rows []telebot.Row
+	if !conv.IsActive {
+		rows = append(rows, menu.Row(menu.Data("▶️ ادامه این گفتگو", "conv_resume", strconv.Itoa(conv.ID))))
+	}
+	rows = append(rows, menu.Row(menu.Data("🔙 بازگشت", "conv_page", "0")))
+	menu.Inline(rows...)
+
+	c.Respond()
+	return c.Edit(truncateRunes(b.String(), telegramMessageLimit), menu)
+}
+
+// callback فعال کردن دوباره یک رشته قدیمی
+func handleResumeConversation(c telebot.Context, db *sql.DB) error {
+	id, err := strconv.Atoi(c.Data())
+	if err != nil {
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ داده نامعتبر"})
+	}
+
+	if err := models.ActivateConversation(db, c.Sender().ID, id); err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("خطا در فعال‌سازی گفتگو %d: %v", id, err)
+		}
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ فعال‌سازی گفتگو ممکن نشد", ShowAlert: true})
+	}
+
+	c.Respond(&telebot.CallbackResponse{Text: "✅ گفتگو فعال شد"})
+	return c.Send("▶️ گفتگوی انتخاب‌شده فعال شد؛ پیام بعدی شما در ادامه همین گفتگو ارسال می‌شود.")
+}
+
+// conversationTitle عنوان قابل نمایش رشته
+func conversationTitle(conv models.Conversation) string {
+	if conv.Title == "" {
+		return "بدون عنوان"
+	}
+	return conv.Title
+}
+
+// activeConversation رشته فعال کاربر یا ایجاد رشته جدید با عنوان اولین پیام
+func activeConversation(db *sql.DB, userID int64, firstMessage string) (*models.Conversation, error) {
+	conv, err := models.GetActiveConversation(db, userID)
+	if err != nil || conv != nil {
+		return conv, err
+	}
+
+	title := strings.Join(strings.Fields(firstMessage), " ")
+	if len([]rune(title)) > conversationTitleLength {
+		title = truncateRunes(title, conversationTitleLength) + "…"
+	}
+	return models.CreateConversation(db, userID, title)
+}
+
+// loadConversationHistory پیام‌های رشته از کش Redis یا در صورت نبود کش از دیتابیس
+func loadConversationHistory(db *sql.DB, conversationID int) ([]services.Turn, error) {
+	cached, found, err := database.GetConversationCache(conversationID)
+	if err != nil {
+		log.Printf("خطا در خواندن کش گفتگو %d: %v", conversationID, err)
+	}
+	if found {
+		history := make([]services.Turn, 0, len(cached))
+		for _, raw := range cached {
+			var m models.ConversationMessage
+			if err := json.Unmarshal([]byte(raw), &m); err != nil {
+				continue
+			}
+			history = append(history, conversationTurn(m))
+		}
+		return history, nil
+	}
+
+	messages, err := models.GetConversationMessages(db, conversationID, conversationHistoryLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	history := make([]services.Turn, 0, len(messages))
+	encoded := make([]string, 0, len(messages))
+	for _, m := range messages {
+		history = append(history, conversationTurn(m))
+		if raw, err := json.Marshal(m); err == nil {
+			encoded = append(encoded, string(raw))
+		}
+	}
+	if err := database.SetConversationCache(conversationID, encoded, conversationHistoryLimit); err != nil {
+		log.Printf("خطا در ذخیره کش گفتگو %d: %v", conversationID, err)
+	}
+	return history, nil
+}
+
+// saveConversationTurn ذخیره پرسش و پاسخ در دیتابیس و کش
+func saveConversationTurn(db *sql.DB, conversationID int, question string, result services.ChatResult) error {
+	// توکن‌های prompt گزارش‌شده شامل تاریخچه هم هست؛ سهم پرسش جدید تخمین زده می‌شود
+	messages := []models.ConversationMessage{
+		{ConversationID: conversationID, Role: services.RoleUser, Content: question, Tokens: services.EstimateTokens(question)},
+		{ConversationID: conversationID, Role: services.RoleAssistant, Content: result.Content, Tokens: result.Usage.CompletionTokens},
+	}
+	if err := models.AddConversationMessages(db, conversationID, messages...); err != nil {
+		return err
+	}
+
+	encoded := make([]string, 0, len(messages))
+	for _, m := range messages {
+		if raw, err := json.Marshal(m); err == nil {
+			encoded = append(encoded, string(raw))
+		}
+	}
+	if err := database.AppendConversationCache(conversationID, conversationHistoryLimit, encoded...); err != nil {
+		log.Printf("خطا در بروزرسانی کش گفتگو %d: %v", conversationID, err)
+	}
+	return nil
+}
+
+// conversationTurn تبدیل پیام ذخیره‌شده به پیام تاریخچه
+func conversationTurn(m models.ConversationMessage) services.Turn {
+	return services.Turn{
+		Message: services.Message{Role: m.Role, Content: m.Content},
+		Tokens:  m.Tokens,
+	}
+}
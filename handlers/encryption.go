@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+
+	"gopkg.in/telebot.v3"
+
+	"telegram-bot-manager/models"
+	"telegram-bot-manager/utils"
+)
+
+// registerEncryptionHandlers ثبت دکمه رمزنگاری دوباره کلیدهای API در پنل مدیریت (فقط مالک)
+func registerEncryptionHandlers(bot *telebot.Bot, db *sql.DB) {
+	bot.Handle("🔐 رمزنگاری کلیدها", func(c telebot.Context) error {
+		return showEncryptionStatus(c, db)
+	}, requireAdmin(db, models.PermManageEncryption))
+
+	bot.Handle(&telebot.Btn{Unique: "keys_rewrap"}, func(c telebot.Context) error {
+		return handleRewrapKeys(c, db)
+	}, requireAdmin(db, models.PermManageEncryption))
+}
+
+// نمایش نسخه کلید اصلی فعلی و تعداد کلیدهایی که هنوز با آن رمز نشده‌اند
+func showEncryptionStatus(c telebot.Context, db *sql.DB) error {
+	pending, err := models.CountAPIKeysToRotate(db)
+	if err != nil {
+		log.Printf("خطا در شمارش کلیدهای API: %v", err)
+		return c.Send("❌ خطا در دریافت وضعیت رمزنگاری")
+	}
+
+	text := fmt.Sprintf("🔐 رمزنگاری کلیدهای API\n\n🔸 نسخه کلید اصلی فعلی: %d\n🔸 کلیدهای با نسخه قدیمی: %d",
+		utils.MasterKeys.CurrentVersion(), pending)
+	if pending == 0 {
+		return c.Send(text + "\n\n✅ همه کلیدها با کلید اصلی فعلی رمز شده‌اند.")
+	}
+
+	menu := &telebot.ReplyMarkup{}
+	menu.Inline(menu.Row(menu.Data("🔄 رمزنگاری دوباره همه کلیدها", "keys_rewrap")))
+	return c.Send(text+"\n\nپس از چرخش کلید اصلی، کلیدها را با نسخه جدید دوباره رمز کنید.", menu)
+}
+
+// رمزنگاری دوباره همه کلیدها با کلید اصلی فعلی؛ کلیدهایی که باز نشوند گزارش می‌شوند
+func handleRewrapKeys(c telebot.Context, db *sql.DB) error {
+	c.Respond(&telebot.CallbackResponse{Text: "⏳ در حال رمزنگاری دوباره..."})
+
+	res, err := models.RotateAPIKeyEncryption(db)
+	if err != nil {
+		log.Printf("خطا در رمزنگاری دوباره کلیدهای API: %v", err)
+		return c.Send("❌ خطا در رمزنگاری دوباره کلیدها؛ هیچ کلیدی تغییر نکرد.")
+	}
+
+	text := fmt.Sprintf("✅ %d کلید با کلید اصلی نسخه %d دوباره رمز شد.", res.Rewrapped, utils.MasterKeys.CurrentVersion())
+	if len(res.Failed) > 0 {
+		text += fmt.Sprintf("\n\n⚠️ %d کلید باز نشد و دست‌نخورده ماند (آیدی: %v).\n"+
+			"کلید اصلی نسخه آن‌ها را در encryption.old_keys قرار دهید و دوباره تلاش کنید.", len(res.Failed), res.Failed)
+	}
+	return c.Edit(text)
+}
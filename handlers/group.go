@@ -1,10 +1,11 @@
 package handlers
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"log"
-	"strings"
-	"time"
 
 	"gopkg.in/telebot.v3"
 
@@ -13,73 +14,134 @@ import (
 	"telegram-bot-manager/services"
 )
 
-// HandleGroupMessages مدیریت پیام‌های گروه
-func HandleGroupMessages(bot *telebot.Bot, db *sql.DB) {
-	// پردازش پیام‌هایی که با * شروع می‌شوند
-	bot.Handle(telebot.OnText, func(c telebot.Context) error {
-		// فقط در گروه‌ها پردازش کن
-		if c.Chat().Type != telebot.ChatGroup && c.Chat().Type != telebot.ChatSuperGroup {
+// handleGroupText دیسپچر پیام‌های متنی گروه: تشخیص روش فعال‌سازی و بررسی مجوز پرسش بر اساس تنظیمات گروه
+//
+// گروهی که هنوز ثبت نشده با پیشوند پیش‌فرض پاسخ داده می‌شود و با اولین سوال به نام سازنده گروه ثبت می‌شود.
+func handleGroupText(c telebot.Context, db *sql.DB) error {
+	chat := c.Chat()
+
+	group, err := models.GetGroup(db, chat.ID)
+	if err != nil {
+		log.Printf("خطا در دریافت تنظیمات گروه %d: %v", chat.ID, err)
+		return nil
+	}
+	if group == nil {
+		group = &models.Group{
+			GroupID:       chat.ID,
+			IsActive:      true,
+			TriggerPrefix: models.DefaultTriggerPrefix,
+			TriggerModes:  []string{models.TriggerModePrefix},
+		}
+	}
+	if !group.IsActive {
+		return nil
+	}
+
+	req, ok := matchGroupTrigger(c, group)
+	if !ok {
+		return nil
+	}
+
+	if group.ID == 0 {
+		registered, err := registerGroup(c, db)
+		if err != nil {
+			log.Printf("خطا در ثبت گروه %d: %v", chat.ID, err)
+			return c.Reply("خطای سیستمی. لطفاً مجدد تلاش کنید.")
+		}
+		group = registered
+	}
+
+	if req.Question == "" {
+		if !req.explicit() {
 			return nil
 		}
+		return c.Reply(groupTriggerHelp(group, c.Bot().Me.Username))
+	}
 
-		text := c.Text()
-		if !strings.HasPrefix(text, "*") {
+	// فقط اعضای مجاز (در صورت تعیین توسط مالک گروه)
+	if !group.CanAsk(c.Sender().ID) {
+		if !req.explicit() {
 			return nil
 		}
+		return c.Reply("🔒 پرسش در این گروه فقط برای اعضای تعیین‌شده توسط مدیر گروه فعال است.")
+	}
+
+	if group.AdminsOnly {
+		admin, err := isGroupAdmin(c)
+		if err != nil {
+			log.Printf("خطا در بررسی ادمین بودن کاربر %d در گروه %d: %v", c.Sender().ID, chat.ID, err)
+		}
+		if !admin {
+			if !req.explicit() {
+				return nil
+			}
+			return c.Reply("👮 در این گروه فقط ادمین‌ها می‌توانند سوال بپرسند.")
+		}
+	}
 
-		return handleGroupQuestion(bot, c, db, text)
-	})
+	// در گروه‌های شلوغ پرسش‌ها در پنجره تجمیع جمع و با هم پاسخ داده می‌شوند
+	if group.BatchWindow > 0 {
+		return queueGroupQuestion(c, db, group, req)
+	}
+	return handleGroupQuestion(c.Bot(), c, db, group, req)
 }
 
-// پردازش سوالات گروه
-func handleGroupQuestion(bot *telebot.Bot, c telebot.Context, db *sql.DB, question string) error {
-	user := c.Sender()
+// registerGroup ثبت گروه به نام سازنده آن (برای گروه‌هایی که پیش از این ثبت نشده‌اند)
+func registerGroup(c telebot.Context, db *sql.DB) (*models.Group, error) {
 	chat := c.Chat()
-	
-	// حذف * از ابتدای سوال
-	question = strings.TrimPrefix(question, "*")
-	question = strings.TrimSpace(question)
+	admins, err := c.Bot().AdminsOf(chat)
+	if err != nil {
+		return nil, err
+	}
 
-	if question == "" {
-		return c.Reply("لطفاً پس از * سوال خود را وارد کنید.")
+	for _, m := range admins {
+		if m.Role != telebot.Creator || m.User == nil {
+			continue
+		}
+		if err := models.CreateUser(db, m.User.ID, m.User.Username, m.User.FirstName, m.User.LastName); err != nil {
+			return nil, err
+		}
+		return models.RegisterGroup(db, chat.ID, chat.Title, m.User.ID, settings.GroupRateLimit)
 	}
+	return nil, fmt.Errorf("سازنده گروه %d یافت نشد", chat.ID)
+}
+
+// پردازش سوالات گروه
+func handleGroupQuestion(bot *telebot.Bot, c telebot.Context, db *sql.DB, group *models.Group, req groupRequest) error {
+	user := c.Sender()
+	chat := c.Chat()
 
-	// بررسی rate limiting
-	canProceed, currentCount, err := checkGroupRateLimit(chat.ID)
+	// بررسی محدودیت‌های نرخ گروه، عضو و کاربر (پنجره لغزان)
+	rate, err := database.AllowRate(groupRateLimits(group, user.ID)...)
 	if err != nil {
 		log.Printf("خطا در بررسی rate limit: %v", err)
 		return c.Reply("خطای سیستمی. لطفاً مجدد تلاش کنید.")
 	}
 
-	if !canProceed {
-		// فقط یک بار هشدار بده
-		warningSent, err := database.IsWarningSent(fmt.Sprintf("%d", chat.ID))
+	if !rate.Allowed {
+		// برای هر محدودیت فقط یک بار تا آزاد شدن ظرفیت هشدار بده
+		warningKey := rate.Exceeded.Key
+		warningSent, err := database.IsWarningSent(warningKey)
 		if err == nil && !warningSent {
-			database.SetWarningSent(fmt.Sprintf("%d", chat.ID))
-			
+			database.SetWarningSent(warningKey, rate.RetryAfter)
+
 			menu := &telebot.ReplyMarkup{}
 			btnVIP := menu.URL("🎯 ارتقاء به VIP", "https://t.me/gpt_yourbot?start=vip_request")
 			menu.Inline(menu.Row(btnVIP))
-			
-			message := fmt.Sprintf(
-				"⚠️ محدودیت پاسخ‌گویی در گروه فعال است.\n"+
-					"حداکثر ۵ سوال در دقیقه پاسخ داده می‌شود.\n"+
-					"لطفاً چند لحظه بعد دوباره تلاش کنید.\n\n"+
-					"🕒 سوالات این دقیقه: %d/۵",
-				currentCount,
-			)
-			
-			return c.Reply(message, menu)
+
+			return c.Reply(rateLimitMessage(rate), menu)
 		}
 		return nil
 	}
 
-	// افزایش شمارنده rate limit
-	database.IncrementGroupRateLimit(fmt.Sprintf("%d", chat.ID), time.Minute)
-
 	// نشان دادن تایپینگ
 	bot.Notify(chat, telebot.Typing)
 
+	// ثبت عضو گروه تا مصرف او (حتی با کلید گروه) قابل ثبت باشد
+	if err := models.CreateUser(db, user.ID, user.Username, user.FirstName, user.LastName); err != nil {
+		log.Printf("خطا در ثبت کاربر %d: %v", user.ID, err)
+	}
+
 	// دریافت اطلاعات کاربر
 	dbUser, err := models.GetUserByTelegramID(db, user.ID)
 	if err != nil {
@@ -87,19 +149,18 @@ func handleGroupQuestion(bot *telebot.Bot, c telebot.Context, db *sql.DB, questi
 		return c.Reply("خطا در دریافت اطلاعات کاربر.")
 	}
 
-	// دریافت پرامپت فعال کاربر
-	var promptContent string
-	activePrompt, err := models.GetActivePrompt(db, user.ID)
-	if err == nil && activePrompt != nil {
-		promptContent = activePrompt.Content
-	} else {
-		// پرامپت پیش‌فرض
-		promptContent = "تو یک دستیار هوشمند هستی. به سوالات کاربران به صورت مفید و دقیق پاسخ بده."
-	}
+	// دریافت پرامپت فعال کاربر (در نبود آن پرامپت گروه یا پرامپت پیش‌فرض)
+	promptContent := groupSystemPrompt(db, group, user.ID)
 
-	// دریافت API Key کاربر
-	apiKey, err := models.GetActiveAPIKey(db, user.ID)
-	if err != nil || apiKey == nil {
+	// دریافت کلیدهای پرسش بر اساس روش پرداخت گروه (کلید کاربر یا کلید گروه)
+	keys, sponsored, err := groupKeys(db, group, user.ID)
+	if errors.Is(err, errGroupBudgetReached) || errors.Is(err, errSponsorDailyLimit) {
+		return c.Reply(sponsorErrorMessage(group, err))
+	}
+	if err != nil && !errors.Is(err, errSponsorUnavailable) {
+		log.Printf("خطا در انتخاب کلید گروه %d: %v", chat.ID, err)
+	}
+	if err != nil || len(keys) == 0 {
 		menu := &telebot.ReplyMarkup{}
 		btnAPI := menu.URL("🔑 تنظیم API", "https://t.me/gpt_yourbot?start=api_setup")
 		menu.Inline(menu.Row(btnAPI))
@@ -111,47 +172,35 @@ func handleGroupQuestion(bot *telebot.Bot, c telebot.Context, db *sql.DB, questi
 		)
 	}
 
-	// بررسی سقف مصرف
-	if dbUser != nil {
-		withinLimit, remaining, err := models.CheckUsageLimit(db, user.ID, dbUser.IsVIP)
-		if err == nil && !withinLimit && !dbUser.IsVIP {
-			menu := &telebot.ReplyMarkup{}
-			btnVIP := menu.URL("🎯 ارتقاء به VIP", "https://t.me/gpt_yourbot?start=vip_request")
-			menu.Inline(menu.Row(btnVIP))
-			
-			return c.Reply(
-				"⚠️ شما به سقف مصرف روزانه رسیده‌اید.\n"+
-					"برای استفاده نامحدود به VIP ارتقا پیدا کنید.",
-				menu,
-			)
-		}
+	// بررسی سهمیه روزانه
+	if status, ok := checkQuota(db, user.ID); !ok {
+		return replyQuotaExceeded(c, status)
 	}
 
-	// ارسال به ChatGPT
-	response, tokensUsed, err := services.CallChatGPT(apiKey.APIKey, promptContent, question, dbUser != nil && dbUser.IsVIP)
+	// ارسال به مدل زبانی (در صورت پشتیبانی، پاسخ به صورت تدریجی نمایش داده می‌شود)
+	messages := services.PromptMessages(promptContent, req.Question)
+	if req.Previous != "" {
+		// ادامه پاسخ قبلی ربات (ریپلای)
+		messages = services.ReplyMessages(promptContent, req.Previous, req.Question)
+	}
+	stream, result, key, err := askWithStreaming(c, db, keys, messages, true)
 	if err != nil {
-		log.Printf("خطا در تماس با ChatGPT: %v", err)
-		
-		if strings.Contains(err.Error(), "insufficient_quota") {
-			return c.Reply("❌ سقف مصرف API Key شما به پایان رسیده است. لطفاً API Key جدیدی اضافه کنید.")
-		} else if strings.Contains(err.Error(), "invalid_api_key") {
-			return c.Reply("❌ API Key نامعتبر است. لطفاً API Key خود را بررسی کنید.")
-		}
-		
-		return c.Reply("❌ خطا در ارتباط با سرویس ChatGPT. لطفاً مجدد تلاش کنید.")
+		log.Printf("خطا در تماس با مدل زبانی: %v", err)
+		return stream.fail(apiErrorMessage(err))
 	}
 
 	// ثبت مصرف توکن
-	if tokensUsed > 0 {
-		cost := float64(tokensUsed) * 0.002 / 1000 // تقریباً 0.002 دلار per 1K tokens
-		models.RecordTokenUsage(db, user.ID, tokensUsed, cost)
+	services.RecordGroupUsage(db, user.ID, chat.ID, key, sponsored, result)
+
+	// شمارش سوالات پاسخ داده‌شده گروه
+	if err := models.IncrementGroupQuestions(db, chat.ID); err != nil {
+		log.Printf("خطا در ثبت آمار گروه %d: %v", chat.ID, err)
 	}
 
-	// اضافه کردن متن پایانی اگر کاربر VIP است و تنظیم کرده
-	finalResponse := response
-	if dbUser != nil && dbUser.IsVIP {
-		// در اینجا می‌توان متن پایانی از تنظیمات گروه را اضافه کرد
-		// finalResponse = response + "\n\n" + groupSettings.FooterText
+	// اضافه کردن متن پایانی تنظیم‌شده توسط مالک گروه
+	finalResponse := result.Content
+	if group.FooterText != "" {
+		finalResponse += "\n\n" + group.FooterText
 	}
 
 	// اضافه کردن دکمه ارتقا برای کاربران عادی
@@ -162,138 +211,159 @@ func handleGroupQuestion(bot *telebot.Bot, c telebot.Context, db *sql.DB, questi
 		replyMarkup.Inline(replyMarkup.Row(btnVIP))
 	}
 
-	return c.Reply(finalResponse, replyMarkup)
+	return stream.finish(finalResponse, replyMarkup)
 }
 
-// بررسی rate limit گروه
-func checkGroupRateLimit(chatID int64) (bool, int, error) {
-	key := fmt.Sprintf("%d", chatID)
-	
-	// دریافت تعداد فعلی
-	currentCount, err := database.GetGroupRateLimit(key)
-	if err != nil {
-		return false, 0, err
+// groupSystemPrompt پرامپت سیستمی پرسش در گروه: پرامپت فعال کاربر، سپس پرامپت گروه و در نهایت پرامپت پیش‌فرض
+func groupSystemPrompt(db *sql.DB, group *models.Group, userID int64) string {
+	if activePrompt, err := models.GetActivePrompt(db, userID); err == nil && activePrompt != nil {
+		return activePrompt.Content
 	}
-
-	// کاربران VIP محدودیت ندارند (در اینجا می‌توان بررسی کرد که کاربر VIP است یا نه)
-	// برای سادگی، در این نسخه همه کاربران در گروه محدودیت یکسان دارند
-	
-	if currentCount >= 5 { // حداکثر ۵ سوال در دقیقه
-		return false, currentCount, nil
+	if group.SystemPrompt != "" {
+		return group.SystemPrompt
 	}
-
-	return true, currentCount, nil
+	return defaultSystemPrompt
 }
 
-// پردازش چند سوال همزمان
-func handleMultipleQuestions(bot *telebot.Bot, c telebot.Context, db *sql.DB, questions map[int64]string) error {
-	chat := c.Chat()
-	
-	// بررسی rate limiting برای سوالات چندگانه
-	canProceed, currentCount, err := checkGroupRateLimit(chat.ID)
-	if err != nil || !canProceed {
-		return nil // سکوت در صورت محدودیت
+// handleMultipleQuestions پاسخ به پرسش‌های تجمیع‌شده یک گروه به ترتیب ورود
+//
+// هر پاسخ به پیام پرسش خودش ریپلای می‌شود و وقتی چند پرسش با هم پاسخ داده می‌شوند طول هر پاسخ محدود می‌شود.
+func handleMultipleQuestions(bot *telebot.Bot, db *sql.DB, chat *telebot.Chat, questions []batchedQuestion) error {
+	group, err := models.GetGroup(db, chat.ID)
+	if err != nil || group == nil || !group.IsActive {
+		return err
 	}
 
-	// افزایش شمارنده برای هر سوال
-	for range questions {
-		database.IncrementGroupRateLimit(fmt.Sprintf("%d", chat.ID), time.Minute)
+	// حداکثر طول هر پاسخ (با احتساب متن پایانی)
+	limit := telegramMessageLimit
+	if len(questions) > 1 {
+		limit = batchAnswerMaxRunes
+	}
+	if group.FooterText != "" {
+		limit -= len([]rune(group.FooterText)) + 2
 	}
 
 	// نشان دادن تایپینگ
 	bot.Notify(chat, telebot.Typing)
 
-	// جمع‌آوری پاسخ‌ها
-	var responses []string
-	totalTokens := 0
-
-	for userID, question := range questions {
-		// دریافت اطلاعات کاربر
-		dbUser, err := models.GetUserByTelegramID(db, userID)
+	for _, q := range questions {
+		// پرسش‌های بیش از ظرفیت محدودیت‌ها بی‌پاسخ می‌مانند (سکوت در صورت محدودیت)
+		rate, err := database.AllowRate(groupRateLimits(group, q.UserID)...)
 		if err != nil {
-			continue
+			return err
 		}
-
-		// دریافت API Key کاربر
-		apiKey, err := models.GetActiveAPIKey(db, userID)
-		if err != nil || apiKey == nil {
-			responses = append(responses, fmt.Sprintf("👤 کاربر %d: 🔑 API Key تنظیم نشده", userID))
+		if !rate.Allowed {
+			log.Printf("پرسش %d در گروه %d به دلیل محدودیت %s بی‌پاسخ ماند", q.MessageID, chat.ID, rate.Exceeded.Scope)
 			continue
 		}
 
-		// دریافت پرامپت فعال
-		var promptContent string
-		activePrompt, err := models.GetActivePrompt(db, userID)
-		if err == nil && activePrompt != nil {
-			promptContent = activePrompt.Content
-		} else {
-			promptContent = "تو یک دستیار هوشمند هستی. به سوالات کاربران به صورت مفید و دقیق پاسخ بده."
+		response, answered := answerBatchedQuestion(db, group, q)
+		var replyMarkup *telebot.ReplyMarkup
+		if answered {
+			// کوتاه کردن پاسخ بدون شکستن کاراکترهای چندبایتی
+			if cut := truncateRunes(response, limit-1); cut != response {
+				response = cut + "…"
+			}
+			if group.FooterText != "" {
+				response += "\n\n" + group.FooterText
+			}
+
+			// اضافه کردن دکمه ارتقا برای کاربران عادی
+			if dbUser, err := models.GetUserByTelegramID(db, q.UserID); err != nil || dbUser == nil || !dbUser.IsVIP {
+				replyMarkup = &telebot.ReplyMarkup{}
+				btnVIP := replyMarkup.URL("🎯 ارتقاء به VIP", "https://t.me/gpt_yourbot?start=vip_request")
+				replyMarkup.Inline(replyMarkup.Row(btnVIP))
+			}
 		}
 
-		// ارسال به ChatGPT
-		response, tokensUsed, err := services.CallChatGPT(apiKey.APIKey, promptContent, question, dbUser != nil && dbUser.IsVIP)
-		if err != nil {
-			responses = append(responses, fmt.Sprintf("👤 کاربر %d: ❌ خطا در دریافت پاسخ", userID))
-			continue
+		opts := &telebot.SendOptions{
+			ReplyTo:     &telebot.Message{ID: q.MessageID, Chat: chat},
+			ReplyMarkup: replyMarkup,
 		}
-
-		// ثبت مصرف توکن
-		if tokensUsed > 0 {
-			cost := float64(tokensUsed) * 0.002 / 1000
-			models.RecordTokenUsage(db, userID, tokensUsed, cost)
-			totalTokens += tokensUsed
+		if _, err := bot.Send(chat, response, opts); err != nil {
+			log.Printf("خطا در ارسال پاسخ پرسش %d در گروه %d: %v", q.MessageID, chat.ID, err)
 		}
+	}
+	return nil
+}
 
-		// کوتاه کردن پاسخ اگر طولانی باشد
-		if len(response) > 500 {
-			response = response[:500] + "..."
-		}
+// answerBatchedQuestion پاسخ مدل به یک پرسش تجمیع‌شده؛ answered=false یعنی متن برگشتی پیام خطاست
+func answerBatchedQuestion(db *sql.DB, group *models.Group, q batchedQuestion) (response string, answered bool) {
+	// ثبت عضو گروه تا مصرف او (حتی با کلید گروه) قابل ثبت باشد
+	if err := models.CreateUser(db, q.UserID, q.Username, q.FirstName, q.LastName); err != nil {
+		log.Printf("خطا در ثبت کاربر %d: %v", q.UserID, err)
+	}
 
-		responses = append(responses, fmt.Sprintf("👤 کاربر %d: %s", userID, response))
+	// دریافت کلیدهای پرسش بر اساس روش پرداخت گروه
+	keys, sponsored, err := groupKeys(db, group, q.UserID)
+	if errors.Is(err, errGroupBudgetReached) || errors.Is(err, errSponsorDailyLimit) {
+		return sponsorErrorMessage(group, err), false
+	}
+	if err != nil || len(keys) == 0 {
+		return "🔑 شما هنوز API Key خود را تنظیم نکرده‌اید.\n" +
+			"لطفاً در چت خصوصی با ربات، API Key خود را اضافه کنید.", false
 	}
 
-	// ترکیب تمام پاسخ‌ها
-	finalResponse := strings.Join(responses, "\n\n")
-	
-	// اضافه کردن اطلاعات rate limit
-	finalResponse += fmt.Sprintf("\n\n🕒 %d/۵ سوال در این دقیقه", len(questions)+currentCount)
+	// بررسی سهمیه روزانه
+	if status, ok := checkQuota(db, q.UserID); !ok {
+		return quotaExceededText(status), false
+	}
 
-	// اضافه کردن دکمه ارتقا اگر کاربران عادی هستند
-	replyMarkup := &telebot.ReplyMarkup{}
-	btnVIP := replyMarkup.URL("🎯 ارتقاء به VIP", "https://t.me/gpt_yourbot?start=vip_request")
-	replyMarkup.Inline(replyMarkup.Row(btnVIP))
+	// ارسال به مدل زبانی
+	promptContent := groupSystemPrompt(db, group, q.UserID)
+	messages := services.PromptMessages(promptContent, q.Question)
+	if q.Previous != "" {
+		messages = services.ReplyMessages(promptContent, q.Previous, q.Question)
+	}
+	result, key, err := services.ChatWithFailover(context.Background(), db, keys, services.ChatRequest{Messages: messages}, nil)
+	if err != nil {
+		log.Printf("خطا در تماس با مدل زبانی: %v", err)
+		return apiErrorMessage(err), false
+	}
 
-	return c.Reply(finalResponse, replyMarkup)
+	// ثبت مصرف توکن و شمارش سوالات پاسخ داده‌شده گروه
+	services.RecordGroupUsage(db, q.UserID, group.GroupID, key, sponsored, result)
+	if err := models.IncrementGroupQuestions(db, group.GroupID); err != nil {
+		log.Printf("خطا در ثبت آمار گروه %d: %v", group.GroupID, err)
+	}
+	return result.Content, true
 }
 
-// مدیریت اضافه شدن ربات به گروه جدید
-func HandleBotAddedToGroup(bot *telebot.Bot, c telebot.Context, db *sql.DB) {
+// HandleBotAddedToGroup ثبت گروه به نام کاربری که ربات را اضافه کرده و ارسال پیام خوش‌آمد
+func HandleBotAddedToGroup(bot *telebot.Bot, c telebot.Context, db *sql.DB, botStatus string) (*models.Group, error) {
 	chat := c.Chat()
 	addedBy := c.Sender()
 
 	log.Printf("ربات به گروه اضافه شد: %s (%d) توسط کاربر: %d", chat.Title, chat.ID, addedBy.ID)
 
+	if err := models.CreateUser(db, addedBy.ID, addedBy.Username, addedBy.FirstName, addedBy.LastName); err != nil {
+		return nil, err
+	}
+	group, err := models.UpsertGroupMembership(db, chat.ID, chat.Title, addedBy.ID, botStatus, settings.GroupRateLimit)
+	if err != nil {
+		return nil, err
+	}
+
 	// ارسال پیام خوش‌آمد به صورت خصوصی به کاربر
 	welcomeMsg := fmt.Sprintf(
-		"🤖 ربات ChatGPT به گروه «%s» اضافه شد!\n\n"+
-			"📝 نحوه استفاده در گروه:\n"+
-			"• پیام خود را با * شروع کنید\n"+
-			"• مثال: *سلام چطوری می‌تونم انگلیسی یاد بگیرم؟\n\n"+
+		"🤖 ربات ChatGPT به گروه «%s» اضافه شد و گروه به نام شما ثبت شد!\n\n"+
+			"%s\n"+
 			"⚙️ برای مدیریت تنظیمات گروه:\n"+
 			"• به چت خصوصی با ربات مراجعه کنید\n"+
-			"• منوی «🔨 تنظیمات گروه» را انتخاب کنید\n\n"+
+			"• منوی «🔨 تنظیمات گروه» (/groups) را انتخاب کنید\n\n"+
 			"🎯 برای حذف محدودیت‌ها به VIP ارتقا پیدا کنید!",
-		chat.Title,
+		chat.Title, groupTriggerHelp(group, bot.Me.Username),
 	)
 
-	bot.Send(addedBy, welcomeMsg)
+	if _, err := bot.Send(addedBy, welcomeMsg); err != nil {
+		log.Printf("ارسال پیام خوش‌آمد به کاربر %d ممکن نشد: %v", addedBy.ID, err)
+	}
 
 	// ارسال پیام در گروه (اختیاری)
-	groupMsg := "🤖 ربات ChatGPT فعال شد!\n\n" +
-		"برای استفاده، پیام خود را با * شروع کنید.\n" +
-		"مثال: *سوال خود را اینجا بنویسید"
+	groupMsg := "🤖 ربات ChatGPT فعال شد!\n\n" + groupTriggerHelp(group, bot.Me.Username)
 
 	c.Send(groupMsg)
+	return group, nil
 }
 
 // بررسی وضعیت ربات در گروه
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"time"
+
+	"gopkg.in/telebot.v3"
+	"telegram-bot-manager/database"
+	"telegram-bot-manager/models"
+)
+
+const (
+	// حداکثر طول هر پاسخ وقتی چند پرسش با هم پاسخ داده می‌شوند
+	batchAnswerMaxRunes = 1500
+	// مهلت نگهداری صف؛ صف‌هایی که در توقف ربات مانده‌اند پس از راه‌اندازی دوباره پاسخ داده می‌شوند
+	// و فقط صف رهاشده (مثلاً پس از حذف ربات) پس از این مدت پاک می‌شود
+	batchQueueTTL = 24 * time.Hour
+	// فاصله بررسی پنجره‌هایی که زمان‌بندی پاسخ آن‌ها از دست رفته است
+	batchSweepInterval = 5 * time.Second
+)
+
+// batchedQuestion - پرسش گروه در صف پنجره تجمیع
+type batchedQuestion struct {
+	MessageID int    `json:"message_id"`
+	UserID    int64  `json:"user_id"`
+	Username  string `json:"username,omitempty"`
+	FirstName string `json:"first_name,omitempty"`
+	LastName  string `json:"last_name,omitempty"`
+	Question  string `json:"question"`
+	Previous  string `json:"previous,omitempty"`
+}
+
+// queueGroupQuestion افزودن پرسش به صف تجمیع گروه
+//
+// پرسشی که پنجره جدید باز می‌کند پاسخ‌گویی دسته را پس از پایان پنجره زمان‌بندی می‌کند؛
+// پایان پنجره در Redis هم ثبت می‌شود تا StartGroupBatchSweeper صف‌های بی‌زمان‌بندی را پاسخ دهد.
+// در صورت خطای Redis پرسش بدون تجمیع پاسخ داده می‌شود.
+func queueGroupQuestion(c telebot.Context, db *sql.DB, group *models.Group, req groupRequest) error {
+	sender := c.Sender()
+	item, err := json.Marshal(batchedQuestion{
+		MessageID: c.Message().ID,
+		UserID:    sender.ID,
+		Username:  sender.Username,
+		FirstName: sender.FirstName,
+		LastName:  sender.LastName,
+		Question:  req.Question,
+		Previous:  req.Previous,
+	})
+	if err != nil {
+		return err
+	}
+
+	window := time.Duration(group.BatchWindow) * time.Second
+	opened, err := database.PushGroupBatch(group.GroupID, string(item), time.Now().Add(window), batchQueueTTL)
+	if err != nil {
+		log.Printf("خطا در افزودن پرسش به صف تجمیع گروه %d: %v", group.GroupID, err)
+		return handleGroupQuestion(c.Bot(), c, db, group, req)
+	}
+
+	if opened {
+		bot, chat := c.Bot(), c.Chat()
+		time.AfterFunc(window, func() { flushGroupBatch(bot, db, chat) })
+	}
+	return nil
+}
+
+// StartGroupBatchSweeper پاسخ به صف‌هایی که پنجره آن‌ها تمام شده ولی زمان‌بندی در حافظه ندارند
+// (مثلاً پس از راه‌اندازی دوباره ربات)
+func StartGroupBatchSweeper(bot *telebot.Bot, db *sql.DB) {
+	ticker := time.NewTicker(batchSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		groups, err := database.DueGroupBatches(time.Now())
+		if err != nil {
+			log.Printf("خطا در دریافت صف‌های تجمیع سررسیده: %v", err)
+		}
+		for _, id := range groups {
+			go flushGroupBatch(bot, db, &telebot.Chat{ID: id})
+		}
+		<-ticker.C
+	}
+}
+
+// flushGroupBatch برداشتن پرسش‌های صف تجمیع گروه و پاسخ به آن‌ها به ترتیب ورود
+func flushGroupBatch(bot *telebot.Bot, db *sql.DB, chat *telebot.Chat) {
+	items, err := database.TakeGroupBatch(chat.ID)
+	if err != nil {
+		log.Printf("خطا در دریافت صف تجمیع گروه %d: %v", chat.ID, err)
+		return
+	}
+
+	questions := make([]batchedQuestion, 0, len(items))
+	for _, item := range items {
+		var q batchedQuestion
+		if err := json.Unmarshal([]byte(item), &q); err != nil {
+			log.Printf("پرسش نامعتبر در صف تجمیع گروه %d: %v", chat.ID, err)
+			continue
+		}
+		questions = append(questions, q)
+	}
+	if len(questions) == 0 {
+		return
+	}
+
+	if err := handleMultipleQuestions(bot, db, chat, questions); err != nil {
+		log.Printf("خطا در پاسخ به پرسش‌های تجمیع‌شده گروه %d: %v", chat.ID, err)
+	}
+}
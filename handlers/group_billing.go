@@ -0,0 +1,330 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"gopkg.in/telebot.v3"
+	"telegram-bot-manager/models"
+	"telegram-bot-manager/services"
+	"telegram-bot-manager/utils"
+)
+
+const (
+	// حداکثر اعضای نمایش داده‌شده در گزارش مصرف گروه
+	groupUsageMaxMembers = 10
+	// حداکثر سقف پرسش روزانه هر عضو با کلید اسپانسر
+	groupSponsorDailyMax = 1000
+	// حداکثر بودجه ماهانه گروه به دلار
+	groupBudgetMax = 100000
+)
+
+// خطاهای استفاده از کلید اسپانسر گروه
+var (
+	errSponsorUnavailable = errors.New("کلید اسپانسر گروه در دسترس نیست")
+	errGroupBudgetReached = errors.New("بودجه ماهانه گروه تمام شده است")
+	errSponsorDailyLimit  = errors.New("سقف پرسش روزانه عضو با کلید اسپانسر تمام شده است")
+)
+
+// نام نمایشی روش‌های پرداخت هزینه گروه
+var billingModeNames = map[string]string{
+	models.BillingModeMember:   "👤 هر عضو با کلید خودش",
+	models.BillingModeFallback: "🤝 کلید گروه برای اعضای بدون کلید",
+	models.BillingModeSponsor:  "💳 همه با کلید گروه",
+}
+
+// ترتیب نمایش روش‌های پرداخت
+var billingModes = []string{models.BillingModeMember, models.BillingModeFallback, models.BillingModeSponsor}
+
+// registerGroupBillingHandlers ثبت دکمه‌های کلید اسپانسر و گزارش مصرف گروه
+func registerGroupBillingHandlers(bot *telebot.Bot, db *sql.DB) {
+	bot.Handle(&telebot.Btn{Unique: "group_billing"}, func(c telebot.Context) error {
+		return withOwnedGroup(c, db, func(g *models.Group) error {
+			c.Respond()
+			return showGroupBilling(c, db, g)
+		})
+	})
+
+	bot.Handle(&telebot.Btn{Unique: "group_bmode"}, func(c telebot.Context) error {
+		return withOwnedGroup(c, db, func(g *models.Group) error { return handleGroupBillingMode(c, db, g) })
+	})
+
+	bot.Handle(&telebot.Btn{Unique: "group_skeys"}, func(c telebot.Context) error {
+		return withOwnedGroup(c, db, func(g *models.Group) error {
+			c.Respond()
+			return showSponsorKeyChoices(c, db, g)
+		})
+	})
+
+	bot.Handle(&telebot.Btn{Unique: "group_skey"}, func(c telebot.Context) error {
+		return withOwnedGroup(c, db, func(g *models.Group) error { return handleSponsorKeySelect(c, db, g) })
+	})
+
+	bot.Handle(&telebot.Btn{Unique: "group_cap"}, func(c telebot.Context) error {
+		return withOwnedGroup(c, db, func(g *models.Group) error {
+			return askGroupInput(c, groupStateSponsorCap, g, fmt.Sprintf(
+				"⏳ حداکثر تعداد پرسش روزانه هر عضو با کلید گروه را بفرستید (۰ تا %d).\n۰ یعنی نامحدود.",
+				groupSponsorDailyMax))
+		})
+	})
+
+	bot.Handle(&telebot.Btn{Unique: "group_gbudget"}, func(c telebot.Context) error {
+		return withOwnedGroup(c, db, func(g *models.Group) error {
+			return askGroupInput(c, groupStateBudget, g,
+				"💰 سقف هزینه ماهانه کلید گروه را به دلار بفرستید (مثلاً 5).\n۰ یعنی بدون سقف.")
+		})
+	})
+
+	bot.Handle(&telebot.Btn{Unique: "group_usage"}, func(c telebot.Context) error {
+		return withOwnedGroup(c, db, func(g *models.Group) error {
+			c.Respond()
+			return showGroupUsage(c, db, g)
+		})
+	})
+}
+
+// groupKeys کلیدهای پرسش عضو در گروه بر اساس روش پرداخت گروه
+//
+// sponsored نشان می‌دهد هزینه با کلید اسپانسر مالک گروه پرداخت می‌شود.
+func groupKeys(db *sql.DB, group *models.Group, userID int64) (keys []*models.APIKey, sponsored bool, err error) {
+	if group.BillingMode != models.BillingModeSponsor {
+		keys, err := services.SelectKeys(db, userID)
+		if err != nil {
+			return nil, false, err
+		}
+		if len(keys) > 0 || group.BillingMode != models.BillingModeFallback {
+			return keys, false, nil
+		}
+	}
+
+	key, err := sponsorKey(db, group, userID)
+	if err != nil {
+		return nil, false, err
+	}
+	return []*models.APIKey{key}, true, nil
+}
+
+// sponsorKey کلید اسپانسر گروه پس از بررسی بودجه ماهانه گروه و سقف روزانه عضو
+func sponsorKey(db *sql.DB, group *models.Group, userID int64) (*models.APIKey, error) {
+	if group.SponsorKeyID == 0 {
+		return nil, errSponsorUnavailable
+	}
+	key, err := models.GetAPIKey(db, group.OwnerID, group.SponsorKeyID)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil || !key.IsActive || key.OverBudget() {
+		return nil, errSponsorUnavailable
+	}
+
+	if group.MonthlyBudget > 0 {
+		spent, err := models.GetGroupSponsoredMonthCost(db, group.GroupID)
+		if err != nil {
+			return nil, err
+		}
+		if spent >= group.MonthlyBudget {
+			return nil, errGroupBudgetReached
+		}
+	}
+
+	// مالک گروه مشمول سقف روزانه اعضا نیست
+	if group.SponsorDaily > 0 && userID != group.OwnerID {
+		count, err := models.GetGroupSponsoredToday(db, group.GroupID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if count >= group.SponsorDaily {
+			return nil, errSponsorDailyLimit
+		}
+	}
+	return key, nil
+}
+
+// sponsorErrorMessage پیام خطای استفاده از کلید اسپانسر برای عضو گروه
+func sponsorErrorMessage(group *models.Group, err error) string {
+	switch {
+	case errors.Is(err, errGroupBudgetReached):
+		return "💸 بودجه ماهانه گروه برای پاسخ‌گویی تمام شده است.\n" +
+			"برای ادامه، کلید API خود را در چت خصوصی با ربات اضافه کنید."
+	case errors.Is(err, errSponsorDailyLimit):
+		return fmt.Sprintf("⏳ سهم امروز شما از پرسش با حساب گروه (%d پرسش) تمام شده است.\n"+
+			"برای ادامه، کلید API خود را در چت خصوصی با ربات اضافه کنید.", group.SponsorDaily)
+	}
+	return "🔑 کلید API گروه در دسترس نیست.\n" +
+		"لطفاً در چت خصوصی با ربات، API Key خود را اضافه کنید."
+}
+
+// showGroupBilling نمایش و تغییر روش پرداخت هزینه پرسش‌های گروه
+func showGroupBilling(c telebot.Context, db *sql.DB, g *models.Group) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "💳 پرداخت هزینه پرسش‌ها در «%s»\n\n", groupTitle(g))
+	fmt.Fprintf(&b, "⚙️ روش پرداخت: %s\n", billingModeNames[g.BillingMode])
+
+	if g.SponsorKeyID == 0 {
+		b.WriteString("🔑 کلید گروه: انتخاب نشده\n")
+	} else if key, err := models.GetAPIKey(db, g.OwnerID, g.SponsorKeyID); err != nil || key == nil {
+		b.WriteString("🔑 کلید گروه: ❌ یافت نشد\n")
+	} else {
+		fmt.Fprintf(&b, "🔑 کلید گروه: %s\n", keySummaryLine(key))
+	}
+
+	if g.SponsorDaily > 0 {
+		fmt.Fprintf(&b, "⏳ سقف روزانه هر عضو: %d پرسش\n", g.SponsorDaily)
+	} else {
+		b.WriteString("⏳ سقف روزانه هر عضو: نامحدود\n")
+	}
+
+	spent, err := models.GetGroupSponsoredMonthCost(db, g.GroupID)
+	if err != nil {
+		log.Printf("خطا در دریافت هزینه ماهانه گروه %d: %v", g.GroupID, err)
+	}
+	if g.MonthlyBudget > 0 {
+		fmt.Fprintf(&b, "💰 هزینه این ماه: %.2f از %.2f دلار\n", spent, g.MonthlyBudget)
+	} else {
+		fmt.Fprintf(&b, "💰 هزینه این ماه: %.2f دلار (بدون سقف)\n", spent)
+	}
+	b.WriteString("\nهزینه پرسش‌های پرداخت‌شده با کلید گروه در مصرف شما و عضو پرسنده ثبت می‌شود.")
+
+	id := strconv.Itoa(g.ID)
+	menu := &telebot.ReplyMarkup{}
+	var rows []telebot.Row
+	for _, mode := range billingModes {
+		mark := "⬜"
+		if g.BillingMode == mode {
+			mark = "✅"
+		}
+		rows = append(rows, menu.Row(menu.Data(mark+" "+billingModeNames[mode], "group_bmode", id, mode)))
+	}
+	rows = append(rows,
+		menu.Row(menu.Data("🔑 انتخاب کلید گروه", "group_skeys", id)),
+		menu.Row(menu.Data("⏳ سقف روزانه هر عضو", "group_cap", id), menu.Data("💰 بودجه ماهانه", "group_gbudget", id)),
+		menu.Row(menu.Data("🔙 بازگشت", "group_open", id)),
+	)
+	menu.Inline(rows...)
+
+	return c.Edit(b.String(), menu)
+}
+
+// callback تغییر روش پرداخت هزینه گروه
+func handleGroupBillingMode(c telebot.Context, db *sql.DB, g *models.Group) error {
+	args := c.Args()
+	if len(args) < 2 || billingModeNames[args[1]] == "" {
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ داده نامعتبر"})
+	}
+	mode := args[1]
+	if mode != models.BillingModeMember && g.SponsorKeyID == 0 {
+		return c.Respond(&telebot.CallbackResponse{Text: "⚠️ ابتدا کلید گروه را انتخاب کنید", ShowAlert: true})
+	}
+
+	if err := models.SetGroupBillingMode(db, g.OwnerID, g.ID, mode); err != nil {
+		log.Printf("خطا در تغییر روش پرداخت گروه %d: %v", g.GroupID, err)
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ خطا در ذخیره تغییرات"})
+	}
+
+	g.BillingMode = mode
+	c.Respond(&telebot.CallbackResponse{Text: billingModeNames[mode]})
+	return showGroupBilling(c, db, g)
+}
+
+// showSponsorKeyChoices فهرست کلیدهای مالک برای انتخاب کلید گروه
+func showSponsorKeyChoices(c telebot.Context, db *sql.DB, g *models.Group) error {
+	keys, err := models.ListAPIKeys(db, g.OwnerID)
+	if err != nil {
+		log.Printf("خطا در دریافت کلیدهای کاربر %d: %v", g.OwnerID, err)
+		return c.Send("❌ خطا در دریافت کلیدها.")
+	}
+
+	id := strconv.Itoa(g.ID)
+	menu := &telebot.ReplyMarkup{}
+	var rows []telebot.Row
+	for i := range keys {
+		k := &keys[i]
+		mark := "🔑"
+		if k.ID == g.SponsorKeyID {
+			mark = "✅"
+		}
+		rows = append(rows, menu.Row(menu.Data(fmt.Sprintf("%s %s", mark, keyLabel(k)), "group_skey", id, strconv.Itoa(k.ID))))
+	}
+	if g.SponsorKeyID != 0 {
+		rows = append(rows, menu.Row(menu.Data("❌ حذف کلید گروه", "group_skey", id, "0")))
+	}
+	rows = append(rows, menu.Row(menu.Data("🔙 بازگشت", "group_billing", id)))
+	menu.Inline(rows...)
+
+	text := "🔑 یکی از کلیدهای خود را برای پرداخت هزینه پرسش‌های اعضای گروه انتخاب کنید.\n" +
+		"سقف بودجه ماهانه خود کلید (/keys) هم رعایت می‌شود."
+	if len(keys) == 0 {
+		text = "🔑 هنوز کلیدی ثبت نکرده‌اید. ابتدا با /addapi یک کلید اضافه کنید."
+	}
+	return c.Edit(text, menu)
+}
+
+// callback انتخاب یا حذف کلید گروه
+func handleSponsorKeySelect(c telebot.Context, db *sql.DB, g *models.Group) error {
+	args := c.Args()
+	if len(args) < 2 {
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ داده نامعتبر"})
+	}
+	keyID, err := strconv.Atoi(args[1])
+	if err != nil {
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ داده نامعتبر"})
+	}
+
+	if err := models.SetGroupSponsorKey(db, g.OwnerID, g.ID, keyID); err != nil {
+		log.Printf("خطا در تعیین کلید گروه %d: %v", g.GroupID, err)
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ خطا در ذخیره تغییرات"})
+	}
+
+	g.SponsorKeyID = keyID
+	if keyID == 0 {
+		g.BillingMode = models.BillingModeMember
+		c.Respond(&telebot.CallbackResponse{Text: "❌ کلید گروه حذف شد؛ هر عضو با کلید خودش می‌پرسد"})
+	} else {
+		c.Respond(&telebot.CallbackResponse{Text: "✅ کلید گروه انتخاب شد"})
+	}
+	return showGroupBilling(c, db, g)
+}
+
+// showGroupUsage گزارش مصرف امروز و ماه جاری گروه برای مالک
+func showGroupUsage(c telebot.Context, db *sql.DB, g *models.Group) error {
+	report, err := models.GetGroupUsageReport(db, g.GroupID, groupUsageMaxMembers)
+	if err != nil {
+		log.Printf("خطا در دریافت گزارش مصرف گروه %d: %v", g.GroupID, err)
+		return c.Send("❌ خطا در دریافت گزارش مصرف گروه.")
+	}
+
+	rate, err := models.GetUSDToTomanRate(db)
+	if err != nil {
+		log.Printf("خطا در دریافت نرخ دلار: %v", err)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "📊 گزارش مصرف «%s»\n\n", groupTitle(g))
+	fmt.Fprintf(&b, "📅 امروز: %s\n", usageTotalsLine(report.Today, rate))
+	fmt.Fprintf(&b, "🗓️ این ماه: %s\n", usageTotalsLine(report.Month, rate))
+	fmt.Fprintf(&b, "💳 با کلید گروه (این ماه): %s\n", usageTotalsLine(report.Sponsored, rate))
+
+	if len(report.Members) > 0 {
+		b.WriteString("\n👥 پرمصرف‌ترین اعضا (این ماه):\n")
+		for _, m := range report.Members {
+			name := m.Name
+			if name == "" {
+				name = strconv.FormatInt(m.UserID, 10)
+			}
+			fmt.Fprintf(&b, "• %s: %d درخواست، %s توکن، $%.4f",
+				name, m.Requests, utils.FormatCompact(float64(m.Tokens)), m.Cost)
+			if m.SponsoredCost > 0 {
+				fmt.Fprintf(&b, " (کلید گروه: $%.4f)", m.SponsoredCost)
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	menu := &telebot.ReplyMarkup{}
+	menu.Inline(menu.Row(menu.Data("🔙 بازگشت", "group_open", strconv.Itoa(g.ID))))
+	return c.Edit(b.String(), menu)
+}
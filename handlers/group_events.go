@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+
+	"gopkg.in/telebot.v3"
+	"telegram-bot-manager/models"
+)
+
+// RegisterGroupEventHandlers ثبت رویدادهای عضویت ربات در گروه‌ها و تبدیل گروه به سوپرگروه
+func RegisterGroupEventHandlers(bot *telebot.Bot, db *sql.DB) {
+	bot.Handle(telebot.OnMyChatMember, func(c telebot.Context) error {
+		return handleMyChatMember(bot, c, db)
+	})
+
+	bot.Handle(telebot.OnMigration, func(c telebot.Context) error {
+		return handleGroupMigration(bot, c, db)
+	})
+}
+
+// handleMyChatMember پردازش تغییر وضعیت ربات در گروه (اضافه شدن، حذف، ادمین شدن یا برکناری)
+func handleMyChatMember(bot *telebot.Bot, c telebot.Context, db *sql.DB) error {
+	update := c.ChatMember()
+	if update == nil || update.NewChatMember == nil {
+		return nil
+	}
+	chat := update.Chat
+	if chat.Type != telebot.ChatGroup && chat.Type != telebot.ChatSuperGroup {
+		return nil
+	}
+
+	oldStatus := telebot.Left
+	if update.OldChatMember != nil {
+		oldStatus = update.OldChatMember.Role
+	}
+	newStatus := update.NewChatMember.Role
+	if oldStatus == newStatus {
+		return nil
+	}
+
+	// ورود دوباره یا اولین ورود ربات به گروه
+	if !botInChat(oldStatus) && botInChat(newStatus) {
+		if _, err := HandleBotAddedToGroup(bot, c, db, string(newStatus)); err != nil {
+			log.Printf("خطا در ثبت گروه %d: %v", chat.ID, err)
+		}
+		return nil
+	}
+
+	left := !botInChat(newStatus)
+	group, err := models.UpdateGroupBotStatus(db, chat.ID, string(newStatus), left)
+	if err != nil {
+		log.Printf("خطا در به‌روزرسانی وضعیت ربات در گروه %d: %v", chat.ID, err)
+		return nil
+	}
+	if group == nil {
+		return nil
+	}
+
+	log.Printf("وضعیت ربات در گروه %s (%d): %s → %s", chat.Title, chat.ID, oldStatus, newStatus)
+
+	var msg string
+	switch {
+	case newStatus == telebot.Kicked:
+		msg = fmt.Sprintf("🚫 ربات از گروه «%s» اخراج شد و پاسخ‌گویی در آن متوقف شد.", groupTitle(group))
+		if by := update.Sender; by != nil && by.ID != group.OwnerID {
+			msg += fmt.Sprintf("\n👤 توسط: %s", senderName(by))
+		}
+	case left:
+		msg = fmt.Sprintf("👋 ربات از گروه «%s» خارج شد و پاسخ‌گویی در آن متوقف شد.", groupTitle(group))
+	case newStatus == telebot.Administrator:
+		msg = fmt.Sprintf("⭐ ربات در گروه «%s» ادمین شد.", groupTitle(group))
+	case oldStatus == telebot.Administrator:
+		msg = fmt.Sprintf("⚠️ ربات در گروه «%s» از ادمینی برکنار شد.", groupTitle(group))
+	case newStatus == telebot.Restricted:
+		msg = fmt.Sprintf("🔇 دسترسی ربات در گروه «%s» محدود شد؛ ممکن است نتواند پاسخ بفرستد.", groupTitle(group))
+	default:
+		msg = fmt.Sprintf("ℹ️ محدودیت ربات در گروه «%s» برداشته شد.", groupTitle(group))
+	}
+	if left {
+		msg += "\nبرای فعال‌سازی دوباره، ربات را دوباره به گروه اضافه کنید."
+	}
+
+	notifyGroupOwner(bot, group, msg)
+	return nil
+}
+
+// handleGroupMigration انتقال تنظیمات گروه به آیدی جدید پس از تبدیل به سوپرگروه
+func handleGroupMigration(bot *telebot.Bot, c telebot.Context, db *sql.DB) error {
+	from, to := c.Migration()
+	if from == 0 || to == 0 {
+		return nil
+	}
+
+	group, err := models.MigrateGroup(db, from, to)
+	if err != nil {
+		log.Printf("خطا در انتقال گروه %d به %d: %v", from, to, err)
+		return nil
+	}
+	if group == nil {
+		return nil
+	}
+
+	log.Printf("گروه %d به سوپرگروه %d تبدیل شد", from, to)
+	notifyGroupOwner(bot, group, fmt.Sprintf(
+		"🔄 گروه «%s» به سوپرگروه تبدیل شد؛ تنظیمات گروه به آیدی جدید منتقل شد.", groupTitle(group)))
+	return nil
+}
+
+// botInChat بررسی حضور ربات در گروه بر اساس وضعیت عضویت
+func botInChat(status telebot.MemberStatus) bool {
+	return status != telebot.Left && status != telebot.Kicked
+}
+
+// senderName نام قابل نمایش کاربر تلگرام
+func senderName(u *telebot.User) string {
+	if u.Username != "" {
+		return "@" + u.Username
+	}
+	return fmt.Sprintf("%s (%d)", u.FirstName, u.ID)
+}
+
+// notifyGroupOwner ارسال پیام به مالک گروه در چت خصوصی
+func notifyGroupOwner(bot *telebot.Bot, group *models.Group, msg string) {
+	if _, err := bot.Send(&telebot.User{ID: group.OwnerID}, msg+"\n\n🔨 تنظیمات گروه: /groups"); err != nil {
+		log.Printf("ارسال پیام به مالک گروه %d ممکن نشد: %v", group.GroupID, err)
+	}
+}
@@ -0,0 +1,613 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"gopkg.in/telebot.v3"
+	"telegram-bot-manager/models"
+	"telegram-bot-manager/utils"
+)
+
+// وضعیت‌های ورودی متنی تنظیمات گروه (به همراه آیدی گروه)
+const (
+	groupStatePrefix     = "group:"
+	groupStateRateLimit  = "group:rate:"
+	groupStateFooter     = "group:footer:"
+	groupStateTrigger    = "group:trigger:"
+	groupStateMembers    = "group:members:"
+	groupStatePrompt     = "group:prompt:"
+	groupStateKeywords   = "group:keywords:"
+	groupStateSponsorCap = "group:cap:"
+	groupStateBudget     = "group:budget:"
+	groupStateBatch      = "group:batch:"
+	groupStateTTL        = 10 * time.Minute
+
+	// محدودیت طول تنظیمات متنی گروه
+	groupFooterMaxLength  = 200
+	groupPromptMaxLength  = 2000
+	groupTriggerMaxLength = 10
+	groupMembersMax       = 50
+	groupKeywordsMax      = 20
+	groupKeywordMaxLength = 30
+
+	// ورودی پاک کردن تنظیم متنی
+	groupClearInput = "-"
+)
+
+// نمایش وضعیت ربات در گروه
+var groupBotStatusNames = map[string]string{
+	models.GroupBotMember:     "👤 عضو عادی",
+	models.GroupBotAdmin:      "⭐ ادمین",
+	models.GroupBotRestricted: "🔇 محدودشده",
+	models.GroupBotLeft:       "👋 خارج شده",
+	models.GroupBotKicked:     "🚫 اخراج شده",
+}
+
+// RegisterGroupSettingsHandlers ثبت منوی «🔨 تنظیمات گروه» و دکمه‌های آن
+func RegisterGroupSettingsHandlers(bot *telebot.Bot, db *sql.DB) {
+	openList := func(c telebot.Context) error {
+		if c.Chat().Type != telebot.ChatPrivate {
+			return c.Reply("🔒 تنظیمات گروه فقط در چت خصوصی با ربات قابل مدیریت است.")
+		}
+		return showGroupList(c, db, false)
+	}
+	bot.Handle("/groups", openList)
+	bot.Handle("🔨 تنظیمات گروه", openList)
+
+	bot.Handle(&telebot.Btn{Unique: "groups_list"}, func(c telebot.Context) error {
+		c.Respond()
+		return showGroupList(c, db, true)
+	})
+
+	bot.Handle(&telebot.Btn{Unique: "group_open"}, func(c telebot.Context) error {
+		return withOwnedGroup(c, db, func(g *models.Group) error {
+			c.Respond()
+			return showGroupDetails(c, g)
+		})
+	})
+
+	bot.Handle(&telebot.Btn{Unique: "group_toggle"}, func(c telebot.Context) error {
+		return withOwnedGroup(c, db, func(g *models.Group) error { return handleGroupToggle(c, db, g) })
+	})
+
+	bot.Handle(&telebot.Btn{Unique: "group_rate"}, func(c telebot.Context) error {
+		return withOwnedGroup(c, db, func(g *models.Group) error {
+			return askGroupInput(c, groupStateRateLimit, g, fmt.Sprintf(
+				"⏱️ حداکثر تعداد سوال در دقیقه برای «%s» را بفرستید (%d تا %d):",
+				groupTitle(g), models.GroupRateLimitMin, models.GroupRateLimitMax))
+		})
+	})
+
+	bot.Handle(&telebot.Btn{Unique: "group_footer"}, func(c telebot.Context) error {
+		return withOwnedGroup(c, db, func(g *models.Group) error {
+			return askGroupInput(c, groupStateFooter, g, fmt.Sprintf(
+				"📝 متن پایانی پاسخ‌ها را بفرستید (حداکثر %d کاراکتر).\nبرای حذف متن پایانی %s بفرستید.",
+				groupFooterMaxLength, groupClearInput))
+		})
+	})
+
+	bot.Handle(&telebot.Btn{Unique: "group_triggers"}, func(c telebot.Context) error {
+		return withOwnedGroup(c, db, func(g *models.Group) error {
+			c.Respond()
+			return showGroupTriggers(c, g)
+		})
+	})
+
+	bot.Handle(&telebot.Btn{Unique: "group_mode"}, func(c telebot.Context) error {
+		return withOwnedGroup(c, db, func(g *models.Group) error { return handleGroupModeToggle(c, db, g) })
+	})
+
+	bot.Handle(&telebot.Btn{Unique: "group_admins"}, func(c telebot.Context) error {
+		return withOwnedGroup(c, db, func(g *models.Group) error { return handleGroupAdminsOnlyToggle(c, db, g) })
+	})
+
+	bot.Handle(&telebot.Btn{Unique: "group_batch"}, func(c telebot.Context) error {
+		return withOwnedGroup(c, db, func(g *models.Group) error {
+			return askGroupInput(c, groupStateBatch, g, fmt.Sprintf(
+				"🧺 پنجره تجمیع پرسش‌ها را به ثانیه بفرستید (۰ تا %d).\n"+
+					"پرسش‌هایی که در این فاصله می‌رسند با هم و به ترتیب پاسخ داده می‌شوند؛ ۰ یعنی پاسخ فوری.",
+				models.GroupBatchWindowMax))
+		})
+	})
+
+	bot.Handle(&telebot.Btn{Unique: "group_keywords"}, func(c telebot.Context) error {
+		return withOwnedGroup(c, db, func(g *models.Group) error {
+			return askGroupInput(c, groupStateKeywords, g, fmt.Sprintf(
+				"🔑 کلمات کلیدی را با کاما جدا کنید (حداکثر %d کلمه و هر کدام حداکثر %d کاراکتر).\n"+
+					"پیام‌هایی که یکی از این کلمات را داشته باشند پاسخ داده می‌شوند.\n"+
+					"برای حذف همه کلمات %s بفرستید.",
+				groupKeywordsMax, groupKeywordMaxLength, groupClearInput))
+		})
+	})
+
+	bot.Handle(&telebot.Btn{Unique: "group_trigger"}, func(c telebot.Context) error {
+		return withOwnedGroup(c, db, func(g *models.Group) error {
+			return askGroupInput(c, groupStateTrigger, g, fmt.Sprintf(
+				"🎯 پیشوند فعال‌سازی پاسخ را بفرستید (حداکثر %d کاراکتر و بدون فاصله)، مثلاً ؟ یا !ask\nپیش‌فرض: %s",
+				groupTriggerMaxLength, models.DefaultTriggerPrefix))
+		})
+	})
+
+	bot.Handle(&telebot.Btn{Unique: "group_members"}, func(c telebot.Context) error {
+		return withOwnedGroup(c, db, func(g *models.Group) error {
+			return askGroupInput(c, groupStateMembers, g, fmt.Sprintf(
+				"👥 آیدی عددی یا نام کاربری اعضای مجاز را با فاصله یا کاما جدا کنید (حداکثر %d نفر).\n"+
+					"نام کاربری فقط برای کسانی که ربات را استارت کرده‌اند قابل شناسایی است.\n"+
+					"برای آزاد کردن پرسش برای همه اعضا %s بفرستید.",
+				groupMembersMax, groupClearInput))
+		})
+	})
+
+	bot.Handle(&telebot.Btn{Unique: "group_prompt"}, func(c telebot.Context) error {
+		return withOwnedGroup(c, db, func(g *models.Group) error {
+			return askGroupInput(c, groupStatePrompt, g, fmt.Sprintf(
+				"🧠 پرامپت سیستمی پیش‌فرض گروه را بفرستید (حداکثر %d کاراکتر).\n"+
+					"این پرامپت برای اعضایی که پرامپت فعال ندارند استفاده می‌شود.\n"+
+					"برای بازگشت به پرامپت پیش‌فرض ربات %s بفرستید.",
+				groupPromptMaxLength, groupClearInput))
+		})
+	})
+
+	registerGroupBillingHandlers(bot, db)
+}
+
+// withOwnedGroup خواندن آیدی گروه از داده دکمه (اولین مقدار) و بررسی مالکیت کاربر
+func withOwnedGroup(c telebot.Context, db *sql.DB, fn func(g *models.Group) error) error {
+	args := c.Args()
+	if len(args) == 0 {
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ داده نامعتبر"})
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ داده نامعتبر"})
+	}
+	g, err := models.GetOwnedGroup(db, c.Sender().ID, id)
+	if err != nil || g == nil {
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ گروه یافت نشد"})
+	}
+	return fn(g)
+}
+
+// showGroupList نمایش گروه‌هایی که کاربر مالک آن‌هاست
+func showGroupList(c telebot.Context, db *sql.DB, edit bool) error {
+	userID := c.Sender().ID
+
+	groups, err := models.ListOwnedGroups(db, userID)
+	if err != nil {
+		log.Printf("خطا در دریافت گروه‌های کاربر %d: %v", userID, err)
+		return c.Send("❌ خطا در دریافت گروه‌ها.")
+	}
+	if len(groups) == 0 {
+		return c.Send("🔨 هنوز گروهی به نام شما ثبت نشده است.\n\n" +
+			"ربات را به گروه خود اضافه کنید تا گروه به نام شما ثبت شود.")
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "🔨 گروه‌های شما (%d)\n", len(groups))
+	menu := &telebot.ReplyMarkup{}
+	var rows []telebot.Row
+	for i := range groups {
+		g := &groups[i]
+		fmt.Fprintf(&b, "\n%d. %s — %s\n❓ %d سوال پاسخ داده شده\n", i+1, groupTitle(g), groupStateName(g), g.TotalQuestions)
+		rows = append(rows, menu.Row(menu.Data(fmt.Sprintf("⚙️ %d. %s", i+1, groupTitle(g)), "group_open", strconv.Itoa(g.ID))))
+	}
+	menu.Inline(rows...)
+
+	if edit {
+		return c.Edit(b.String(), menu)
+	}
+	return c.Send(b.String(), menu)
+}
+
+// showGroupDetails نمایش تنظیمات و دکمه‌های مدیریت یک گروه
+func showGroupDetails(c telebot.Context, g *models.Group) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "🔨 %s — %s\n\n", groupTitle(g), groupStateName(g))
+	fmt.Fprintf(&b, "🤖 وضعیت ربات: %s\n", groupBotStatusNames[g.BotStatus])
+	fmt.Fprintf(&b, "⏱️ سقف سوال: %d در دقیقه\n", g.RateLimit)
+	fmt.Fprintf(&b, "🎯 فعال‌سازی: %s\n", groupTriggerSummary(g))
+	if g.BatchWindow > 0 {
+		fmt.Fprintf(&b, "🧺 تجمیع پرسش‌ها: هر %d ثانیه\n", g.BatchWindow)
+	} else {
+		b.WriteString("🧺 تجمیع پرسش‌ها: خاموش (پاسخ فوری)\n")
+	}
+	if g.AdminsOnly {
+		b.WriteString("👮 پرسش: فقط ادمین‌ها\n")
+	}
+	if len(g.AllowedMembers) == 0 {
+		b.WriteString("👥 اعضای مجاز: همه اعضا\n")
+	} else {
+		fmt.Fprintf(&b, "👥 اعضای مجاز: %d نفر\n", len(g.AllowedMembers))
+	}
+	if g.FooterText != "" {
+		fmt.Fprintf(&b, "📝 متن پایانی: %s\n", g.FooterText)
+	} else {
+		b.WriteString("📝 متن پایانی: ندارد\n")
+	}
+	if prompt := truncateRunes(g.SystemPrompt, 100); prompt != "" {
+		if prompt != g.SystemPrompt {
+			prompt += "…"
+		}
+		fmt.Fprintf(&b, "🧠 پرامپت گروه: %s\n", prompt)
+	} else {
+		b.WriteString("🧠 پرامپت گروه: پیش‌فرض ربات\n")
+	}
+	fmt.Fprintf(&b, "💳 پرداخت هزینه: %s\n", billingModeNames[g.BillingMode])
+	fmt.Fprintf(&b, "❓ سوالات پاسخ داده شده: %d\n", g.TotalQuestions)
+
+	toggle := "⛔ غیرفعال کردن"
+	if !g.IsActive {
+		toggle = "✅ فعال کردن"
+	}
+
+	id := strconv.Itoa(g.ID)
+	menu := &telebot.ReplyMarkup{}
+	menu.Inline(
+		menu.Row(menu.Data("⏱️ سقف سوال", "group_rate", id), menu.Data("🎯 روش فعال‌سازی", "group_triggers", id)),
+		menu.Row(menu.Data("👥 اعضای مجاز", "group_members", id), menu.Data("📝 متن پایانی", "group_footer", id)),
+		menu.Row(menu.Data("🧠 پرامپت گروه", "group_prompt", id), menu.Data("🧺 تجمیع پرسش‌ها", "group_batch", id)),
+		menu.Row(menu.Data("💳 پرداخت هزینه", "group_billing", id), menu.Data("📊 گزارش مصرف", "group_usage", id)),
+		menu.Row(menu.Data(toggle, "group_toggle", id)),
+		menu.Row(menu.Data("🔙 بازگشت", "groups_list")),
+	)
+
+	return c.Edit(b.String(), menu)
+}
+
+// showGroupTriggers نمایش و تغییر روش‌های فعال‌سازی پاسخ در گروه
+func showGroupTriggers(c telebot.Context, g *models.Group) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "🎯 روش‌های فعال‌سازی پاسخ در «%s»\n\n", groupTitle(g))
+	b.WriteString("با زدن هر گزینه آن را روشن یا خاموش کنید؛ حداقل یک روش باید فعال بماند.\n\n")
+	fmt.Fprintf(&b, "🎯 پیشوند: %s\n", g.TriggerPrefix)
+	if len(g.Keywords) > 0 {
+		fmt.Fprintf(&b, "🔑 کلمات کلیدی: %s\n", strings.Join(g.Keywords, "، "))
+	} else {
+		b.WriteString("🔑 کلمات کلیدی: تعیین نشده\n")
+	}
+
+	id := strconv.Itoa(g.ID)
+	menu := &telebot.ReplyMarkup{}
+	var rows []telebot.Row
+	for _, mode := range models.TriggerModes {
+		mark := "⬜"
+		if g.HasTriggerMode(mode) {
+			mark = "✅"
+		}
+		rows = append(rows, menu.Row(menu.Data(mark+" "+triggerModeNames[mode], "group_mode", id, mode)))
+	}
+
+	adminsOnly := "👮 فقط ادمین‌ها: خاموش"
+	if g.AdminsOnly {
+		adminsOnly = "👮 فقط ادمین‌ها: روشن"
+	}
+	rows = append(rows,
+		menu.Row(menu.Data("✏️ تغییر پیشوند", "group_trigger", id), menu.Data("🔑 کلمات کلیدی", "group_keywords", id)),
+		menu.Row(menu.Data(adminsOnly, "group_admins", id)),
+		menu.Row(menu.Data("🔙 بازگشت", "group_open", id)),
+	)
+	menu.Inline(rows...)
+
+	return c.Edit(b.String(), menu)
+}
+
+// groupTriggerSummary خلاصه روش‌های فعال‌سازی گروه
+func groupTriggerSummary(g *models.Group) string {
+	var names []string
+	for _, mode := range models.TriggerModes {
+		if !g.HasTriggerMode(mode) {
+			continue
+		}
+		name := triggerModeNames[mode]
+		if mode == models.TriggerModePrefix {
+			name += " " + g.TriggerPrefix
+		}
+		names = append(names, name)
+	}
+	return strings.Join(names, "، ")
+}
+
+// callback روشن یا خاموش کردن یک روش فعال‌سازی
+func handleGroupModeToggle(c telebot.Context, db *sql.DB, g *models.Group) error {
+	args := c.Args()
+	if len(args) < 2 || triggerModeNames[args[1]] == "" {
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ داده نامعتبر"})
+	}
+	mode := args[1]
+
+	var modes []string
+	for _, m := range models.TriggerModes {
+		if (m == mode) != g.HasTriggerMode(m) {
+			modes = append(modes, m)
+		}
+	}
+	if len(modes) == 0 {
+		return c.Respond(&telebot.CallbackResponse{Text: "⚠️ حداقل یک روش فعال‌سازی باید روشن بماند", ShowAlert: true})
+	}
+	if mode == models.TriggerModeKeyword && !g.HasTriggerMode(mode) && len(g.Keywords) == 0 {
+		return c.Respond(&telebot.CallbackResponse{Text: "⚠️ ابتدا کلمات کلیدی را تعیین کنید", ShowAlert: true})
+	}
+
+	if err := models.SetGroupTriggerModes(db, g.OwnerID, g.ID, modes); err != nil {
+		log.Printf("خطا در تغییر روش فعال‌سازی گروه %d: %v", g.GroupID, err)
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ خطا در ذخیره تغییرات"})
+	}
+
+	g.TriggerModes = modes
+	c.Respond()
+	return showGroupTriggers(c, g)
+}
+
+// callback محدود کردن پرسش به ادمین‌های گروه
+func handleGroupAdminsOnlyToggle(c telebot.Context, db *sql.DB, g *models.Group) error {
+	if err := models.SetGroupAdminsOnly(db, g.OwnerID, g.ID, !g.AdminsOnly); err != nil {
+		log.Printf("خطا در تغییر محدودیت ادمین گروه %d: %v", g.GroupID, err)
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ خطا در ذخیره تغییرات"})
+	}
+
+	g.AdminsOnly = !g.AdminsOnly
+	if g.AdminsOnly {
+		c.Respond(&telebot.CallbackResponse{Text: "👮 فقط ادمین‌های گروه پاسخ می‌گیرند"})
+	} else {
+		c.Respond(&telebot.CallbackResponse{Text: "👥 همه اعضا پاسخ می‌گیرند"})
+	}
+	return showGroupTriggers(c, g)
+}
+
+// groupTitle نام قابل نمایش گروه
+func groupTitle(g *models.Group) string {
+	if g.Title != "" {
+		return g.Title
+	}
+	return fmt.Sprintf("گروه %d", g.GroupID)
+}
+
+// groupStateName وضعیت پاسخ‌گویی گروه
+func groupStateName(g *models.Group) string {
+	if g.IsActive {
+		return "✅ فعال"
+	}
+	return "⛔ غیرفعال"
+}
+
+// callback روشن یا خاموش کردن پاسخ‌گویی در گروه
+func handleGroupToggle(c telebot.Context, db *sql.DB, g *models.Group) error {
+	if err := models.SetGroupActive(db, g.OwnerID, g.ID, !g.IsActive); err != nil {
+		log.Printf("خطا در تغییر وضعیت گروه %d: %v", g.GroupID, err)
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ خطا در ذخیره تغییرات"})
+	}
+
+	g.IsActive = !g.IsActive
+	if g.IsActive {
+		c.Respond(&telebot.CallbackResponse{Text: "✅ پاسخ‌گویی در گروه فعال شد"})
+	} else {
+		c.Respond(&telebot.CallbackResponse{Text: "⛔ پاسخ‌گویی در گروه متوقف شد"})
+	}
+	return showGroupDetails(c, g)
+}
+
+// askGroupInput پرسیدن ورودی متنی برای یک گروه
+func askGroupInput(c telebot.Context, statePrefix string, g *models.Group, prompt string) error {
+	err := utils.State.SetState(context.Background(), c.Sender().ID, statePrefix+strconv.Itoa(g.ID), groupStateTTL)
+	if err != nil {
+		log.Printf("خطا در ذخیره وضعیت کاربر: %v", err)
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ خطا، دوباره تلاش کنید"})
+	}
+	c.Respond()
+	return c.Send(prompt)
+}
+
+// HandleGroupText پردازش ورودی متنی تنظیمات گروه
+func HandleGroupText(c telebot.Context, db *sql.DB, state string) error {
+	ctx := context.Background()
+	userID := c.Sender().ID
+	text := strings.TrimSpace(c.Text())
+	utils.State.ClearState(ctx, userID)
+
+	// جدا کردن نوع تنظیم و آیدی گروه از وضعیت
+	idx := strings.LastIndex(state, ":")
+	id, err := strconv.Atoi(state[idx+1:])
+	if err != nil {
+		return nil
+	}
+	prefix := state[:idx+1]
+
+	switch prefix {
+	case groupStateRateLimit:
+		limit, err := strconv.Atoi(utils.NormalizeDigits(text))
+		if err != nil || limit < models.GroupRateLimitMin || limit > models.GroupRateLimitMax {
+			return c.Send(fmt.Sprintf("❌ سقف سوال باید عددی بین %d و %d باشد.", models.GroupRateLimitMin, models.GroupRateLimitMax))
+		}
+		err = models.SetGroupRateLimit(db, userID, id, limit)
+		return replyGroupSaved(c, err, fmt.Sprintf("✅ سقف سوال گروه %d در دقیقه تنظیم شد.", limit))
+
+	case groupStateFooter:
+		if text == groupClearInput {
+			text = ""
+		}
+		if len([]rune(text)) > groupFooterMaxLength {
+			return c.Send(fmt.Sprintf("❌ متن پایانی حداکثر %d کاراکتر می‌تواند باشد.", groupFooterMaxLength))
+		}
+		err := models.SetGroupFooter(db, userID, id, text)
+		if text == "" {
+			return replyGroupSaved(c, err, "✅ متن پایانی گروه حذف شد.")
+		}
+		return replyGroupSaved(c, err, "✅ متن پایانی گروه ذخیره شد.")
+
+	case groupStateTrigger:
+		if text == "" || len([]rune(text)) > groupTriggerMaxLength || strings.IndexFunc(text, unicode.IsSpace) >= 0 {
+			return c.Send(fmt.Sprintf("❌ پیشوند باید بین ۱ تا %d کاراکتر و بدون فاصله باشد.", groupTriggerMaxLength))
+		}
+		if strings.HasPrefix(text, "/") {
+			return c.Send("❌ پیشوند نمی‌تواند با / شروع شود؛ این کاراکتر برای دستورات تلگرام است.")
+		}
+		err := models.SetGroupTriggerPrefix(db, userID, id, text)
+		return replyGroupSaved(c, err, fmt.Sprintf("✅ پیشوند فعال‌سازی %s ذخیره شد.", text))
+
+	case groupStateKeywords:
+		var keywords []string
+		if text != groupClearInput {
+			parsed, err := parseGroupKeywords(text)
+			if err != nil {
+				return c.Send(err.Error())
+			}
+			keywords = parsed
+		}
+		err := models.SetGroupKeywords(db, userID, id, keywords)
+		if len(keywords) == 0 {
+			return replyGroupSaved(c, err, "✅ کلمات کلیدی گروه حذف شد.")
+		}
+		return replyGroupSaved(c, err, fmt.Sprintf("✅ %d کلمه کلیدی ذخیره شد؛ حالت «%s» را از منوی روش فعال‌سازی روشن کنید.",
+			len(keywords), triggerModeNames[models.TriggerModeKeyword]))
+
+	case groupStateMembers:
+		var members []int64
+		if text != groupClearInput {
+			parsed, err := parseGroupMembers(db, text)
+			if err != nil {
+				return c.Send(err.Error())
+			}
+			members = parsed
+		}
+		err := models.SetGroupAllowedMembers(db, userID, id, members)
+		if len(members) == 0 {
+			return replyGroupSaved(c, err, "✅ همه اعضای گروه می‌توانند سوال بپرسند.")
+		}
+		return replyGroupSaved(c, err, fmt.Sprintf("✅ پرسش در گروه به %d عضو محدود شد.", len(members)))
+
+	case groupStatePrompt:
+		if text == groupClearInput {
+			text = ""
+		}
+		if len([]rune(text)) > groupPromptMaxLength {
+			return c.Send(fmt.Sprintf("❌ پرامپت گروه حداکثر %d کاراکتر می‌تواند باشد.", groupPromptMaxLength))
+		}
+		err := models.SetGroupSystemPrompt(db, userID, id, text)
+		if text == "" {
+			return replyGroupSaved(c, err, "✅ پرامپت پیش‌فرض ربات برای گروه استفاده می‌شود.")
+		}
+		return replyGroupSaved(c, err, "✅ پرامپت گروه ذخیره شد.")
+
+	case groupStateBatch:
+		seconds, err := strconv.Atoi(utils.NormalizeDigits(text))
+		if err != nil || seconds < 0 || seconds > models.GroupBatchWindowMax {
+			return c.Send(fmt.Sprintf("❌ پنجره تجمیع باید عددی بین ۰ و %d ثانیه باشد.", models.GroupBatchWindowMax))
+		}
+		err = models.SetGroupBatchWindow(db, userID, id, seconds)
+		if seconds == 0 {
+			return replyGroupSaved(c, err, "✅ تجمیع پرسش‌ها خاموش شد؛ هر پرسش فوری پاسخ داده می‌شود.")
+		}
+		return replyGroupSaved(c, err, fmt.Sprintf("✅ پرسش‌های گروه هر %d ثانیه با هم پاسخ داده می‌شوند.", seconds))
+
+	case groupStateSponsorCap:
+		limit, err := strconv.Atoi(utils.NormalizeDigits(text))
+		if err != nil || limit < 0 || limit > groupSponsorDailyMax {
+			return c.Send(fmt.Sprintf("❌ سقف روزانه باید عددی بین ۰ و %d باشد.", groupSponsorDailyMax))
+		}
+		err = models.SetGroupSponsorDailyLimit(db, userID, id, limit)
+		if limit == 0 {
+			return replyGroupSaved(c, err, "✅ سقف روزانه اعضا برداشته شد.")
+		}
+		return replyGroupSaved(c, err, fmt.Sprintf("✅ هر عضو روزانه %d پرسش با کلید گروه دارد.", limit))
+
+	case groupStateBudget:
+		budget, err := strconv.ParseFloat(utils.NormalizeDigits(text), 64)
+		if err != nil || budget < 0 || budget > groupBudgetMax {
+			return c.Send(fmt.Sprintf("❌ بودجه ماهانه باید عددی بین ۰ و %d دلار باشد.", groupBudgetMax))
+		}
+		err = models.SetGroupMonthlyBudget(db, userID, id, budget)
+		if budget == 0 {
+			return replyGroupSaved(c, err, "✅ سقف بودجه ماهانه گروه برداشته شد.")
+		}
+		return replyGroupSaved(c, err, fmt.Sprintf("✅ بودجه ماهانه گروه %s تنظیم شد.", formatUSD(budget)))
+	}
+
+	return nil
+}
+
+// replyGroupSaved پاسخ نتیجه ذخیره تنظیم گروه
+func replyGroupSaved(c telebot.Context, err error, success string) error {
+	if err != nil {
+		log.Printf("خطا در ذخیره تنظیمات گروه: %v", err)
+		return c.Send("❌ خطا در ذخیره تنظیمات گروه.")
+	}
+	return c.Send(success + " /groups")
+}
+
+// parseGroupKeywords جدا کردن کلمات کلیدی با کاما یا خط جدید
+func parseGroupKeywords(text string) ([]string, error) {
+	fields := strings.FieldsFunc(text, func(r rune) bool {
+		return r == ',' || r == '،' || r == '\n'
+	})
+
+	seen := make(map[string]bool)
+	var keywords []string
+	for _, f := range fields {
+		f = strings.TrimSpace(f)
+		if f == "" || seen[strings.ToLower(f)] {
+			continue
+		}
+		if len([]rune(f)) > groupKeywordMaxLength {
+			return nil, fmt.Errorf("❌ کلمه «%s» بیش از %d کاراکتر است.", f, groupKeywordMaxLength)
+		}
+		seen[strings.ToLower(f)] = true
+		keywords = append(keywords, f)
+	}
+
+	if len(keywords) == 0 {
+		return nil, errors.New("❌ هیچ کلمه‌ای وارد نشده است.")
+	}
+	if len(keywords) > groupKeywordsMax {
+		return nil, fmt.Errorf("❌ حداکثر %d کلمه کلیدی می‌توان تعیین کرد.", groupKeywordsMax)
+	}
+	return keywords, nil
+}
+
+// parseGroupMembers تبدیل فهرست آیدی‌ها و نام‌های کاربری به آیدی تلگرام
+func parseGroupMembers(db *sql.DB, text string) ([]int64, error) {
+	fields := strings.FieldsFunc(text, func(r rune) bool {
+		return unicode.IsSpace(r) || r == ',' || r == '،'
+	})
+	if len(fields) == 0 {
+		return nil, errors.New("❌ هیچ عضوی وارد نشده است.")
+	}
+
+	seen := make(map[int64]bool)
+	var members []int64
+	for _, f := range fields {
+		var id int64
+		if strings.HasPrefix(f, "@") {
+			found, err := models.GetUserIDByUsername(db, strings.TrimPrefix(f, "@"))
+			if err != nil {
+				return nil, fmt.Errorf("❌ خطا در جستجوی %s.", f)
+			}
+			if found == 0 {
+				return nil, fmt.Errorf("❌ کاربر %s یافت نشد؛ از آیدی عددی او استفاده کنید.", f)
+			}
+			id = found
+		} else {
+			parsed, err := strconv.ParseInt(utils.NormalizeDigits(f), 10, 64)
+			if err != nil || parsed <= 0 {
+				return nil, fmt.Errorf("❌ «%s» آیدی عددی یا نام کاربری معتبر نیست.", f)
+			}
+			id = parsed
+		}
+		if !seen[id] {
+			seen[id] = true
+			members = append(members, id)
+		}
+	}
+
+	if len(members) > groupMembersMax {
+		return nil, fmt.Errorf("❌ حداکثر %d عضو مجاز را می‌توان تعیین کرد.", groupMembersMax)
+	}
+	return members, nil
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"gopkg.in/telebot.v3"
+	"telegram-bot-manager/models"
+)
+
+// نام نمایشی روش‌های فعال‌سازی پاسخ در گروه
+var triggerModeNames = map[string]string{
+	models.TriggerModeCommand: "⌨️ دستور /ask",
+	models.TriggerModePrefix:  "🎯 پیشوند",
+	models.TriggerModeReply:   "↩️ ریپلای به ربات",
+	models.TriggerModeMention: "📣 منشن ربات",
+	models.TriggerModeKeyword: "🔑 کلمات کلیدی",
+}
+
+// groupRequest - پرسش شناسایی‌شده در پیام گروه
+type groupRequest struct {
+	Mode     string // روش فعال‌سازی که پیام با آن شناسایی شد
+	Question string
+	Previous string // متن پاسخ قبلی ربات در حالت ریپلای
+}
+
+// explicit پرسش صریح خطاب به ربات؛ پیام‌های شامل کلمه کلیدی در صورت رد شدن بی‌پاسخ می‌مانند
+func (r groupRequest) explicit() bool {
+	return r.Mode != models.TriggerModeKeyword
+}
+
+// RegisterGroupCommands ثبت دستور /ask برای پرسش در گروه‌ها
+func RegisterGroupCommands(bot *telebot.Bot, db *sql.DB) {
+	bot.Handle("/ask", func(c telebot.Context) error {
+		if chatType := c.Chat().Type; chatType == telebot.ChatGroup || chatType == telebot.ChatSuperGroup {
+			return handleGroupText(c, db)
+		}
+		return c.Send("💬 در چت خصوصی کافی است پیام خود را بدون دستور بفرستید.")
+	})
+}
+
+// matchGroupTrigger بررسی روش‌های فعال‌سازی گروه به ترتیب models.TriggerModes
+func matchGroupTrigger(c telebot.Context, group *models.Group) (groupRequest, bool) {
+	msg := c.Message()
+	text := strings.TrimSpace(c.Text())
+	me := c.Bot().Me
+
+	for _, mode := range models.TriggerModes {
+		if !group.HasTriggerMode(mode) {
+			continue
+		}
+		req := groupRequest{Mode: mode}
+
+		switch mode {
+		case models.TriggerModeCommand:
+			if isAskCommand(text, me.Username) {
+				req.Question = strings.TrimSpace(msg.Payload)
+				return req, true
+			}
+
+		case models.TriggerModePrefix:
+			if question, ok := group.TrimTrigger(text); ok {
+				req.Question = question
+				return req, true
+			}
+
+		case models.TriggerModeReply:
+			if r := msg.ReplyTo; r != nil && r.Sender != nil && r.Sender.ID == me.ID && !strings.HasPrefix(text, "/") {
+				req.Question, req.Previous = text, r.Text
+				return req, true
+			}
+
+		case models.TriggerModeMention:
+			if question, ok := trimMention(text, me.Username); ok {
+				req.Question = question
+				return req, true
+			}
+
+		case models.TriggerModeKeyword:
+			if group.MatchKeyword(text) {
+				req.Question = text
+				return req, true
+			}
+		}
+	}
+	return groupRequest{}, false
+}
+
+// isAskCommand بررسی دستور /ask (با یا بدون نام کاربری ربات)
+func isAskCommand(text, botUsername string) bool {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return false
+	}
+	return fields[0] == "/ask" || strings.EqualFold(fields[0], "/ask@"+botUsername)
+}
+
+// trimMention حذف منشن ربات از متن؛ در نبود منشن false برمی‌گرداند
+func trimMention(text, botUsername string) (string, bool) {
+	mention := "@" + botUsername
+	found := false
+	var words []string
+	for _, w := range strings.Fields(text) {
+		if strings.EqualFold(strings.TrimRightFunc(w, unicode.IsPunct), mention) {
+			found = true
+			continue
+		}
+		words = append(words, w)
+	}
+	return strings.Join(words, " "), found
+}
+
+// isGroupAdmin بررسی ادمین بودن فرستنده؛ ادمین ناشناس به نام خود گروه پیام می‌فرستد
+func isGroupAdmin(c telebot.Context) (bool, error) {
+	if sc := c.Message().SenderChat; sc != nil && sc.ID == c.Chat().ID {
+		return true, nil
+	}
+	member, err := c.Bot().ChatMemberOf(c.Chat(), c.Sender())
+	if err != nil {
+		return false, err
+	}
+	return member.Role == telebot.Administrator || member.Role == telebot.Creator, nil
+}
+
+// groupTriggerHelp راهنمای پرسیدن سوال در گروه بر اساس روش‌های فعال
+func groupTriggerHelp(group *models.Group, botUsername string) string {
+	var b strings.Builder
+	b.WriteString("📝 نحوه پرسیدن سوال در این گروه:\n")
+	for _, mode := range models.TriggerModes {
+		if !group.HasTriggerMode(mode) {
+			continue
+		}
+		switch mode {
+		case models.TriggerModeCommand:
+			b.WriteString("• دستور /ask و سپس سوال\n")
+		case models.TriggerModePrefix:
+			fmt.Fprintf(&b, "• شروع پیام با %s، مثال: %sسوال خود را اینجا بنویسید\n", group.TriggerPrefix, group.TriggerPrefix)
+		case models.TriggerModeReply:
+			b.WriteString("• ریپلای به پاسخ‌های ربات برای ادامه گفتگو\n")
+		case models.TriggerModeMention:
+			fmt.Fprintf(&b, "• منشن @%s همراه سوال\n", botUsername)
+		case models.TriggerModeKeyword:
+			b.WriteString("• پیام‌های شامل کلمات کلیدی گروه\n")
+		}
+	}
+	if group.AdminsOnly {
+		b.WriteString("👮 فقط ادمین‌های گروه می‌توانند سوال بپرسند.\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,320 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/telebot.v3"
+	"telegram-bot-manager/models"
+	"telegram-bot-manager/utils"
+)
+
+// وضعیت‌های ورودی متنی مدیریت کلیدها (به همراه آیدی کلید)
+const (
+	keyStatePrefix = "key:"
+	keyStateLabel  = "key:label:"
+	keyStateBudget = "key:budget:"
+	keyStateTTL    = 10 * time.Minute
+
+	// حداکثر طول برچسب کلید (مطابق ستون label)
+	keyLabelMaxLength = 50
+)
+
+// نمایش وضعیت کلید
+var keyStatusNames = map[string]string{
+	models.KeyStatusValid:         "✅ معتبر",
+	models.KeyStatusInvalid:       "❌ نامعتبر",
+	models.KeyStatusQuotaExceeded: "💸 بدون اعتبار",
+	models.KeyStatusUnchecked:     "⏳ بررسی نشده",
+}
+
+// نام روش‌های انتخاب کلید
+var keyStrategyNames = map[string]string{
+	models.KeyStrategyPriority:   "🥇 اولویت",
+	models.KeyStrategyRoundRobin: "🔁 چرخشی",
+}
+
+// RegisterKeyHandlers ثبت دستور /keys و دکمه‌های مدیریت حلقه کلیدها
+func RegisterKeyHandlers(bot *telebot.Bot, db *sql.DB) {
+	bot.Handle("/keys", func(c telebot.Context) error {
+		if c.Chat().Type != telebot.ChatPrivate {
+			return c.Reply("🔒 مدیریت کلیدها فقط در چت خصوصی با ربات ممکن است.")
+		}
+		return showKeyList(c, db, false)
+	})
+
+	bot.Handle(&telebot.Btn{Unique: "keys_list"}, func(c telebot.Context) error {
+		c.Respond()
+		return showKeyList(c, db, true)
+	})
+
+	bot.Handle(&telebot.Btn{Unique: "keys_strategy"}, func(c telebot.Context) error {
+		return handleKeyStrategyCallback(c, db)
+	})
+
+	bot.Handle(&telebot.Btn{Unique: "key_open"}, func(c telebot.Context) error {
+		return withKeyID(c, func(id int) error {
+			c.Respond()
+			return showKeyDetails(c, db, id)
+		})
+	})
+
+	bot.Handle(&telebot.Btn{Unique: "key_up"}, func(c telebot.Context) error {
+		return withKeyID(c, func(id int) error { return handleKeyMove(c, db, id, -1) })
+	})
+
+	bot.Handle(&telebot.Btn{Unique: "key_down"}, func(c telebot.Context) error {
+		return withKeyID(c, func(id int) error { return handleKeyMove(c, db, id, 1) })
+	})
+
+	bot.Handle(&telebot.Btn{Unique: "key_toggle"}, func(c telebot.Context) error {
+		return withKeyID(c, func(id int) error { return handleKeyToggle(c, db, id) })
+	})
+
+	bot.Handle(&telebot.Btn{Unique: "key_label"}, func(c telebot.Context) error {
+		return withKeyID(c, func(id int) error {
+			return askKeyInput(c, keyStateLabel, id, fmt.Sprintf("🏷️ برچسب جدید کلید را بفرستید (حداکثر %d کاراکتر):", keyLabelMaxLength))
+		})
+	})
+
+	bot.Handle(&telebot.Btn{Unique: "key_budget"}, func(c telebot.Context) error {
+		return withKeyID(c, func(id int) error {
+			return askKeyInput(c, keyStateBudget, id, "💰 سقف هزینه ماهانه این کلید را به دلار بفرستید (مثلاً 10).\n۰ یعنی بدون سقف.")
+		})
+	})
+
+	bot.Handle(&telebot.Btn{Unique: "key_delete"}, func(c telebot.Context) error {
+		return withKeyID(c, func(id int) error { return handleKeyDelete(c, db, id) })
+	})
+}
+
+// withKeyID خواندن آیدی کلید از داده دکمه
+func withKeyID(c telebot.Context, fn func(id int) error) error {
+	id, err := strconv.Atoi(c.Data())
+	if err != nil {
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ داده نامعتبر"})
+	}
+	return fn(id)
+}
+
+// showKeyList نمایش حلقه کلیدهای کاربر
+func showKeyList(c telebot.Context, db *sql.DB, edit bool) error {
+	userID := c.Sender().ID
+
+	keys, err := models.ListAPIKeys(db, userID)
+	if err != nil {
+		log.Printf("خطا در دریافت کلیدهای کاربر %d: %v", userID, err)
+		return c.Send("❌ خطا در دریافت کلیدها.")
+	}
+	if len(keys) == 0 {
+		return c.Send("🔑 هنوز کلیدی ثبت نکرده‌اید.\n\n"+addAPIUsage, &telebot.SendOptions{ParseMode: telebot.ModeMarkdown})
+	}
+
+	strategy, err := models.GetKeyStrategy(db, userID)
+	if err != nil {
+		strategy = models.KeyStrategyPriority
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "🔑 کلیدهای شما (%d)\n⚙️ روش انتخاب: %s\n", len(keys), keyStrategyNames[strategy])
+	menu := &telebot.ReplyMarkup{}
+	var rows []telebot.Row
+	for i, k := range keys {
+		fmt.Fprintf(&b, "\n%d. %s\n%s", i+1, keySummaryLine(&k), keyBudgetLine(&k))
+		rows = append(rows, menu.Row(menu.Data(fmt.Sprintf("⚙️ %d. %s", i+1, keyLabel(&k)), "key_open", strconv.Itoa(k.ID))))
+	}
+	b.WriteString("\n\nدر صورت خطای یک کلید (۴۲۹ یا تمام شدن اعتبار) کلید بعدی استفاده می‌شود.\n➕ افزودن کلید: /addapi")
+
+	rows = append(rows, menu.Row(menu.Data("🔄 تغییر روش انتخاب", "keys_strategy")))
+	menu.Inline(rows...)
+
+	if edit {
+		return c.Edit(b.String(), menu)
+	}
+	return c.Send(b.String(), menu)
+}
+
+// showKeyDetails نمایش جزئیات و دکمه‌های مدیریت یک کلید
+func showKeyDetails(c telebot.Context, db *sql.DB, keyID int) error {
+	key, err := models.GetAPIKey(db, c.Sender().ID, keyID)
+	if err != nil || key == nil {
+		return c.Edit("❌ کلید یافت نشد.")
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "🔑 %s\n\n", keySummaryLine(key))
+	b.WriteString(keyBudgetLine(key))
+	fmt.Fprintf(&b, "🥇 اولویت: %d\n", key.Priority)
+	if key.Model != "" {
+		fmt.Fprintf(&b, "🧠 مدل: %s\n", key.Model)
+	}
+	if key.Organization != "" {
+		fmt.Fprintf(&b, "🏢 سازمان: %s\n", key.Organization)
+	}
+	if len(key.AvailableModels) > 0 {
+		fmt.Fprintf(&b, "📋 %d مدل در دسترس\n", len(key.AvailableModels))
+	}
+	if key.LastCheckedAt.Valid {
+		fmt.Fprintf(&b, "🩺 آخرین بررسی: %s\n", key.LastCheckedAt.Time.Format("2006-01-02 15:04"))
+	}
+
+	toggle := "⛔ غیرفعال کردن"
+	if !key.IsActive {
+		toggle = "✅ فعال کردن"
+	}
+
+	id := strconv.Itoa(key.ID)
+	menu := &telebot.ReplyMarkup{}
+	menu.Inline(
+		menu.Row(menu.Data("⬆️ بالاتر", "key_up", id), menu.Data("⬇️ پایین‌تر", "key_down", id)),
+		menu.Row(menu.Data("🏷️ برچسب", "key_label", id), menu.Data("💰 بودجه ماهانه", "key_budget", id)),
+		menu.Row(menu.Data(toggle, "key_toggle", id), menu.Data("🗑️ حذف", "key_delete", id)),
+		menu.Row(menu.Data("🔙 بازگشت", "keys_list")),
+	)
+
+	return c.Edit(b.String(), menu)
+}
+
+// keySummaryLine خط خلاصه کلید: وضعیت، برچسب، Provider و کلید پوشیده
+func keySummaryLine(k *models.APIKey) string {
+	state := keyStatusNames[k.Status]
+	if !k.IsActive {
+		state = "⛔ غیرفعال"
+	} else if k.OverBudget() {
+		state = "📛 بیش از بودجه"
+	}
+	return fmt.Sprintf("%s — %s\n%s %s", keyLabel(k), state, providerNames[k.Provider], k.Masked())
+}
+
+// keyBudgetLine خط مصرف و بودجه ماه جاری
+func keyBudgetLine(k *models.APIKey) string {
+	if k.MonthlyBudget > 0 {
+		return fmt.Sprintf("💰 مصرف این ماه: %.2f از %.2f دلار\n", k.MonthSpent, k.MonthlyBudget)
+	}
+	return fmt.Sprintf("💰 مصرف این ماه: %.2f دلار (بدون سقف)\n", k.MonthSpent)
+}
+
+// keyLabel نام قابل نمایش کلید
+func keyLabel(k *models.APIKey) string {
+	if k.Label != "" {
+		return k.Label
+	}
+	return fmt.Sprintf("کلید #%d", k.ID)
+}
+
+// callback تغییر روش انتخاب کلید
+func handleKeyStrategyCallback(c telebot.Context, db *sql.DB) error {
+	userID := c.Sender().ID
+
+	strategy, err := models.GetKeyStrategy(db, userID)
+	if err != nil {
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ خطا در دریافت تنظیمات"})
+	}
+
+	next := models.KeyStrategyRoundRobin
+	if strategy == models.KeyStrategyRoundRobin {
+		next = models.KeyStrategyPriority
+	}
+	if err := models.SetKeyStrategy(db, userID, next); err != nil {
+		log.Printf("خطا در تغییر روش انتخاب کلید کاربر %d: %v", userID, err)
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ خطا در ذخیره تنظیمات"})
+	}
+
+	c.Respond(&telebot.CallbackResponse{Text: "روش انتخاب: " + keyStrategyNames[next]})
+	return showKeyList(c, db, true)
+}
+
+// callback جابجایی کلید در ترتیب اولویت
+func handleKeyMove(c telebot.Context, db *sql.DB, keyID, delta int) error {
+	if err := models.MoveAPIKey(db, c.Sender().ID, keyID, delta); err != nil {
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ جابجایی کلید ممکن نشد"})
+	}
+	c.Respond()
+	return showKeyDetails(c, db, keyID)
+}
+
+// callback فعال یا غیرفعال کردن کلید
+func handleKeyToggle(c telebot.Context, db *sql.DB, keyID int) error {
+	key, err := models.GetAPIKey(db, c.Sender().ID, keyID)
+	if err != nil || key == nil {
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ کلید یافت نشد"})
+	}
+
+	if err := models.SetAPIKeyActive(db, key.UserID, key.ID, !key.IsActive); err != nil {
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ خطا در ذخیره تغییرات"})
+	}
+
+	if key.IsActive {
+		c.Respond(&telebot.CallbackResponse{Text: "⛔ کلید غیرفعال شد"})
+	} else {
+		c.Respond(&telebot.CallbackResponse{Text: "✅ کلید فعال شد و به زودی دوباره بررسی می‌شود"})
+	}
+	return showKeyDetails(c, db, keyID)
+}
+
+// callback حذف کلید
+func handleKeyDelete(c telebot.Context, db *sql.DB, keyID int) error {
+	if err := models.DeleteAPIKeyByID(db, c.Sender().ID, keyID); err != nil {
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ حذف کلید ممکن نشد"})
+	}
+	c.Respond(&telebot.CallbackResponse{Text: "🗑️ کلید حذف شد"})
+	return showKeyList(c, db, true)
+}
+
+// askKeyInput پرسیدن ورودی متنی برای یک کلید
+func askKeyInput(c telebot.Context, statePrefix string, keyID int, prompt string) error {
+	err := utils.State.SetState(context.Background(), c.Sender().ID, statePrefix+strconv.Itoa(keyID), keyStateTTL)
+	if err != nil {
+		log.Printf("خطا در ذخیره وضعیت کاربر: %v", err)
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ خطا، دوباره تلاش کنید"})
+	}
+	c.Respond()
+	return c.Send(prompt)
+}
+
+// HandleKeyText پردازش ورودی متنی مدیریت کلیدها (برچسب یا بودجه)
+func HandleKeyText(c telebot.Context, db *sql.DB, state string) error {
+	ctx := context.Background()
+	userID := c.Sender().ID
+	text := strings.TrimSpace(c.Text())
+	utils.State.ClearState(ctx, userID)
+
+	switch {
+	case strings.HasPrefix(state, keyStateLabel):
+		id, err := strconv.Atoi(strings.TrimPrefix(state, keyStateLabel))
+		if err != nil {
+			return nil
+		}
+		if text == "" || len([]rune(text)) > keyLabelMaxLength {
+			return c.Send(fmt.Sprintf("❌ برچسب باید بین ۱ تا %d کاراکتر باشد.", keyLabelMaxLength))
+		}
+		if err := models.SetAPIKeyLabel(db, userID, id, text); err != nil {
+			return c.Send("❌ خطا در ذخیره برچسب.")
+		}
+		return c.Send("✅ برچسب کلید ذخیره شد. /keys")
+
+	case strings.HasPrefix(state, keyStateBudget):
+		id, err := strconv.Atoi(strings.TrimPrefix(state, keyStateBudget))
+		if err != nil {
+			return nil
+		}
+		budget, err := strconv.ParseFloat(utils.NormalizeDigits(text), 64)
+		if err != nil || budget < 0 || budget > 100000 {
+			return c.Send("❌ مقدار بودجه نامعتبر است. یک عدد بین ۰ و ۱۰۰۰۰۰ دلار بفرستید.")
+		}
+		if err := models.SetAPIKeyBudget(db, userID, id, budget); err != nil {
+			return c.Send("❌ خطا در ذخیره بودجه.")
+		}
+		if budget == 0 {
+			return c.Send("✅ سقف بودجه این کلید برداشته شد. /keys")
+		}
+		return c.Send(fmt.Sprintf("✅ سقف هزینه ماهانه کلید %.2f دلار تنظیم شد. /keys", budget))
+	}
+
+	return nil
+}
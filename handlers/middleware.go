@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+
+	"gopkg.in/telebot.v3"
+
+	"telegram-bot-manager/models"
+)
+
+// requireAdmin - middleware بررسی مجوز ادمین برای دکمه‌ها و callbackهای پنل مدیریت
+//
+// ادمین یافت‌شده با کلید "admin" در context ذخیره می‌شود.
+func requireAdmin(db *sql.DB, perm models.Permission) telebot.MiddlewareFunc {
+	return func(next telebot.HandlerFunc) telebot.HandlerFunc {
+		return func(c telebot.Context) error {
+			admin, err := models.GetAdmin(db, c.Sender().ID)
+			if err != nil {
+				log.Printf("خطا در بررسی دسترسی ادمین %d: %v", c.Sender().ID, err)
+				return denyAccess(c, "❌ خطا در بررسی دسترسی")
+			}
+
+			if admin == nil {
+				return denyAccess(c, "⛔ دسترسی denied")
+			}
+
+			if !admin.Can(perm) {
+				return denyAccess(c, "⛔ نقش شما ("+models.RoleNames[admin.Role]+") اجازه این عملیات را ندارد")
+			}
+
+			c.Set("admin", admin)
+			return next(c)
+		}
+	}
+}
+
+// denyAccess پاسخ عدم دسترسی؛ برای callbackها به صورت alert
+func denyAccess(c telebot.Context, message string) error {
+	if c.Callback() != nil {
+		return c.Respond(&telebot.CallbackResponse{Text: message, ShowAlert: true})
+	}
+	return c.Send(message)
+}
+
+// currentAdmin ادمینی که middleware در context قرار داده است
+func currentAdmin(c telebot.Context) *models.Admin {
+	admin, _ := c.Get("admin").(*models.Admin)
+	return admin
+}
@@ -0,0 +1,403 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/telebot.v3"
+
+	"telegram-bot-manager/models"
+	"telegram-bot-manager/utils"
+)
+
+// نام فارسی پلن‌ها
+var planNames = map[string]string{
+	"1month":  "۱ ماه",
+	"3months": "۳ ماه",
+	"6months": "۶ ماه",
+	"1year":   "۱ سال",
+}
+
+const (
+	// وضعیت کاربر در انتظار ارسال رسید: payment:<plan>
+	paymentStatePrefix = "payment:"
+	// وضعیت ادمین در انتظار دلیل رد: admin:reject_payment:<id>
+	adminStateRejectPayment = "admin:reject_payment:"
+
+	paymentStateTTL = 30 * time.Minute
+
+	// پیشوند ذخیره مدرک پرداخت در payment_proof
+	proofPhotoPrefix = "photo:"
+	proofCodePrefix  = "code:"
+)
+
+// RegisterPaymentHandlers ثبت مراحل خرید اشتراک و بررسی پرداخت‌ها
+func RegisterPaymentHandlers(bot *telebot.Bot, db *sql.DB) {
+	bot.Handle("/vip", func(c telebot.Context) error {
+		return HandleVIPPurchase(c, db)
+	})
+
+	bot.Handle("💎 خرید اشتراک VIP", func(c telebot.Context) error {
+		return HandleVIPPurchase(c, db)
+	})
+
+	bot.Handle(&telebot.Btn{Unique: "buy_plan"}, func(c telebot.Context) error {
+		return handleBuyPlanCallback(c, db)
+	})
+
+	// رسید پرداخت به صورت عکس
+	bot.Handle(telebot.OnPhoto, func(c telebot.Context) error {
+		if c.Chat().Type != telebot.ChatPrivate {
+			return nil
+		}
+		plan, ok := pendingPaymentPlan(c.Sender().ID)
+		if !ok {
+			return nil
+		}
+		return submitPaymentProof(c, db, plan, proofPhotoPrefix+c.Message().Photo.FileID)
+	})
+
+	// تأیید و رد توسط ادمین
+	bot.Handle(&telebot.Btn{Unique: "pay_approve"}, func(c telebot.Context) error {
+		return handleApprovePaymentCallback(c, db)
+	}, requireAdmin(db, models.PermManagePayments))
+
+	bot.Handle(&telebot.Btn{Unique: "pay_reject"}, func(c telebot.Context) error {
+		return handleRejectPaymentCallback(c, db)
+	}, requireAdmin(db, models.PermManagePayments))
+}
+
+// HandleVIPPurchase - نمایش پلن‌های فعال برای خرید
+func HandleVIPPurchase(c telebot.Context, db *sql.DB) error {
+	links, err := models.GetPaymentLinks(db, true)
+	if err != nil {
+		log.Printf("خطا در دریافت پلن‌ها: %v", err)
+		return c.Send("❌ خطا در دریافت پلن‌های اشتراک")
+	}
+
+	menu := &telebot.ReplyMarkup{}
+	var rows []telebot.Row
+	var message strings.Builder
+	message.WriteString("💎 خرید اشتراک VIP\n\n")
+
+	for i := range links {
+		l := &links[i]
+		// پلن‌هایی که هنوز لینک واقعی ندارند نمایش داده نمی‌شوند
+		if l.IsPlaceholder() {
+			continue
+		}
+		message.WriteString(planSummaryLine(l) + "\n")
+		rows = append(rows, menu.Row(menu.Data(
+			fmt.Sprintf("⭐ %s — %s تومان", planNames[l.Plan], formatPrice(l.Price)),
+			"buy_plan", l.Plan,
+		)))
+	}
+	if len(rows) == 0 {
+		return c.Send("📭 در حال حاضر پلنی برای خرید فعال نیست.")
+	}
+	menu.Inline(rows...)
+
+	message.WriteString("\nپلن مورد نظر خود را انتخاب کنید:")
+	return c.Send(message.String(), menu)
+}
+
+// خلاصه یک‌خطی پلن در منوی خرید
+func planSummaryLine(l *models.PaymentLink) string {
+	line := fmt.Sprintf("⭐ %s: %s تومان (%d روز)", planNames[l.Plan], formatPrice(l.Price), l.DurationDays)
+	if l.Description != "" {
+		line += " — " + l.Description
+	}
+	return line
+}
+
+// planCardText کارت پلن همان‌طور که به کاربر نمایش داده می‌شود
+func planCardText(l *models.PaymentLink) string {
+	message := fmt.Sprintf(
+		"⭐ پلن %s\n\n"+
+			"💰 مبلغ: %s تومان\n"+
+			"📅 مدت: %d روز\n",
+		planNames[l.Plan], formatPrice(l.Price), l.DurationDays,
+	)
+	if l.Description != "" {
+		message += "📝 " + l.Description + "\n"
+	}
+	message += "\n۱. از دکمه «💳 پرداخت» مبلغ را پرداخت کنید\n" +
+		"۲. عکس رسید یا کد پیگیری تراکنش را همین‌جا ارسال کنید\n\n" +
+		"پس از تأیید ادمین، اشتراک شما فعال می‌شود."
+	return message
+}
+
+// callback انتخاب پلن توسط کاربر
+func handleBuyPlanCallback(c telebot.Context, db *sql.DB) error {
+	plan := c.Data()
+
+	link, err := models.GetPaymentLink(db, plan)
+	if err != nil || link == nil || !link.IsActive || link.IsPlaceholder() {
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ این پلن در دسترس نیست", ShowAlert: true})
+	}
+
+	pending, err := models.HasPendingPaymentRequest(db, c.Sender().ID)
+	if err == nil && pending {
+		return c.Respond(&telebot.CallbackResponse{
+			Text:      "⏳ یک درخواست پرداخت در انتظار بررسی دارید. لطفاً تا بررسی آن صبر کنید.",
+			ShowAlert: true,
+		})
+	}
+
+	err = utils.State.SetState(context.Background(), c.Sender().ID, paymentStatePrefix+plan, paymentStateTTL)
+	if err != nil {
+		log.Printf("خطا در ذخیره وضعیت پرداخت: %v", err)
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ خطای سیستمی. لطفاً مجدد تلاش کنید."})
+	}
+	c.Respond()
+
+	menu := &telebot.ReplyMarkup{}
+	menu.Inline(menu.Row(menu.URL("💳 پرداخت", link.Link)))
+
+	return c.Send(planCardText(link), menu)
+}
+
+// pendingPaymentPlan پلنی که کاربر برای آن منتظر ارسال رسید است
+func pendingPaymentPlan(userID int64) (string, bool) {
+	state, err := utils.State.GetState(context.Background(), userID)
+	if err != nil || !strings.HasPrefix(state, paymentStatePrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(state, paymentStatePrefix), true
+}
+
+// HandlePaymentProofText - دریافت کد پیگیری به عنوان مدرک پرداخت
+func HandlePaymentProofText(c telebot.Context, db *sql.DB, plan string) error {
+	code := strings.TrimSpace(c.Text())
+	if len([]rune(code)) < 4 {
+		return c.Send("❌ کد پیگیری نامعتبر است. لطفاً کد کامل یا عکس رسید را ارسال کنید.")
+	}
+	return submitPaymentProof(c, db, plan, proofCodePrefix+code)
+}
+
+// ثبت درخواست پرداخت و ارسال آن برای ادمین‌ها
+func submitPaymentProof(c telebot.Context, db *sql.DB, plan, proof string) error {
+	user := c.Sender()
+
+	link, err := models.GetPaymentLink(db, plan)
+	if err != nil || link == nil || !link.IsActive {
+		utils.State.ClearState(context.Background(), user.ID)
+		return c.Send("❌ این پلن دیگر در دسترس نیست. لطفاً دوباره از /vip شروع کنید.")
+	}
+
+	_ = models.CreateUser(db, user.ID, user.Username, user.FirstName, user.LastName)
+
+	id, err := models.CreatePaymentRequest(db, user.ID, plan, link.Price, proof)
+	if err != nil {
+		log.Printf("خطا در ثبت درخواست پرداخت: %v", err)
+		return c.Send("❌ خطا در ثبت درخواست پرداخت. لطفاً مجدد تلاش کنید.")
+	}
+	utils.State.ClearState(context.Background(), user.ID)
+
+	request, err := models.GetPaymentRequest(db, id)
+	if err == nil && request != nil {
+		notifyPaymentAdmins(c.Bot(), db, request, user)
+	}
+
+	return c.Send(fmt.Sprintf(
+		"✅ درخواست پرداخت شما (شماره %d) ثبت شد.\n\nپس از بررسی توسط ادمین نتیجه به شما اطلاع داده می‌شود.",
+		id,
+	))
+}
+
+// ارسال کارت درخواست برای همه ادمین‌هایی که مجوز بررسی پرداخت دارند
+func notifyPaymentAdmins(bot *telebot.Bot, db *sql.DB, request *models.PaymentRequest, user *telebot.User) {
+	admins, err := models.ListAdmins(db)
+	if err != nil {
+		log.Printf("خطا در دریافت لیست ادمین‌ها: %v", err)
+		return
+	}
+
+	for _, a := range admins {
+		if !a.Can(models.PermManagePayments) {
+			continue
+		}
+		if err := sendPaymentCard(bot, &telebot.User{ID: a.TelegramID}, request, user); err != nil {
+			log.Printf("خطا در ارسال درخواست پرداخت به ادمین %d: %v", a.TelegramID, err)
+		}
+	}
+}
+
+// ارسال کارت درخواست پرداخت همراه با دکمه‌های تأیید و رد
+func sendPaymentCard(bot *telebot.Bot, to telebot.Recipient, request *models.PaymentRequest, user *telebot.User) error {
+	menu := &telebot.ReplyMarkup{}
+	id := strconv.Itoa(request.ID)
+	menu.Inline(menu.Row(
+		menu.Data("✅ تأیید", "pay_approve", id),
+		menu.Data("❌ رد", "pay_reject", id),
+	))
+
+	caption := paymentCardText(request, user)
+
+	if strings.HasPrefix(request.PaymentProof, proofPhotoPrefix) {
+		photo := &telebot.Photo{
+			File:    telebot.File{FileID: strings.TrimPrefix(request.PaymentProof, proofPhotoPrefix)},
+			Caption: caption,
+		}
+		_, err := bot.Send(to, photo, menu)
+		return err
+	}
+
+	_, err := bot.Send(to, caption, menu)
+	return err
+}
+
+// متن کارت درخواست پرداخت
+func paymentCardText(request *models.PaymentRequest, user *telebot.User) string {
+	name := strconv.FormatInt(request.UserID, 10)
+	if user != nil {
+		name = fmt.Sprintf("%s %s (%s)", user.FirstName, user.LastName, getUsername(user.Username))
+	}
+
+	text := fmt.Sprintf(
+		"💳 درخواست پرداخت #%d\n\n"+
+			"👤 کاربر: %s\n"+
+			"🔸 آیدی: %d\n"+
+			"⭐ پلن: %s\n"+
+			"💰 مبلغ: %s تومان\n"+
+			"🕒 زمان: %s",
+		request.ID, name, request.UserID, planNames[request.Plan],
+		formatPrice(request.Amount), request.CreatedAt.Format("2006-01-02 15:04"),
+	)
+
+	if strings.HasPrefix(request.PaymentProof, proofCodePrefix) {
+		text += "\n🧾 کد پیگیری: " + strings.TrimPrefix(request.PaymentProof, proofCodePrefix)
+	}
+
+	return text
+}
+
+// مدیریت درخواست‌های پرداخت
+func handlePaymentRequests(c telebot.Context, db *sql.DB) error {
+	requests, err := models.GetPendingPaymentRequests(db, 10)
+	if err != nil {
+		return c.Send("❌ خطا در دریافت درخواست‌های پرداخت")
+	}
+
+	if len(requests) == 0 {
+		return c.Send("📭 درخواست پرداخت در انتظاری وجود ندارد")
+	}
+
+	c.Send(fmt.Sprintf("💳 %d درخواست در انتظار بررسی (قدیمی‌ترین اول):", len(requests)))
+	for i := range requests {
+		if err := sendPaymentCard(c.Bot(), c.Recipient(), &requests[i], nil); err != nil {
+			log.Printf("خطا در ارسال کارت پرداخت %d: %v", requests[i].ID, err)
+		}
+	}
+	return nil
+}
+
+// callback تأیید پرداخت
+func handleApprovePaymentCallback(c telebot.Context, db *sql.DB) error {
+	admin := currentAdmin(c)
+
+	id, err := strconv.Atoi(c.Data())
+	if err != nil {
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ داده نامعتبر"})
+	}
+
+	request, days, err := models.ApprovePaymentRequest(db, id, admin.TelegramID)
+	if errors.Is(err, models.ErrPaymentAlreadyProcessed) {
+		return c.Respond(&telebot.CallbackResponse{Text: "ℹ️ این درخواست قبلاً بررسی شده است", ShowAlert: true})
+	}
+	if err != nil {
+		log.Printf("خطا در تأیید پرداخت %d: %v", id, err)
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ خطا در تأیید پرداخت", ShowAlert: true})
+	}
+
+	c.Bot().Send(&telebot.User{ID: request.UserID}, fmt.Sprintf(
+		"🎉 پرداخت شما تأیید شد!\n\n⭐ پلن: %s\n📅 %d روز به اشتراک VIP شما اضافه شد.",
+		planNames[request.Plan], days,
+	))
+
+	c.Respond(&telebot.CallbackResponse{Text: "✅ پرداخت تأیید شد"})
+	return updatePaymentCard(c, fmt.Sprintf("\n\n✅ تأیید شده توسط %d", admin.TelegramID))
+}
+
+// callback رد پرداخت؛ دلیل رد در پیام بعدی پرسیده می‌شود
+func handleRejectPaymentCallback(c telebot.Context, db *sql.DB) error {
+	id, err := strconv.Atoi(c.Data())
+	if err != nil {
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ داده نامعتبر"})
+	}
+
+	request, err := models.GetPaymentRequest(db, id)
+	if err != nil || request == nil {
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ درخواست یافت نشد"})
+	}
+	if request.Status != models.PaymentPending {
+		return c.Respond(&telebot.CallbackResponse{Text: "ℹ️ این درخواست قبلاً بررسی شده است", ShowAlert: true})
+	}
+
+	if err := setAdminState(c, adminStateRejectPayment+c.Data()); err != nil {
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ خطای سیستمی"})
+	}
+	c.Respond()
+
+	return c.Send(fmt.Sprintf("✍️ دلیل رد درخواست #%d را بنویسید (برای کاربر ارسال می‌شود):", id))
+}
+
+// ثبت رد پرداخت پس از دریافت دلیل
+func processRejectPayment(c telebot.Context, db *sql.DB, admin *models.Admin, idStr, reason string) error {
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return c.Send("❌ شماره درخواست نامعتبر است")
+	}
+
+	if reason == "" {
+		return c.Send("❌ دلیل رد نمی‌تواند خالی باشد")
+	}
+
+	request, err := models.RejectPaymentRequest(db, id, admin.TelegramID, reason)
+	if errors.Is(err, models.ErrPaymentAlreadyProcessed) {
+		return c.Send("ℹ️ این درخواست قبلاً توسط ادمین دیگری بررسی شده است")
+	}
+	if err != nil {
+		log.Printf("خطا در رد پرداخت %d: %v", id, err)
+		return c.Send("❌ خطا در ثبت رد پرداخت")
+	}
+
+	c.Bot().Send(&telebot.User{ID: request.UserID}, fmt.Sprintf(
+		"❌ درخواست پرداخت شما برای پلن %s رد شد.\n\n📝 دلیل: %s\n\nدر صورت نیاز می‌توانید دوباره از /vip اقدام کنید.",
+		planNames[request.Plan], reason,
+	))
+
+	return c.Send(fmt.Sprintf("✅ درخواست #%d رد شد و به کاربر اطلاع داده شد", id))
+}
+
+// به‌روزرسانی کارت درخواست و حذف دکمه‌ها پس از بررسی
+func updatePaymentCard(c telebot.Context, suffix string) error {
+	msg := c.Message()
+	if msg == nil {
+		return nil
+	}
+
+	if msg.Photo != nil {
+		return c.EditCaption(msg.Caption + suffix)
+	}
+	return c.Edit(msg.Text + suffix)
+}
+
+// فرمت قیمت با جداکننده هزارگان
+func formatPrice(price float64) string {
+	s := strconv.FormatInt(int64(price), 10)
+	var out strings.Builder
+	for i, ch := range s {
+		if i > 0 && (len(s)-i)%3 == 0 {
+			out.WriteRune(',')
+		}
+		out.WriteRune(ch)
+	}
+	return out.String()
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"gopkg.in/telebot.v3"
+
+	"telegram-bot-manager/models"
+	"telegram-bot-manager/utils"
+)
+
+// وضعیت‌های ورودی متنی قیمت‌گذاری: admin:pricing:<عملیات>
+const (
+	adminStatePricing       = "admin:pricing:"
+	adminStatePricingSet    = adminStatePricing + "set"
+	adminStatePricingDelete = adminStatePricing + "delete"
+	adminStatePricingRate   = adminStatePricing + "rate"
+)
+
+// registerPricingHandlers ثبت دکمه‌های قیمت مدل‌ها و نرخ دلار در پنل مدیریت
+func registerPricingHandlers(bot *telebot.Bot, db *sql.DB) {
+	bot.Handle("💲 قیمت مدل‌ها", func(c telebot.Context) error {
+		return showModelPrices(c, db, false)
+	}, requireAdmin(db, models.PermManagePricing))
+
+	bot.Handle(&telebot.Btn{Unique: "price_set"}, func(c telebot.Context) error {
+		return askPricingInput(c, adminStatePricingSet,
+			"✏️ نام مدل و قیمت ورودی و خروجی (دلار برای هر یک میلیون توکن) را وارد کنید:\n"+
+				"مثال: gpt-4o-mini 0.15 0.6\n\n"+
+				"برای قیمت مدل‌های بدون قیمت از نام default استفاده کنید.")
+	}, requireAdmin(db, models.PermManagePricing))
+
+	bot.Handle(&telebot.Btn{Unique: "price_delete"}, func(c telebot.Context) error {
+		return askPricingInput(c, adminStatePricingDelete, "🗑️ نام مدلی که قیمتش حذف شود را وارد کنید:")
+	}, requireAdmin(db, models.PermManagePricing))
+
+	bot.Handle(&telebot.Btn{Unique: "price_rate"}, func(c telebot.Context) error {
+		return askPricingInput(c, adminStatePricingRate, "💱 نرخ هر دلار به تومان را وارد کنید (مثال: 60000):")
+	}, requireAdmin(db, models.PermManagePricing))
+}
+
+// نمایش جدول قیمت مدل‌ها و نرخ دلار
+func showModelPrices(c telebot.Context, db *sql.DB, edit bool) error {
+	prices, err := models.ListModelPrices(db)
+	if err != nil {
+		log.Printf("خطا در دریافت قیمت مدل‌ها: %v", err)
+		return c.Send("❌ خطا در دریافت قیمت مدل‌ها")
+	}
+
+	rate, err := models.GetUSDToTomanRate(db)
+	if err != nil {
+		log.Printf("خطا در دریافت نرخ دلار: %v", err)
+	}
+
+	var b strings.Builder
+	b.WriteString("💲 قیمت مدل‌ها (دلار برای هر یک میلیون توکن)\n")
+	b.WriteString("ورودی / خروجی\n\n")
+	for _, p := range prices {
+		fmt.Fprintf(&b, "• %s: %s / %s\n", p.Model, formatUSD(p.InputPrice), formatUSD(p.OutputPrice))
+	}
+	if len(prices) == 0 {
+		b.WriteString("📭 قیمتی ثبت نشده است؛ هزینه درخواست‌ها صفر ثبت می‌شود.\n")
+	}
+	fmt.Fprintf(&b, "\n💱 نرخ دلار: %s تومان\n", formatPrice(rate))
+	b.WriteString("\nنام‌های نسخه‌دار (مثل gpt-4o-2024-08-06) با طولانی‌ترین پیشوند منطبق قیمت‌گذاری می‌شوند.")
+
+	menu := &telebot.ReplyMarkup{}
+	menu.Inline(
+		menu.Row(menu.Data("✏️ ثبت/ویرایش قیمت", "price_set"), menu.Data("🗑️ حذف قیمت", "price_delete")),
+		menu.Row(menu.Data("💱 نرخ دلار", "price_rate")),
+	)
+
+	if edit {
+		return c.Edit(b.String(), menu)
+	}
+	return c.Send(b.String(), menu)
+}
+
+// askPricingInput ثبت وضعیت و درخواست ورودی متنی
+func askPricingInput(c telebot.Context, state, prompt string) error {
+	if err := setAdminState(c, state); err != nil {
+		return c.Respond(&telebot.CallbackResponse{Text: "❌ خطای سیستمی"})
+	}
+	c.Respond()
+	return c.Send(prompt)
+}
+
+// پردازش ورودی متنی قیمت‌گذاری
+func processPricingInput(c telebot.Context, db *sql.DB, state, text string) error {
+	switch state {
+	case adminStatePricingSet:
+		parts := strings.Fields(text)
+		if len(parts) != 3 {
+			return c.Send("❌ فرمت نامعتبر. مثال: gpt-4o-mini 0.15 0.6")
+		}
+		input, errIn := strconv.ParseFloat(utils.NormalizeDigits(parts[1]), 64)
+		output, errOut := strconv.ParseFloat(utils.NormalizeDigits(parts[2]), 64)
+		if errIn != nil || errOut != nil || input < 0 || output < 0 || input >= 1000000 || output >= 1000000 {
+			return c.Send("❌ قیمت نامعتبر است. دو عدد نامنفی وارد کنید.")
+		}
+		model := strings.ToLower(parts[0])
+		if len(model) > 100 {
+			return c.Send("❌ نام مدل طولانی است.")
+		}
+		if err := models.SetModelPrice(db, model, input, output); err != nil {
+			log.Printf("خطا در ذخیره قیمت مدل %s: %v", model, err)
+			return c.Send("❌ خطا در ذخیره قیمت")
+		}
+		c.Send(fmt.Sprintf("✅ قیمت %s ذخیره شد.", model))
+
+	case adminStatePricingDelete:
+		model := strings.ToLower(text)
+		if model == models.DefaultPriceModel {
+			return c.Send("⚠️ قیمت پیش‌فرض قابل حذف نیست؛ می‌توانید آن را ویرایش کنید.")
+		}
+		err := models.DeleteModelPrice(db, model)
+		if err == sql.ErrNoRows {
+			return c.Send("❌ قیمتی برای این مدل ثبت نشده است.")
+		}
+		if err != nil {
+			log.Printf("خطا در حذف قیمت مدل %s: %v", model, err)
+			return c.Send("❌ خطا در حذف قیمت")
+		}
+		c.Send(fmt.Sprintf("🗑️ قیمت %s حذف شد.", model))
+
+	case adminStatePricingRate:
+		rate, err := strconv.ParseFloat(utils.NormalizeDigits(text), 64)
+		if err != nil || rate <= 0 || rate >= 100000000 {
+			return c.Send("❌ نرخ نامعتبر است. یک عدد مثبت به تومان وارد کنید.")
+		}
+		if err := models.SetUSDToTomanRate(db, rate); err != nil {
+			log.Printf("خطا در ذخیره نرخ دلار: %v", err)
+			return c.Send("❌ خطا در ذخیره نرخ")
+		}
+		c.Send(fmt.Sprintf("✅ نرخ دلار %s تومان ثبت شد.", formatPrice(rate)))
+
+	default:
+		return c.Send("❌ دستور نامعتبر. لطفاً دوباره تلاش کنید.")
+	}
+
+	return showModelPrices(c, db, false)
+}
+
+// فرمت مبلغ دلاری بدون صفرهای اضافه
+func formatUSD(amount float64) string {
+	return "$" + strconv.FormatFloat(amount, 'f', -1, 64)
+}
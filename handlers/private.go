@@ -1,22 +1,56 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
-	"fmt"
+	"errors"
+	"log"
 	"strings"
 
 	"gopkg.in/telebot.v3"
+	"telegram-bot-manager/database"
 	"telegram-bot-manager/models"
+	"telegram-bot-manager/services"
+	"telegram-bot-manager/utils"
 )
 
-// HandlePrivateMessage - مدیریت پیام‌های خصوصی کاربران
+// پرامپت سیستمی پیش‌فرض برای کاربرانی که پرامپت فعال ندارند
+const defaultSystemPrompt = "تو یک دستیار هوشمند هستی. به سوالات کاربران به صورت مفید و دقیق پاسخ بده."
+
+// HandlePrivateMessage - مدیریت پیام‌های خصوصی کاربران (پیام‌های گروه به handleGroupText سپرده می‌شوند)
 func HandlePrivateMessage(bot *telebot.Bot, db *sql.DB) {
 	bot.Handle(telebot.OnText, func(c telebot.Context) error {
+		if chatType := c.Chat().Type; chatType == telebot.ChatGroup || chatType == telebot.ChatSuperGroup {
+			return handleGroupText(c, db)
+		}
+		if c.Chat().Type != telebot.ChatPrivate {
+			return nil
+		}
+
 		user := c.Sender()
 		userID := user.ID
 
 		// ثبت خودکار کاربر در دیتابیس در صورت عدم وجود
-		_ = models.CreateUserIfNotExists(db, userID, user.Username, user.FirstName, user.LastName)
+		_ = models.CreateUser(db, userID, user.Username, user.FirstName, user.LastName)
+
+		// ورودی‌های متنی پنل مدیریت
+		if state, err := utils.State.GetState(context.Background(), userID); err == nil {
+			switch {
+			case strings.HasPrefix(state, "admin:"):
+				return HandleAdminText(c, db)
+			case strings.HasPrefix(state, keyStatePrefix):
+				return HandleKeyText(c, db, state)
+			case strings.HasPrefix(state, groupStatePrefix):
+				return HandleGroupText(c, db, state)
+			case strings.HasPrefix(state, channelStatePrefix):
+				return HandleChannelText(c, db, state)
+			}
+		}
+
+		// کد پیگیری پرداخت برای پلن انتخاب‌شده
+		if plan, ok := pendingPaymentPlan(userID); ok {
+			return HandlePaymentProofText(c, db, plan)
+		}
 
 		text := strings.TrimSpace(c.Text())
 
@@ -25,7 +59,12 @@ func HandlePrivateMessage(bot *telebot.Bot, db *sql.DB) {
 			msg := "سلام 👋\nمن ربات مدیریت ChatGPT هستم.\n\n" +
 				"می‌تونی کلید API خودت رو اضافه یا حذف کنی:\n\n" +
 				"➕ افزودن API: فقط کلیدت رو بفرست (مثلاً sk-...)\n" +
-				"🗑️ حذف API: دستور /removeapi رو بفرست."
+				"🔑 مدیریت کلیدها (برچسب، اولویت، بودجه): /keys\n" +
+				"🗑️ حذف همه کلیدها: دستور /removeapi رو بفرست.\n" +
+				"🔨 تنظیمات گروه‌های شما: /groups\n\n" +
+				"🆕 گفتگوی جدید: /new\n" +
+				"📜 گفتگوهای قبلی: /history\n" +
+				"📊 گزارش مصرف: /usage"
 			return c.Send(msg)
 
 		case "/removeapi":
@@ -33,29 +72,98 @@ func HandlePrivateMessage(bot *telebot.Bot, db *sql.DB) {
 			if err != nil {
 				return c.Send("❌ خطا در حذف API از دیتابیس.")
 			}
-			return c.Send("✅ کلید API شما با موفقیت حذف شد.")
+			return c.Send("✅ همه کلیدهای API شما با موفقیت حذف شد.\nبرای حذف تنها یک کلید از /keys استفاده کنید.")
 
 		default:
-			// اگر متن شامل "sk-" بود، یعنی کلید API جدید ارسال شده
+			// اگر متن با "sk-" شروع شود، یعنی کلید API جدید ارسال شده
 			if len(text) > 10 && strings.HasPrefix(text, "sk-") {
-				err := models.SaveAPIKey(db, userID, text)
-				if err != nil {
-					return c.Send(fmt.Sprintf("❌ خطا در ذخیره کلید در دیتابیس: %v", err))
-				}
-				return c.Send("✅ کلید API با موفقیت ذخیره شد.")
+				return saveAPIKeyFromMessage(c, db, text)
+			}
+
+			// بررسی محدودیت سراسری درخواست‌های کاربر (در صورت خطای Redis درخواست رد نمی‌شود)
+			if rate, err := database.AllowRate(userRateLimit(userID)); err != nil {
+				log.Printf("خطا در بررسی rate limit کاربر %d: %v", userID, err)
+			} else if !rate.Allowed {
+				return c.Send(rateLimitMessage(rate))
 			}
 
-			// بررسی وجود API Key فعال
-			apiKey, err := models.GetActiveAPIKey(db, userID)
+			// کلیدهای قابل استفاده به ترتیب انتخاب
+			keys, err := services.SelectKeys(db, userID)
 			if err != nil {
 				return c.Send("❌ خطا در خواندن کلید از دیتابیس.")
 			}
-			if apiKey == "" {
-				return c.Send("⚠️ هنوز کلید API ثبت نکرده‌اید.\nکلید خود را ارسال کنید تا ثبت شود.")
+			if len(keys) == 0 {
+				return c.Send(noUsableKeyMessage(db, userID))
 			}
 
-			// پاسخ موقت (در آینده جایگزین ChatGPT API می‌شود)
-			return c.Send(fmt.Sprintf("📩 پیام شما دریافت شد و آماده ارسال به ChatGPT با کلید:\n%s", apiKey))
+			// بررسی سهمیه روزانه
+			if status, ok := checkQuota(db, userID); !ok {
+				return replyQuotaExceeded(c, status)
+			}
+
+			return handlePrivateQuestion(c, db, keys, text)
 		}
 	})
 }
+
+// handlePrivateQuestion ارسال پیام کاربر به مدل زبانی در ادامه رشته گفتگوی فعال
+//
+// پرامپت فعال کاربر به عنوان پیام system و تاریخچه رشته (در حد سقف توکن) همراه پرسش ارسال می‌شود.
+func handlePrivateQuestion(c telebot.Context, db *sql.DB, keys []*models.APIKey, question string) error {
+	userID := c.Sender().ID
+
+	promptContent := defaultSystemPrompt
+	if activePrompt, err := models.GetActivePrompt(db, userID); err == nil && activePrompt != nil {
+		promptContent = activePrompt.Content
+	}
+
+	conv, err := activeConversation(db, userID, question)
+	if err != nil {
+		log.Printf("خطا در دریافت رشته گفتگو: %v", err)
+		return c.Send("❌ خطا در بارگذاری گفتگو.")
+	}
+
+	history, err := loadConversationHistory(db, conv.ID)
+	if err != nil {
+		log.Printf("خطا در بارگذاری تاریخچه گفتگو %d: %v", conv.ID, err)
+	}
+
+	messages := services.BuildContext(promptContent, history, question)
+	stream, result, key, err := askWithStreaming(c, db, keys, messages, false)
+	if err != nil {
+		log.Printf("خطا در تماس با مدل زبانی: %v", err)
+		return stream.fail(apiErrorMessage(err))
+	}
+
+	services.RecordUsage(db, userID, key, models.SurfacePrivate, result)
+
+	if err := saveConversationTurn(db, conv.ID, question, result); err != nil {
+		log.Printf("خطا در ذخیره گفتگو %d: %v", conv.ID, err)
+	}
+
+	return stream.finish(result.Content, nil)
+}
+
+// noUsableKeyMessage پیام نبود کلید قابل استفاده (ثبت‌نشده یا همه غیرفعال/بیش از بودجه)
+func noUsableKeyMessage(db *sql.DB, userID int64) string {
+	if keys, err := models.ListAPIKeys(db, userID); err == nil && len(keys) > 0 {
+		return "⚠️ همه کلیدهای API شما غیرفعال هستند یا به سقف بودجه ماهانه رسیده‌اند.\nمدیریت کلیدها: /keys"
+	}
+	return "⚠️ هنوز کلید API ثبت نکرده‌اید.\nکلید خود را ارسال کنید تا ثبت شود."
+}
+
+// apiErrorMessage پیام مناسب کاربر برای خطای Provider
+func apiErrorMessage(err error) string {
+	var apiErr *services.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.Code {
+		case "insufficient_quota":
+			return "❌ سقف مصرف API Key شما به پایان رسیده است. لطفاً API Key جدیدی اضافه کنید."
+		case "invalid_api_key":
+			return "❌ API Key نامعتبر است. لطفاً API Key خود را بررسی کنید."
+		case "rate_limit_exceeded":
+			return "⏳ محدودیت درخواست سرویس فعال شده است. لطفاً کمی بعد تلاش کنید."
+		}
+	}
+	return "❌ خطا در ارتباط با سرویس هوش مصنوعی. لطفاً مجدد تلاش کنید."
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"gopkg.in/telebot.v3"
+
+	"telegram-bot-manager/models"
+	"telegram-bot-manager/utils"
+)
+
+// نام نمایشی سطوح سهمیه (سطح پلن‌ها با نام پلن نمایش داده می‌شود)
+var quotaTierNames = map[string]string{
+	models.QuotaTierFree: "🆓 عادی",
+	models.QuotaTierVIP:  "💎 VIP",
+}
+
+// checkQuota بررسی سهمیه روزانه کاربر پیش از ارسال درخواست به مدل
+//
+// در صورت خطا در بررسی، درخواست رد نمی‌شود تا مشکل Redis یا دیتابیس ربات را از کار نیندازد.
+func checkQuota(db *sql.DB, userID int64) (*models.QuotaStatus, bool) {
+	status, err := models.CheckUsageLimit(db, userID)
+	if err != nil {
+		log.Printf("خطا در بررسی سهمیه کاربر %d: %v", userID, err)
+		return nil, true
+	}
+	return status, !status.Exceeded()
+}
+
+// quotaExceededText پیام پایان سهمیه روزانه
+func quotaExceededText(status *models.QuotaStatus) string {
+	var b strings.Builder
+	b.WriteString("⚠️ شما به سقف مصرف روزانه رسیده‌اید.\n\n")
+	b.WriteString(quotaStatusLines(status))
+	if status.Tier == models.QuotaTierFree {
+		b.WriteString("\n💎 برای سهمیه بیشتر اشتراک VIP تهیه کنید.")
+	}
+	return b.String()
+}
+
+// quotaStatusLines خلاصه سهمیه امروز: مصرف، باقی‌مانده و زمان ریست
+func quotaStatusLines(status *models.QuotaStatus) string {
+	var b strings.Builder
+	tier := quotaTierNames[status.Tier]
+	if tier == "" {
+		tier = "💎 پلن " + planNames[status.Tier]
+	}
+	fmt.Fprintf(&b, "🎚️ سطح: %s\n", tier)
+	if status.Limits.Unlimited() {
+		b.WriteString("♾️ سهمیه روزانه: نامحدود\n")
+		return b.String()
+	}
+
+	if status.Limits.MessagesPerDay > 0 {
+		fmt.Fprintf(&b, "📨 پیام امروز: %d از %d (باقی‌مانده: %d)\n",
+			status.MessagesUsed, status.Limits.MessagesPerDay, status.RemainingMessages())
+	}
+	if status.Limits.TokensPerDay > 0 {
+		fmt.Fprintf(&b, "🔢 توکن امروز: %s از %s (باقی‌مانده: %s)\n",
+			utils.FormatCompact(float64(status.TokensUsed)), utils.FormatCompact(float64(status.Limits.TokensPerDay)),
+			utils.FormatCompact(float64(status.RemainingTokens())))
+	}
+	fmt.Fprintf(&b, "🕛 ریست سهمیه: %s دیگر\n", formatDuration(time.Until(status.ResetAt)))
+	return b.String()
+}
+
+// replyQuotaExceeded پاسخ پایان سهمیه همراه با دکمه خرید VIP برای کاربران عادی
+func replyQuotaExceeded(c telebot.Context, status *models.QuotaStatus) error {
+	if status.Tier != models.QuotaTierFree {
+		return c.Reply(quotaExceededText(status))
+	}
+
+	menu := &telebot.ReplyMarkup{}
+	menu.Inline(menu.Row(menu.URL("🎯 ارتقاء به VIP", "https://t.me/"+c.Bot().Me.Username+"?start=vip_request")))
+	return c.Reply(quotaExceededText(status), menu)
+}
+
+// formatDuration نمایش مدت به صورت «X ساعت و Y دقیقه»
+func formatDuration(d time.Duration) string {
+	if d < time.Minute {
+		return "کمتر از یک دقیقه"
+	}
+	hours := int(d.Hours())
+	minutes := int(d.Minutes()) % 60
+	switch {
+	case hours == 0:
+		return fmt.Sprintf("%d دقیقه", minutes)
+	case minutes == 0:
+		return fmt.Sprintf("%d ساعت", hours)
+	}
+	return fmt.Sprintf("%d ساعت و %d دقیقه", hours, minutes)
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"telegram-bot-manager/database"
+	"telegram-bot-manager/models"
+)
+
+// پنجره محدودیت‌های نرخ درخواست
+const rateLimitWindow = time.Minute
+
+// userRateLimit محدودیت سراسری درخواست‌های کاربر
+func userRateLimit(userID int64) database.RateLimit {
+	return database.UserRate(userID, settings.UserRateLimit, rateLimitWindow)
+}
+
+// groupRateLimits محدودیت‌های پرسش عضو در گروه: سقف گروه، سقف هر عضو و سقف سراسری کاربر
+func groupRateLimits(group *models.Group, userID int64) []database.RateLimit {
+	return []database.RateLimit{
+		database.GroupRate(group.GroupID, group.RateLimit, rateLimitWindow),
+		database.MemberRate(group.GroupID, userID, settings.MemberRateLimit, rateLimitWindow),
+		userRateLimit(userID),
+	}
+}
+
+// retrySeconds زمان انتظار به ثانیه (حداقل یک ثانیه)
+func retrySeconds(d time.Duration) int {
+	if s := int(math.Ceil(d.Seconds())); s > 1 {
+		return s
+	}
+	return 1
+}
+
+// rateLimitMessage پیام رد درخواست با زمان دقیق تلاش دوباره بر اساس محدودیتی که پر شده
+func rateLimitMessage(result database.RateLimitResult) string {
+	wait := retrySeconds(result.RetryAfter)
+	if result.Exceeded == nil {
+		return fmt.Sprintf("⏱️ لطفاً %d ثانیه دیگر دوباره تلاش کنید.", wait)
+	}
+
+	limit := result.Exceeded.Limit
+	switch result.Exceeded.Scope {
+	case database.RateScopeGroup:
+		return fmt.Sprintf(
+			"⚠️ محدودیت پاسخ‌گویی در گروه فعال است.\n"+
+				"حداکثر %d سوال در دقیقه پاسخ داده می‌شود.\n"+
+				"🕒 لطفاً %d ثانیه دیگر دوباره تلاش کنید.",
+			limit, wait,
+		)
+	case database.RateScopeMember:
+		return fmt.Sprintf(
+			"⏱️ هر عضو در این گروه حداکثر %d سوال در دقیقه می‌تواند بپرسد.\n"+
+				"🕒 لطفاً %d ثانیه دیگر دوباره تلاش کنید.",
+			limit, wait,
+		)
+	}
+	return fmt.Sprintf(
+		"⏱️ شما به سقف %d درخواست در دقیقه رسیده‌اید.\n"+
+			"🕒 لطفاً %d ثانیه دیگر دوباره تلاش کنید.",
+		limit, wait,
+	)
+}
@@ -0,0 +1,27 @@
+package handlers
+
+// Settings - تنظیمات قابل پیکربندی هندلرها
+type Settings struct {
+	GroupRateLimit  int // حداکثر سوال در دقیقه برای گروه‌های تازه ثبت‌شده (قابل تغییر توسط مالک گروه)
+	MemberRateLimit int // حداکثر سوال در دقیقه برای هر عضو در هر گروه
+	UserRateLimit   int // حداکثر درخواست در دقیقه برای هر کاربر (چت خصوصی و همه گروه‌ها)
+}
+
+var settings = Settings{
+	GroupRateLimit:  5,
+	MemberRateLimit: 3,
+	UserRateLimit:   20,
+}
+
+// Configure اعمال تنظیمات هندلرها (در زمان راه‌اندازی از main فراخوانی می‌شود)
+func Configure(s Settings) {
+	if s.GroupRateLimit > 0 {
+		settings.GroupRateLimit = s.GroupRateLimit
+	}
+	if s.MemberRateLimit > 0 {
+		settings.MemberRateLimit = s.MemberRateLimit
+	}
+	if s.UserRateLimit > 0 {
+		settings.UserRateLimit = s.UserRateLimit
+	}
+}
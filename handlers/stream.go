@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"gopkg.in/telebot.v3"
+	"telegram-bot-manager/models"
+	"telegram-bot-manager/services"
+)
+
+const (
+	// فاصله حداقل بین دو ویرایش پیام (تلگرام ویرایش‌های پشت‌سرهم را محدود می‌کند)
+	streamEditInterval = 1500 * time.Millisecond
+	// حداقل تعداد کاراکتر جدید برای ویرایش بعدی
+	streamMinDelta = 20
+	// حداکثر طول یک پیام تلگرام
+	telegramMessageLimit = 4096
+	// متن پیام موقت تا رسیدن اولین بخش پاسخ
+	streamPlaceholder = "⏳ در حال نوشتن پاسخ..."
+	// نشانگر ادامه داشتن پاسخ
+	streamCursor = " ▌"
+)
+
+// streamingReply - پیامی که با رسیدن پاسخ تدریجی مدل ویرایش می‌شود
+type streamingReply struct {
+	c        telebot.Context
+	reply    bool
+	msg      *telebot.Message
+	lastEdit time.Time
+	lastLen  int
+	// تا این زمان به دلیل محدودیت تلگرام ویرایشی انجام نمی‌شود
+	pausedUntil time.Time
+}
+
+// askWithStreaming پرسش از مدل؛ در صورت پشتیبانی Provider پاسخ تدریجی در یک پیام ویرایش‌شونده نمایش داده می‌شود
+//
+// کلیدها به ترتیب امتحان می‌شوند و کلید استفاده‌شده برگردانده می‌شود.
+// اگر reply برقرار باشد پیام به صورت پاسخ به پیام کاربر ارسال می‌شود. پیام نهایی باید با finish ارسال شود.
+func askWithStreaming(c telebot.Context, db *sql.DB, keys []*models.APIKey, messages []services.Message, reply bool) (*streamingReply, services.ChatResult, *models.APIKey, error) {
+	r := &streamingReply{c: c, reply: reply}
+	req := services.ChatRequest{Messages: messages}
+
+	if len(keys) == 0 || !services.SupportsStreaming(keys[0]) {
+		_ = c.Notify(telebot.Typing)
+		result, key, err := services.ChatWithFailover(context.Background(), db, keys, req, nil)
+		return r, result, key, err
+	}
+
+	// پیام موقت؛ اگر ارسال نشد پاسخ در پایان یک‌جا ارسال می‌شود
+	if msg, err := r.send(streamPlaceholder); err == nil {
+		r.msg = msg
+	} else {
+		log.Printf("خطا در ارسال پیام موقت: %v", err)
+	}
+
+	result, key, err := services.ChatWithFailover(context.Background(), db, keys, req, r.update)
+	return r, result, key, err
+}
+
+// update ویرایش پیام با متن جدید با رعایت محدودیت تعداد ویرایش
+func (r *streamingReply) update(text string) {
+	if r.msg == nil {
+		return
+	}
+
+	now := time.Now()
+	if now.Before(r.pausedUntil) || now.Sub(r.lastEdit) < streamEditInterval || len(text)-r.lastLen < streamMinDelta {
+		return
+	}
+
+	preview := truncateRunes(text, telegramMessageLimit-len([]rune(streamCursor))) + streamCursor
+	_, err := r.c.Bot().Edit(r.msg, preview)
+	r.lastEdit = now
+	r.lastLen = len(text)
+
+	var flood telebot.FloodError
+	if errors.As(err, &flood) {
+		r.pausedUntil = now.Add(time.Duration(flood.RetryAfter) * time.Second)
+	}
+}
+
+// finish نمایش متن نهایی؛ پیام موقت ویرایش می‌شود و بخش‌های اضافه پیام جداگانه ارسال می‌شوند
+//
+// ابتدا با قالب Markdown تلاش می‌شود و در صورت خطای قالب، متن ساده ارسال می‌شود.
+func (r *streamingReply) finish(text string, markup *telebot.ReplyMarkup) error {
+	parts := splitMessage(text, telegramMessageLimit)
+	for i, part := range parts {
+		var opts []interface{}
+		if markup != nil && i == len(parts)-1 {
+			opts = append(opts, markup)
+		}
+
+		var err error
+		if i == 0 && r.msg != nil {
+			err = r.edit(part, opts...)
+		} else {
+			_, err = r.sendFormatted(part, opts...)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fail نمایش پیام خطا به جای پاسخ
+func (r *streamingReply) fail(text string) error {
+	if r.msg != nil {
+		_, err := r.c.Bot().Edit(r.msg, text)
+		return err
+	}
+	_, err := r.send(text)
+	return err
+}
+
+// edit ویرایش پیام موقت با متن نهایی
+func (r *streamingReply) edit(text string, opts ...interface{}) error {
+	_, err := r.c.Bot().Edit(r.msg, text, append(opts, telebot.ModeMarkdown)...)
+	if err == nil || errors.Is(err, telebot.ErrSameMessageContent) || errors.Is(err, telebot.ErrMessageNotModified) {
+		return nil
+	}
+	_, err = r.c.Bot().Edit(r.msg, text, opts...)
+	if errors.Is(err, telebot.ErrSameMessageContent) || errors.Is(err, telebot.ErrMessageNotModified) {
+		return nil
+	}
+	return err
+}
+
+// sendFormatted ارسال پیام جدید با Markdown و بازگشت به متن ساده در صورت خطا
+func (r *streamingReply) sendFormatted(text string, opts ...interface{}) (*telebot.Message, error) {
+	if msg, err := r.send(text, append(opts, telebot.ModeMarkdown)...); err == nil {
+		return msg, nil
+	}
+	return r.send(text, opts...)
+}
+
+// send ارسال پیام جدید (در صورت نیاز به صورت پاسخ به پیام کاربر)
+func (r *streamingReply) send(text string, opts ...interface{}) (*telebot.Message, error) {
+	if r.reply && r.c.Message() != nil {
+		// SendOptions باید اول بیاید چون گزینه‌های قبلی را بازنویسی می‌کند
+		opts = append([]interface{}{&telebot.SendOptions{ReplyTo: r.c.Message()}}, opts...)
+	}
+	return r.c.Bot().Send(r.c.Recipient(), text, opts...)
+}
+
+// truncateRunes کوتاه کردن متن بدون شکستن کاراکترهای چندبایتی
+func truncateRunes(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	return string(runes[:limit])
+}
+
+// splitMessage تقسیم متن طولانی به بخش‌هایی در حد مجاز تلگرام (ترجیحاً روی خط جدید)
+func splitMessage(text string, limit int) []string {
+	runes := []rune(text)
+	var parts []string
+	for len(runes) > limit {
+		cut := limit
+		for i := limit; i > limit/2; i-- {
+			if runes[i-1] == '\n' {
+				cut = i
+				break
+			}
+		}
+		parts = append(parts, string(runes[:cut]))
+		runes = runes[cut:]
+	}
+	return append(parts, string(runes))
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"image/color"
+	"log"
+	"strings"
+
+	"gopkg.in/telebot.v3"
+
+	"telegram-bot-manager/models"
+	"telegram-bot-manager/utils"
+)
+
+const (
+	// تعداد روزهای نمودار مصرف
+	usageChartDays = 30
+	// حداکثر ردیف تفکیک مدل‌ها
+	usageMaxModels = 8
+)
+
+// نام نمایشی محل‌های استفاده
+var surfaceNames = map[string]string{
+	models.SurfacePrivate: "💬 چت خصوصی",
+	models.SurfaceGroup:   "👥 گروه‌ها",
+	models.SurfaceChannel: "📢 کانال‌ها",
+}
+
+// رنگ توکن‌های ورودی و خروجی در نمودار
+var usageChartColors = []color.RGBA{
+	{66, 133, 244, 255},
+	{251, 140, 0, 255},
+}
+
+// RegisterUsageHandlers ثبت دستور /usage
+func RegisterUsageHandlers(bot *telebot.Bot, db *sql.DB) {
+	bot.Handle("/usage", func(c telebot.Context) error {
+		if c.Chat().Type != telebot.ChatPrivate {
+			return c.Reply("📊 گزارش مصرف فقط در چت خصوصی با ربات نمایش داده می‌شود.")
+		}
+		return showUsage(c, db)
+	})
+}
+
+// /usage - گزارش مصرف کاربر همراه با نمودار ۳۰ روز اخیر
+func showUsage(c telebot.Context, db *sql.DB) error {
+	userID := c.Sender().ID
+
+	periods, err := models.GetUserUsagePeriods(db, userID)
+	if err != nil {
+		log.Printf("خطا در دریافت مصرف کاربر %d: %v", userID, err)
+		return c.Send("❌ خطا در دریافت گزارش مصرف.")
+	}
+
+	rate, err := models.GetUSDToTomanRate(db)
+	if err != nil {
+		log.Printf("خطا در دریافت نرخ دلار: %v", err)
+	}
+
+	var b strings.Builder
+	b.WriteString("📊 گزارش مصرف شما\n\n")
+	fmt.Fprintf(&b, "📅 امروز: %s\n", usageTotalsLine(periods.Today, rate))
+	fmt.Fprintf(&b, "🗓️ این هفته: %s\n", usageTotalsLine(periods.Week, rate))
+	fmt.Fprintf(&b, "🗓️ این ماه: %s\n", usageTotalsLine(periods.Month, rate))
+
+	if status, err := models.CheckUsageLimit(db, userID); err != nil {
+		log.Printf("خطا در بررسی سهمیه کاربر %d: %v", userID, err)
+	} else {
+		b.WriteString("\n" + quotaStatusLines(status))
+	}
+
+	if periods.Month.Requests > 0 {
+		if byModel, err := models.GetUserUsageByModel(db, userID); err != nil {
+			log.Printf("خطا در دریافت مصرف مدل‌های کاربر %d: %v", userID, err)
+		} else if len(byModel) > 0 {
+			b.WriteString("\n🧠 به تفکیک مدل (این ماه):\n")
+			for i, m := range byModel {
+				if i == usageMaxModels {
+					fmt.Fprintf(&b, "• … و %d مدل دیگر\n", len(byModel)-usageMaxModels)
+					break
+				}
+				name := m.Name
+				if name == "" {
+					name = "نامشخص"
+				}
+				fmt.Fprintf(&b, "• %s: %s\n", name, usageBreakdownLine(m))
+			}
+		}
+
+		if bySurface, err := models.GetUserUsageBySurface(db, userID); err != nil {
+			log.Printf("خطا در دریافت مصرف محل‌های کاربر %d: %v", userID, err)
+		} else if len(bySurface) > 0 {
+			b.WriteString("\n📍 به تفکیک محل استفاده (این ماه):\n")
+			for _, s := range bySurface {
+				name := surfaceNames[s.Name]
+				if name == "" {
+					name = "❔ نامشخص"
+				}
+				fmt.Fprintf(&b, "• %s: %s\n", name, usageBreakdownLine(s))
+			}
+		}
+	}
+
+	b.WriteString("\n🔑 مصرف و بودجه هر کلید: /keys")
+	if err := c.Send(b.String()); err != nil {
+		return err
+	}
+
+	points, err := models.GetUserDailyUsage(db, userID, usageChartDays)
+	if err != nil {
+		log.Printf("خطا در دریافت مصرف روزانه کاربر %d: %v", userID, err)
+		return nil
+	}
+	chart, err := renderUsageChart(points)
+	if err != nil {
+		log.Printf("خطا در رسم نمودار مصرف: %v", err)
+		return nil
+	}
+	if chart == nil {
+		return nil
+	}
+
+	photo := &telebot.Photo{
+		File:    telebot.FromReader(bytes.NewReader(chart)),
+		Caption: fmt.Sprintf("📈 مصرف توکن در %d روز اخیر\n🟦 ورودی  🟧 خروجی", usageChartDays),
+	}
+	return c.Send(photo)
+}
+
+// renderUsageChart رسم نمودار مصرف روزانه؛ اگر مصرفی نباشد nil برمی‌گرداند
+func renderUsageChart(points []models.DailyUsagePoint) ([]byte, error) {
+	hasUsage := false
+	bars := make([]utils.ChartBar, len(points))
+	for i, p := range points {
+		bars[i].Values = []float64{float64(p.PromptTokens), float64(p.CompletionTokens)}
+		if p.PromptTokens+p.CompletionTokens > 0 {
+			hasUsage = true
+		}
+		// برچسب هر پنج روز و روز آخر
+		if (len(points)-1-i)%5 == 0 {
+			bars[i].Label = p.Date.Format("1/2")
+		}
+	}
+	if !hasUsage {
+		return nil, nil
+	}
+
+	return utils.RenderBarChart(utils.BarChart{
+		Width:  900,
+		Height: 420,
+		Colors: usageChartColors,
+		Bars:   bars,
+	})
+}
+
+// usageTotalsLine خلاصه مصرف یک بازه
+func usageTotalsLine(t models.UsageTotals, rate float64) string {
+	if t.Requests == 0 && t.Tokens == 0 {
+		return "بدون مصرف"
+	}
+	return fmt.Sprintf("%d درخواست، %s توکن، $%.4f (%s تومان)",
+		t.Requests, utils.FormatCompact(float64(t.Tokens)), t.Cost, formatPrice(t.Cost*rate))
+}
+
+// usageBreakdownLine خلاصه مصرف یک مدل یا محل استفاده
+func usageBreakdownLine(b models.UsageBreakdown) string {
+	return fmt.Sprintf("%d درخواست، %s توکن، $%.4f",
+		b.Requests, utils.FormatCompact(float64(b.Tokens)), b.Cost)
+}
@@ -1,41 +1,240 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"gopkg.in/telebot.v3"
+	"log"
 	"strings"
 	"telegram-bot-manager/models"
+	"telegram-bot-manager/services"
 )
 
 // -----------------------------
 // مدیریت API کاربران
 // -----------------------------
 
+// راهنمای فرمت‌های دستور /addapi
+const addAPIUsage = "🔑 لطفاً کلید API خود را بعد از دستور ارسال کنید.\nمثال‌ها:\n" +
+	"`/addapi sk-abc123`\n" +
+	"`/addapi anthropic sk-ant-abc123`\n" +
+	"`/addapi local http://localhost:11434/v1 [کلید] [مدل]`"
+
+// apiKeyInput - کلید API تجزیه‌شده از ورودی کاربر
+type apiKeyInput struct {
+	Provider string
+	APIKey   string
+	BaseURL  string
+	Model    string
+}
+
+// parseAPIKeyInput تجزیه ورودی /addapi
+//
+// فرمت‌ها: «sk-...»، «anthropic sk-ant-...»، «openai sk-... [مدل]» و «local آدرس [کلید] [مدل]».
+// کلیدهای sk-ant- بدون نام Provider هم Anthropic تشخیص داده می‌شوند.
+func parseAPIKeyInput(args string) (*apiKeyInput, error) {
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("کلید API ارسال نشده است")
+	}
+
+	provider := strings.ToLower(fields[0])
+	switch provider {
+	case models.ProviderOpenAI, models.ProviderAnthropic, models.ProviderLocal:
+		fields = fields[1:]
+	default:
+		provider = ""
+	}
+
+	input := &apiKeyInput{Provider: provider}
+
+	if provider == models.ProviderLocal {
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("آدرس سرور محلی را وارد کنید (مثلاً http://localhost:11434/v1)")
+		}
+		if !strings.HasPrefix(fields[0], "http://") && !strings.HasPrefix(fields[0], "https://") {
+			return nil, fmt.Errorf("آدرس سرور محلی باید با http:// یا https:// شروع شود")
+		}
+		input.BaseURL = fields[0]
+		if len(fields) > 1 {
+			input.APIKey = fields[1]
+		}
+		if len(fields) > 2 {
+			input.Model = fields[2]
+		}
+		return input, nil
+	}
+
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("کلید API ارسال نشده است")
+	}
+	input.APIKey = fields[0]
+	if len(fields) > 1 {
+		input.Model = fields[1]
+	}
+
+	if input.Provider == "" {
+		if strings.HasPrefix(input.APIKey, "sk-ant-") {
+			input.Provider = models.ProviderAnthropic
+		} else {
+			input.Provider = models.ProviderOpenAI
+		}
+	}
+
+	switch input.Provider {
+	case models.ProviderAnthropic:
+		if !strings.HasPrefix(input.APIKey, "sk-ant-") {
+			return nil, fmt.Errorf("فرمت کلید Anthropic معتبر نیست. باید با `sk-ant-` شروع شود.")
+		}
+	case models.ProviderOpenAI:
+		if !strings.HasPrefix(input.APIKey, "sk-") {
+			return nil, fmt.Errorf("فرمت کلید API معتبر نیست. باید با `sk-` شروع شود.")
+		}
+	}
+
+	return input, nil
+}
+
+// providerNames نام نمایشی Provider ها
+var providerNames = map[string]string{
+	models.ProviderOpenAI:    "OpenAI",
+	models.ProviderAnthropic: "Anthropic",
+	models.ProviderLocal:     "سرور محلی",
+}
+
 // HandleAddAPI - افزودن کلید API جدید
 func HandleAddAPI(bot *telebot.Bot, db *sql.DB) telebot.HandlerFunc {
 	return func(c telebot.Context) error {
-		userID := c.Sender().ID
-
 		args := strings.TrimSpace(c.Message().Payload)
 		if args == "" {
-			return c.Send("🔑 لطفاً کلید API خود را بعد از دستور ارسال کنید.\nمثال:\n`/addapi sk-abc123`", &telebot.SendOptions{ParseMode: telebot.ModeMarkdown})
+			return c.Send(addAPIUsage, &telebot.SendOptions{ParseMode: telebot.ModeMarkdown})
 		}
 
-		if !strings.HasPrefix(args, "sk-") {
-			return c.Send("❌ فرمت کلید API معتبر نیست. باید با `sk-` شروع شود.")
+		return saveAPIKeyFromMessage(c, db, args)
+	}
+}
+
+// saveAPIKeyFromMessage ذخیره کلید ارسال‌شده و حذف پیام حاوی کلید از چت
+func saveAPIKeyFromMessage(c telebot.Context, db *sql.DB, args string) error {
+	// کلید ارسال‌شده در گروه بلافاصله حذف می‌شود و ذخیره نمی‌شود
+	if c.Chat().Type != telebot.ChatPrivate {
+		if err := c.Delete(); err != nil {
+			log.Printf("خطا در حذف پیام حاوی کلید در چت %d: %v", c.Chat().ID, err)
 		}
+		return c.Send("⚠️ کلید API را فقط در چت خصوصی با ربات ارسال کنید.")
+	}
 
-		err := models.SaveAPIKey(db, userID, args)
-		if err != nil {
-			return c.Send(fmt.Sprintf("❌ خطا در ذخیره کلید: %v", err))
+	// پیام کاربر حاوی کلید خام است و نباید در تاریخچه چت بماند (چه کلید معتبر باشد چه نه)
+	deleted := c.Delete() == nil
+
+	input, err := parseAPIKeyInput(args)
+	if err != nil {
+		return c.Send("❌ " + err.Error())
+	}
+
+	key := &models.APIKey{
+		UserID:   c.Sender().ID,
+		APIKey:   input.APIKey,
+		Provider: input.Provider,
+		BaseURL:  input.BaseURL,
+		Model:    input.Model,
+	}
+
+	// کلید تکراری به جای افزودن دوباره به حلقه، بروزرسانی می‌شود
+	existing, err := models.ListAPIKeys(db, key.UserID)
+	if err != nil {
+		log.Printf("خطا در دریافت کلیدهای کاربر %d: %v", key.UserID, err)
+		return c.Send("❌ خطا در ذخیره کلید. لطفاً دوباره تلاش کنید.")
+	}
+	for _, k := range existing {
+		if k.APIKey == key.APIKey {
+			key.ID = k.ID
+			key.IsActive = k.IsActive
+			break
+		}
+	}
+	updated := key.ID != 0
+
+	// بررسی کلید نزد Provider پیش از ذخیره
+	_ = c.Notify(telebot.Typing)
+	info, err := services.ValidateKey(context.Background(), key)
+	if err != nil {
+		log.Printf("اعتبارسنجی کلید کاربر %d ناموفق بود: %v", key.UserID, err)
+		return c.Send(keyValidationMessage(err, key))
+	}
+
+	if key.Model != "" && len(info.Models) > 0 && !containsString(info.Models, key.Model) {
+		return c.Send(fmt.Sprintf("❌ مدل «%s» برای این کلید در دسترس نیست.\n📋 نمونه مدل‌های در دسترس: %s",
+			key.Model, strings.Join(firstN(info.Models, 5), "، ")))
+	}
+
+	check := services.KeyCheckResult(info, nil, models.KeyStatusUnchecked)
+	if err := models.SaveAPIKey(db, key, check); err != nil {
+		log.Printf("خطا در ذخیره کلید کاربر %d: %v", key.UserID, err)
+		return c.Send("❌ خطا در ذخیره کلید. لطفاً دوباره تلاش کنید.")
+	}
+
+	msg := fmt.Sprintf("✅ کلید API شما (%s) بررسی و به حلقه کلیدها با اولویت %d اضافه شد.\n🔑 %s", providerNames[input.Provider], key.Priority, key.Masked())
+	if updated {
+		msg = fmt.Sprintf("✅ این کلید قبلاً ثبت شده بود؛ تنظیمات آن (%s) بروزرسانی شد.\n🔑 %s", providerNames[input.Provider], key.Masked())
+		if !key.IsActive {
+			msg += "\n⏸ این کلید غیرفعال است و تا فعال کردن دوباره از /keys استفاده نمی‌شود."
+		}
+	}
+	if info.Organization != "" {
+		msg += "\n🏢 سازمان: " + info.Organization
+	}
+	if len(info.Models) > 0 {
+		msg += fmt.Sprintf("\n📋 %d مدل در دسترس (مثلاً %s)", len(info.Models), strings.Join(firstN(info.Models, 3), "، "))
+	}
+	if deleted {
+		msg += "\n🧹 پیام حاوی کلید برای امنیت حذف شد."
+	} else {
+		msg += "\n⚠️ لطفاً پیام حاوی کلید را خودتان حذف کنید."
+	}
+	msg += "\n\n🔑 مدیریت کلیدها: /keys"
+	return c.Send(msg)
+}
+
+// keyValidationMessage پیام خطای اعتبارسنجی کلید برای کاربر
+func keyValidationMessage(err error, key *models.APIKey) string {
+	var apiErr *services.APIError
+	if !errors.As(err, &apiErr) {
+		if key.Provider == models.ProviderLocal {
+			return "❌ ارتباط با سرور محلی برقرار نشد. آدرس و در دسترس بودن سرور را بررسی کنید."
 		}
+		return "❌ ارتباط با سرویس برای بررسی کلید برقرار نشد. لطفاً کمی بعد دوباره تلاش کنید."
+	}
+
+	check := services.KeyCheckResult(services.KeyInfo{}, err, models.KeyStatusUnchecked)
+	switch check.Status {
+	case models.KeyStatusInvalid:
+		return fmt.Sprintf("❌ کلید %s توسط %s نامعتبر اعلام شد و ذخیره نشد.", key.Masked(), apiErr.Provider)
+	case models.KeyStatusQuotaExceeded:
+		return fmt.Sprintf("❌ اعتبار حساب کلید %s به پایان رسیده است و ذخیره نشد.", key.Masked())
+	}
+	return fmt.Sprintf("❌ %s کلید را نپذیرفت (%d). کلید ذخیره نشد.", apiErr.Provider, apiErr.StatusCode)
+}
+
+func containsString(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
 
-		return c.Send("✅ کلید API شما با موفقیت ذخیره شد.")
+func firstN(list []string, n int) []string {
+	if len(list) > n {
+		return list[:n]
 	}
+	return list
 }
 
-// HandleRemoveAPI - حذف کلید API کاربر
+// HandleRemoveAPI - حذف همه کلیدهای API کاربر
 func HandleRemoveAPI(bot *telebot.Bot, db *sql.DB) telebot.HandlerFunc {
 	return func(c telebot.Context) error {
 		userID := c.Sender().ID
@@ -45,6 +244,6 @@ func HandleRemoveAPI(bot *telebot.Bot, db *sql.DB) telebot.HandlerFunc {
 			return c.Send(fmt.Sprintf("❌ خطا در حذف کلید: %v", err))
 		}
 
-		return c.Send("🗑️ کلید API شما حذف شد.")
+		return c.Send("🗑️ همه کلیدهای API شما حذف شد.\nبرای حذف تنها یک کلید از /keys استفاده کنید.")
 	}
 }
@@ -4,43 +4,100 @@ import (
 	"log"
 	"os"
 	"time"
+	// داده منطقه‌های زمانی (برای quotas.timezone در کانتینرهای بدون tzdata)
+	_ "time/tzdata"
 
 	"gopkg.in/telebot.v3"
 
 	"telegram-bot-manager/database"
 	"telegram-bot-manager/handlers"
+	"telegram-bot-manager/models"
+	"telegram-bot-manager/services"
+	"telegram-bot-manager/utils"
 )
 
 func main() {
+	cfg, args, err := LoadConfig(os.Args[1:])
+	if err != nil {
+		log.Fatalf("❌  %v", err)
+	}
+
+	// زیر‌دستور مایگریشن: ./bot migrate up|down|status
+	if len(args) > 0 && args[0] == "migrate" {
+		if err := runMigrateCommand(cfg.DatabaseURL, args[1:]); err != nil {
+			log.Fatalf("❌  خطا در مایگریشن: %v", err)
+		}
+		return
+	}
+
+	// زیر‌دستور چرخش کلید اصلی: ./bot rotate-master-key
+	if len(args) > 0 && args[0] == "rotate-master-key" {
+		if err := runRotateMasterKeyCommand(cfg); err != nil {
+			log.Fatalf("❌  خطا در چرخش کلید اصلی: %v", err)
+		}
+		return
+	}
+
 	log.Println("🚀 در حال راه‌اندازی ربات...")
 
-	// ۱️⃣ اتصال به PostgreSQL
-	db, err := database.ConnectPostgres()
-	if err != nil {
+	// ۱️⃣ اتصال به PostgreSQL و اعمال مایگریشن‌ها
+	if err := database.InitPostgreSQL(cfg.DatabaseURL); err != nil {
 		log.Fatalf("❌  خطا در اتصال به PostgreSQL: %v", err)
 	}
-	log.Println("✅  اتصال موفق به PostgreSQL برقرار شد.")
+	db := database.DB
 
-	// ۲️⃣ اتصال به Redis
-	rdb, err := database.ConnectRedis()
+	if err := models.ApplyPlanPrices(db, cfg.PlanPrices); err != nil {
+		log.Printf("⚠️  خطا در اعمال قیمت پلن‌ها: %v", err)
+	}
+
+	// کلید اصلی رمزنگاری کلیدهای API؛ کلیدهای قدیمی رمز‌نشده همین‌جا رمز می‌شوند
+	masterKeys, err := cfg.MasterKeys()
 	if err != nil {
-		log.Fatalf("❌  خطا در اتصال به Redis: %v", err)
+		log.Fatalf("❌  %v", err)
+	}
+	if err := utils.ConfigureMasterKeys(cfg.Encryption.KeyVersion, masterKeys); err != nil {
+		log.Fatalf("❌  خطا در تنظیم کلید اصلی: %v", err)
+	}
+	if res, err := models.EncryptLegacyAPIKeys(db); err != nil {
+		log.Fatalf("❌  خطا در رمزنگاری کلیدهای API قدیمی: %v", err)
+	} else if res.Rewrapped > 0 {
+		log.Printf("🔐 %d کلید API قدیمی رمز شد", res.Rewrapped)
 	}
-	log.Println("✅  اتصال موفق به Redis برقرار شد.")
 
-	// جلوگیری از خطای استفاده‌نشده
-	_ = db
-	_ = rdb
+	// ادمین‌های تنظیمات همیشه نقش مالک دارند؛ بقیه ادمین‌ها از داخل پنل اضافه می‌شوند
+	if err := models.EnsureOwners(db, cfg.AdminIDs); err != nil {
+		log.Fatalf("❌  خطا در ثبت ادمین‌های اصلی: %v", err)
+	}
+
+	// ۲️⃣ اتصال به Redis
+	if err := database.InitRedis(cfg.Redis.Addr, cfg.Redis.Password, cfg.Redis.DB); err != nil {
+		log.Fatalf("❌  خطا در اتصال به Redis: %v", err)
+	}
 
-	// ۳️⃣ خواندن توکن ربات از متغیر محیطی
-	token := os.Getenv("BOT_TOKEN")
-	if token == "" {
-		log.Fatal("❌  متغیر BOT_TOKEN تنظیم نشده است.")
+	// ۳️⃣ اعمال تنظیمات روی سرویس‌ها و هندلرها
+	services.Configure(services.Settings{
+		BaseURL:       cfg.OpenAI.BaseURL,
+		DefaultModel:  cfg.OpenAI.DefaultModel,
+		ContextTokens: cfg.OpenAI.ContextTokens,
+	})
+	handlers.Configure(handlers.Settings{
+		GroupRateLimit:  cfg.RateLimits.GroupPerMinute,
+		MemberRateLimit: cfg.RateLimits.MemberPerMinute,
+		UserRateLimit:   cfg.RateLimits.UserPerMinute,
+	})
+	quotas, err := cfg.QuotaSettings()
+	if err != nil {
+		log.Fatalf("❌  %v", err)
 	}
+	models.ConfigureQuotas(quotas)
+	models.ConfigureChannelLimits(cfg.ChannelLimitSettings())
+	services.ConfigureScheduler(services.SchedulerSettings{
+		CatchupGrace: time.Duration(cfg.Scheduler.CatchupGraceMinutes) * time.Minute,
+	})
 
 	// ۴️⃣ پیکربندی ربات
 	pref := telebot.Settings{
-		Token:  token,
+		Token:  cfg.BotToken,
 		Poller: &telebot.LongPoller{Timeout: 10 * time.Second},
 	}
 
@@ -52,13 +109,55 @@ func main() {
 
 	// ۶️⃣ تعریف هندلرهای اصلی
 	bot.Handle("/start", func(c telebot.Context) error {
-		msg := "سلام 👋\nمن آماده‌ام — از دکمه‌ها یا ارسال پیام استفاده کن.\n\nدکمه‌ها:\n➕ /addapi - افزودن API\n🗑️ /removeapi - حذف API\n(پس از افزودن API، هر پیام شما به ChatGPT ارسال می‌شود.)"
+		// لینک ارتقاء از گروه‌ها: t.me/<bot>?start=vip_request
+		if c.Message().Payload == "vip_request" {
+			return handlers.HandleVIPPurchase(c, db)
+		}
+
+		msg := "سلام 👋\nمن آماده‌ام — از دکمه‌ها یا ارسال پیام استفاده کن.\n\nدکمه‌ها:\n➕ /addapi - افزودن API\n🔑 /keys - مدیریت کلیدها\n📊 /usage - گزارش مصرف\n🔨 /groups - تنظیمات گروه\n📢 /channel - مدیریت کانال (VIP)\n🗑️ /removeapi - حذف همه کلیدها\n💎 /vip - خرید اشتراک VIP\n🆕 /new - شروع گفتگوی جدید\n📜 /history - گفتگوهای قبلی\n(پس از افزودن API، هر پیام شما به ChatGPT ارسال می‌شود.)"
 		return c.Send(msg)
 	})
 
 	// ⚙️ هندلرهای مدیریت API
 	bot.Handle("/addapi", handlers.HandleAddAPI(bot, db))
 	bot.Handle("/removeapi", handlers.HandleRemoveAPI(bot, db))
+	handlers.RegisterKeyHandlers(bot, db)
+
+	// 📊 گزارش مصرف کاربر
+	handlers.RegisterUsageHandlers(bot, db)
+
+	// 🛠️ پنل مدیریت (دسترسی بر اساس نقش ادمین)
+	handlers.RegisterAdminHandlers(bot, db)
+
+	// 💎 خرید اشتراک و بررسی پرداخت‌ها
+	handlers.RegisterPaymentHandlers(bot, db)
+
+	// 🧵 رشته‌های گفتگو (/new و /history)
+	handlers.RegisterConversationHandlers(bot, db)
+
+	// 🔨 تنظیمات گروه‌ها (از چت خصوصی)
+	handlers.RegisterGroupSettingsHandlers(bot, db)
+
+	// 👥 ورود و خروج ربات از گروه‌ها و تبدیل به سوپرگروه
+	handlers.RegisterGroupEventHandlers(bot, db)
+
+	// ❓ دستور /ask در گروه‌ها
+	handlers.RegisterGroupCommands(bot, db)
+
+	// 📢 مدیریت کانال VIP
+	handlers.RegisterChannelHandlers(bot, db)
+
+	// 💬 پیام‌های متنی چت خصوصی و گروه‌ها
+	handlers.HandlePrivateMessage(bot, db)
+
+	// 🧺 پاسخ به صف‌های تجمیع گروه که زمان‌بندی آن‌ها از دست رفته است
+	go handlers.StartGroupBatchSweeper(bot, db)
+
+	// 🕒 انتشار زمان‌بندی‌شده محتوای کانال‌ها
+	go services.NewScheduler(bot, db).Start()
+
+	// 🩺 بررسی دوره‌ای اعتبار کلیدهای API
+	go services.NewKeyHealthChecker(bot, db).Start()
 
 	// ✅ شروع کار ربات
 	log.Println("🤖 ربات با موفقیت راه‌اندازی شد و در حال اجراست...")
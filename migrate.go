@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"telegram-bot-manager/database"
+)
+
+const migrateUsage = "استفاده: migrate up | down [تعداد] | status"
+
+// runMigrateCommand اجرای زیر‌دستور migrate روی دیتابیس
+func runMigrateCommand(databaseURL string, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	if err := database.ConnectPostgreSQL(databaseURL); err != nil {
+		return err
+	}
+	defer database.DB.Close()
+
+	switch args[0] {
+	case "up":
+		applied, err := database.MigrateUp(database.DB)
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Println("✅ اسکیمای دیتابیس به‌روز است.")
+			return nil
+		}
+		for _, m := range applied {
+			fmt.Printf("⬆️  %04d_%s\n", m.Version, m.Name)
+		}
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n <= 0 {
+				return fmt.Errorf("تعداد مراحل نامعتبر است: %s", args[1])
+			}
+			steps = n
+		}
+		reverted, err := database.MigrateDown(database.DB, steps)
+		if err != nil {
+			return err
+		}
+		if len(reverted) == 0 {
+			fmt.Println("ℹ️ مایگریشنی برای بازگرداندن وجود ندارد.")
+			return nil
+		}
+		for _, m := range reverted {
+			fmt.Printf("⬇️  %04d_%s\n", m.Version, m.Name)
+		}
+
+	case "status":
+		statuses, err := database.GetMigrationStatus(database.DB)
+		if err != nil {
+			return err
+		}
+		for _, st := range statuses {
+			state := "⏳ در انتظار"
+			if st.Applied {
+				state = "✅ اعمال شده در " + st.AppliedAt.Time.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-40s %s\n", st.Version, st.Name, state)
+		}
+
+	default:
+		return errors.New(migrateUsage)
+	}
+
+	return nil
+}
@@ -0,0 +1,159 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// نقش‌های ادمین
+const (
+	RoleOwner     = "owner"
+	RoleFinance   = "finance"
+	RoleSupport   = "support"
+	RoleModerator = "moderator"
+)
+
+// Roles ترتیب نمایش نقش‌ها
+var Roles = []string{RoleOwner, RoleFinance, RoleSupport, RoleModerator}
+
+// RoleNames نام فارسی نقش‌ها
+var RoleNames = map[string]string{
+	RoleOwner:     "👑 مالک",
+	RoleFinance:   "💰 مالی",
+	RoleSupport:   "🎧 پشتیبانی",
+	RoleModerator: "🛡️ ناظر",
+}
+
+// Permission - یک مجوز در پنل مدیریت
+type Permission string
+
+const (
+	PermViewStats        Permission = "view_stats"
+	PermSearchUsers      Permission = "search_users"
+	PermManageVIP        Permission = "manage_vip"
+	PermManagePayments   Permission = "manage_payments"
+	PermManageLinks      Permission = "manage_links"
+	PermViewReports      Permission = "view_reports"
+	PermManageAdmins     Permission = "manage_admins"
+	PermManagePricing    Permission = "manage_pricing"
+	PermManageEncryption Permission = "manage_encryption" // فقط مالک (رمزنگاری دوباره کلیدهای API)
+)
+
+// مجوزهای هر نقش (مالک همه مجوزها را دارد)
+var rolePermissions = map[string][]Permission{
+	RoleFinance:   {PermViewStats, PermSearchUsers, PermManagePayments, PermManageLinks, PermViewReports, PermManagePricing},
+	RoleSupport:   {PermViewStats, PermSearchUsers, PermViewReports},
+	RoleModerator: {PermSearchUsers},
+}
+
+// Admin - ادمین ربات
+type Admin struct {
+	ID         int
+	TelegramID int64
+	Role       string
+	AddedBy    sql.NullInt64
+	IsActive   bool
+	CreatedAt  time.Time
+}
+
+// Can بررسی داشتن یک مجوز
+func (a *Admin) Can(p Permission) bool {
+	if a == nil || !a.IsActive {
+		return false
+	}
+	if a.Role == RoleOwner {
+		return true
+	}
+	for _, perm := range rolePermissions[a.Role] {
+		if perm == p {
+			return true
+		}
+	}
+	return false
+}
+
+// IsValidRole بررسی معتبر بودن نام نقش
+func IsValidRole(role string) bool {
+	_, ok := RoleNames[role]
+	return ok
+}
+
+// دریافت ادمین فعال بر اساس آیدی تلگرام
+func GetAdmin(db *sql.DB, telegramID int64) (*Admin, error) {
+	admin := &Admin{}
+	err := db.QueryRow(`
+		SELECT id, telegram_id, role, added_by, is_active, created_at
+		FROM admins
+		WHERE telegram_id = $1 AND is_active = TRUE
+	`, telegramID).Scan(&admin.ID, &admin.TelegramID, &admin.Role, &admin.AddedBy, &admin.IsActive, &admin.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return admin, nil
+}
+
+// لیست ادمین‌های فعال
+func ListAdmins(db *sql.DB) ([]Admin, error) {
+	rows, err := db.Query(`
+		SELECT id, telegram_id, role, added_by, is_active, created_at
+		FROM admins
+		WHERE is_active = TRUE
+		ORDER BY created_at
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var admins []Admin
+	for rows.Next() {
+		var a Admin
+		if err := rows.Scan(&a.ID, &a.TelegramID, &a.Role, &a.AddedBy, &a.IsActive, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		admins = append(admins, a)
+	}
+	return admins, rows.Err()
+}
+
+// افزودن ادمین یا تغییر نقش ادمین موجود
+func SaveAdmin(db *sql.DB, telegramID int64, role string, addedBy int64) error {
+	_, err := db.Exec(`
+		INSERT INTO admins (telegram_id, role, added_by, is_active, created_at, updated_at)
+		VALUES ($1, $2, $3, TRUE, $4, $4)
+		ON CONFLICT (telegram_id) DO UPDATE SET
+			role = EXCLUDED.role,
+			is_active = TRUE,
+			updated_at = EXCLUDED.updated_at
+	`, telegramID, role, addedBy, time.Now())
+	return err
+}
+
+// غیرفعال کردن ادمین
+func RemoveAdmin(db *sql.DB, telegramID int64) error {
+	_, err := db.Exec(`
+		UPDATE admins SET is_active = FALSE, updated_at = $1 WHERE telegram_id = $2
+	`, time.Now(), telegramID)
+	return err
+}
+
+// ثبت ادمین‌های تنظیمات به عنوان مالک (در زمان راه‌اندازی)
+func EnsureOwners(db *sql.DB, telegramIDs []int64) error {
+	for _, id := range telegramIDs {
+		_, err := db.Exec(`
+			INSERT INTO admins (telegram_id, role, is_active, created_at, updated_at)
+			VALUES ($1, $2, TRUE, $3, $3)
+			ON CONFLICT (telegram_id) DO UPDATE SET
+				role = EXCLUDED.role,
+				is_active = TRUE,
+				updated_at = EXCLUDED.updated_at
+		`, id, RoleOwner, time.Now())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
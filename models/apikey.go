@@ -3,41 +3,440 @@ package models
 import (
 	"database/sql"
 	"errors"
+	"fmt"
+	"log"
 	"time"
+
+	"github.com/lib/pq"
+
+	"telegram-bot-manager/utils"
+)
+
+// Providerهای پشتیبانی‌شده برای کلید API
+const (
+	ProviderOpenAI    = "openai"
+	ProviderAnthropic = "anthropic"
+	ProviderLocal     = "local" // سرور محلی سازگار با OpenAI (llama.cpp، Ollama و ...)
+)
+
+// وضعیت اعتبارسنجی کلید نزد Provider
+const (
+	KeyStatusValid         = "valid"
+	KeyStatusInvalid       = "invalid"
+	KeyStatusQuotaExceeded = "quota_exceeded"
+	KeyStatusUnchecked     = "unchecked"
 )
 
 // ساختار ذخیره کلید API
 type APIKey struct {
-	ID         int
-	UserID     int64
-	APIKey     string
-	IsActive   bool
-	CreatedAt  time.Time
+	ID              int
+	UserID          int64
+	APIKey          string // کلید رمزگشایی‌شده (در دیتابیس به صورت رمز‌شده ذخیره می‌شود)
+	Provider        string
+	BaseURL         string // خالی یعنی آدرس پیش‌فرض Provider
+	Model           string // خالی یعنی مدل پیش‌فرض
+	IsActive        bool
+	Label           string
+	Priority        int     // عدد کمتر یعنی اولویت بالاتر
+	MonthlyBudget   float64 // سقف هزینه ماهانه به دلار؛ صفر یعنی بدون سقف
+	MonthSpent      float64 // هزینه ماه جاری به دلار
+	Status          string
+	AvailableModels []string
+	Organization    string
+	LastCheckedAt   sql.NullTime
+	LastError       string
+	CreatedAt       time.Time
+}
+
+// روش انتخاب کلید از حلقه کلیدهای کاربر
+const (
+	KeyStrategyPriority   = "priority"    // همیشه کلید با بالاترین اولویت، بقیه فقط برای جایگزینی
+	KeyStrategyRoundRobin = "round_robin" // پخش درخواست‌ها بین کلیدها به نوبت
+)
+
+// APIKeyCheck - نتیجه یک بار اعتبارسنجی کلید
+type APIKeyCheck struct {
+	Status       string
+	Models       []string
+	Organization string
+	Error        string
+}
+
+// ستون‌های مشترک خواندن کلید (به ترتیب scanAPIKey)
+const apiKeyColumns = `id, user_id, api_key, COALESCE(encrypted_dek, ''), key_version,
+	provider, COALESCE(base_url, ''), COALESCE(model, ''), is_active,
+	label, priority, COALESCE(monthly_budget, 0),
+	(SELECT COALESCE(SUM(u.cost), 0) FROM api_key_usage u
+		WHERE u.api_key_id = api_keys.id AND u.month = date_trunc('month', CURRENT_DATE)::DATE),
+	status, available_models, COALESCE(organization, ''), last_checked_at, COALESCE(last_error, ''), created_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// ErrAPIKeyUnreadable - کلید با کلیدهای اصلی تنظیم‌شده باز نمی‌شود (مثلاً کلید قدیمی در old_keys نیست)
+var ErrAPIKeyUnreadable = errors.New("رمزگشایی کلید ممکن نیست")
+
+// scanAPIKey خواندن و رمزگشایی یک ردیف کلید
+func scanAPIKey(row rowScanner) (*APIKey, error) {
+	k := &APIKey{}
+	var sealed utils.Sealed
+	err := row.Scan(&k.ID, &k.UserID, &sealed.Ciphertext, &sealed.WrappedKey, &sealed.KeyVersion,
+		&k.Provider, &k.BaseURL, &k.Model, &k.IsActive,
+		&k.Label, &k.Priority, &k.MonthlyBudget, &k.MonthSpent,
+		&k.Status, pq.Array(&k.AvailableModels), &k.Organization, &k.LastCheckedAt, &k.LastError, &k.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if k.APIKey, err = utils.MasterKeys.Open(sealed); err != nil {
+		return nil, fmt.Errorf("کلید API %d: %w: %v", k.ID, ErrAPIKeyUnreadable, err)
+	}
+	return k, nil
+}
+
+// Masked نمایش امن کلید (مثلاً sk-...abcd)
+func (k *APIKey) Masked() string {
+	return utils.MaskAPIKey(k.APIKey)
+}
+
+// OverBudget بررسی رسیدن کلید به سقف هزینه ماهانه
+func (k *APIKey) OverBudget() bool {
+	return k.MonthlyBudget > 0 && k.MonthSpent >= k.MonthlyBudget
+}
+
+// افزودن کلید جدید به انتهای حلقه کلیدها یا بروزرسانی کلید موجود (key.ID غیر صفر)
+// همراه نتیجه اعتبارسنجی؛ کلید با کلید اصلی فعلی رمز می‌شود. بروزرسانی وضعیت فعال/غیرفعال
+// کلید را تغییر نمی‌دهد تا کلیدی که کاربر خاموش کرده با ارسال دوباره روشن نشود
+func SaveAPIKey(db *sql.DB, key *APIKey, check APIKeyCheck) error {
+	sealed, err := utils.MasterKeys.Seal(key.APIKey)
+	if err != nil {
+		return err
+	}
+
+	if key.ID != 0 {
+		_, err = db.Exec(`
+			UPDATE api_keys SET api_key = $1, encrypted_dek = $2, key_version = $3,
+				provider = $4, base_url = NULLIF($5, ''), model = NULLIF($6, ''),
+				status = $7, available_models = $8, organization = NULLIF($9, ''),
+				last_checked_at = NOW(), last_error = NULLIF($10, '')
+			WHERE id = $11 AND user_id = $12
+		`, sealed.Ciphertext, sealed.WrappedKey, sealed.KeyVersion, key.Provider, key.BaseURL, key.Model,
+			check.Status, pq.Array(check.Models), check.Organization, check.Error, key.ID, key.UserID)
+		return err
+	}
+
+	return db.QueryRow(`
+		INSERT INTO api_keys (user_id, api_key, encrypted_dek, key_version, provider, base_url, model,
+			label, priority, status, available_models, organization, last_checked_at, last_error, is_active, created_at)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), NULLIF($7, ''), $8,
+			(SELECT COALESCE(MAX(priority), 0) + 1 FROM api_keys WHERE user_id = $1),
+			$9, $10, NULLIF($11, ''), NOW(), NULLIF($12, ''), TRUE, NOW())
+		RETURNING id, priority
+	`, key.UserID, sealed.Ciphertext, sealed.WrappedKey, sealed.KeyVersion, key.Provider, key.BaseURL, key.Model,
+		key.Label, check.Status, pq.Array(check.Models), check.Organization, check.Error).Scan(&key.ID, &key.Priority)
+}
+
+// لیست همه کلیدهای کاربر به ترتیب اولویت
+func ListAPIKeys(db *sql.DB, userID int64) ([]APIKey, error) {
+	return queryAPIKeys(db, `
+		SELECT `+apiKeyColumns+`
+		FROM api_keys
+		WHERE user_id = $1
+		ORDER BY priority, id
+	`, userID)
+}
+
+// کلیدهای فعال و زیر سقف بودجه کاربر به ترتیب اولویت
+func UsableAPIKeys(db *sql.DB, userID int64) ([]APIKey, error) {
+	keys, err := queryAPIKeys(db, `
+		SELECT `+apiKeyColumns+`
+		FROM api_keys
+		WHERE user_id = $1 AND is_active = TRUE
+		ORDER BY priority, id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	usable := keys[:0]
+	for _, k := range keys {
+		if !k.OverBudget() {
+			usable = append(usable, k)
+		}
+	}
+	return usable, nil
+}
+
+// دریافت یک کلید کاربر (nil در صورت نبود کلید)
+func GetAPIKey(db *sql.DB, userID int64, keyID int) (*APIKey, error) {
+	k, err := scanAPIKey(db.QueryRow(`
+		SELECT `+apiKeyColumns+`
+		FROM api_keys
+		WHERE id = $1 AND user_id = $2
+	`, keyID, userID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+func queryAPIKeys(db *sql.DB, query string, args ...interface{}) ([]APIKey, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []APIKey
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		// کلیدی که باز نمی‌شود نباید بقیه کلیدهای کاربر (یا بررسی دوره‌ای همه کاربران) را از کار بیندازد
+		if errors.Is(err, ErrAPIKeyUnreadable) {
+			log.Printf("⚠️ %v", err)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *k)
+	}
+	return keys, rows.Err()
+}
+
+// تغییر برچسب کلید
+func SetAPIKeyLabel(db *sql.DB, userID int64, keyID int, label string) error {
+	return execAPIKeyUpdate(db, `UPDATE api_keys SET label = $1 WHERE id = $2 AND user_id = $3`, label, keyID, userID)
+}
+
+// تغییر سقف هزینه ماهانه (صفر یعنی بدون سقف)
+func SetAPIKeyBudget(db *sql.DB, userID int64, keyID int, budget float64) error {
+	return execAPIKeyUpdate(db, `
+		UPDATE api_keys SET monthly_budget = NULLIF($1, 0) WHERE id = $2 AND user_id = $3
+	`, budget, keyID, userID)
+}
+
+// فعال یا غیرفعال کردن کلید؛ کلید فعال‌شده در دور بعد دوباره اعتبارسنجی می‌شود
+func SetAPIKeyActive(db *sql.DB, userID int64, keyID int, active bool) error {
+	return execAPIKeyUpdate(db, `
+		UPDATE api_keys SET is_active = $1,
+			status = CASE WHEN $1 THEN 'unchecked' ELSE status END,
+			last_checked_at = CASE WHEN $1 THEN NULL ELSE last_checked_at END
+		WHERE id = $2 AND user_id = $3
+	`, active, keyID, userID)
 }
 
-// افزودن یا بروزرسانی کلید API
-func SaveAPIKey(db *sql.DB, userID int64, key string) error {
+// جابجایی کلید در ترتیب اولویت (delta منفی یعنی بالاتر)
+func MoveAPIKey(db *sql.DB, userID int64, keyID int, delta int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT id FROM api_keys WHERE user_id = $1 ORDER BY priority, id FOR UPDATE
+	`, userID)
+	if err != nil {
+		return err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	pos := -1
+	for i, id := range ids {
+		if id == keyID {
+			pos = i
+		}
+	}
+	if pos < 0 {
+		return sql.ErrNoRows
+	}
+	target := pos + delta
+	if target < 0 || target >= len(ids) {
+		return nil
+	}
+	ids[pos], ids[target] = ids[target], ids[pos]
+
+	// اولویت‌ها از ۱ دوباره شماره‌گذاری می‌شوند
+	for i, id := range ids {
+		if _, err := tx.Exec(`UPDATE api_keys SET priority = $1 WHERE id = $2`, i+1, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// حذف یک کلید کاربر
+func DeleteAPIKeyByID(db *sql.DB, userID int64, keyID int) error {
+	return execAPIKeyUpdate(db, `DELETE FROM api_keys WHERE id = $1 AND user_id = $2`, keyID, userID)
+}
+
+func execAPIKeyUpdate(db *sql.DB, query string, args ...interface{}) error {
+	res, err := db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// روش انتخاب کلید کاربر
+func GetKeyStrategy(db *sql.DB, userID int64) (string, error) {
+	var strategy string
+	err := db.QueryRow(`SELECT key_strategy FROM users WHERE telegram_id = $1`, userID).Scan(&strategy)
+	if err == sql.ErrNoRows {
+		return KeyStrategyPriority, nil
+	}
+	return strategy, err
+}
+
+// تغییر روش انتخاب کلید کاربر
+func SetKeyStrategy(db *sql.DB, userID int64, strategy string) error {
+	_, err := db.Exec(`UPDATE users SET key_strategy = $1, updated_at = NOW() WHERE telegram_id = $2`, strategy, userID)
+	return err
+}
+
+// ثبت نتیجه اعتبارسنجی دوره‌ای؛ کلیدهای نامعتبر یا بدون اعتبار غیرفعال می‌شوند
+func RecordAPIKeyCheck(db *sql.DB, keyID int, check APIKeyCheck) error {
+	disable := check.Status == KeyStatusInvalid || check.Status == KeyStatusQuotaExceeded
+
+	// فهرست مدل‌ها و سازمان فقط در صورت دریافت موفق جایگزین می‌شوند
 	_, err := db.Exec(`
-		INSERT INTO user_api_keys (user_id, api_key, is_active, created_at)
-		VALUES ($1, $2, TRUE, NOW())
-		ON CONFLICT (user_id)
-		DO UPDATE SET api_key = EXCLUDED.api_key, is_active = TRUE, created_at = NOW()
-	`, userID, key)
+		UPDATE api_keys SET
+			status = $1,
+			available_models = CASE WHEN $2::TEXT[] = '{}' THEN available_models ELSE $2::TEXT[] END,
+			organization = COALESCE(NULLIF($3, ''), organization),
+			last_error = NULLIF($4, ''),
+			last_checked_at = NOW(),
+			is_active = CASE WHEN $5 THEN FALSE ELSE is_active END
+		WHERE id = $6
+	`, check.Status, pq.Array(check.Models), check.Organization, check.Error, disable, keyID)
 	return err
 }
 
-// حذف کلید API کاربر
+// کلیدهای فعالی که از آخرین بررسی آن‌ها بیش از maxAge گذشته است
+func ListAPIKeysDueForCheck(db *sql.DB, maxAge time.Duration, limit int) ([]APIKey, error) {
+	return queryAPIKeys(db, `
+		SELECT `+apiKeyColumns+`
+		FROM api_keys
+		WHERE is_active = TRUE AND (last_checked_at IS NULL OR last_checked_at < $1)
+		ORDER BY last_checked_at NULLS FIRST
+		LIMIT $2
+	`, time.Now().Add(-maxAge), limit)
+}
+
+// حذف همه کلیدهای API کاربر
 func DeleteAPIKey(db *sql.DB, userID int64) error {
-	_, err := db.Exec(`DELETE FROM user_api_keys WHERE user_id = $1`, userID)
+	_, err := db.Exec(`DELETE FROM api_keys WHERE user_id = $1`, userID)
 	return err
 }
 
-// دریافت کلید فعال کاربر
-func GetActiveAPIKey(db *sql.DB, userID int64) (string, error) {
-	var key string
-	err := db.QueryRow(`SELECT api_key FROM user_api_keys WHERE user_id = $1 AND is_active = TRUE LIMIT 1`, userID).Scan(&key)
-	if err == sql.ErrNoRows {
-		return "", errors.New("کلید فعالی یافت نشد")
+// دریافت کلید با بالاترین اولویت از میان کلیدهای قابل استفاده (nil در صورت نبود کلید)
+func GetActiveAPIKey(db *sql.DB, userID int64) (*APIKey, error) {
+	keys, err := UsableAPIKeys(db, userID)
+	if err != nil || len(keys) == 0 {
+		return nil, err
+	}
+	return &keys[0], nil
+}
+
+// KeyRotationResult - نتیجه رمزنگاری دوباره کلیدهای API
+type KeyRotationResult struct {
+	Rewrapped int
+	Failed    []int // آیدی ردیف‌هایی که با کلیدهای اصلی تنظیم‌شده باز نشدند و دست‌نخورده ماندند
+}
+
+// EncryptLegacyAPIKeys رمزنگاری کلیدهای قدیمی که به صورت متن ساده ذخیره شده‌اند
+func EncryptLegacyAPIKeys(db *sql.DB) (KeyRotationResult, error) {
+	return reencryptAPIKeys(db, `key_version = 0`)
+}
+
+// RotateAPIKeyEncryption رمزنگاری دوباره همه کلیدهایی که با نسخه قبلی کلید اصلی رمز شده‌اند
+//
+// فقط کلید داده هر ردیف دوباره رمز می‌شود؛ کلیدهای قدیمی رمز‌نشده هم رمز می‌شوند.
+// ردیفی که باز نشود (مثلاً کلید اصلی نسخه آن در old_keys نیست) رد و در Failed گزارش می‌شود.
+func RotateAPIKeyEncryption(db *sql.DB) (KeyRotationResult, error) {
+	return reencryptAPIKeys(db, `key_version <> $1`, utils.MasterKeys.CurrentVersion())
+}
+
+// CountAPIKeysToRotate تعداد کلیدهایی که هنوز با کلید اصلی فعلی رمز نشده‌اند
+func CountAPIKeysToRotate(db *sql.DB) (int, error) {
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM api_keys WHERE key_version <> $1`,
+		utils.MasterKeys.CurrentVersion()).Scan(&count)
+	return count, err
+}
+
+func reencryptAPIKeys(db *sql.DB, where string, args ...interface{}) (KeyRotationResult, error) {
+	var result KeyRotationResult
+	tx, err := db.Begin()
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT id, api_key, COALESCE(encrypted_dek, ''), key_version
+		FROM api_keys
+		WHERE `+where+`
+		FOR UPDATE
+	`, args...)
+	if err != nil {
+		return result, err
+	}
+
+	type row struct {
+		id     int
+		sealed utils.Sealed
+	}
+	var pending []row
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.id, &r.sealed.Ciphertext, &r.sealed.WrappedKey, &r.sealed.KeyVersion); err != nil {
+			rows.Close()
+			return result, err
+		}
+		pending = append(pending, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return result, err
+	}
+
+	for _, r := range pending {
+		sealed, err := utils.MasterKeys.Rewrap(r.sealed)
+		if err != nil {
+			log.Printf("⚠️ کلید ردیف %d (نسخه %d) دوباره رمز نشد: %v", r.id, r.sealed.KeyVersion, err)
+			result.Failed = append(result.Failed, r.id)
+			continue
+		}
+		if _, err := tx.Exec(`
+			UPDATE api_keys SET api_key = $1, encrypted_dek = $2, key_version = $3 WHERE id = $4
+		`, sealed.Ciphertext, sealed.WrappedKey, sealed.KeyVersion, r.id); err != nil {
+			return KeyRotationResult{}, err
+		}
+		result.Rewrapped++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return KeyRotationResult{}, err
 	}
-	return key, err
+	return result, nil
 }
@@ -0,0 +1,366 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// محدوده مجاز تعداد پست هر نوبت (مطابق check_posts_per_batch)
+const (
+	ChannelPostsMin = 1
+	ChannelPostsMax = 10
+)
+
+// الگوی زمان انتشار (مطابق check_schedule_time)
+var scheduleTimePattern = regexp.MustCompile(`^([0-1][0-9]|2[0-3]):[0-5][0-9]$`)
+
+// خطاهای تنظیمات کانال
+var (
+	ErrInvalidScheduleTime  = errors.New("زمان انتشار باید به فرمت HH:MM باشد")
+	ErrInvalidPostsPerBatch = fmt.Errorf("تعداد پست باید بین %d و %d باشد", ChannelPostsMin, ChannelPostsMax)
+	ErrChannelTaken         = errors.New("این کانال توسط کاربر دیگری ثبت شده است")
+	ErrChannelLimitReached  = errors.New("به سقف تعداد کانال پلن خود رسیده‌اید")
+)
+
+// ChannelLimits - سقف تعداد کانال هر مالک VIP
+type ChannelLimits struct {
+	VIP   int
+	Plans map[string]int // سقف اختصاصی پلن‌ها؛ در نبود، سقف VIP
+}
+
+var channelLimits = ChannelLimits{VIP: 1}
+
+// ConfigureChannelLimits اعمال سقف تعداد کانال (در زمان راه‌اندازی از main فراخوانی می‌شود)
+func ConfigureChannelLimits(l ChannelLimits) {
+	if l.VIP < 1 {
+		l.VIP = channelLimits.VIP
+	}
+	channelLimits = l
+}
+
+// ChannelLimitForUser سقف تعداد کانال کاربر؛ صفر برای کاربران بدون VIP فعال
+func ChannelLimitForUser(u *User) int {
+	if u == nil || !u.HasActiveVIP() {
+		return 0
+	}
+	if limit, ok := channelLimits.Plans[u.VIPPlan]; ok && u.VIPPlan != "" {
+		return limit
+	}
+	return channelLimits.VIP
+}
+
+// ChannelConfig - تنظیمات کانال (مشترک میان منوی کانال و زمان‌بندی انتشار)
+type ChannelConfig struct {
+	ID            int
+	OwnerID       int64
+	ChannelID     string // نام کاربری کانال به شکل @channel
+	ChannelTitle  string
+	Prompt        string
+	Schedule      ChannelSchedule
+	NextRunAt     sql.NullTime // نوبت بعدی انتشار؛ NULL یعنی هنوز محاسبه نشده
+	PostsPerBatch int
+	IsActive      bool
+	AutoPublish   bool // انتشار مستقیم؛ در غیر این صورت پست‌ها پیش‌نویس می‌شوند و به تأیید مالک می‌رسند
+	LastPostAt    sql.NullTime
+	TotalPosts    int
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// ValidScheduleTime بررسی فرمت زمان انتشار HH:MM
+func ValidScheduleTime(t string) bool {
+	return scheduleTimePattern.MatchString(t)
+}
+
+const channelColumns = `id, owner_id, channel_id, COALESCE(channel_title, ''), COALESCE(prompt, ''),
+	schedule_kind, schedule_slots, schedule_weekdays, schedule_interval, schedule_cron, timezone, next_run_at,
+	COALESCE(posts_per_batch, 1), COALESCE(is_active, FALSE), auto_publish,
+	last_post_at, COALESCE(total_posts, 0), created_at, updated_at`
+
+// شرط داشتن زمان‌بندی تنظیم‌شده
+const channelScheduledCond = `(cardinality(schedule_slots) > 0 OR schedule_interval > 0 OR schedule_cron <> '')`
+
+func scanChannel(row interface{ Scan(...interface{}) error }) (*ChannelConfig, error) {
+	ch := &ChannelConfig{}
+	var weekdays pq.Int64Array
+	err := row.Scan(&ch.ID, &ch.OwnerID, &ch.ChannelID, &ch.ChannelTitle, &ch.Prompt,
+		&ch.Schedule.Kind, pq.Array(&ch.Schedule.Slots), &weekdays, &ch.Schedule.Interval,
+		&ch.Schedule.Cron, &ch.Schedule.Timezone, &ch.NextRunAt,
+		&ch.PostsPerBatch, &ch.IsActive, &ch.AutoPublish,
+		&ch.LastPostAt, &ch.TotalPosts, &ch.CreatedAt, &ch.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range weekdays {
+		ch.Schedule.Weekdays = append(ch.Schedule.Weekdays, int(d))
+	}
+	return ch, nil
+}
+
+// کانال‌های کاربر به ترتیب ثبت
+func ListOwnedChannels(db *sql.DB, ownerID int64) ([]ChannelConfig, error) {
+	return queryChannels(db, `
+		SELECT `+channelColumns+`
+		FROM channels
+		WHERE owner_id = $1
+		ORDER BY id
+	`, ownerID)
+}
+
+// دریافت یک کانال کاربر (nil در صورت نبود کانال یا مالکیت کاربر دیگر)
+func GetOwnedChannel(db *sql.DB, ownerID int64, id int) (*ChannelConfig, error) {
+	ch, err := scanChannel(db.QueryRow(`
+		SELECT `+channelColumns+`
+		FROM channels
+		WHERE id = $1 AND owner_id = $2
+	`, id, ownerID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return ch, err
+}
+
+// ثبت کانال جدید برای کاربر تا سقف maxChannels
+//
+// کانالی که قبلاً به نام همین کاربر ثبت شده فقط عنوانش به‌روز می‌شود؛
+// کانال کاربر دیگر ErrChannelTaken و رسیدن به سقف ErrChannelLimitReached برمی‌گرداند.
+func AddChannel(db *sql.DB, ownerID int64, channelID, title string, maxChannels int) (*ChannelConfig, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// قفل ردیف کاربر تا ثبت هم‌زمان از سقف عبور نکند
+	if _, err := tx.Exec(`SELECT 1 FROM users WHERE telegram_id = $1 FOR UPDATE`, ownerID); err != nil {
+		return nil, err
+	}
+
+	var existingOwner int64
+	err = tx.QueryRow(`SELECT owner_id FROM channels WHERE channel_id = $1`, channelID).Scan(&existingOwner)
+	switch {
+	case err == sql.ErrNoRows:
+		var count int
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM channels WHERE owner_id = $1`, ownerID).Scan(&count); err != nil {
+			return nil, err
+		}
+		if count >= maxChannels {
+			return nil, ErrChannelLimitReached
+		}
+	case err != nil:
+		return nil, err
+	case existingOwner != ownerID:
+		return nil, ErrChannelTaken
+	}
+
+	// منطقه زمانی کانال جدید همان منطقه زمانی سهمیه است
+	ch, err := scanChannel(tx.QueryRow(`
+		INSERT INTO channels (owner_id, channel_id, channel_title, timezone)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (channel_id) DO UPDATE SET
+			channel_title = EXCLUDED.channel_title,
+			updated_at = NOW()
+		RETURNING `+channelColumns,
+		ownerID, channelID, title, quotaSettings.Location.String()))
+	if isUniqueViolation(err) {
+		return nil, ErrChannelTaken
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ch, tx.Commit()
+}
+
+// حذف کانال کاربر
+func DeleteChannel(db *sql.DB, ownerID int64, id int) error {
+	return execChannelUpdate(db, `DELETE FROM channels WHERE id = $1 AND owner_id = $2`, id, ownerID)
+}
+
+// کپی تنظیمات تولید محتوا (پرامپت، زمان‌بندی، تعداد پست و انتشار مستقیم) از یک کانال کاربر به کانال دیگر او
+func CloneChannelSettings(db *sql.DB, ownerID int64, fromID, toID int) error {
+	return execChannelUpdate(db, `
+		UPDATE channels AS dst SET
+			prompt = src.prompt,
+			schedule_kind = src.schedule_kind,
+			schedule_slots = src.schedule_slots,
+			schedule_weekdays = src.schedule_weekdays,
+			schedule_interval = src.schedule_interval,
+			schedule_cron = src.schedule_cron,
+			timezone = src.timezone,
+			next_run_at = src.next_run_at,
+			posts_per_batch = src.posts_per_batch,
+			auto_publish = src.auto_publish,
+			updated_at = NOW()
+		FROM channels AS src
+		WHERE src.id = $1 AND src.owner_id = $3
+			AND dst.id = $2 AND dst.owner_id = $3 AND dst.id <> src.id
+	`, fromID, toID, ownerID)
+}
+
+// تغییر پرامپت کانال
+func UpdateChannelPrompt(db *sql.DB, ownerID int64, id int, prompt string) error {
+	return execChannelUpdate(db, `UPDATE channels SET prompt = NULLIF($1, ''), updated_at = NOW() WHERE id = $2 AND owner_id = $3`,
+		prompt, id, ownerID)
+}
+
+// تغییر زمان‌بندی انتشار و محاسبه نوبت بعدی
+func UpdateChannelSchedule(db *sql.DB, ownerID int64, id int, s ChannelSchedule) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	next, err := nullNextRun(s)
+	if err != nil {
+		return err
+	}
+
+	weekdays := make([]int64, len(s.Weekdays))
+	for i, d := range s.Weekdays {
+		weekdays[i] = int64(d)
+	}
+	if s.Slots == nil {
+		s.Slots = []string{}
+	}
+	return execChannelUpdate(db, `
+		UPDATE channels SET
+			schedule_kind = $1, schedule_slots = $2, schedule_weekdays = $3,
+			schedule_interval = $4, schedule_cron = $5, timezone = $6,
+			next_run_at = $7, updated_at = NOW()
+		WHERE id = $8 AND owner_id = $9
+	`, s.Kind, pq.Array(s.Slots), pq.Array(weekdays), s.Interval, s.Cron, s.Timezone, next, id, ownerID)
+}
+
+// تغییر تعداد پست هر نوبت
+func UpdateChannelPosts(db *sql.DB, ownerID int64, id, posts int) error {
+	if posts < ChannelPostsMin || posts > ChannelPostsMax {
+		return ErrInvalidPostsPerBatch
+	}
+	return execChannelUpdate(db, `UPDATE channels SET posts_per_batch = $1, updated_at = NOW() WHERE id = $2 AND owner_id = $3`,
+		posts, id, ownerID)
+}
+
+// فعال یا غیرفعال کردن انتشار خودکار
+//
+// با فعال‌سازی، نوبت بعدی از همین لحظه محاسبه می‌شود تا نوبت‌های دوره غیرفعال جبران نشوند.
+func UpdateChannelStatus(db *sql.DB, ownerID int64, id int, isActive bool) error {
+	var next sql.NullTime
+	if isActive {
+		ch, err := GetOwnedChannel(db, ownerID, id)
+		if err != nil {
+			return err
+		}
+		if ch == nil {
+			return sql.ErrNoRows
+		}
+		if next, err = nullNextRun(ch.Schedule); err != nil {
+			return err
+		}
+	}
+	return execChannelUpdate(db, `UPDATE channels SET is_active = $1, next_run_at = $2, updated_at = NOW() WHERE id = $3 AND owner_id = $4`,
+		isActive, next, id, ownerID)
+}
+
+// روشن یا خاموش کردن انتشار مستقیم (بدون تأیید مالک)
+func UpdateChannelAutoPublish(db *sql.DB, ownerID int64, id int, autoPublish bool) error {
+	return execChannelUpdate(db, `UPDATE channels SET auto_publish = $1, updated_at = NOW() WHERE id = $2 AND owner_id = $3`,
+		autoPublish, id, ownerID)
+}
+
+// nullNextRun نوبت بعدی زمان‌بندی از همین لحظه (NULL برای زمان‌بندی خالی)
+func nullNextRun(s ChannelSchedule) (sql.NullTime, error) {
+	next, err := s.Next(time.Now())
+	if err != nil || next.IsZero() {
+		return sql.NullTime{}, err
+	}
+	return sql.NullTime{Time: next, Valid: true}, nil
+}
+
+// تعداد کانال‌های فعال (برای آمار پنل مدیریت)
+func CountActiveChannels(db *sql.DB) (int, error) {
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM channels WHERE is_active`).Scan(&count)
+	return count, err
+}
+
+// کانال‌های فعال دارای زمان‌بندی
+func ListActiveChannels(db *sql.DB) ([]ChannelConfig, error) {
+	return queryChannels(db, `
+		SELECT `+channelColumns+`
+		FROM channels
+		WHERE is_active = TRUE AND `+channelScheduledCond+`
+		ORDER BY id
+	`)
+}
+
+// کانال‌های فعالی که نوبت انتشارشان رسیده یا هنوز محاسبه نشده است
+func ListDueChannels(db *sql.DB, now time.Time) ([]ChannelConfig, error) {
+	return queryChannels(db, `
+		SELECT `+channelColumns+`
+		FROM channels
+		WHERE is_active = TRUE AND `+channelScheduledCond+`
+			AND (next_run_at IS NULL OR next_run_at <= $1)
+		ORDER BY next_run_at NULLS FIRST, id
+	`, now)
+}
+
+// جلو بردن نوبت بعدی کانال؛ فقط اگر نوبت فعلی هنوز prev باشد (false یعنی نمونه دیگری زودتر برداشته است)
+func AdvanceChannelRun(db *sql.DB, id int, prev sql.NullTime, next time.Time) (bool, error) {
+	res, err := db.Exec(`
+		UPDATE channels SET next_run_at = $1
+		WHERE id = $2 AND next_run_at IS NOT DISTINCT FROM $3
+	`, sql.NullTime{Time: next, Valid: !next.IsZero()}, id, prev)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func queryChannels(db *sql.DB, query string, args ...interface{}) ([]ChannelConfig, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var channels []ChannelConfig
+	for rows.Next() {
+		ch, err := scanChannel(rows)
+		if err != nil {
+			return nil, err
+		}
+		channels = append(channels, *ch)
+	}
+	return channels, rows.Err()
+}
+
+// ثبت انتشار پست‌های یک نوبت
+func RecordChannelPosts(db *sql.DB, id, posts int) error {
+	_, err := db.Exec(`
+		UPDATE channels SET last_post_at = NOW(), total_posts = COALESCE(total_posts, 0) + $1
+		WHERE id = $2
+	`, posts, id)
+	return err
+}
+
+// execChannelUpdate اجرای تغییر تنظیمات؛ نبود کانال sql.ErrNoRows برمی‌گرداند
+func execChannelUpdate(db *sql.DB, query string, args ...interface{}) error {
+	res, err := db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// isUniqueViolation بررسی خطای تکراری بودن مقدار ستون یکتا
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
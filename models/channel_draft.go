@@ -0,0 +1,144 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// وضعیت‌های پیش‌نویس پست کانال
+const (
+	DraftPending   = "pending"  // در انتظار بررسی مالک
+	DraftApproved  = "approved" // در نوبت بعدی منتشر می‌شود
+	DraftPublished = "published"
+	DraftDiscarded = "discarded"
+)
+
+// حداکثر پیش‌نویس‌های در صف (در انتظار و تأییدشده) هر کانال
+const ChannelDraftQueueMax = 10
+
+// ChannelDraft - پیش‌نویس پست کانال در صف تأیید
+type ChannelDraft struct {
+	ID           int64
+	ChannelID    int
+	ChannelTitle string
+	Content      string
+	Status       string
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	PublishedAt  sql.NullTime
+}
+
+const draftColumns = `d.id, d.channel_id, COALESCE(c.channel_title, c.channel_id), d.content, d.status,
+	d.created_at, d.updated_at, d.published_at`
+
+func scanDraft(row interface{ Scan(...interface{}) error }) (*ChannelDraft, error) {
+	d := &ChannelDraft{}
+	err := row.Scan(&d.ID, &d.ChannelID, &d.ChannelTitle, &d.Content, &d.Status,
+		&d.CreatedAt, &d.UpdatedAt, &d.PublishedAt)
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// ثبت پیش‌نویس تولیدشده در نوبت runID
+func CreateChannelDraft(db *sql.DB, channelID int, content string, runID int64) (*ChannelDraft, error) {
+	var id int64
+	err := db.QueryRow(`
+		INSERT INTO channel_drafts (channel_id, content, run_id)
+		VALUES ($1, $2, $3)
+		RETURNING id
+	`, channelID, content, sql.NullInt64{Int64: runID, Valid: runID > 0}).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	return getDraft(db, `d.id = $1`, id)
+}
+
+// دریافت پیش‌نویس یکی از کانال‌های کاربر (nil در صورت نبود)
+func GetOwnedDraft(db *sql.DB, ownerID int64, id int64) (*ChannelDraft, error) {
+	d, err := getDraft(db, `d.id = $1 AND c.owner_id = $2`, id, ownerID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return d, err
+}
+
+func getDraft(db *sql.DB, cond string, args ...interface{}) (*ChannelDraft, error) {
+	return scanDraft(db.QueryRow(`
+		SELECT `+draftColumns+`
+		FROM channel_drafts d
+		JOIN channels c ON c.id = d.channel_id
+		WHERE `+cond, args...))
+}
+
+// تغییر وضعیت پیش‌نویسی که هنوز منتشر یا حذف نشده است
+func SetDraftStatus(db *sql.DB, ownerID int64, id int64, status string) error {
+	return execChannelUpdate(db, `
+		UPDATE channel_drafts d SET status = $1, updated_at = NOW()
+		FROM channels c
+		WHERE c.id = d.channel_id AND d.id = $2 AND c.owner_id = $3
+			AND d.status IN ('pending', 'approved')
+	`, status, id, ownerID)
+}
+
+// جایگزینی متن پیش‌نویسی که هنوز منتشر یا حذف نشده است
+func UpdateDraftContent(db *sql.DB, ownerID int64, id int64, content string) error {
+	return execChannelUpdate(db, `
+		UPDATE channel_drafts d SET content = $1, updated_at = NOW()
+		FROM channels c
+		WHERE c.id = d.channel_id AND d.id = $2 AND c.owner_id = $3
+			AND d.status IN ('pending', 'approved')
+	`, content, id, ownerID)
+}
+
+// پیش‌نویس‌های تأییدشده کانال به ترتیب ثبت (برای انتشار در نوبت)
+func ListApprovedDrafts(db *sql.DB, channelID int, limit int) ([]ChannelDraft, error) {
+	return queryDrafts(db, `d.channel_id = $1 AND d.status = 'approved' ORDER BY d.id LIMIT $2`, channelID, limit)
+}
+
+// پیش‌نویس‌های در انتظار بررسی کانال
+func ListPendingDrafts(db *sql.DB, channelID int) ([]ChannelDraft, error) {
+	return queryDrafts(db, `d.channel_id = $1 AND d.status = 'pending' ORDER BY d.id`, channelID)
+}
+
+func queryDrafts(db *sql.DB, cond string, args ...interface{}) ([]ChannelDraft, error) {
+	rows, err := db.Query(`
+		SELECT `+draftColumns+`
+		FROM channel_drafts d
+		JOIN channels c ON c.id = d.channel_id
+		WHERE `+cond, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var drafts []ChannelDraft
+	for rows.Next() {
+		d, err := scanDraft(rows)
+		if err != nil {
+			return nil, err
+		}
+		drafts = append(drafts, *d)
+	}
+	return drafts, rows.Err()
+}
+
+// تعداد پیش‌نویس‌های در انتظار و تأییدشده کانال
+func CountQueuedDrafts(db *sql.DB, channelID int) (pending, approved int, err error) {
+	err = db.QueryRow(`
+		SELECT COUNT(*) FILTER (WHERE status = 'pending'), COUNT(*) FILTER (WHERE status = 'approved')
+		FROM channel_drafts
+		WHERE channel_id = $1
+	`, channelID).Scan(&pending, &approved)
+	return pending, approved, err
+}
+
+// ثبت انتشار پیش‌نویس تأییدشده در نوبت runID
+func MarkDraftPublished(db *sql.DB, id int64, runID int64) error {
+	_, err := db.Exec(`
+		UPDATE channel_drafts SET status = 'published', published_run_id = $1, published_at = NOW(), updated_at = NOW()
+		WHERE id = $2 AND status = 'approved'
+	`, runID, id)
+	return err
+}
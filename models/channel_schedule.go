@@ -0,0 +1,224 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// انواع زمان‌بندی انتشار کانال
+const (
+	ScheduleDaily    = "daily"    // یک یا چند نوبت ساعتی در روزهای انتخاب‌شده هفته
+	ScheduleInterval = "interval" // هر چند دقیقه از نیمه‌شب، در روزهای انتخاب‌شده هفته
+	ScheduleCron     = "cron"     // عبارت cron پنج‌بخشی
+)
+
+// محدودیت‌های زمان‌بندی کانال
+const (
+	ChannelSlotsMax        = 12
+	ChannelIntervalMin     = 30      // حداقل فاصله دو انتشار (دقیقه)
+	ChannelIntervalMax     = 24 * 60 // دقیقه
+	DefaultChannelTimezone = "Asia/Tehran"
+)
+
+// خطاهای زمان‌بندی کانال
+var (
+	ErrInvalidSchedule     = errors.New("زمان‌بندی نامعتبر است")
+	ErrInvalidCron         = errors.New("عبارت cron نامعتبر است (پنج بخش: دقیقه ساعت روز ماه روز‌هفته)")
+	ErrInvalidTimezone     = errors.New("منطقه زمانی نامعتبر است (مثال: Asia/Tehran)")
+	ErrTooManySlots        = fmt.Errorf("حداکثر %d نوبت انتشار در روز مجاز است", ChannelSlotsMax)
+	ErrScheduleTooFrequent = fmt.Errorf("فاصله نوبت‌های انتشار باید حداقل %d دقیقه باشد", ChannelIntervalMin)
+	ErrNoWeekdays          = errors.New("دست‌کم یک روز هفته باید انتخاب شود")
+)
+
+// پارسر cron پنج‌بخشی (به همراه @daily و مشابه آن)
+var cronParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// ChannelSchedule - زمان‌بندی انتشار یک کانال در منطقه زمانی خود کانال
+type ChannelSchedule struct {
+	Kind     string
+	Slots    []string // HH:MM مرتب (روزانه)
+	Weekdays []int    // 0 = یکشنبه ... 6 = شنبه؛ خالی یعنی همه روزها (روزانه و فاصله ثابت)
+	Interval int      // فاصله به دقیقه
+	Cron     string
+	Timezone string
+}
+
+// IsZero بررسی تنظیم نشدن زمان‌بندی
+func (s ChannelSchedule) IsZero() bool {
+	switch s.Kind {
+	case ScheduleInterval:
+		return s.Interval == 0
+	case ScheduleCron:
+		return s.Cron == ""
+	}
+	return len(s.Slots) == 0
+}
+
+// Location منطقه زمانی زمان‌بندی
+func (s ChannelSchedule) Location() (*time.Location, error) {
+	if s.Timezone == "" {
+		return time.LoadLocation(DefaultChannelTimezone)
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return nil, ErrInvalidTimezone
+	}
+	return loc, nil
+}
+
+// Validate بررسی معتبر بودن زمان‌بندی (زمان‌بندی خالی فقط از نظر منطقه زمانی بررسی می‌شود)
+func (s ChannelSchedule) Validate() error {
+	if _, err := s.Location(); err != nil {
+		return err
+	}
+	for _, d := range s.Weekdays {
+		if d < 0 || d > 6 {
+			return ErrInvalidSchedule
+		}
+	}
+	if s.IsZero() {
+		return nil
+	}
+
+	switch s.Kind {
+	case ScheduleDaily:
+		if len(s.Slots) > ChannelSlotsMax {
+			return ErrTooManySlots
+		}
+		minutes := make([]int, 0, len(s.Slots))
+		for _, slot := range s.Slots {
+			if !ValidScheduleTime(slot) {
+				return ErrInvalidScheduleTime
+			}
+			minutes = append(minutes, slotMinutes(slot))
+		}
+		sort.Ints(minutes)
+		for i := range minutes {
+			// فاصله هر نوبت تا نوبت بعدی (آخرین نوبت تا اولین نوبت فردا)
+			next := minutes[(i+1)%len(minutes)]
+			if i == len(minutes)-1 {
+				next += 24 * 60
+			}
+			if len(minutes) > 1 && next-minutes[i] < ChannelIntervalMin {
+				return ErrScheduleTooFrequent
+			}
+		}
+
+	case ScheduleInterval:
+		if s.Interval < ChannelIntervalMin {
+			return ErrScheduleTooFrequent
+		}
+		if s.Interval > ChannelIntervalMax {
+			return ErrInvalidSchedule
+		}
+
+	case ScheduleCron:
+		if strings.Contains(s.Cron, "TZ=") {
+			return ErrInvalidCron
+		}
+		sched, err := cronParser.Parse(s.Cron)
+		if err != nil {
+			return ErrInvalidCron
+		}
+		// بررسی فاصله چند اجرای پیاپی
+		prev := sched.Next(time.Now())
+		for i := 0; i < 10 && !prev.IsZero(); i++ {
+			next := sched.Next(prev)
+			if next.IsZero() {
+				break
+			}
+			if next.Sub(prev) < ChannelIntervalMin*time.Minute {
+				return ErrScheduleTooFrequent
+			}
+			prev = next
+		}
+
+	default:
+		return ErrInvalidSchedule
+	}
+	return nil
+}
+
+// Next اولین نوبت انتشار پس از after؛ برای زمان‌بندی خالی زمان صفر
+func (s ChannelSchedule) Next(after time.Time) (time.Time, error) {
+	if s.IsZero() {
+		return time.Time{}, nil
+	}
+	loc, err := s.Location()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if s.Kind == ScheduleCron {
+		sched, err := cronParser.Parse(s.Cron)
+		if err != nil {
+			return time.Time{}, ErrInvalidCron
+		}
+		next := sched.Next(after.In(loc))
+		if next.IsZero() {
+			return time.Time{}, ErrInvalidCron
+		}
+		return next, nil
+	}
+
+	local := after.In(loc)
+	// یک هفته کامل به همراه روز جاری بررسی می‌شود
+	for d := 0; d <= 7; d++ {
+		day := time.Date(local.Year(), local.Month(), local.Day()+d, 0, 0, 0, 0, loc)
+		if !s.OnWeekday(day.Weekday()) {
+			continue
+		}
+		for _, t := range s.dayRuns(day, loc) {
+			if t.After(after) {
+				return t, nil
+			}
+		}
+	}
+	return time.Time{}, ErrNoWeekdays
+}
+
+// OnWeekday بررسی فعال بودن انتشار در یک روز هفته
+func (s ChannelSchedule) OnWeekday(d time.Weekday) bool {
+	if len(s.Weekdays) == 0 {
+		return true
+	}
+	for _, w := range s.Weekdays {
+		if w == int(d) {
+			return true
+		}
+	}
+	return false
+}
+
+// dayRuns نوبت‌های انتشار یک روز به ترتیب زمان
+func (s ChannelSchedule) dayRuns(day time.Time, loc *time.Location) []time.Time {
+	var runs []time.Time
+	if s.Kind == ScheduleInterval {
+		end := time.Date(day.Year(), day.Month(), day.Day()+1, 0, 0, 0, 0, loc)
+		for t := day; t.Before(end); t = t.Add(time.Duration(s.Interval) * time.Minute) {
+			runs = append(runs, t)
+		}
+		return runs
+	}
+
+	for _, slot := range s.Slots {
+		m := slotMinutes(slot)
+		runs = append(runs, time.Date(day.Year(), day.Month(), day.Day(), m/60, m%60, 0, 0, loc))
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].Before(runs[j]) })
+	return runs
+}
+
+// slotMinutes تبدیل HH:MM به دقیقه از نیمه‌شب
+func slotMinutes(slot string) int {
+	t, err := time.Parse("15:04", slot)
+	if err != nil {
+		return 0
+	}
+	return t.Hour()*60 + t.Minute()
+}
@@ -0,0 +1,174 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func utc(day, hour, min int) time.Time {
+	return time.Date(2026, time.October, day, hour, min, 0, 0, time.UTC)
+}
+
+func TestChannelScheduleNext(t *testing.T) {
+	tehran, err := time.LoadLocation("Asia/Tehran")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// ۱۸ اکتبر ۲۰۲۶ یکشنبه است
+	tests := []struct {
+		name  string
+		sched ChannelSchedule
+		after time.Time
+		want  time.Time
+	}{
+		{
+			name:  "daily later today",
+			sched: ChannelSchedule{Kind: ScheduleDaily, Slots: []string{"09:00", "18:00"}, Timezone: "UTC"},
+			after: utc(18, 10, 0),
+			want:  utc(18, 18, 0),
+		},
+		{
+			name:  "daily strictly after slot",
+			sched: ChannelSchedule{Kind: ScheduleDaily, Slots: []string{"09:00", "18:00"}, Timezone: "UTC"},
+			after: utc(18, 18, 0),
+			want:  utc(19, 9, 0),
+		},
+		{
+			name:  "daily unsorted slots",
+			sched: ChannelSchedule{Kind: ScheduleDaily, Slots: []string{"18:00", "09:00"}, Timezone: "UTC"},
+			after: utc(18, 8, 0),
+			want:  utc(18, 9, 0),
+		},
+		{
+			name:  "daily on monday only",
+			sched: ChannelSchedule{Kind: ScheduleDaily, Slots: []string{"09:00"}, Weekdays: []int{1}, Timezone: "UTC"},
+			after: utc(18, 10, 0),
+			want:  utc(19, 9, 0),
+		},
+		{
+			name:  "daily same weekday next week",
+			sched: ChannelSchedule{Kind: ScheduleDaily, Slots: []string{"09:00"}, Weekdays: []int{0}, Timezone: "UTC"},
+			after: utc(18, 10, 0),
+			want:  utc(25, 9, 0),
+		},
+		{
+			name:  "daily in channel timezone",
+			sched: ChannelSchedule{Kind: ScheduleDaily, Slots: []string{"09:00"}, Timezone: "Asia/Tehran"},
+			after: time.Date(2026, time.October, 18, 9, 30, 0, 0, tehran),
+			want:  time.Date(2026, time.October, 19, 9, 0, 0, 0, tehran),
+		},
+		{
+			name:  "default timezone",
+			sched: ChannelSchedule{Kind: ScheduleDaily, Slots: []string{"09:00"}},
+			after: time.Date(2026, time.October, 18, 8, 0, 0, 0, tehran),
+			want:  time.Date(2026, time.October, 18, 9, 0, 0, 0, tehran),
+		},
+		{
+			name:  "interval from midnight",
+			sched: ChannelSchedule{Kind: ScheduleInterval, Interval: 90, Timezone: "UTC"},
+			after: utc(18, 10, 0),
+			want:  utc(18, 10, 30),
+		},
+		{
+			name:  "interval restarts at midnight",
+			sched: ChannelSchedule{Kind: ScheduleInterval, Interval: 7 * 60, Timezone: "UTC"},
+			after: utc(18, 22, 0),
+			want:  utc(19, 0, 0),
+		},
+		{
+			name:  "interval on tuesday only",
+			sched: ChannelSchedule{Kind: ScheduleInterval, Interval: 60, Weekdays: []int{2}, Timezone: "UTC"},
+			after: utc(18, 10, 0),
+			want:  utc(20, 0, 0),
+		},
+		{
+			name:  "cron",
+			sched: ChannelSchedule{Kind: ScheduleCron, Cron: "0 9 * * 1", Timezone: "UTC"},
+			after: utc(18, 10, 0),
+			want:  utc(19, 9, 0),
+		},
+		{
+			name:  "cron in channel timezone",
+			sched: ChannelSchedule{Kind: ScheduleCron, Cron: "30 8 * * *", Timezone: "Asia/Tehran"},
+			after: utc(18, 4, 0),
+			want:  utc(18, 5, 0),
+		},
+		{
+			name:  "empty schedule",
+			sched: ChannelSchedule{Kind: ScheduleDaily, Timezone: "UTC"},
+			after: utc(18, 10, 0),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.sched.Next(tt.after)
+			if err != nil {
+				t.Fatalf("Next: %v", err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("Next = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChannelScheduleNextErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		sched ChannelSchedule
+		want  error
+	}{
+		{"unknown timezone", ChannelSchedule{Kind: ScheduleDaily, Slots: []string{"09:00"}, Timezone: "Mars/Base"}, ErrInvalidTimezone},
+		{"bad cron", ChannelSchedule{Kind: ScheduleCron, Cron: "every day", Timezone: "UTC"}, ErrInvalidCron},
+		{"no matching weekday", ChannelSchedule{Kind: ScheduleDaily, Slots: []string{"09:00"}, Weekdays: []int{9}, Timezone: "UTC"}, ErrNoWeekdays},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.sched.Next(utc(18, 10, 0)); !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestChannelScheduleValidate(t *testing.T) {
+	hourly := make([]string, ChannelSlotsMax+1)
+	for i := range hourly {
+		hourly[i] = time.Date(0, 1, 1, i, 0, 0, 0, time.UTC).Format("15:04")
+	}
+
+	tests := []struct {
+		name  string
+		sched ChannelSchedule
+		want  error
+	}{
+		{"empty", ChannelSchedule{Kind: ScheduleDaily}, nil},
+		{"daily", ChannelSchedule{Kind: ScheduleDaily, Slots: []string{"09:00", "21:00"}, Weekdays: []int{0, 6}}, nil},
+		{"single slot", ChannelSchedule{Kind: ScheduleDaily, Slots: []string{"23:59"}}, nil},
+		{"too many slots", ChannelSchedule{Kind: ScheduleDaily, Slots: hourly}, ErrTooManySlots},
+		{"slots too close", ChannelSchedule{Kind: ScheduleDaily, Slots: []string{"09:00", "09:20"}}, ErrScheduleTooFrequent},
+		{"slots too close across midnight", ChannelSchedule{Kind: ScheduleDaily, Slots: []string{"00:10", "23:50"}}, ErrScheduleTooFrequent},
+		{"bad slot time", ChannelSchedule{Kind: ScheduleDaily, Slots: []string{"25:00"}}, ErrInvalidScheduleTime},
+		{"bad weekday", ChannelSchedule{Kind: ScheduleDaily, Slots: []string{"09:00"}, Weekdays: []int{7}}, ErrInvalidSchedule},
+		{"bad timezone", ChannelSchedule{Kind: ScheduleDaily, Slots: []string{"09:00"}, Timezone: "Mars/Base"}, ErrInvalidTimezone},
+		{"interval", ChannelSchedule{Kind: ScheduleInterval, Interval: ChannelIntervalMin}, nil},
+		{"interval too short", ChannelSchedule{Kind: ScheduleInterval, Interval: ChannelIntervalMin - 1}, ErrScheduleTooFrequent},
+		{"interval too long", ChannelSchedule{Kind: ScheduleInterval, Interval: ChannelIntervalMax + 1}, ErrInvalidSchedule},
+		{"cron", ChannelSchedule{Kind: ScheduleCron, Cron: "0 9 * * 1-5"}, nil},
+		{"cron descriptor", ChannelSchedule{Kind: ScheduleCron, Cron: "@daily"}, nil},
+		{"cron too frequent", ChannelSchedule{Kind: ScheduleCron, Cron: "*/10 * * * *"}, ErrScheduleTooFrequent},
+		{"cron with timezone", ChannelSchedule{Kind: ScheduleCron, Cron: "CRON_TZ=UTC 0 9 * * *"}, ErrInvalidCron},
+		{"cron with six fields", ChannelSchedule{Kind: ScheduleCron, Cron: "0 0 9 * * *"}, ErrInvalidCron},
+		{"unknown kind", ChannelSchedule{Kind: "weekly", Slots: []string{"09:00"}}, ErrInvalidSchedule},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.sched.Validate(); !errors.Is(err, tt.want) {
+				t.Errorf("Validate = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
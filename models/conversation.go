@@ -0,0 +1,215 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Conversation - یک رشته گفتگوی چت خصوصی
+type Conversation struct {
+	ID           int
+	UserID       int64
+	Title        string
+	IsActive     bool
+	MessageCount int
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// ConversationMessage - یک پیام ذخیره‌شده در رشته گفتگو
+type ConversationMessage struct {
+	ID             int
+	ConversationID int
+	Role           string
+	Content        string
+	Tokens         int
+	CreatedAt      time.Time
+}
+
+// دریافت رشته فعال کاربر (nil یعنی رشته فعالی وجود ندارد)
+func GetActiveConversation(db *sql.DB, userID int64) (*Conversation, error) {
+	conv := &Conversation{}
+	err := db.QueryRow(`
+		SELECT id, user_id, title, is_active, created_at, updated_at
+		FROM conversations
+		WHERE user_id = $1 AND is_active = TRUE
+	`, userID).Scan(&conv.ID, &conv.UserID, &conv.Title, &conv.IsActive, &conv.CreatedAt, &conv.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return conv, nil
+}
+
+// دریافت رشته گفتگو متعلق به کاربر (nil یعنی یافت نشد)
+func GetConversation(db *sql.DB, userID int64, conversationID int) (*Conversation, error) {
+	conv := &Conversation{}
+	err := db.QueryRow(`
+		SELECT c.id, c.user_id, c.title, c.is_active, c.created_at, c.updated_at,
+			(SELECT COUNT(*) FROM conversation_messages m WHERE m.conversation_id = c.id)
+		FROM conversations c
+		WHERE c.id = $1 AND c.user_id = $2
+	`, conversationID, userID).Scan(&conv.ID, &conv.UserID, &conv.Title, &conv.IsActive,
+		&conv.CreatedAt, &conv.UpdatedAt, &conv.MessageCount)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return conv, nil
+}
+
+// ایجاد رشته جدید و غیرفعال کردن رشته قبلی کاربر
+func CreateConversation(db *sql.DB, userID int64, title string) (*Conversation, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	if _, err := tx.Exec(`
+		UPDATE conversations SET is_active = FALSE WHERE user_id = $1 AND is_active = TRUE
+	`, userID); err != nil {
+		return nil, err
+	}
+
+	conv := &Conversation{UserID: userID, Title: title, IsActive: true, CreatedAt: now, UpdatedAt: now}
+	err = tx.QueryRow(`
+		INSERT INTO conversations (user_id, title, is_active, created_at, updated_at)
+		VALUES ($1, $2, TRUE, $3, $3)
+		RETURNING id
+	`, userID, title, now).Scan(&conv.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return conv, tx.Commit()
+}
+
+// پایان رشته فعال کاربر (پیام بعدی رشته جدیدی شروع می‌کند)
+func CloseActiveConversation(db *sql.DB, userID int64) error {
+	_, err := db.Exec(`
+		UPDATE conversations SET is_active = FALSE WHERE user_id = $1 AND is_active = TRUE
+	`, userID)
+	return err
+}
+
+// فعال کردن دوباره یک رشته قدیمی برای ادامه گفتگو
+func ActivateConversation(db *sql.DB, userID int64, conversationID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		UPDATE conversations SET is_active = FALSE WHERE user_id = $1 AND is_active = TRUE
+	`, userID); err != nil {
+		return err
+	}
+
+	res, err := tx.Exec(`
+		UPDATE conversations SET is_active = TRUE, updated_at = $1 WHERE id = $2 AND user_id = $3
+	`, time.Now(), conversationID, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return tx.Commit()
+}
+
+// لیست رشته‌های کاربر به ترتیب آخرین فعالیت
+func ListConversations(db *sql.DB, userID int64, limit, offset int) ([]Conversation, error) {
+	rows, err := db.Query(`
+		SELECT c.id, c.user_id, c.title, c.is_active, c.created_at, c.updated_at,
+			(SELECT COUNT(*) FROM conversation_messages m WHERE m.conversation_id = c.id)
+		FROM conversations c
+		WHERE c.user_id = $1
+		ORDER BY c.updated_at DESC, c.id DESC
+		LIMIT $2 OFFSET $3
+	`, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var conversations []Conversation
+	for rows.Next() {
+		var c Conversation
+		if err := rows.Scan(&c.ID, &c.UserID, &c.Title, &c.IsActive, &c.CreatedAt, &c.UpdatedAt, &c.MessageCount); err != nil {
+			return nil, err
+		}
+		conversations = append(conversations, c)
+	}
+	return conversations, rows.Err()
+}
+
+// تعداد رشته‌های کاربر
+func CountConversations(db *sql.DB, userID int64) (int, error) {
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM conversations WHERE user_id = $1`, userID).Scan(&count)
+	return count, err
+}
+
+// افزودن پیام‌ها به رشته و بروزرسانی زمان آخرین فعالیت
+func AddConversationMessages(db *sql.DB, conversationID int, messages ...ConversationMessage) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	for _, m := range messages {
+		if _, err := tx.Exec(`
+			INSERT INTO conversation_messages (conversation_id, role, content, tokens, created_at)
+			VALUES ($1, $2, $3, $4, $5)
+		`, conversationID, m.Role, m.Content, m.Tokens, now); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(`
+		UPDATE conversations SET updated_at = $1 WHERE id = $2
+	`, now, conversationID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// آخرین پیام‌های رشته به ترتیب زمانی
+func GetConversationMessages(db *sql.DB, conversationID int, limit int) ([]ConversationMessage, error) {
+	rows, err := db.Query(`
+		SELECT id, conversation_id, role, content, tokens, created_at
+		FROM (
+			SELECT id, conversation_id, role, content, COALESCE(tokens, 0) AS tokens, created_at
+			FROM conversation_messages
+			WHERE conversation_id = $1
+			ORDER BY id DESC
+			LIMIT $2
+		) recent
+		ORDER BY id
+	`, conversationID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []ConversationMessage
+	for rows.Next() {
+		var m ConversationMessage
+		if err := rows.Scan(&m.ID, &m.ConversationID, &m.Role, &m.Content, &m.Tokens, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
@@ -0,0 +1,378 @@
+package models
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// محدوده مجاز تنظیمات گروه (مطابق محدودیت‌های جدول groups)
+const (
+	DefaultTriggerPrefix = "*"
+	GroupRateLimitMin    = 1
+	GroupRateLimitMax    = 100
+	GroupBatchWindowMax  = 30 // ثانیه
+)
+
+// روش‌های فعال‌سازی پاسخ در گروه
+const (
+	TriggerModePrefix  = "prefix"  // پیام با پیشوند گروه شروع شود
+	TriggerModeReply   = "reply"   // ریپلای به پیام ربات (ادامه پاسخ قبلی)
+	TriggerModeMention = "mention" // منشن ربات
+	TriggerModeCommand = "command" // دستور /ask
+	TriggerModeKeyword = "keyword" // وجود یکی از کلمات کلیدی گروه
+)
+
+// TriggerModes ترتیب نمایش و بررسی روش‌های فعال‌سازی
+var TriggerModes = []string{TriggerModeCommand, TriggerModePrefix, TriggerModeReply, TriggerModeMention, TriggerModeKeyword}
+
+// روش پرداخت هزینه پرسش‌های گروه
+const (
+	BillingModeMember   = "member"   // هر عضو با کلید خودش
+	BillingModeFallback = "fallback" // کلید اسپانسر برای اعضای بدون کلید
+	BillingModeSponsor  = "sponsor"  // همه اعضا با کلید اسپانسر
+)
+
+// وضعیت ربات در گروه (مطابق وضعیت عضویت در API تلگرام)
+const (
+	GroupBotMember     = "member"
+	GroupBotAdmin      = "administrator"
+	GroupBotRestricted = "restricted"
+	GroupBotLeft       = "left"
+	GroupBotKicked     = "kicked"
+)
+
+// Group - گروهی که ربات در آن فعال است به همراه تنظیمات مالک گروه
+type Group struct {
+	ID             int
+	GroupID        int64 // آیدی چت تلگرام
+	Title          string
+	OwnerID        int64
+	FooterText     string
+	IsActive       bool
+	RateLimit      int // حداکثر سوال در دقیقه
+	TotalQuestions int
+	TriggerPrefix  string
+	AllowedMembers []int64 // خالی یعنی همه اعضا
+	SystemPrompt   string
+	BotStatus      string
+	TriggerModes   []string
+	Keywords       []string
+	AdminsOnly     bool // پاسخ فقط به ادمین‌های گروه
+	BillingMode    string
+	SponsorKeyID   int     // کلید مالک گروه برای پرداخت هزینه اعضا؛ صفر یعنی بدون کلید اسپانسر
+	SponsorDaily   int     // سقف پرسش روزانه هر عضو با کلید اسپانسر؛ صفر یعنی نامحدود
+	MonthlyBudget  float64 // سقف هزینه ماهانه گروه به دلار؛ صفر یعنی بدون سقف
+	BatchWindow    int     // پنجره تجمیع پرسش‌ها به ثانیه؛ صفر یعنی پاسخ فوری
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// CanAsk بررسی مجاز بودن عضو برای پرسیدن سوال در گروه
+func (g *Group) CanAsk(userID int64) bool {
+	if len(g.AllowedMembers) == 0 {
+		return true
+	}
+	for _, id := range g.AllowedMembers {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// HasTriggerMode بررسی فعال بودن یک روش فعال‌سازی
+func (g *Group) HasTriggerMode(mode string) bool {
+	for _, m := range g.TriggerModes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchKeyword بررسی وجود یکی از کلمات کلیدی گروه در متن (بدون حساسیت به حروف بزرگ و کوچک)
+func (g *Group) MatchKeyword(text string) bool {
+	text = strings.ToLower(text)
+	for _, k := range g.Keywords {
+		if k != "" && strings.Contains(text, strings.ToLower(k)) {
+			return true
+		}
+	}
+	return false
+}
+
+// TrimTrigger جدا کردن سوال از پیشوند فعال‌سازی گروه؛ در نبود پیشوند false برمی‌گرداند
+func (g *Group) TrimTrigger(text string) (string, bool) {
+	prefix := g.TriggerPrefix
+	if prefix == "" {
+		prefix = DefaultTriggerPrefix
+	}
+	if !strings.HasPrefix(text, prefix) {
+		return "", false
+	}
+	return strings.TrimSpace(strings.TrimPrefix(text, prefix)), true
+}
+
+const groupColumns = `id, group_id, COALESCE(group_title, ''), owner_id, COALESCE(footer_text, ''),
+	is_active, rate_limit, total_questions, trigger_prefix, allowed_members,
+	COALESCE(system_prompt, ''), bot_status, trigger_modes, trigger_keywords, admins_only,
+	billing_mode, COALESCE(sponsor_key_id, 0), sponsor_daily_limit, COALESCE(monthly_budget, 0),
+	batch_window, created_at, updated_at`
+
+func scanGroup(row interface{ Scan(...interface{}) error }) (*Group, error) {
+	g := &Group{}
+	var allowed pq.Int64Array
+	var modes, keywords pq.StringArray
+	err := row.Scan(&g.ID, &g.GroupID, &g.Title, &g.OwnerID, &g.FooterText,
+		&g.IsActive, &g.RateLimit, &g.TotalQuestions, &g.TriggerPrefix, &allowed,
+		&g.SystemPrompt, &g.BotStatus, &modes, &keywords, &g.AdminsOnly,
+		&g.BillingMode, &g.SponsorKeyID, &g.SponsorDaily, &g.MonthlyBudget,
+		&g.BatchWindow, &g.CreatedAt, &g.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	g.AllowedMembers = allowed
+	g.TriggerModes = modes
+	g.Keywords = keywords
+	return g, nil
+}
+
+// تعداد گروه‌های فعال (برای آمار پنل مدیریت)
+func CountActiveGroups(db *sql.DB) (int, error) {
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM groups WHERE is_active`).Scan(&count)
+	return count, err
+}
+
+// دریافت گروه بر اساس آیدی چت؛ در صورت عدم ثبت nil برمی‌گرداند
+func GetGroup(db *sql.DB, groupID int64) (*Group, error) {
+	g, err := scanGroup(db.QueryRow(`SELECT `+groupColumns+` FROM groups WHERE group_id = $1`, groupID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return g, err
+}
+
+// ثبت گروه با مالک مشخص؛ اگر گروه از قبل ثبت شده باشد فقط عنوان آن به‌روز می‌شود
+func RegisterGroup(db *sql.DB, groupID int64, title string, ownerID int64, rateLimit int) (*Group, error) {
+	if rateLimit < GroupRateLimitMin || rateLimit > GroupRateLimitMax {
+		rateLimit = 5
+	}
+	return scanGroup(db.QueryRow(`
+		INSERT INTO groups (group_id, group_title, owner_id, rate_limit)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (group_id) DO UPDATE SET group_title = EXCLUDED.group_title, updated_at = NOW()
+		RETURNING `+groupColumns, groupID, title, ownerID, rateLimit))
+}
+
+// ثبت ورود ربات به گروه: کاربری که ربات را اضافه کرده مالک گروه می‌شود و پاسخ‌گویی فعال می‌شود
+func UpsertGroupMembership(db *sql.DB, groupID int64, title string, ownerID int64, botStatus string, rateLimit int) (*Group, error) {
+	if rateLimit < GroupRateLimitMin || rateLimit > GroupRateLimitMax {
+		rateLimit = 5
+	}
+	return scanGroup(db.QueryRow(`
+		INSERT INTO groups (group_id, group_title, owner_id, rate_limit, bot_status)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (group_id) DO UPDATE SET
+			group_title = EXCLUDED.group_title,
+			owner_id = EXCLUDED.owner_id,
+			bot_status = EXCLUDED.bot_status,
+			is_active = TRUE,
+			updated_at = NOW()
+		RETURNING `+groupColumns, groupID, title, ownerID, rateLimit, botStatus))
+}
+
+// تغییر وضعیت ربات در گروه؛ با deactivate پاسخ‌گویی هم غیرفعال می‌شود (خروج یا اخراج ربات)
+//
+// برای گروه ثبت‌نشده nil برمی‌گرداند.
+func UpdateGroupBotStatus(db *sql.DB, groupID int64, botStatus string, deactivate bool) (*Group, error) {
+	g, err := scanGroup(db.QueryRow(`
+		UPDATE groups SET bot_status = $2,
+			is_active = CASE WHEN $3 THEN FALSE ELSE is_active END,
+			updated_at = NOW()
+		WHERE group_id = $1
+		RETURNING `+groupColumns, groupID, botStatus, deactivate))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return g, err
+}
+
+// انتقال گروه به آیدی جدید پس از تبدیل گروه عادی به سوپرگروه
+//
+// اگر ردیفی برای آیدی جدید زودتر ساخته شده باشد، تنظیمات گروه قدیمی جایگزین آن می‌شود.
+// برای گروه ثبت‌نشده nil برمی‌گرداند.
+func MigrateGroup(db *sql.DB, fromID, toID int64) (*Group, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM groups WHERE group_id = $1)`, fromID).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, nil
+	}
+
+	if _, err := tx.Exec(`DELETE FROM groups WHERE group_id = $1`, toID); err != nil {
+		return nil, err
+	}
+	g, err := scanGroup(tx.QueryRow(`
+		UPDATE groups SET group_id = $2, updated_at = NOW()
+		WHERE group_id = $1
+		RETURNING `+groupColumns, fromID, toID))
+	if err != nil {
+		return nil, err
+	}
+	// مصرف ثبت‌شده گروه برای گزارش و سقف بودجه ماهانه
+	if _, err := tx.Exec(`UPDATE usage_events SET group_id = $2 WHERE group_id = $1`, fromID, toID); err != nil {
+		return nil, err
+	}
+	return g, tx.Commit()
+}
+
+// گروه‌های متعلق به کاربر
+func ListOwnedGroups(db *sql.DB, ownerID int64) ([]Group, error) {
+	rows, err := db.Query(`SELECT `+groupColumns+` FROM groups WHERE owner_id = $1 ORDER BY created_at`, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []Group
+	for rows.Next() {
+		g, err := scanGroup(rows)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, *g)
+	}
+	return groups, rows.Err()
+}
+
+// دریافت گروه با بررسی مالکیت؛ در صورت عدم وجود nil برمی‌گرداند
+func GetOwnedGroup(db *sql.DB, ownerID int64, id int) (*Group, error) {
+	g, err := scanGroup(db.QueryRow(`SELECT `+groupColumns+` FROM groups WHERE id = $1 AND owner_id = $2`, id, ownerID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return g, err
+}
+
+// تغییر سقف سوال در دقیقه
+func SetGroupRateLimit(db *sql.DB, ownerID int64, id, limit int) error {
+	return execGroupUpdate(db, `UPDATE groups SET rate_limit = $1, updated_at = NOW() WHERE id = $2 AND owner_id = $3`,
+		limit, id, ownerID)
+}
+
+// تغییر پنجره تجمیع پرسش‌ها به ثانیه (صفر یعنی پاسخ فوری)
+func SetGroupBatchWindow(db *sql.DB, ownerID int64, id, seconds int) error {
+	return execGroupUpdate(db, `UPDATE groups SET batch_window = $1, updated_at = NOW() WHERE id = $2 AND owner_id = $3`,
+		seconds, id, ownerID)
+}
+
+// تغییر متن پایانی پاسخ‌ها (رشته خالی یعنی بدون متن پایانی)
+func SetGroupFooter(db *sql.DB, ownerID int64, id int, footer string) error {
+	return execGroupUpdate(db, `UPDATE groups SET footer_text = NULLIF($1, ''), updated_at = NOW() WHERE id = $2 AND owner_id = $3`,
+		footer, id, ownerID)
+}
+
+// تغییر پیشوند فعال‌سازی پاسخ
+func SetGroupTriggerPrefix(db *sql.DB, ownerID int64, id int, prefix string) error {
+	return execGroupUpdate(db, `UPDATE groups SET trigger_prefix = $1, updated_at = NOW() WHERE id = $2 AND owner_id = $3`,
+		prefix, id, ownerID)
+}
+
+// تغییر اعضای مجاز (خالی یعنی همه اعضا)
+func SetGroupAllowedMembers(db *sql.DB, ownerID int64, id int, members []int64) error {
+	if members == nil {
+		members = []int64{}
+	}
+	return execGroupUpdate(db, `UPDATE groups SET allowed_members = $1, updated_at = NOW() WHERE id = $2 AND owner_id = $3`,
+		pq.Array(members), id, ownerID)
+}
+
+// تغییر پرامپت سیستمی پیش‌فرض گروه (رشته خالی یعنی پرامپت پیش‌فرض ربات)
+func SetGroupSystemPrompt(db *sql.DB, ownerID int64, id int, prompt string) error {
+	return execGroupUpdate(db, `UPDATE groups SET system_prompt = NULLIF($1, ''), updated_at = NOW() WHERE id = $2 AND owner_id = $3`,
+		prompt, id, ownerID)
+}
+
+// تغییر روش‌های فعال‌سازی پاسخ
+func SetGroupTriggerModes(db *sql.DB, ownerID int64, id int, modes []string) error {
+	return execGroupUpdate(db, `UPDATE groups SET trigger_modes = $1, updated_at = NOW() WHERE id = $2 AND owner_id = $3`,
+		pq.Array(modes), id, ownerID)
+}
+
+// تغییر کلمات کلیدی حالت keyword
+func SetGroupKeywords(db *sql.DB, ownerID int64, id int, keywords []string) error {
+	if keywords == nil {
+		keywords = []string{}
+	}
+	return execGroupUpdate(db, `UPDATE groups SET trigger_keywords = $1, updated_at = NOW() WHERE id = $2 AND owner_id = $3`,
+		pq.Array(keywords), id, ownerID)
+}
+
+// محدود کردن پاسخ‌گویی به ادمین‌های گروه
+func SetGroupAdminsOnly(db *sql.DB, ownerID int64, id int, adminsOnly bool) error {
+	return execGroupUpdate(db, `UPDATE groups SET admins_only = $1, updated_at = NOW() WHERE id = $2 AND owner_id = $3`,
+		adminsOnly, id, ownerID)
+}
+
+// تعیین کلید اسپانسر گروه از میان کلیدهای مالک (صفر یعنی حذف کلید اسپانسر و بازگشت به پرداخت توسط اعضا)
+func SetGroupSponsorKey(db *sql.DB, ownerID int64, id, keyID int) error {
+	return execGroupUpdate(db, `
+		UPDATE groups SET sponsor_key_id = NULLIF($1, 0),
+			billing_mode = CASE WHEN $1 = 0 THEN 'member' ELSE billing_mode END,
+			updated_at = NOW()
+		WHERE id = $2 AND owner_id = $3
+			AND ($1 = 0 OR EXISTS (SELECT 1 FROM api_keys WHERE id = $1 AND user_id = $3))
+	`, keyID, id, ownerID)
+}
+
+// تغییر روش پرداخت هزینه پرسش‌های گروه
+func SetGroupBillingMode(db *sql.DB, ownerID int64, id int, mode string) error {
+	return execGroupUpdate(db, `UPDATE groups SET billing_mode = $1, updated_at = NOW() WHERE id = $2 AND owner_id = $3`,
+		mode, id, ownerID)
+}
+
+// تغییر سقف پرسش روزانه هر عضو با کلید اسپانسر (صفر یعنی نامحدود)
+func SetGroupSponsorDailyLimit(db *sql.DB, ownerID int64, id, limit int) error {
+	return execGroupUpdate(db, `UPDATE groups SET sponsor_daily_limit = $1, updated_at = NOW() WHERE id = $2 AND owner_id = $3`,
+		limit, id, ownerID)
+}
+
+// تغییر سقف هزینه ماهانه گروه (صفر یعنی بدون سقف)
+func SetGroupMonthlyBudget(db *sql.DB, ownerID int64, id int, budget float64) error {
+	return execGroupUpdate(db, `UPDATE groups SET monthly_budget = NULLIF($1, 0), updated_at = NOW() WHERE id = $2 AND owner_id = $3`,
+		budget, id, ownerID)
+}
+
+// فعال یا غیرفعال کردن پاسخ‌گویی در گروه
+func SetGroupActive(db *sql.DB, ownerID int64, id int, active bool) error {
+	return execGroupUpdate(db, `UPDATE groups SET is_active = $1, updated_at = NOW() WHERE id = $2 AND owner_id = $3`,
+		active, id, ownerID)
+}
+
+// افزایش شمارنده سوالات پاسخ داده‌شده گروه
+func IncrementGroupQuestions(db *sql.DB, groupID int64) error {
+	_, err := db.Exec(`UPDATE groups SET total_questions = total_questions + 1 WHERE group_id = $1`, groupID)
+	return err
+}
+
+func execGroupUpdate(db *sql.DB, query string, args ...interface{}) error {
+	res, err := db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
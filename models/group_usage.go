@@ -0,0 +1,96 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// GroupMemberUsage - مصرف ماه جاری یک عضو در گروه
+type GroupMemberUsage struct {
+	UserID        int64
+	Name          string
+	Requests      int
+	Tokens        int
+	Cost          float64
+	SponsoredCost float64 // بخشی از هزینه که با کلید اسپانسر پرداخت شده
+}
+
+// GroupUsageReport - گزارش مصرف گروه برای مالک
+type GroupUsageReport struct {
+	Today     UsageTotals
+	Month     UsageTotals
+	Sponsored UsageTotals // پرسش‌های ماه جاری با کلید اسپانسر
+	Members   []GroupMemberUsage
+}
+
+// تعداد پرسش‌های امروز عضو با کلید اسپانسر گروه
+func GetGroupSponsoredToday(db *sql.DB, groupID, userID int64) (int, error) {
+	var count int
+	err := db.QueryRow(`
+		SELECT COUNT(*) FROM usage_events
+		WHERE group_id = $1 AND user_id = $2 AND sponsor_id IS NOT NULL AND created_at >= $3
+	`, groupID, userID, dayStart(time.Now())).Scan(&count)
+	return count, err
+}
+
+// هزینه ماه جاری گروه که با کلید اسپانسر پرداخت شده است
+func GetGroupSponsoredMonthCost(db *sql.DB, groupID int64) (float64, error) {
+	var cost float64
+	err := db.QueryRow(`
+		SELECT COALESCE(SUM(cost), 0) FROM usage_events
+		WHERE group_id = $1 AND sponsor_id IS NOT NULL AND created_at >= $2
+	`, groupID, monthStart(time.Now())).Scan(&cost)
+	return cost, err
+}
+
+// گزارش مصرف امروز و ماه جاری گروه همراه با پرمصرف‌ترین اعضا
+func GetGroupUsageReport(db *sql.DB, groupID int64, maxMembers int) (*GroupUsageReport, error) {
+	now := time.Now()
+	r := &GroupUsageReport{}
+	err := db.QueryRow(`
+		SELECT
+			COUNT(*) FILTER (WHERE created_at >= $3),
+			COALESCE(SUM(prompt_tokens + completion_tokens) FILTER (WHERE created_at >= $3), 0),
+			COALESCE(SUM(cost) FILTER (WHERE created_at >= $3), 0),
+			COUNT(*),
+			COALESCE(SUM(prompt_tokens + completion_tokens), 0),
+			COALESCE(SUM(cost), 0),
+			COUNT(*) FILTER (WHERE sponsor_id IS NOT NULL),
+			COALESCE(SUM(prompt_tokens + completion_tokens) FILTER (WHERE sponsor_id IS NOT NULL), 0),
+			COALESCE(SUM(cost) FILTER (WHERE sponsor_id IS NOT NULL), 0)
+		FROM usage_events
+		WHERE group_id = $1 AND created_at >= $2
+	`, groupID, monthStart(now), dayStart(now)).Scan(
+		&r.Today.Requests, &r.Today.Tokens, &r.Today.Cost,
+		&r.Month.Requests, &r.Month.Tokens, &r.Month.Cost,
+		&r.Sponsored.Requests, &r.Sponsored.Tokens, &r.Sponsored.Cost,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`
+		SELECT e.user_id, COALESCE('@' || NULLIF(u.username, ''), u.first_name, ''),
+			COUNT(*), COALESCE(SUM(e.prompt_tokens + e.completion_tokens), 0), COALESCE(SUM(e.cost), 0),
+			COALESCE(SUM(e.cost) FILTER (WHERE e.sponsor_id IS NOT NULL), 0)
+		FROM usage_events e
+		LEFT JOIN users u ON u.telegram_id = e.user_id
+		WHERE e.group_id = $1 AND e.created_at >= $2
+		GROUP BY e.user_id, u.username, u.first_name
+		ORDER BY SUM(e.cost) DESC, COUNT(*) DESC
+		LIMIT $3
+	`, groupID, monthStart(now), maxMembers)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var m GroupMemberUsage
+		if err := rows.Scan(&m.UserID, &m.Name, &m.Requests, &m.Tokens, &m.Cost, &m.SponsoredCost); err != nil {
+			return nil, err
+		}
+		r.Members = append(r.Members, m)
+	}
+	return r, rows.Err()
+}
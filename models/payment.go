@@ -0,0 +1,276 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// اعمال قیمت‌های اولیه پلن‌ها از تنظیمات
+//
+// قیمت پلن‌هایی که از پنل ادمین ویرایش شده‌اند (price_overridden) دست نمی‌خورد،
+// تا تغییرات ادمین با هر بار راه‌اندازی مجدد بازنویسی نشود.
+func ApplyPlanPrices(db *sql.DB, prices map[string]float64) error {
+	for plan, price := range prices {
+		_, err := db.Exec(`
+			UPDATE payment_links
+			SET price = $1, updated_at = $2
+			WHERE plan = $3 AND NOT price_overridden AND price <> $1
+		`, price, time.Now(), plan)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PaymentLink - پلن اشتراک و لینک پرداخت آن
+type PaymentLink struct {
+	ID           int
+	Plan         string
+	Link         string
+	Price        float64
+	DurationDays int
+	IsActive     bool
+	Description  string
+	UpdatedAt    time.Time
+}
+
+// PaymentRequest - درخواست پرداخت کاربر
+type PaymentRequest struct {
+	ID              int
+	UserID          int64
+	Plan            string
+	Amount          float64
+	Status          string
+	PaymentProof    string
+	RejectionReason sql.NullString
+	ProcessedBy     sql.NullInt64
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
+
+// وضعیت‌های درخواست پرداخت
+const (
+	PaymentPending  = "pending"
+	PaymentApproved = "approved"
+	PaymentRejected = "rejected"
+)
+
+// ErrPaymentAlreadyProcessed درخواست قبلاً توسط ادمین دیگری بررسی شده است
+var ErrPaymentAlreadyProcessed = errors.New("درخواست پرداخت قبلاً بررسی شده است")
+
+// دریافت پلن‌ها؛ در صورت activeOnly فقط پلن‌های فعال
+func GetPaymentLinks(db *sql.DB, activeOnly bool) ([]PaymentLink, error) {
+	rows, err := db.Query(`
+		SELECT id, plan, link, COALESCE(price, 0), duration_days, is_active,
+		       COALESCE(description, ''), updated_at
+		FROM payment_links
+		WHERE is_active = TRUE OR NOT $1
+		ORDER BY duration_days
+	`, activeOnly)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var links []PaymentLink
+	for rows.Next() {
+		var l PaymentLink
+		if err := rows.Scan(&l.ID, &l.Plan, &l.Link, &l.Price, &l.DurationDays, &l.IsActive, &l.Description, &l.UpdatedAt); err != nil {
+			return nil, err
+		}
+		links = append(links, l)
+	}
+	return links, rows.Err()
+}
+
+// دریافت یک پلن
+func GetPaymentLink(db *sql.DB, plan string) (*PaymentLink, error) {
+	l := &PaymentLink{}
+	err := db.QueryRow(`
+		SELECT id, plan, link, COALESCE(price, 0), duration_days, is_active,
+		       COALESCE(description, ''), updated_at
+		FROM payment_links
+		WHERE plan = $1
+	`, plan).Scan(&l.ID, &l.Plan, &l.Link, &l.Price, &l.DurationDays, &l.IsActive, &l.Description, &l.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// ثبت درخواست پرداخت جدید
+func CreatePaymentRequest(db *sql.DB, userID int64, plan string, amount float64, proof string) (int, error) {
+	var id int
+	err := db.QueryRow(`
+		INSERT INTO payment_requests (user_id, plan, amount, status, payment_proof, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $6)
+		RETURNING id
+	`, userID, plan, amount, PaymentPending, proof, time.Now()).Scan(&id)
+	return id, err
+}
+
+// دریافت درخواست پرداخت
+func GetPaymentRequest(db *sql.DB, id int) (*PaymentRequest, error) {
+	r := &PaymentRequest{}
+	err := db.QueryRow(`
+		SELECT id, user_id, plan, COALESCE(amount, 0), status, COALESCE(payment_proof, ''),
+		       rejection_reason, processed_by, created_at, updated_at
+		FROM payment_requests
+		WHERE id = $1
+	`, id).Scan(&r.ID, &r.UserID, &r.Plan, &r.Amount, &r.Status, &r.PaymentProof,
+		&r.RejectionReason, &r.ProcessedBy, &r.CreatedAt, &r.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// درخواست‌های در انتظار بررسی (قدیمی‌ترین اول)
+func GetPendingPaymentRequests(db *sql.DB, limit int) ([]PaymentRequest, error) {
+	rows, err := db.Query(`
+		SELECT id, user_id, plan, COALESCE(amount, 0), status, COALESCE(payment_proof, ''),
+		       rejection_reason, processed_by, created_at, updated_at
+		FROM payment_requests
+		WHERE status = $1
+		ORDER BY created_at
+		LIMIT $2
+	`, PaymentPending, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var requests []PaymentRequest
+	for rows.Next() {
+		var r PaymentRequest
+		if err := rows.Scan(&r.ID, &r.UserID, &r.Plan, &r.Amount, &r.Status, &r.PaymentProof,
+			&r.RejectionReason, &r.ProcessedBy, &r.CreatedAt, &r.UpdatedAt); err != nil {
+			return nil, err
+		}
+		requests = append(requests, r)
+	}
+	return requests, rows.Err()
+}
+
+// بررسی وجود درخواست در انتظار برای کاربر
+func HasPendingPaymentRequest(db *sql.DB, userID int64) (bool, error) {
+	var exists bool
+	err := db.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM payment_requests WHERE user_id = $1 AND status = $2)
+	`, userID, PaymentPending).Scan(&exists)
+	return exists, err
+}
+
+// تأیید درخواست پرداخت و فعال‌سازی VIP به مدت پلن
+//
+// تغییر وضعیت و فعال‌سازی VIP در یک تراکنش انجام می‌شود؛ وضعیت فقط اگر هنوز pending باشد
+// تغییر می‌کند تا دو ادمین همزمان یک درخواست را تأیید نکنند.
+func ApprovePaymentRequest(db *sql.DB, id int, adminID int64) (*PaymentRequest, int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer tx.Rollback()
+
+	r := &PaymentRequest{ID: id}
+	err = tx.QueryRow(`
+		UPDATE payment_requests
+		SET status = $1, processed_by = $2, updated_at = $3
+		WHERE id = $4 AND status = $5
+		RETURNING user_id, plan, COALESCE(amount, 0)
+	`, PaymentApproved, adminID, time.Now(), id, PaymentPending).Scan(&r.UserID, &r.Plan, &r.Amount)
+	if err == sql.ErrNoRows {
+		return nil, 0, ErrPaymentAlreadyProcessed
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	r.Status = PaymentApproved
+
+	var days int
+	err = tx.QueryRow(`SELECT duration_days FROM payment_links WHERE plan = $1`, r.Plan).Scan(&days)
+	if err == sql.ErrNoRows {
+		return nil, 0, fmt.Errorf("پلن %s یافت نشد", r.Plan)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	err = ActivateVIP(tx, r.UserID, r.Plan, days)
+	if err == sql.ErrNoRows {
+		return nil, 0, fmt.Errorf("کاربر %d یافت نشد", r.UserID)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, 0, err
+	}
+	return r, days, nil
+}
+
+// رد درخواست پرداخت با ذکر دلیل
+func RejectPaymentRequest(db *sql.DB, id int, adminID int64, reason string) (*PaymentRequest, error) {
+	r := &PaymentRequest{ID: id}
+	err := db.QueryRow(`
+		UPDATE payment_requests
+		SET status = $1, processed_by = $2, rejection_reason = $3, updated_at = $4
+		WHERE id = $5 AND status = $6
+		RETURNING user_id, plan, COALESCE(amount, 0)
+	`, PaymentRejected, adminID, reason, time.Now(), id, PaymentPending).Scan(&r.UserID, &r.Plan, &r.Amount)
+	if err == sql.ErrNoRows {
+		return nil, ErrPaymentAlreadyProcessed
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.Status = PaymentRejected
+	r.RejectionReason = sql.NullString{String: reason, Valid: true}
+	return r, nil
+}
+
+// IsPlaceholder لینک هنوز همان لینک نمونه‌ی اولیه است
+func (l *PaymentLink) IsPlaceholder() bool {
+	return strings.HasPrefix(l.Link, "https://example.com/")
+}
+
+// به‌روزرسانی لینک پرداخت پلن
+func UpdatePaymentLinkURL(db *sql.DB, plan, link string) error {
+	_, err := db.Exec(`UPDATE payment_links SET link = $1, updated_at = $2 WHERE plan = $3`, link, time.Now(), plan)
+	return err
+}
+
+// به‌روزرسانی قیمت پلن (از این پس plan_prices تنظیمات روی آن اعمال نمی‌شود)
+func UpdatePaymentLinkPrice(db *sql.DB, plan string, price float64) error {
+	_, err := db.Exec(`UPDATE payment_links SET price = $1, price_overridden = TRUE, updated_at = $2 WHERE plan = $3`, price, time.Now(), plan)
+	return err
+}
+
+// به‌روزرسانی مدت پلن (روز)
+func UpdatePaymentLinkDuration(db *sql.DB, plan string, days int) error {
+	_, err := db.Exec(`UPDATE payment_links SET duration_days = $1, updated_at = $2 WHERE plan = $3`, days, time.Now(), plan)
+	return err
+}
+
+// به‌روزرسانی توضیحات پلن
+func UpdatePaymentLinkDescription(db *sql.DB, plan, description string) error {
+	_, err := db.Exec(`UPDATE payment_links SET description = $1, updated_at = $2 WHERE plan = $3`, description, time.Now(), plan)
+	return err
+}
+
+// فعال/غیرفعال کردن پلن
+func UpdatePaymentLinkStatus(db *sql.DB, plan string, isActive bool) error {
+	_, err := db.Exec(`UPDATE payment_links SET is_active = $1, updated_at = $2 WHERE plan = $3`, isActive, time.Now(), plan)
+	return err
+}
@@ -2,20 +2,21 @@ package models
 
 import (
 	"database/sql"
-	"errors"
 	"time"
 )
 
 type Prompt struct {
 	ID         int
-	UserID     int
+	UserID     int64
+	Title      string
 	Content    string
 	Response   string
+	IsActive   bool
 	CreatedAt  time.Time
 	IsFavorite bool
 }
 
-func CreatePrompt(db *sql.DB, userID int, content, response string) error {
+func CreatePrompt(db *sql.DB, userID int64, content, response string) error {
 	query := `
 		INSERT INTO prompts (user_id, content, response, created_at)
 		VALUES ($1, $2, $3, NOW());
@@ -24,9 +25,9 @@ func CreatePrompt(db *sql.DB, userID int, content, response string) error {
 	return err
 }
 
-func GetUserPrompts(db *sql.DB, userID int, limit int) ([]Prompt, error) {
+func GetUserPrompts(db *sql.DB, userID int64, limit int) ([]Prompt, error) {
 	query := `
-		SELECT id, user_id, content, response, created_at, false as is_favorite
+		SELECT id, user_id, content, COALESCE(response, ''), created_at, COALESCE(is_favorite, false)
 		FROM prompts
 		WHERE user_id = $1
 		ORDER BY created_at DESC
@@ -50,8 +51,27 @@ func GetUserPrompts(db *sql.DB, userID int, limit int) ([]Prompt, error) {
 	return prompts, nil
 }
 
+// GetActivePrompt پرامپت سیستمی فعال کاربر (nil در صورت نبود)
+func GetActivePrompt(db *sql.DB, userID int64) (*Prompt, error) {
+	p := &Prompt{}
+	err := db.QueryRow(`
+		SELECT id, user_id, COALESCE(title, ''), content, is_active, created_at
+		FROM prompts
+		WHERE user_id = $1 AND is_active = TRUE
+		ORDER BY created_at DESC
+		LIMIT 1;
+	`, userID).Scan(&p.ID, &p.UserID, &p.Title, &p.Content, &p.IsActive, &p.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
 // CheckPromptLimit بررسی می‌کند که آیا کاربر هنوز مجاز به ساخت پرامپت جدید هست یا نه.
-func CheckPromptLimit(db *sql.DB, userID int, isVIP bool) (bool, int, error) {
+func CheckPromptLimit(db *sql.DB, userID int64, isVIP bool) (bool, int, error) {
 	var count int
 	err := db.QueryRow(`SELECT COUNT(*) FROM prompts WHERE user_id = $1;`, userID).Scan(&count)
 	if err != nil {
@@ -72,7 +92,7 @@ func CheckPromptLimit(db *sql.DB, userID int, isVIP bool) (bool, int, error) {
 }
 
 // DeleteOldPrompts حذف پرامپت‌های قدیمی در صورت تجاوز از محدودیت
-func DeleteOldPrompts(db *sql.DB, userID int, isVIP bool) error {
+func DeleteOldPrompts(db *sql.DB, userID int64, isVIP bool) error {
 	maxPrompts := 3
 	if isVIP {
 		maxPrompts = 10
@@ -90,22 +110,3 @@ func DeleteOldPrompts(db *sql.DB, userID int, isVIP bool) error {
 	_, err := db.Exec(query, userID, maxPrompts)
 	return err
 }
-
-// EnsurePromptTable ایجاد جدول در صورت نبود
-func EnsurePromptTable(db *sql.DB) error {
-	query := `
-		CREATE TABLE IF NOT EXISTS prompts (
-			id SERIAL PRIMARY KEY,
-			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
-			content TEXT NOT NULL,
-			response TEXT,
-			created_at TIMESTAMP DEFAULT NOW(),
-			is_favorite BOOLEAN DEFAULT FALSE
-		);
-	`
-	_, err := db.Exec(query)
-	if err != nil {
-		return errors.New("cannot create table prompts: " + err.Error())
-	}
-	return nil
-}
@@ -0,0 +1,149 @@
+package models
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"telegram-bot-manager/database"
+)
+
+// سطوح سهمیه (برای VIP دارای پلن، نام پلن به عنوان سطح استفاده می‌شود)
+const (
+	QuotaTierFree = "free"
+	QuotaTierVIP  = "vip"
+)
+
+// QuotaLimits - سقف مصرف روزانه؛ صفر یعنی نامحدود
+type QuotaLimits struct {
+	MessagesPerDay int
+	TokensPerDay   int
+}
+
+// Unlimited بررسی نامحدود بودن هر دو سقف
+func (l QuotaLimits) Unlimited() bool {
+	return l.MessagesPerDay == 0 && l.TokensPerDay == 0
+}
+
+// QuotaSettings - تنظیمات سهمیه روزانه
+type QuotaSettings struct {
+	Location *time.Location // روز مصرف در نیمه‌شب این منطقه زمانی ریست می‌شود
+	Free     QuotaLimits
+	VIP      QuotaLimits
+	Plans    map[string]QuotaLimits // سهمیه اختصاصی پلن‌ها؛ در نبود، سهمیه VIP
+}
+
+var quotaSettings = QuotaSettings{
+	Location: time.UTC,
+	Free:     QuotaLimits{MessagesPerDay: 20, TokensPerDay: 20000},
+}
+
+// ConfigureQuotas اعمال تنظیمات سهمیه (در زمان راه‌اندازی از main فراخوانی می‌شود)
+func ConfigureQuotas(s QuotaSettings) {
+	if s.Location == nil {
+		s.Location = quotaSettings.Location
+	}
+	quotaSettings = s
+}
+
+// UsageDay روز مصرف (در منطقه زمانی سهمیه) برای زمان t به صورت 2006-01-02
+func UsageDay(t time.Time) string {
+	return t.In(quotaSettings.Location).Format("2006-01-02")
+}
+
+// dayStart شروع روز مصرف t در منطقه زمانی سهمیه
+func dayStart(t time.Time) time.Time {
+	t = t.In(quotaSettings.Location)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, quotaSettings.Location)
+}
+
+// NextQuotaReset زمان ریست بعدی سهمیه (نیمه‌شب بعدی)
+func NextQuotaReset(now time.Time) time.Time {
+	return dayStart(now).AddDate(0, 0, 1)
+}
+
+// QuotaStatus - وضعیت سهمیه امروز کاربر
+type QuotaStatus struct {
+	Tier         string
+	Limits       QuotaLimits
+	MessagesUsed int
+	TokensUsed   int
+	ResetAt      time.Time
+}
+
+// Exceeded بررسی رسیدن به یکی از سقف‌ها
+func (s *QuotaStatus) Exceeded() bool {
+	return (s.Limits.MessagesPerDay > 0 && s.MessagesUsed >= s.Limits.MessagesPerDay) ||
+		(s.Limits.TokensPerDay > 0 && s.TokensUsed >= s.Limits.TokensPerDay)
+}
+
+// RemainingMessages پیام باقی‌مانده امروز؛ ‎-1 یعنی نامحدود
+func (s *QuotaStatus) RemainingMessages() int {
+	return remaining(s.Limits.MessagesPerDay, s.MessagesUsed)
+}
+
+// RemainingTokens توکن باقی‌مانده امروز؛ ‎-1 یعنی نامحدود
+func (s *QuotaStatus) RemainingTokens() int {
+	return remaining(s.Limits.TokensPerDay, s.TokensUsed)
+}
+
+func remaining(limit, used int) int {
+	if limit == 0 {
+		return -1
+	}
+	if used >= limit {
+		return 0
+	}
+	return limit - used
+}
+
+// QuotaForUser سطح و سقف سهمیه کاربر
+func QuotaForUser(u *User) (string, QuotaLimits) {
+	if !u.HasActiveVIP() {
+		return QuotaTierFree, quotaSettings.Free
+	}
+	if limits, ok := quotaSettings.Plans[u.VIPPlan]; ok && u.VIPPlan != "" {
+		return u.VIPPlan, limits
+	}
+	return QuotaTierVIP, quotaSettings.VIP
+}
+
+// CheckUsageLimit وضعیت سهمیه امروز کاربر (مجموع مصرف چت خصوصی، گروه و کانال)
+//
+// مصرف از شمارنده Redis خوانده می‌شود و در نبود آن از جدول token_usage ساخته می‌شود.
+func CheckUsageLimit(db *sql.DB, userID int64) (*QuotaStatus, error) {
+	user, err := GetUserByTelegramID(db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	status := &QuotaStatus{ResetAt: NextQuotaReset(now)}
+	status.Tier, status.Limits = QuotaForUser(user)
+	if status.Limits.Unlimited() {
+		return status, nil
+	}
+
+	day := UsageDay(now)
+	messages, tokens, found, err := database.GetQuotaUsage(userID, day)
+	if err != nil {
+		log.Printf("خطا در خواندن شمارنده سهمیه کاربر %d: %v", userID, err)
+	}
+	if !found {
+		err := db.QueryRow(`
+			SELECT COALESCE(SUM(request_count), 0), COALESCE(SUM(tokens_used), 0)
+			FROM token_usage
+			WHERE user_id = $1 AND date = $2
+		`, userID, day).Scan(&messages, &tokens)
+		if err != nil {
+			return nil, err
+		}
+		// شمارنده تا کمی پس از پایان روز نگه داشته می‌شود
+		if err := database.InitQuotaUsage(userID, day, messages, tokens, time.Until(status.ResetAt)+time.Hour); err != nil {
+			log.Printf("خطا در ساخت شمارنده سهمیه کاربر %d: %v", userID, err)
+		}
+	}
+
+	status.MessagesUsed, status.TokensUsed = messages, tokens
+	return status, nil
+}
@@ -0,0 +1,108 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// وضعیت‌های اجرای نوبت انتشار کانال
+const (
+	RunRunning   = "running"
+	RunSucceeded = "succeeded"
+	RunPartial   = "partial" // بخشی از پست‌های نوبت منتشر شد
+	RunFailed    = "failed"
+	RunFenced    = "fenced" // نمونه دیگری با توکن جدیدتر کانال را در دست گرفت
+)
+
+// ErrRunAlreadyStarted نوبتی که قبلاً شروع شده دوباره اجرا نمی‌شود
+var ErrRunAlreadyStarted = errors.New("این نوبت انتشار قبلاً اجرا شده است")
+
+// ScheduledRun - یک اجرای نوبت انتشار کانال
+type ScheduledRun struct {
+	ID           int64
+	ChannelID    int
+	SlotAt       time.Time
+	Status       string
+	FencingToken int64
+	Instance     string
+	Posts        int
+	Error        string
+	StartedAt    time.Time
+	FinishedAt   sql.NullTime
+}
+
+// شروع اجرای نوبت slot کانال و صدور توکن حصار جدید برای آن
+//
+// توکن با افزایش fencing_token کانال در همان تراکنش صادر می‌شود تا اجرای قبلی کانال
+// (که قفلش منقضی شده) در FencingTokenValid رد شود. نوبتی که قبلاً شروع شده دوباره
+// اجرا نمی‌شود (ErrRunAlreadyStarted) و توکن کانال هم تغییر نمی‌کند.
+func StartScheduledRun(db *sql.DB, channelID int, slot time.Time, instance string) (runID, token int64, err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`
+		UPDATE channels SET fencing_token = fencing_token + 1 WHERE id = $1 RETURNING fencing_token
+	`, channelID).Scan(&token)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO scheduled_runs (channel_id, slot_at, fencing_token, instance)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (channel_id, slot_at) DO NOTHING
+		RETURNING id
+	`, channelID, slot, token, instance).Scan(&runID)
+	if err == sql.ErrNoRows {
+		return 0, 0, ErrRunAlreadyStarted
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	return runID, token, tx.Commit()
+}
+
+// بررسی اینکه token هنوز آخرین توکن حصار کانال است
+func FencingTokenValid(db *sql.DB, channelID int, token int64) (bool, error) {
+	var valid bool
+	err := db.QueryRow(`SELECT fencing_token = $2 FROM channels WHERE id = $1`, channelID, token).Scan(&valid)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return valid, err
+}
+
+// ثبت نتیجه اجرای نوبت
+func FinishScheduledRun(db *sql.DB, runID int64, status string, posts int, errText string) error {
+	_, err := db.Exec(`
+		UPDATE scheduled_runs SET status = $1, posts = $2, error = NULLIF($3, ''), finished_at = NOW()
+		WHERE id = $4
+	`, status, posts, errText, runID)
+	return err
+}
+
+// آخرین اجرای نوبت انتشار کانال (nil اگر هنوز اجرایی نداشته)
+func LastScheduledRun(db *sql.DB, channelID int) (*ScheduledRun, error) {
+	r := &ScheduledRun{}
+	var errText sql.NullString
+	err := db.QueryRow(`
+		SELECT id, channel_id, slot_at, status, fencing_token, instance, posts, error, started_at, finished_at
+		FROM scheduled_runs
+		WHERE channel_id = $1
+		ORDER BY slot_at DESC
+		LIMIT 1
+	`, channelID).Scan(&r.ID, &r.ChannelID, &r.SlotAt, &r.Status, &r.FencingToken, &r.Instance,
+		&r.Posts, &errText, &r.StartedAt, &r.FinishedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.Error = errText.String
+	return r, nil
+}
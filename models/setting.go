@@ -0,0 +1,55 @@
+package models
+
+import (
+	"database/sql"
+	"strconv"
+)
+
+// کلیدهای جدول app_settings
+const (
+	SettingUSDToToman = "usd_to_toman"
+)
+
+// نرخ دلار پیش‌فرض در صورت نبود تنظیم
+const defaultUSDToToman = 30000
+
+// دریافت مقدار تنظیم؛ در صورت نبود، مقدار خالی و false
+func GetSetting(db *sql.DB, key string) (string, bool, error) {
+	var value string
+	err := db.QueryRow(`SELECT value FROM app_settings WHERE key = $1`, key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+// ثبت یا بروزرسانی مقدار تنظیم
+func SetSetting(db *sql.DB, key, value string) error {
+	_, err := db.Exec(`
+		INSERT INTO app_settings (key, value, updated_at)
+		VALUES ($1, $2, NOW())
+		ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, updated_at = EXCLUDED.updated_at
+	`, key, value)
+	return err
+}
+
+// نرخ تبدیل دلار به تومان برای نمایش هزینه‌ها
+func GetUSDToTomanRate(db *sql.DB) (float64, error) {
+	value, found, err := GetSetting(db, SettingUSDToToman)
+	if err != nil || !found {
+		return defaultUSDToToman, err
+	}
+	rate, err := strconv.ParseFloat(value, 64)
+	if err != nil || rate <= 0 {
+		return defaultUSDToToman, nil
+	}
+	return rate, nil
+}
+
+// تنظیم نرخ تبدیل دلار به تومان
+func SetUSDToTomanRate(db *sql.DB, rate float64) error {
+	return SetSetting(db, SettingUSDToToman, strconv.FormatFloat(rate, 'f', -1, 64))
+}
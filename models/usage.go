@@ -0,0 +1,213 @@
+package models
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"telegram-bot-manager/database"
+)
+
+// نام ردیف قیمت پیش‌فرض برای مدل‌هایی که قیمت مشخصی ندارند
+const DefaultPriceModel = "default"
+
+// محل مصرف درخواست
+const (
+	SurfacePrivate = "private"
+	SurfaceGroup   = "group"
+	SurfaceChannel = "channel"
+)
+
+// ModelPrice - قیمت مدل به دلار برای هر یک میلیون توکن
+type ModelPrice struct {
+	Model       string
+	InputPrice  float64
+	OutputPrice float64
+	UpdatedAt   time.Time
+}
+
+// Cost هزینه درخواست به دلار بر اساس توکن‌های ورودی و خروجی
+func (p *ModelPrice) Cost(promptTokens, completionTokens int) float64 {
+	return (float64(promptTokens)*p.InputPrice + float64(completionTokens)*p.OutputPrice) / 1000000
+}
+
+// UsageEvent - مصرف یک درخواست
+type UsageEvent struct {
+	UserID           int64
+	APIKeyID         int // صفر یعنی کلید مشخصی ثبت نمی‌شود
+	Provider         string
+	Model            string
+	Surface          string
+	PromptTokens     int
+	CompletionTokens int
+	Cost             float64
+	GroupID          int64 // گروه محل پرسش؛ صفر برای چت خصوصی و کانال
+	SponsorID        int64 // پرداخت‌کننده هزینه با کلید اسپانسر گروه؛ صفر یعنی خود کاربر
+}
+
+// ثبت مصرف یک درخواست و افزودن آن به جمع روزانه کاربر، جمع ماهانه کلید و شمارنده سهمیه
+//
+// مصرف با کلید اسپانسر علاوه بر کاربر پرسنده، در ستون‌های sponsored_* جمع روزانه اسپانسر هم ثبت می‌شود.
+//
+// روز مصرف در منطقه زمانی سهمیه محاسبه می‌شود تا با ریست سهمیه همخوان باشد.
+func RecordUsageEvent(db *sql.DB, e UsageEvent) error {
+	day := UsageDay(time.Now())
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO usage_events (user_id, api_key_id, provider, model, surface, prompt_tokens, completion_tokens, cost,
+			group_id, sponsor_id, created_at)
+		VALUES ($1, NULLIF($2, 0), $3, $4, $5, $6, $7, $8, NULLIF($9, 0), NULLIF($10, 0), NOW())
+	`, e.UserID, e.APIKeyID, e.Provider, e.Model, e.Surface, e.PromptTokens, e.CompletionTokens, e.Cost,
+		e.GroupID, e.SponsorID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO token_usage (user_id, date, tokens_used, prompt_tokens, completion_tokens, request_count, cost, created_at, updated_at)
+		VALUES ($1, $5, $2 + $3, $2, $3, 1, $4, NOW(), NOW())
+		ON CONFLICT (user_id, date) DO UPDATE SET
+			tokens_used = token_usage.tokens_used + EXCLUDED.tokens_used,
+			prompt_tokens = token_usage.prompt_tokens + EXCLUDED.prompt_tokens,
+			completion_tokens = token_usage.completion_tokens + EXCLUDED.completion_tokens,
+			request_count = token_usage.request_count + 1,
+			cost = token_usage.cost + EXCLUDED.cost,
+			updated_at = EXCLUDED.updated_at
+	`, e.UserID, e.PromptTokens, e.CompletionTokens, e.Cost, day)
+	if err != nil {
+		return err
+	}
+
+	if e.SponsorID != 0 && e.SponsorID != e.UserID {
+		_, err = tx.Exec(`
+			INSERT INTO token_usage (user_id, date, sponsored_tokens, sponsored_cost, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, NOW(), NOW())
+			ON CONFLICT (user_id, date) DO UPDATE SET
+				sponsored_tokens = token_usage.sponsored_tokens + EXCLUDED.sponsored_tokens,
+				sponsored_cost = token_usage.sponsored_cost + EXCLUDED.sponsored_cost,
+				updated_at = EXCLUDED.updated_at
+		`, e.SponsorID, day, e.PromptTokens+e.CompletionTokens, e.Cost)
+		if err != nil {
+			return err
+		}
+	}
+
+	if e.APIKeyID != 0 {
+		_, err = tx.Exec(`
+			INSERT INTO api_key_usage (api_key_id, month, tokens_used, cost, updated_at)
+			VALUES ($1, date_trunc('month', CURRENT_DATE)::DATE, $2, $3, NOW())
+			ON CONFLICT (api_key_id, month) DO UPDATE SET
+				tokens_used = api_key_usage.tokens_used + EXCLUDED.tokens_used,
+				cost = api_key_usage.cost + EXCLUDED.cost,
+				updated_at = EXCLUDED.updated_at
+		`, e.APIKeyID, e.PromptTokens+e.CompletionTokens, e.Cost)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if err := database.IncrementQuotaUsage(e.UserID, day, 1, e.PromptTokens+e.CompletionTokens); err != nil {
+		log.Printf("خطا در بروزرسانی شمارنده سهمیه کاربر %d: %v", e.UserID, err)
+	}
+	return nil
+}
+
+// DailyUsage - جمع مصرف یک روز
+type DailyUsage struct {
+	Requests         int
+	PromptTokens     int
+	CompletionTokens int
+	Cost             float64
+}
+
+// جمع مصرف همه کاربران در امروز
+func GetTodayUsage(db *sql.DB) (DailyUsage, error) {
+	var u DailyUsage
+	err := db.QueryRow(`
+		SELECT COALESCE(SUM(request_count), 0), COALESCE(SUM(prompt_tokens), 0),
+			COALESCE(SUM(completion_tokens), 0), COALESCE(SUM(cost), 0)
+		FROM token_usage
+		WHERE date = $1
+	`, UsageDay(time.Now())).Scan(&u.Requests, &u.PromptTokens, &u.CompletionTokens, &u.Cost)
+	return u, err
+}
+
+// لیست قیمت مدل‌ها (ردیف پیش‌فرض اول)
+func ListModelPrices(db *sql.DB) ([]ModelPrice, error) {
+	rows, err := db.Query(`
+		SELECT model, input_price, output_price, updated_at
+		FROM model_prices
+		ORDER BY model <> $1, model
+	`, DefaultPriceModel)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var prices []ModelPrice
+	for rows.Next() {
+		var p ModelPrice
+		if err := rows.Scan(&p.Model, &p.InputPrice, &p.OutputPrice, &p.UpdatedAt); err != nil {
+			return nil, err
+		}
+		prices = append(prices, p)
+	}
+	return prices, rows.Err()
+}
+
+// دریافت قیمت مدل
+//
+// نام‌های نسخه‌دار (مثل gpt-4o-2024-08-06) با طولانی‌ترین پیشوند منطبق قیمت‌گذاری می‌شوند
+// و در نبود آن قیمت پیش‌فرض برگردانده می‌شود؛ اگر پیش‌فرض هم نباشد nil برمی‌گردد.
+func GetModelPrice(db *sql.DB, model string) (*ModelPrice, error) {
+	var p ModelPrice
+	err := db.QueryRow(`
+		SELECT model, input_price, output_price, updated_at
+		FROM model_prices
+		WHERE model = $2 OR left($1, length(model)) = model
+		ORDER BY model = $2, length(model) DESC
+		LIMIT 1
+	`, model, DefaultPriceModel).Scan(&p.Model, &p.InputPrice, &p.OutputPrice, &p.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// ثبت یا بروزرسانی قیمت مدل
+func SetModelPrice(db *sql.DB, model string, inputPrice, outputPrice float64) error {
+	_, err := db.Exec(`
+		INSERT INTO model_prices (model, input_price, output_price, updated_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (model) DO UPDATE SET
+			input_price = EXCLUDED.input_price,
+			output_price = EXCLUDED.output_price,
+			updated_at = EXCLUDED.updated_at
+	`, model, inputPrice, outputPrice)
+	return err
+}
+
+// حذف قیمت مدل (قیمت پیش‌فرض قابل حذف نیست)
+func DeleteModelPrice(db *sql.DB, model string) error {
+	result, err := db.Exec(`DELETE FROM model_prices WHERE model = $1 AND model <> $2`, model, DefaultPriceModel)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
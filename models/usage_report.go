@@ -0,0 +1,142 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// UsageTotals - جمع مصرف یک بازه
+type UsageTotals struct {
+	Requests int
+	Tokens   int
+	Cost     float64
+}
+
+// UsagePeriods - مصرف کاربر در امروز، هفته جاری (از شنبه) و ماه جاری
+type UsagePeriods struct {
+	Today UsageTotals
+	Week  UsageTotals
+	Month UsageTotals
+}
+
+// UsageBreakdown - مصرف ماه جاری به تفکیک مدل یا محل استفاده
+type UsageBreakdown struct {
+	Name     string
+	Requests int
+	Tokens   int
+	Cost     float64
+}
+
+// DailyUsagePoint - مصرف یک روز کاربر
+type DailyUsagePoint struct {
+	Date             time.Time
+	PromptTokens     int
+	CompletionTokens int
+	Cost             float64
+}
+
+// جمع مصرف کاربر در امروز، هفته و ماه جاری (روزها در منطقه زمانی سهمیه)
+func GetUserUsagePeriods(db *sql.DB, userID int64) (UsagePeriods, error) {
+	var p UsagePeriods
+	// هفته از شنبه شروع می‌شود: فاصله تا شنبه = (DOW + 1) % 7
+	err := db.QueryRow(`
+		WITH bounds AS (
+			SELECT $2::DATE AS today,
+				$2::DATE - ((EXTRACT(DOW FROM $2::DATE)::INT + 1) % 7) AS week_start,
+				date_trunc('month', $2::DATE)::DATE AS month_start
+		)
+		SELECT
+			COALESCE(SUM(u.request_count) FILTER (WHERE u.date = b.today), 0),
+			COALESCE(SUM(u.tokens_used) FILTER (WHERE u.date = b.today), 0),
+			COALESCE(SUM(u.cost) FILTER (WHERE u.date = b.today), 0),
+			COALESCE(SUM(u.request_count) FILTER (WHERE u.date >= b.week_start), 0),
+			COALESCE(SUM(u.tokens_used) FILTER (WHERE u.date >= b.week_start), 0),
+			COALESCE(SUM(u.cost) FILTER (WHERE u.date >= b.week_start), 0),
+			COALESCE(SUM(u.request_count) FILTER (WHERE u.date >= b.month_start), 0),
+			COALESCE(SUM(u.tokens_used) FILTER (WHERE u.date >= b.month_start), 0),
+			COALESCE(SUM(u.cost) FILTER (WHERE u.date >= b.month_start), 0)
+		FROM bounds b
+		LEFT JOIN token_usage u ON u.user_id = $1
+			AND u.date >= LEAST(b.week_start, b.month_start) AND u.date <= b.today
+	`, userID, UsageDay(time.Now())).Scan(
+		&p.Today.Requests, &p.Today.Tokens, &p.Today.Cost,
+		&p.Week.Requests, &p.Week.Tokens, &p.Week.Cost,
+		&p.Month.Requests, &p.Month.Tokens, &p.Month.Cost,
+	)
+	return p, err
+}
+
+// مصرف ماه جاری کاربر به تفکیک مدل (پرهزینه‌ترین اول)
+func GetUserUsageByModel(db *sql.DB, userID int64) ([]UsageBreakdown, error) {
+	return queryUsageBreakdown(db, `
+		SELECT model, COUNT(*), COALESCE(SUM(prompt_tokens + completion_tokens), 0), COALESCE(SUM(cost), 0)
+		FROM usage_events
+		WHERE user_id = $1 AND created_at >= $2
+		GROUP BY model
+		ORDER BY SUM(cost) DESC, COUNT(*) DESC
+	`, userID, monthStart(time.Now()))
+}
+
+// مصرف ماه جاری کاربر به تفکیک محل استفاده (خصوصی، گروه، کانال)
+func GetUserUsageBySurface(db *sql.DB, userID int64) ([]UsageBreakdown, error) {
+	return queryUsageBreakdown(db, `
+		SELECT surface, COUNT(*), COALESCE(SUM(prompt_tokens + completion_tokens), 0), COALESCE(SUM(cost), 0)
+		FROM usage_events
+		WHERE user_id = $1 AND created_at >= $2
+		GROUP BY surface
+		ORDER BY SUM(cost) DESC, COUNT(*) DESC
+	`, userID, monthStart(time.Now()))
+}
+
+// monthStart شروع ماه جاری در منطقه زمانی سهمیه
+func monthStart(now time.Time) time.Time {
+	d := dayStart(now)
+	return d.AddDate(0, 0, 1-d.Day())
+}
+
+func queryUsageBreakdown(db *sql.DB, query string, args ...interface{}) ([]UsageBreakdown, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []UsageBreakdown
+	for rows.Next() {
+		var b UsageBreakdown
+		if err := rows.Scan(&b.Name, &b.Requests, &b.Tokens, &b.Cost); err != nil {
+			return nil, err
+		}
+		items = append(items, b)
+	}
+	return items, rows.Err()
+}
+
+// مصرف روزانه کاربر در days روز اخیر (روزهای بدون مصرف صفر برگردانده می‌شوند)
+//
+// ردیف‌های قدیمی‌تر از تفکیک توکن ورودی/خروجی، کل توکن را به عنوان ورودی نشان می‌دهند.
+func GetUserDailyUsage(db *sql.DB, userID int64, days int) ([]DailyUsagePoint, error) {
+	rows, err := db.Query(`
+		SELECT d::DATE,
+			COALESCE(u.tokens_used - u.completion_tokens, 0),
+			COALESCE(u.completion_tokens, 0),
+			COALESCE(u.cost, 0)
+		FROM generate_series($3::DATE - ($2::INT - 1), $3::DATE, INTERVAL '1 day') AS d
+		LEFT JOIN token_usage u ON u.user_id = $1 AND u.date = d::DATE
+		ORDER BY d
+	`, userID, days, UsageDay(time.Now()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var points []DailyUsagePoint
+	for rows.Next() {
+		var p DailyUsagePoint
+		if err := rows.Scan(&p.Date, &p.PromptTokens, &p.CompletionTokens, &p.Cost); err != nil {
+			return nil, err
+		}
+		points = append(points, p)
+	}
+	return points, rows.Err()
+}
@@ -14,6 +14,7 @@ type User struct {
 	Phone       string       `json:"phone"`
 	IsVIP       bool         `json:"is_vip"`
 	VIPUntil    sql.NullTime `json:"vip_until"`
+	VIPPlan     string       `json:"vip_plan"` // پلن خریداری‌شده؛ خالی برای VIP بدون پلن
 	InviteCount int          `json:"invite_count"`
 	CreatedAt   time.Time    `json:"created_at"`
 	UpdatedAt   time.Time    `json:"updated_at"`
@@ -38,7 +39,7 @@ func CreateUser(db *sql.DB, telegramID int64, username, firstName, lastName stri
 func GetUserByTelegramID(db *sql.DB, telegramID int64) (*User, error) {
 	query := `
 		SELECT id, telegram_id, username, first_name, last_name, phone, 
-		       is_vip, vip_until, invite_count, created_at, updated_at
+		       is_vip, vip_until, COALESCE(vip_plan, ''), invite_count, created_at, updated_at
 		FROM users 
 		WHERE telegram_id = $1
 	`
@@ -48,7 +49,7 @@ func GetUserByTelegramID(db *sql.DB, telegramID int64) (*User, error) {
 	
 	err := db.QueryRow(query, telegramID).Scan(
 		&user.ID, &user.TelegramID, &user.Username, &user.FirstName, &user.LastName,
-		&user.Phone, &user.IsVIP, &vipUntil, &user.InviteCount, &user.CreatedAt, &user.UpdatedAt,
+		&user.Phone, &user.IsVIP, &vipUntil, &user.VIPPlan, &user.InviteCount, &user.CreatedAt, &user.UpdatedAt,
 	)
 	
 	if err != nil {
@@ -62,6 +63,16 @@ func GetUserByTelegramID(db *sql.DB, telegramID int64) (*User, error) {
 	return user, nil
 }
 
+// دریافت آیدی تلگرام بر اساس نام کاربری (بدون @)؛ در صورت عدم وجود صفر برمی‌گرداند
+func GetUserIDByUsername(db *sql.DB, username string) (int64, error) {
+	var telegramID int64
+	err := db.QueryRow(`SELECT telegram_id FROM users WHERE LOWER(username) = LOWER($1)`, username).Scan(&telegramID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return telegramID, err
+}
+
 // آپدیت شماره تلفن کاربر
 func UpdateUserPhone(db *sql.DB, telegramID int64, phone string) error {
 	query := `UPDATE users SET phone = $1, updated_at = $2 WHERE telegram_id = $3`
@@ -69,24 +80,55 @@ func UpdateUserPhone(db *sql.DB, telegramID int64, phone string) error {
 	return err
 }
 
-// فعال‌سازی VIP برای کاربر
-func ActivateVIP(db *sql.DB, telegramID int64, durationDays int) error {
-	vipUntil := time.Now().AddDate(0, 0, durationDays)
-	
-	query := `
-		UPDATE users 
-		SET is_vip = true, vip_until = $1, updated_at = $2 
+// فعال‌سازی یا تمدید VIP کاربر در تراکنش tx به مدت days روز با پلن plan (خالی برای اعطای دستی)
+//
+// روزهای باقیمانده اشتراک فعلی حفظ می‌شود و مدت جدید به آن اضافه می‌شود؛
+// اگر کاربر وجود نداشته باشد sql.ErrNoRows برگردانده می‌شود.
+func ActivateVIP(tx *sql.Tx, telegramID int64, plan string, days int) error {
+	res, err := tx.Exec(`
+		UPDATE users
+		SET is_vip = TRUE,
+			vip_until = GREATEST(COALESCE(vip_until, NOW()), NOW()) + make_interval(days => $1),
+			vip_plan = NULLIF($2, ''), updated_at = NOW()
 		WHERE telegram_id = $3
-	`
-	_, err := db.Exec(query, vipUntil, time.Now(), telegramID)
-	return err
+	`, days, plan, telegramID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// اعطای دستی VIP توسط ادمین به مدت days روز
+func GrantVIP(db *sql.DB, telegramID int64, days int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := ActivateVIP(tx, telegramID, "", days); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// HasActiveVIP بررسی فعال بودن اشتراک VIP (حتی پیش از اجرای بررسی دوره‌ای انقضا)
+func (u *User) HasActiveVIP() bool {
+	return u != nil && u.IsVIP && (!u.VIPUntil.Valid || u.VIPUntil.Time.After(time.Now()))
 }
 
 // غیرفعال کردن VIP
 func DeactivateVIP(db *sql.DB, telegramID int64) error {
 	query := `
 		UPDATE users 
-		SET is_vip = false, vip_until = NULL, updated_at = $1 
+		SET is_vip = false, vip_until = NULL, vip_plan = NULL, updated_at = $1 
 		WHERE telegram_id = $2
 	`
 	_, err := db.Exec(query, time.Now(), telegramID)
@@ -108,7 +150,7 @@ func IncrementInviteCount(db *sql.DB, telegramID int64) error {
 func CheckVIPExpiration(db *sql.DB) error {
 	query := `
 		UPDATE users 
-		SET is_vip = false, vip_until = NULL, updated_at = $1 
+		SET is_vip = false, vip_until = NULL, vip_plan = NULL, updated_at = $1 
 		WHERE is_vip = true AND vip_until < $2
 	`
 	_, err := db.Exec(query, time.Now(), time.Now())
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+
+	"telegram-bot-manager/database"
+	"telegram-bot-manager/models"
+	"telegram-bot-manager/utils"
+)
+
+// runRotateMasterKeyCommand رمزنگاری دوباره همه کلیدهای API با کلید اصلی فعلی
+//
+// پیش از اجرا کلید قبلی با نسخه‌اش در encryption.old_keys و کلید جدید با نسخه بالاتر
+// در encryption.master_key قرار می‌گیرد؛ پس از اجرا کلید قبلی را می‌توان از تنظیمات حذف کرد.
+func runRotateMasterKeyCommand(cfg *Config) error {
+	keys, err := cfg.MasterKeys()
+	if err != nil {
+		return err
+	}
+	if err := utils.ConfigureMasterKeys(cfg.Encryption.KeyVersion, keys); err != nil {
+		return err
+	}
+
+	if err := database.ConnectPostgreSQL(cfg.DatabaseURL); err != nil {
+		return err
+	}
+	defer database.DB.Close()
+
+	res, err := models.RotateAPIKeyEncryption(database.DB)
+	if err != nil {
+		return err
+	}
+
+	if res.Rewrapped == 0 && len(res.Failed) == 0 {
+		fmt.Printf("✅ همه کلیدها با نسخه %d رمز شده‌اند.\n", cfg.Encryption.KeyVersion)
+		return nil
+	}
+	fmt.Printf("🔐 %d کلید با کلید اصلی نسخه %d دوباره رمز شد.\n", res.Rewrapped, cfg.Encryption.KeyVersion)
+	if len(res.Failed) > 0 {
+		return fmt.Errorf("%d کلید دوباره رمز نشد (آیدی: %v)؛ کلید اصلی نسخه آن‌ها را در encryption.old_keys قرار دهید", len(res.Failed), res.Failed)
+	}
+	return nil
+}
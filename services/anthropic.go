@@ -0,0 +1,294 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	anthropicBaseURL      = "https://api.anthropic.com/v1"
+	anthropicVersion      = "2023-06-01"
+	anthropicDefaultModel = "claude-3-haiku-20240307"
+	// Anthropic فیلد max_tokens را اجباری می‌داند
+	anthropicDefaultMaxTokens = 1024
+)
+
+// anthropicProvider - API پیام‌های Anthropic
+type anthropicProvider struct {
+	baseURL string
+	apiKey  string
+}
+
+// anthropicRequest بدنه درخواست /messages
+type anthropicRequest struct {
+	Model     string    `json:"model"`
+	System    string    `json:"system,omitempty"`
+	Messages  []Message `json:"messages"`
+	MaxTokens int       `json:"max_tokens"`
+	Stream    bool      `json:"stream,omitempty"`
+}
+
+// anthropicResponse ساختار پاسخ /messages
+type anthropicResponse struct {
+	Model   string `json:"model"`
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+	StopReason string `json:"stop_reason"`
+	Usage      struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+}
+
+// anthropicStreamEvent رویدادهای پاسخ تدریجی /messages
+type anthropicStreamEvent struct {
+	Type    string `json:"type"`
+	Message struct {
+		Model string `json:"model"`
+		Usage struct {
+			InputTokens int `json:"input_tokens"`
+		} `json:"usage"`
+	} `json:"message"`
+	Delta struct {
+		Type       string `json:"type"`
+		Text       string `json:"text"`
+		StopReason string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage struct {
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// anthropicErrorResponse ساختار خطای API
+type anthropicErrorResponse struct {
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (p *anthropicProvider) Name() string {
+	return "Anthropic"
+}
+
+// Chat ارسال درخواست به /messages
+func (p *anthropicProvider) Chat(ctx context.Context, req ChatRequest) (ChatResult, error) {
+	res, err := p.post(ctx, req, false)
+	if err != nil {
+		return ChatResult{}, err
+	}
+	defer res.Body.Close()
+
+	respBody, _ := io.ReadAll(res.Body)
+	if res.StatusCode >= 400 {
+		return ChatResult{}, p.parseError(res.StatusCode, respBody)
+	}
+
+	var parsed anthropicResponse
+	if err := json.Unmarshal(respBody, &parsed); err != nil {
+		return ChatResult{}, fmt.Errorf("خطا در پردازش پاسخ: %v", err)
+	}
+
+	var content strings.Builder
+	for _, block := range parsed.Content {
+		if block.Type == "text" {
+			content.WriteString(block.Text)
+		}
+	}
+	if content.Len() == 0 {
+		return ChatResult{}, fmt.Errorf("پاسخی از Anthropic دریافت نشد")
+	}
+
+	return ChatResult{
+		Content: content.String(),
+		Model:   parsed.Model,
+		Usage: Usage{
+			PromptTokens:     parsed.Usage.InputTokens,
+			CompletionTokens: parsed.Usage.OutputTokens,
+			TotalTokens:      parsed.Usage.InputTokens + parsed.Usage.OutputTokens,
+		},
+		FinishReason: anthropicFinishReason(parsed.StopReason),
+	}, nil
+}
+
+// ChatStream ارسال درخواست با stream=true و خواندن رویدادهای SSE
+func (p *anthropicProvider) ChatStream(ctx context.Context, req ChatRequest, onDelta func(string)) (ChatResult, error) {
+	res, err := p.post(ctx, req, true)
+	if err != nil {
+		return ChatResult{}, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 400 {
+		respBody, _ := io.ReadAll(res.Body)
+		return ChatResult{}, p.parseError(res.StatusCode, respBody)
+	}
+
+	var result ChatResult
+	var content strings.Builder
+	err = readSSE(res.Body, func(_, data string) (bool, error) {
+		var event anthropicStreamEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return false, fmt.Errorf("خطا در پردازش پاسخ: %v", err)
+		}
+
+		switch event.Type {
+		case "message_start":
+			result.Model = event.Message.Model
+			result.Usage.PromptTokens = event.Message.Usage.InputTokens
+		case "content_block_delta":
+			if event.Delta.Type == "text_delta" && event.Delta.Text != "" {
+				content.WriteString(event.Delta.Text)
+				onDelta(event.Delta.Text)
+			}
+		case "message_delta":
+			result.FinishReason = anthropicFinishReason(event.Delta.StopReason)
+			result.Usage.CompletionTokens = event.Usage.OutputTokens
+		case "message_stop":
+			return false, nil
+		case "error":
+			body, _ := json.Marshal(anthropicErrorResponse{Error: event.Error})
+			return false, p.parseError(res.StatusCode, body)
+		}
+		return true, nil
+	})
+	if err != nil {
+		return ChatResult{}, err
+	}
+
+	if content.Len() == 0 {
+		return ChatResult{}, fmt.Errorf("پاسخی از Anthropic دریافت نشد")
+	}
+	result.Content = content.String()
+	result.Usage.TotalTokens = result.Usage.PromptTokens + result.Usage.CompletionTokens
+	return result, nil
+}
+
+// ListModels دریافت لیست مدل‌ها از /models
+func (p *anthropicProvider) ListModels(ctx context.Context) (KeyInfo, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", p.baseURL+"/models", nil)
+	if err != nil {
+		return KeyInfo{}, err
+	}
+	httpReq.Header.Set("x-api-key", p.apiKey)
+	httpReq.Header.Set("anthropic-version", anthropicVersion)
+
+	res, err := httpClient.Do(httpReq)
+	if err != nil {
+		return KeyInfo{}, fmt.Errorf("خطا در ارسال درخواست: %v", err)
+	}
+	defer res.Body.Close()
+
+	respBody, _ := io.ReadAll(res.Body)
+	if res.StatusCode >= 400 {
+		return KeyInfo{}, p.parseError(res.StatusCode, respBody)
+	}
+
+	var parsed struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(respBody, &parsed); err != nil {
+		return KeyInfo{}, fmt.Errorf("خطا در پردازش پاسخ: %v", err)
+	}
+
+	info := KeyInfo{Organization: res.Header.Get("anthropic-organization-id")}
+	for _, m := range parsed.Data {
+		info.Models = append(info.Models, m.ID)
+	}
+	return info, nil
+}
+
+// post ارسال درخواست به /messages
+func (p *anthropicProvider) post(ctx context.Context, req ChatRequest, stream bool) (*http.Response, error) {
+	// پیام‌های system در Anthropic به صورت فیلد جداگانه ارسال می‌شوند
+	var system []string
+	var messages []Message
+	for _, m := range req.Messages {
+		if m.Role == RoleSystem {
+			system = append(system, m.Content)
+			continue
+		}
+		messages = append(messages, m)
+	}
+
+	maxTokens := req.MaxTokens
+	if maxTokens == 0 {
+		maxTokens = anthropicDefaultMaxTokens
+	}
+
+	body, _ := json.Marshal(anthropicRequest{
+		Model:     req.Model,
+		System:    strings.Join(system, "\n\n"),
+		Messages:  messages,
+		MaxTokens: maxTokens,
+		Stream:    stream,
+	})
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/messages", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("x-api-key", p.apiKey)
+	httpReq.Header.Set("anthropic-version", anthropicVersion)
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	client := httpClient
+	if stream {
+		client = streamClient
+	}
+	res, err := client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("خطا در ارسال درخواست: %v", err)
+	}
+	return res, nil
+}
+
+// anthropicFinishReason تبدیل stop_reason به معادل OpenAI
+func anthropicFinishReason(reason string) string {
+	switch reason {
+	case "end_turn", "stop_sequence":
+		return "stop"
+	case "max_tokens":
+		return "length"
+	}
+	return reason
+}
+
+// parseError تبدیل پاسخ خطا به APIError با کدهای هم‌ارز OpenAI
+func (p *anthropicProvider) parseError(status int, body []byte) error {
+	apiErr := &APIError{Provider: "Anthropic", StatusCode: status}
+
+	var parsed anthropicErrorResponse
+	if err := json.Unmarshal(body, &parsed); err == nil && parsed.Error.Message != "" {
+		apiErr.Code = parsed.Error.Type
+		apiErr.Message = parsed.Error.Message
+	} else {
+		apiErr.Message = string(body)
+	}
+
+	// یکسان‌سازی کدها تا فراخوان‌ها فقط با یک مجموعه کد کار کنند
+	switch apiErr.Code {
+	case "authentication_error":
+		apiErr.Code = "invalid_api_key"
+	case "rate_limit_error":
+		apiErr.Code = "rate_limit_exceeded"
+	}
+	if status == http.StatusPaymentRequired || strings.Contains(apiErr.Message, "credit balance") {
+		apiErr.Code = "insufficient_quota"
+	}
+
+	return apiErr
+}
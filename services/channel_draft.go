@@ -0,0 +1,110 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+
+	"gopkg.in/telebot.v3"
+
+	"telegram-bot-manager/models"
+)
+
+// خطاهای تولید محتوای کانال
+var (
+	ErrNoChannelKeys        = errors.New("API Key تنظیم نشده است")
+	ErrChannelQuotaExceeded = errors.New("سقف مصرف روزانه شما تمام شده است")
+)
+
+// حداکثر طول متن پیش‌نویس در پیام بررسی (سقف پیام تلگرام ۴۰۹۶ کاراکتر است)
+const draftPreviewMax = 3500
+
+// GenerateChannelPost تولید یک پست کانال با کلیدها و سهمیه مالک و ثبت مصرف آن
+func GenerateChannelPost(db *sql.DB, ownerID int64, prompt string) (string, error) {
+	keys, err := SelectKeys(db, ownerID)
+	if err != nil || len(keys) == 0 {
+		return "", ErrNoChannelKeys
+	}
+
+	// سهمیه روزانه مالک برای هر پست بررسی می‌شود
+	if status, err := models.CheckUsageLimit(db, ownerID); err != nil {
+		log.Printf("خطا در بررسی سهمیه کاربر %d: %v", ownerID, err)
+	} else if status.Exceeded() {
+		return "", ErrChannelQuotaExceeded
+	}
+
+	result, key, err := generateChannelContent(db, keys, prompt)
+	if err != nil {
+		return "", err
+	}
+
+	// مصرف توکن حتی اگر انتشار متوقف شود ثبت می‌شود
+	RecordUsage(db, ownerID, key, models.SurfaceChannel, result)
+	return result.Content, nil
+}
+
+// generateChannelContent - تولید محتوا برای کانال
+func generateChannelContent(db *sql.DB, keys []*models.APIKey, prompt string) (ChatResult, *models.APIKey, error) {
+	systemPrompt := fmt.Sprintf(
+		"تو یک تولیدکننده محتوای حرفه‌ای برای کانال‌های تلگرام هستی.\n"+
+			"محتوایی تولید کن که:\n"+
+			"- جذاب و مفید باشد\n"+
+			"- حدود ۲۰۰-۳۰۰ کلمه باشد\n"+
+			"- برای انتشار در کانال مناسب باشد\n"+
+			"- دارای ساختار منظم\n"+
+			"- حاوی نکات کاربردی\n\n"+
+			"دستورالعمل خاص: %s",
+		prompt,
+	)
+
+	userMessage := "لطفاً یک پست جذاب برای کانال تلگرام تولید کن."
+
+	req := ChatRequest{Messages: PromptMessages(systemPrompt, userMessage)}
+	return ChatWithFailover(context.Background(), db, keys, req, nil)
+}
+
+// برچسب وضعیت‌های پیش‌نویس
+var draftStatusLabels = map[string]string{
+	models.DraftPending:   "⏳ در انتظار بررسی",
+	models.DraftApproved:  "✅ تأیید شد؛ در نوبت بعدی منتشر می‌شود",
+	models.DraftPublished: "📤 منتشر شد",
+	models.DraftDiscarded: "🗑 حذف شد",
+}
+
+// DraftReviewMessage متن و دکمه‌های پیام بررسی یک پیش‌نویس
+func DraftReviewMessage(d *models.ChannelDraft) (string, *telebot.ReplyMarkup) {
+	content := []rune(d.Content)
+	preview := d.Content
+	if len(content) > draftPreviewMax {
+		preview = string(content[:draftPreviewMax]) + "…"
+	}
+
+	text := fmt.Sprintf("📝 پیش‌نویس #%d — %s\nوضعیت: %s\n\n%s",
+		d.ID, d.ChannelTitle, draftStatusLabels[d.Status], preview)
+
+	menu := &telebot.ReplyMarkup{}
+	id := fmt.Sprintf("%d", d.ID)
+	switch d.Status {
+	case models.DraftPending:
+		menu.Inline(
+			menu.Row(
+				menu.Data("✅ تأیید", "draft_approve", id),
+				menu.Data("🔄 تولید دوباره", "draft_regen", id),
+			),
+			menu.Row(
+				menu.Data("✏️ ویرایش", "draft_edit", id),
+				menu.Data("🗑 حذف", "draft_discard", id),
+			),
+		)
+	case models.DraftApproved:
+		menu.Inline(
+			menu.Row(
+				menu.Data("✏️ ویرایش", "draft_edit", id),
+				menu.Data("🗑 حذف", "draft_discard", id),
+			),
+		)
+	}
+	return text, menu
+}
@@ -0,0 +1,86 @@
+package services
+
+import "unicode/utf8"
+
+// Turn - پیام تاریخچه گفتگو همراه با تعداد توکن آن
+type Turn struct {
+	Message
+	Tokens int // صفر یعنی نامشخص (تخمین زده می‌شود)
+}
+
+// سربار تقریبی هر پیام (نقش و جداکننده‌ها)
+const messageTokenOverhead = 4
+
+// EstimateTokens تخمین تعداد توکن متن
+//
+// حروف لاتین حدود ۴ کاراکتر در هر توکن و حروف فارسی حدود ۱.۵ کاراکتر در هر توکن مصرف می‌کنند.
+func EstimateTokens(text string) int {
+	ascii, other := 0, 0
+	for _, r := range text {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return ascii/4 + other*2/3 + messageTokenOverhead
+}
+
+// turnTokens تعداد توکن ثبت‌شده یا تخمینی یک پیام
+func turnTokens(t Turn) int {
+	if t.Tokens > 0 {
+		return t.Tokens + messageTokenOverhead
+	}
+	return EstimateTokens(t.Content)
+}
+
+// PromptMessages پیام‌های یک پرسش تک‌مرحله‌ای با پرامپت سیستمی
+func PromptMessages(systemPrompt, question string) []Message {
+	var messages []Message
+	if systemPrompt != "" {
+		messages = append(messages, Message{Role: RoleSystem, Content: systemPrompt})
+	}
+	return append(messages, Message{Role: RoleUser, Content: question})
+}
+
+// ReplyMessages پیام‌های پرسشی که در ادامه یکی از پاسخ‌های قبلی ربات مطرح شده است
+//
+// پاسخ قبلی داخل پیام کاربر قرار می‌گیرد، چون تاریخچه باید با پیام کاربر شروع شود.
+func ReplyMessages(systemPrompt, previousAnswer, question string) []Message {
+	return PromptMessages(systemPrompt, "پاسخ قبلی تو:\n«"+previousAnswer+"»\n\nپرسش در ادامه آن:\n"+question)
+}
+
+// BuildContext ساخت پیام‌های درخواست از پرامپت سیستمی، تاریخچه و پرسش جدید
+//
+// قدیمی‌ترین پیام‌های تاریخچه حذف می‌شوند تا مجموع توکن‌ها از سقف context بیشتر نشود.
+// پرامپت سیستمی و پرسش جدید همیشه ارسال می‌شوند.
+func BuildContext(systemPrompt string, history []Turn, question string) []Message {
+	budget := settings.ContextTokens - EstimateTokens(question)
+	if systemPrompt != "" {
+		budget -= EstimateTokens(systemPrompt)
+	}
+
+	start := len(history)
+	for start > 0 {
+		tokens := turnTokens(history[start-1])
+		if tokens > budget {
+			break
+		}
+		budget -= tokens
+		start--
+	}
+
+	// تاریخچه باید با پیام کاربر شروع شود (الزام Anthropic)
+	for start < len(history) && history[start].Role != RoleUser {
+		start++
+	}
+
+	var messages []Message
+	if systemPrompt != "" {
+		messages = append(messages, Message{Role: RoleSystem, Content: systemPrompt})
+	}
+	for _, t := range history[start:] {
+		messages = append(messages, t.Message)
+	}
+	return append(messages, Message{Role: RoleUser, Content: question})
+}
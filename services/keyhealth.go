@@ -0,0 +1,104 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"gopkg.in/telebot.v3"
+
+	"telegram-bot-manager/models"
+	"telegram-bot-manager/utils"
+)
+
+const (
+	// فاصله بین دو بررسی هر کلید
+	keyCheckInterval = 12 * time.Hour
+	// فاصله اجرای دوره بررسی
+	keyCheckTick = 10 * time.Minute
+	// حداکثر کلید بررسی‌شده در هر دوره (برای پخش بار روی Providerها)
+	keyCheckBatch = 50
+)
+
+// KeyHealthChecker - بررسی دوره‌ای اعتبار کلیدهای API ذخیره‌شده
+type KeyHealthChecker struct {
+	bot *telebot.Bot
+	db  *sql.DB
+}
+
+// NewKeyHealthChecker - ایجاد نمونه جدید بررسی‌کننده کلیدها
+func NewKeyHealthChecker(bot *telebot.Bot, db *sql.DB) *KeyHealthChecker {
+	return &KeyHealthChecker{
+		bot: bot,
+		db:  db,
+	}
+}
+
+// Start - شروع بررسی دوره‌ای
+func (h *KeyHealthChecker) Start() {
+	log.Println("🩺 بررسی دوره‌ای کلیدهای API شروع به کار کرد...")
+
+	h.checkDueKeys()
+
+	ticker := time.NewTicker(keyCheckTick)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		h.checkDueKeys()
+	}
+}
+
+// checkDueKeys - بررسی کلیدهایی که زمان بررسی آن‌ها رسیده است
+func (h *KeyHealthChecker) checkDueKeys() {
+	keys, err := models.ListAPIKeysDueForCheck(h.db, keyCheckInterval, keyCheckBatch)
+	if err != nil {
+		log.Printf("❌ خطا در دریافت کلیدهای API برای بررسی: %v", err)
+		return
+	}
+
+	for i := range keys {
+		h.checkKey(&keys[i])
+	}
+}
+
+// checkKey - اعتبارسنجی یک کلید و ثبت نتیجه
+func (h *KeyHealthChecker) checkKey(key *models.APIKey) {
+	info, err := ValidateKey(context.Background(), key)
+	// سرور محلی اعتبار حسابی ندارد
+	if err == nil && key.Provider != models.ProviderLocal {
+		err = ProbeKeyQuota(context.Background(), key)
+	}
+	check := KeyCheckResult(info, err, key.Status)
+
+	if err := models.RecordAPIKeyCheck(h.db, key.ID, check); err != nil {
+		log.Printf("❌ خطا در ثبت نتیجه بررسی کلید %d: %v", key.ID, err)
+		return
+	}
+
+	if check.Status == models.KeyStatusInvalid || check.Status == models.KeyStatusQuotaExceeded {
+		log.Printf("⚠️ کلید %d کاربر %d غیرفعال شد: %s", key.ID, key.UserID, check.Status)
+		h.notifyOwner(key, check.Status)
+	}
+}
+
+// notifyOwner - اطلاع‌رسانی غیرفعال شدن کلید به صاحب آن
+func (h *KeyHealthChecker) notifyOwner(key *models.APIKey, status string) {
+	if h.bot == nil {
+		return
+	}
+
+	reason := "کلید توسط سرویس‌دهنده نامعتبر اعلام شد"
+	if status == models.KeyStatusQuotaExceeded {
+		reason = "اعتبار حساب این کلید به پایان رسیده است"
+	}
+
+	msg := fmt.Sprintf(
+		"⚠️ کلید API شما غیرفعال شد\n\n🔑 %s\n❌ %s\n\nبرای ادامه استفاده، کلید جدیدی با /addapi ثبت کنید.",
+		utils.MaskAPIKey(key.APIKey), reason,
+	)
+	if _, err := h.bot.Send(&telebot.User{ID: key.UserID}, msg); err != nil {
+		log.Printf("خطا در اطلاع‌رسانی به کاربر %d: %v", key.UserID, err)
+	}
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"telegram-bot-manager/database"
+	"telegram-bot-manager/models"
+)
+
+// ErrNoUsableKey کاربر کلید فعال زیر سقف بودجه ندارد
+var ErrNoUsableKey = errors.New("کلید API قابل استفاده‌ای وجود ندارد")
+
+// SelectKeys کلیدهای قابل استفاده کاربر به ترتیب امتحان
+//
+// در روش priority ترتیب همان اولویت کلیدهاست؛ در روش round_robin ترتیب در هر درخواست
+// یک کلید می‌چرخد تا بار بین کلیدها پخش شود. بقیه کلیدها برای جایگزینی در صورت خطا می‌آیند.
+func SelectKeys(db *sql.DB, userID int64) ([]*models.APIKey, error) {
+	usable, err := models.UsableAPIKeys(db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]*models.APIKey, len(usable))
+	for i := range usable {
+		keys[i] = &usable[i]
+	}
+	if len(keys) < 2 {
+		return keys, nil
+	}
+
+	strategy, err := models.GetKeyStrategy(db, userID)
+	if err != nil {
+		log.Printf("خطا در دریافت روش انتخاب کلید کاربر %d: %v", userID, err)
+		return keys, nil
+	}
+	if strategy != models.KeyStrategyRoundRobin {
+		return keys, nil
+	}
+
+	turn, err := database.NextKeyTurn(userID)
+	if err != nil {
+		log.Printf("خطا در دریافت نوبت کلید کاربر %d: %v", userID, err)
+		return keys, nil
+	}
+	start := int(turn % int64(len(keys)))
+	return append(keys[start:], keys[:start]...), nil
+}
+
+// ChatWithFailover ارسال درخواست با کلیدها به ترتیب؛ در صورت محدودیت نرخ یا تمام شدن اعتبار، کلید بعدی امتحان می‌شود
+//
+// جایگزینی فقط تا پیش از دریافت اولین بخش پاسخ انجام می‌شود و خطاهای دیگر (درخواست نامعتبر،
+// خطای شبکه و ...) بی‌درنگ برگردانده می‌شوند. کلیدهای نامعتبر یا بدون اعتبار در همین مسیر
+// غیرفعال می‌شوند. کلید استفاده‌شده همراه نتیجه برگردانده می‌شود.
+func ChatWithFailover(ctx context.Context, db *sql.DB, keys []*models.APIKey, req ChatRequest, onText StreamHandler) (ChatResult, *models.APIKey, error) {
+	if len(keys) == 0 {
+		return ChatResult{}, nil, ErrNoUsableKey
+	}
+
+	var lastErr error
+	for i, key := range keys {
+		emitted := false
+		handler := onText
+		if onText != nil {
+			handler = func(text string) {
+				emitted = true
+				onText(text)
+			}
+		}
+
+		result, err := ChatStream(ctx, key, req, handler)
+		if err == nil {
+			return result, key, nil
+		}
+		lastErr = err
+
+		flagKey(db, key, err)
+
+		if emitted || ctx.Err() != nil || !isFailoverError(err) || i == len(keys)-1 {
+			break
+		}
+		log.Printf("⚠️ کلید %d کاربر %d خطا داد، کلید بعدی امتحان می‌شود: %v", key.ID, key.UserID, err)
+	}
+
+	return ChatResult{}, nil, lastErr
+}
+
+// isFailoverError خطاهایی که به خود کلید مربوط‌اند و با کلید دیگری ممکن است برطرف شوند
+func isFailoverError(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	return apiErr.Code == "rate_limit_exceeded" || apiErr.Code == "insufficient_quota" ||
+		apiErr.StatusCode == http.StatusTooManyRequests
+}
+
+// flagKey غیرفعال کردن کلیدی که نامعتبر یا بدون اعتبار اعلام شده است
+func flagKey(db *sql.DB, key *models.APIKey, err error) {
+	check := KeyCheckResult(KeyInfo{}, err, key.Status)
+	if check.Status != models.KeyStatusInvalid && check.Status != models.KeyStatusQuotaExceeded {
+		return
+	}
+	if err := models.RecordAPIKeyCheck(db, key.ID, check); err != nil {
+		log.Printf("خطا در ثبت وضعیت کلید %d: %v", key.ID, err)
+	}
+}
+
+// RecordUsage ثبت مصرف واقعی درخواست (بر اساس usage گزارش‌شده Provider) برای کاربر و کلید استفاده‌شده
+//
+// surface محل استفاده است (models.SurfacePrivate، SurfaceGroup یا SurfaceChannel).
+func RecordUsage(db *sql.DB, userID int64, key *models.APIKey, surface string, result ChatResult) {
+	recordUsageEvent(db, models.UsageEvent{UserID: userID, Surface: surface}, key, result)
+}
+
+// RecordGroupUsage ثبت مصرف پرسش در گروه؛ با sponsored هزینه به نام مالک کلید اسپانسر هم ثبت می‌شود
+func RecordGroupUsage(db *sql.DB, userID, groupID int64, key *models.APIKey, sponsored bool, result ChatResult) {
+	event := models.UsageEvent{UserID: userID, Surface: models.SurfaceGroup, GroupID: groupID}
+	if sponsored && key != nil {
+		event.SponsorID = key.UserID
+	}
+	recordUsageEvent(db, event, key, result)
+}
+
+// recordUsageEvent ثبت هر درخواست موفق به عنوان یک پیام؛ توکن‌های گزارش‌نشده پیش‌تر در estimateUsage تخمین زده شده‌اند
+func recordUsageEvent(db *sql.DB, event models.UsageEvent, key *models.APIKey, result ChatResult) {
+	usage := result.Usage
+
+	event.Model = result.Model
+	event.PromptTokens = usage.PromptTokens
+	event.CompletionTokens = usage.CompletionTokens
+	if key != nil {
+		event.APIKeyID = key.ID
+		event.Provider = key.Provider
+	}
+	event.Cost = CalculateCost(db, event.Provider, result.Model, usage)
+
+	if err := models.RecordUsageEvent(db, event); err != nil {
+		log.Printf("خطا در ثبت مصرف کاربر %d: %v", event.UserID, err)
+	}
+}
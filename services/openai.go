@@ -7,60 +7,287 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"time"
+	"strings"
 )
 
-// ChatRequest برای ارسال درخواست به OpenAI
-type ChatRequest struct {
-	Model    string              `json:"model"`
-	Messages []map[string]string `json:"messages"`
+// Settings - تنظیمات سرویس مدل زبانی
+type Settings struct {
+	BaseURL       string
+	DefaultModel  string
+	ContextTokens int // سقف توکن تاریخچه ارسالی در گفتگوی چندمرحله‌ای
 }
 
-// ChatResponse ساختار پاسخ API
-type ChatResponse struct {
+var settings = Settings{
+	BaseURL:       "https://api.openai.com/v1",
+	DefaultModel:  "gpt-3.5-turbo",
+	ContextTokens: 3000,
+}
+
+// Configure اعمال تنظیمات سرویس (در زمان راه‌اندازی از main فراخوانی می‌شود)
+func Configure(s Settings) {
+	if s.BaseURL != "" {
+		settings.BaseURL = strings.TrimRight(s.BaseURL, "/")
+	}
+	if s.DefaultModel != "" {
+		settings.DefaultModel = s.DefaultModel
+	}
+	if s.ContextTokens > 0 {
+		settings.ContextTokens = s.ContextTokens
+	}
+}
+
+// DefaultModel مدل پیش‌فرض تنظیم‌شده
+func DefaultModel() string {
+	return settings.DefaultModel
+}
+
+// openAIProvider - هر API سازگار با OpenAI (خود OpenAI یا سرور محلی)
+type openAIProvider struct {
+	name    string
+	baseURL string
+	apiKey  string
+}
+
+// openAIChatRequest بدنه درخواست chat/completions
+type openAIChatRequest struct {
+	Model         string               `json:"model"`
+	Messages      []Message            `json:"messages"`
+	MaxTokens     int                  `json:"max_tokens,omitempty"`
+	Stream        bool                 `json:"stream,omitempty"`
+	StreamOptions *openAIStreamOptions `json:"stream_options,omitempty"`
+}
+
+// openAIStreamOptions درخواست گزارش مصرف در انتهای پاسخ تدریجی
+type openAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// openAIChatResponse ساختار پاسخ API
+type openAIChatResponse struct {
+	Model   string `json:"model"`
 	Choices []struct {
 		Message struct {
 			Content string `json:"content"`
 		} `json:"message"`
+		FinishReason string `json:"finish_reason"`
 	} `json:"choices"`
+	Usage struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+		TotalTokens      int `json:"total_tokens"`
+	} `json:"usage"`
 }
 
-// SendChatWithKey — ارسال درخواست ChatGPT با کلید اختصاصی کاربر
-func SendChatWithKey(apiKey, model, prompt string) (string, error) {
-	url := "https://api.openai.com/v1/chat/completions"
+// openAIStreamChunk یک تکه از پاسخ تدریجی
+type openAIStreamChunk struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+		TotalTokens      int `json:"total_tokens"`
+	} `json:"usage"`
+}
 
-	reqBody := ChatRequest{
-		Model: model,
-		Messages: []map[string]string{
-			{"role": "user", "content": prompt},
-		},
-	}
+// openAIErrorResponse ساختار خطای API
+type openAIErrorResponse struct {
+	Error struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+		Code    string `json:"code"`
+	} `json:"error"`
+}
 
-	body, _ := json.Marshal(reqBody)
-	req, _ := http.NewRequestWithContext(context.Background(), "POST", url, bytes.NewReader(body))
-	req.Header.Set("Authorization", "Bearer "+apiKey)
-	req.Header.Set("Content-Type", "application/json")
+func (p *openAIProvider) Name() string {
+	return p.name
+}
 
-	client := &http.Client{Timeout: 40 * time.Second}
-	res, err := client.Do(req)
+// Chat ارسال درخواست به chat/completions
+func (p *openAIProvider) Chat(ctx context.Context, req ChatRequest) (ChatResult, error) {
+	res, err := p.post(ctx, openAIChatRequest{
+		Model:     req.Model,
+		Messages:  req.Messages,
+		MaxTokens: req.MaxTokens,
+	})
 	if err != nil {
-		return "", fmt.Errorf("خطا در ارسال درخواست: %v", err)
+		return ChatResult{}, err
 	}
 	defer res.Body.Close()
 
 	respBody, _ := io.ReadAll(res.Body)
 	if res.StatusCode >= 400 {
-		return "", fmt.Errorf("OpenAI پاسخ خطا داد (%d): %s", res.StatusCode, string(respBody))
+		return ChatResult{}, p.parseError(res.StatusCode, respBody)
 	}
 
-	var parsed ChatResponse
+	var parsed openAIChatResponse
 	if err := json.Unmarshal(respBody, &parsed); err != nil {
-		return "", fmt.Errorf("خطا در پردازش پاسخ: %v", err)
+		return ChatResult{}, fmt.Errorf("خطا در پردازش پاسخ: %v", err)
 	}
 
 	if len(parsed.Choices) == 0 {
-		return "", fmt.Errorf("پاسخی از GPT دریافت نشد")
+		return ChatResult{}, fmt.Errorf("پاسخی از %s دریافت نشد", p.name)
+	}
+
+	usage := Usage{
+		PromptTokens:     parsed.Usage.PromptTokens,
+		CompletionTokens: parsed.Usage.CompletionTokens,
+		TotalTokens:      parsed.Usage.TotalTokens,
+	}
+	if usage.TotalTokens == 0 {
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+
+	return ChatResult{
+		Content:      parsed.Choices[0].Message.Content,
+		Model:        parsed.Model,
+		Usage:        usage,
+		FinishReason: parsed.Choices[0].FinishReason,
+	}, nil
+}
+
+// ChatStream ارسال درخواست با stream=true و خواندن تکه‌های SSE
+func (p *openAIProvider) ChatStream(ctx context.Context, req ChatRequest, onDelta func(string)) (ChatResult, error) {
+	res, err := p.post(ctx, openAIChatRequest{
+		Model:         req.Model,
+		Messages:      req.Messages,
+		MaxTokens:     req.MaxTokens,
+		Stream:        true,
+		StreamOptions: &openAIStreamOptions{IncludeUsage: true},
+	})
+	if err != nil {
+		return ChatResult{}, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 400 {
+		respBody, _ := io.ReadAll(res.Body)
+		return ChatResult{}, p.parseError(res.StatusCode, respBody)
+	}
+
+	var result ChatResult
+	var content strings.Builder
+	err = readSSE(res.Body, func(_, data string) (bool, error) {
+		if data == "[DONE]" {
+			return false, nil
+		}
+
+		var chunk openAIStreamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return false, fmt.Errorf("خطا در پردازش پاسخ: %v", err)
+		}
+
+		if chunk.Model != "" {
+			result.Model = chunk.Model
+		}
+		for _, choice := range chunk.Choices {
+			if choice.Delta.Content != "" {
+				content.WriteString(choice.Delta.Content)
+				onDelta(choice.Delta.Content)
+			}
+			if choice.FinishReason != nil {
+				result.FinishReason = *choice.FinishReason
+			}
+		}
+		if chunk.Usage != nil {
+			result.Usage = Usage{
+				PromptTokens:     chunk.Usage.PromptTokens,
+				CompletionTokens: chunk.Usage.CompletionTokens,
+				TotalTokens:      chunk.Usage.TotalTokens,
+			}
+		}
+		return true, nil
+	})
+	if err != nil {
+		return ChatResult{}, err
+	}
+
+	if content.Len() == 0 {
+		return ChatResult{}, fmt.Errorf("پاسخی از %s دریافت نشد", p.name)
+	}
+	result.Content = content.String()
+	return result, nil
+}
+
+// ListModels دریافت لیست مدل‌ها از /models
+func (p *openAIProvider) ListModels(ctx context.Context) (KeyInfo, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", p.baseURL+"/models", nil)
+	if err != nil {
+		return KeyInfo{}, err
+	}
+	if p.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+
+	res, err := httpClient.Do(httpReq)
+	if err != nil {
+		return KeyInfo{}, fmt.Errorf("خطا در ارسال درخواست: %v", err)
+	}
+	defer res.Body.Close()
+
+	respBody, _ := io.ReadAll(res.Body)
+	if res.StatusCode >= 400 {
+		return KeyInfo{}, p.parseError(res.StatusCode, respBody)
+	}
+
+	var parsed struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(respBody, &parsed); err != nil {
+		return KeyInfo{}, fmt.Errorf("خطا در پردازش پاسخ: %v", err)
+	}
+
+	info := KeyInfo{Organization: res.Header.Get("openai-organization")}
+	for _, m := range parsed.Data {
+		info.Models = append(info.Models, m.ID)
+	}
+	return info, nil
+}
+
+// post ارسال بدنه به chat/completions
+func (p *openAIProvider) post(ctx context.Context, body openAIChatRequest) (*http.Response, error) {
+	payload, _ := json.Marshal(body)
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/chat/completions", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	if p.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	client := httpClient
+	if body.Stream {
+		client = streamClient
+	}
+	res, err := client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("خطا در ارسال درخواست: %v", err)
+	}
+	return res, nil
+}
+
+// parseError تبدیل پاسخ خطا به APIError
+func (p *openAIProvider) parseError(status int, body []byte) error {
+	apiErr := &APIError{Provider: p.name, StatusCode: status}
+
+	var parsed openAIErrorResponse
+	if err := json.Unmarshal(body, &parsed); err == nil && parsed.Error.Message != "" {
+		apiErr.Code = parsed.Error.Code
+		if apiErr.Code == "" {
+			apiErr.Code = parsed.Error.Type
+		}
+		apiErr.Message = parsed.Error.Message
+	} else {
+		apiErr.Message = string(body)
 	}
 
-	return parsed.Choices[0].Message.Content, nil
+	return apiErr
 }
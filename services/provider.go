@@ -0,0 +1,257 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"telegram-bot-manager/models"
+)
+
+// نقش‌های پیام در گفتگو
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// Message - یک پیام در گفتگو با مدل
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// ChatRequest - درخواست مستقل از Provider
+type ChatRequest struct {
+	Model     string
+	Messages  []Message
+	MaxTokens int // صفر یعنی پیش‌فرض Provider
+}
+
+// Usage - مصرف توکن گزارش‌شده توسط Provider
+type Usage struct {
+	PromptTokens     int
+	CompletionTokens int
+	TotalTokens      int
+}
+
+// ChatResult - پاسخ مستقل از Provider
+type ChatResult struct {
+	Content      string
+	Model        string
+	Usage        Usage
+	FinishReason string // stop، length، ... (مقادیر Anthropic به معادل OpenAI تبدیل می‌شوند)
+}
+
+// KeyInfo - اطلاعات کلید دریافت‌شده از Provider هنگام اعتبارسنجی
+type KeyInfo struct {
+	Models       []string
+	Organization string
+}
+
+// Provider - سرویس مدل زبانی
+type Provider interface {
+	Name() string
+	Chat(ctx context.Context, req ChatRequest) (ChatResult, error)
+	// ListModels درخواست کم‌هزینه لیست مدل‌ها؛ برای اعتبارسنجی کلید استفاده می‌شود
+	ListModels(ctx context.Context) (KeyInfo, error)
+}
+
+// APIError - خطای برگشتی از Provider
+//
+// Code همان کد خطای Provider است (مثل invalid_api_key یا insufficient_quota) و در متن خطا هم می‌آید.
+type APIError struct {
+	Provider   string
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s پاسخ خطا داد (%d): %s %s", e.Provider, e.StatusCode, e.Code, e.Message)
+}
+
+// زمان انتظار پیش‌فرض برای هر درخواست
+const requestTimeout = 60 * time.Second
+
+// حداکثر سکوت بین دو تکه پاسخ تدریجی
+const streamIdleTimeout = 30 * time.Second
+
+var httpClient = &http.Client{Timeout: requestTimeout}
+
+// پاسخ تدریجی سقف زمان کل ندارد؛ مهلت آن در ChatStream با تایمر سکوت کنترل می‌شود
+var streamClient = &http.Client{}
+
+// NewProvider ساخت Provider مناسب برای کلید کاربر
+func NewProvider(key *models.APIKey) (Provider, error) {
+	switch key.Provider {
+	case models.ProviderOpenAI, "":
+		baseURL := key.BaseURL
+		if baseURL == "" {
+			baseURL = settings.BaseURL
+		}
+		return &openAIProvider{name: "OpenAI", baseURL: strings.TrimRight(baseURL, "/"), apiKey: key.APIKey}, nil
+
+	case models.ProviderAnthropic:
+		baseURL := key.BaseURL
+		if baseURL == "" {
+			baseURL = anthropicBaseURL
+		}
+		return &anthropicProvider{baseURL: strings.TrimRight(baseURL, "/"), apiKey: key.APIKey}, nil
+
+	case models.ProviderLocal:
+		if key.BaseURL == "" {
+			return nil, fmt.Errorf("آدرس سرور محلی برای این کلید تنظیم نشده است")
+		}
+		return &openAIProvider{name: "Local", baseURL: strings.TrimRight(key.BaseURL, "/"), apiKey: key.APIKey}, nil
+	}
+
+	return nil, fmt.Errorf("Provider ناشناخته: %s", key.Provider)
+}
+
+// modelForKey مدل مورد استفاده برای کلید (مدل کلید یا پیش‌فرض Provider)
+func modelForKey(key *models.APIKey) string {
+	if key.Model != "" {
+		return key.Model
+	}
+	if key.Provider == models.ProviderAnthropic {
+		return anthropicDefaultModel
+	}
+	return settings.DefaultModel
+}
+
+// Chat ارسال درخواست با کلید کاربر؛ مسیر مشترک چت خصوصی، گروه و کانال
+func Chat(ctx context.Context, key *models.APIKey, req ChatRequest) (ChatResult, error) {
+	provider, err := NewProvider(key)
+	if err != nil {
+		return ChatResult{}, err
+	}
+
+	if req.Model == "" {
+		req.Model = modelForKey(key)
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, requestTimeout)
+		defer cancel()
+	}
+
+	result, err := provider.Chat(ctx, req)
+	if err != nil {
+		return ChatResult{}, err
+	}
+	if result.Model == "" {
+		result.Model = req.Model
+	}
+	estimateUsage(req, &result)
+	return result, nil
+}
+
+// estimateUsage تخمین مصرف برای سرورهایی که usage گزارش نمی‌کنند (مثل برخی سرورهای محلی)
+// تا سهمیه روزانه و سقف اسپانسر برای این درخواست‌ها هم جلو برود
+func estimateUsage(req ChatRequest, result *ChatResult) {
+	if result.Usage.PromptTokens+result.Usage.CompletionTokens > 0 {
+		return
+	}
+	for _, m := range req.Messages {
+		result.Usage.PromptTokens += EstimateTokens(m.Content)
+	}
+	result.Usage.CompletionTokens = EstimateTokens(result.Content)
+	result.Usage.TotalTokens = result.Usage.PromptTokens + result.Usage.CompletionTokens
+}
+
+// Ask پرسش تک‌مرحله‌ای با پرامپت سیستمی
+func Ask(ctx context.Context, key *models.APIKey, systemPrompt, question string) (ChatResult, error) {
+	return Chat(ctx, key, ChatRequest{Messages: PromptMessages(systemPrompt, question)})
+}
+
+// زمان انتظار اعتبارسنجی کلید
+const validateTimeout = 15 * time.Second
+
+// ValidateKey بررسی کلید نزد Provider و دریافت مدل‌های در دسترس
+func ValidateKey(ctx context.Context, key *models.APIKey) (KeyInfo, error) {
+	provider, err := NewProvider(key)
+	if err != nil {
+		return KeyInfo{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, validateTimeout)
+	defer cancel()
+
+	info, err := provider.ListModels(ctx)
+	if err != nil {
+		return KeyInfo{}, err
+	}
+	sort.Strings(info.Models)
+	return info, nil
+}
+
+// ProbeKeyQuota یک درخواست یک‌توکنی برای آشکار کردن تمام شدن اعتبار حساب
+//
+// لیست مدل‌ها برای حساب بدون اعتبار هم موفق است و فقط درخواست تولید insufficient_quota برمی‌گرداند؛
+// خطاهای دیگر (مدل نامعتبر، محدودیت نرخ، شبکه) نتیجه بررسی را تغییر نمی‌دهند و nil برگردانده می‌شود.
+func ProbeKeyQuota(ctx context.Context, key *models.APIKey) error {
+	ctx, cancel := context.WithTimeout(ctx, validateTimeout)
+	defer cancel()
+
+	_, err := Chat(ctx, key, ChatRequest{
+		Messages:  []Message{{Role: "user", Content: "ping"}},
+		MaxTokens: 1,
+	})
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.Code == "insufficient_quota" {
+		return err
+	}
+	if err != nil {
+		log.Printf("بررسی اعتبار حساب کلید %d ناموفق بود: %v", key.ID, err)
+	}
+	return nil
+}
+
+// KeyCheckResult تبدیل نتیجه اعتبارسنجی به وضعیت قابل ذخیره
+//
+// فقط invalid_api_key و insufficient_quota کلید را از کار می‌اندازند؛ خطاهای شبکه یا موقت
+// وضعیت قبلی کلید را تغییر نمی‌دهند (previousStatus).
+func KeyCheckResult(info KeyInfo, err error, previousStatus string) models.APIKeyCheck {
+	if err == nil {
+		return models.APIKeyCheck{Status: models.KeyStatusValid, Models: info.Models, Organization: info.Organization}
+	}
+
+	check := models.APIKeyCheck{Status: previousStatus, Error: err.Error()}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		switch {
+		case apiErr.Code == "invalid_api_key" || apiErr.StatusCode == http.StatusUnauthorized:
+			check.Status = models.KeyStatusInvalid
+		case apiErr.Code == "insufficient_quota":
+			check.Status = models.KeyStatusQuotaExceeded
+		}
+	}
+	return check
+}
+
+// CalculateCost هزینه درخواست به دلار بر اساس جدول قیمت مدل‌ها
+//
+// درخواست‌های سرور محلی هزینه‌ای ندارند؛ در صورت خطا در خواندن قیمت، صفر برگردانده می‌شود.
+func CalculateCost(db *sql.DB, provider, model string, usage Usage) float64 {
+	if provider == models.ProviderLocal {
+		return 0
+	}
+
+	price, err := models.GetModelPrice(db, model)
+	if err != nil {
+		log.Printf("خطا در دریافت قیمت مدل %s: %v", model, err)
+		return 0
+	}
+	if price == nil {
+		return 0
+	}
+	return price.Cost(usage.PromptTokens, usage.CompletionTokens)
+}
@@ -2,9 +2,10 @@ package services
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
-	"strings"
+	"os"
 	"time"
 
 	"gopkg.in/telebot.v3"
@@ -13,17 +14,43 @@ import (
 	"telegram-bot-manager/models"
 )
 
+// SchedulerSettings - تنظیمات زمان‌بندی انتشار کانال‌ها
+type SchedulerSettings struct {
+	// نوبت‌هایی که حداکثر به این اندازه عقب افتاده‌اند (مثلاً به خاطر توقف ربات) هنوز اجرا می‌شوند
+	CatchupGrace time.Duration
+}
+
+var schedulerSettings = SchedulerSettings{
+	CatchupGrace: 30 * time.Minute,
+}
+
+// ConfigureScheduler اعمال تنظیمات زمان‌بندی (در زمان راه‌اندازی از main فراخوانی می‌شود)
+func ConfigureScheduler(s SchedulerSettings) {
+	if s.CatchupGrace > 0 {
+		schedulerSettings.CatchupGrace = s.CatchupGrace
+	}
+}
+
+// مدت قفل انتشار هر کانال؛ نمونه‌ای که بیش از این طول بکشد با توکن حصار متوقف می‌شود
+const channelRunLockTTL = 15 * time.Minute
+
+// errRunFenced - نمونه دیگری با توکن حصار جدیدتر انتشار کانال را در دست گرفته است
+var errRunFenced = errors.New("توکن حصار منسوخ است؛ انتشار به نمونه دیگر سپرده شد")
+
 // Scheduler - سیستم زمان‌بندی تولید محتوا
 type Scheduler struct {
-	bot *telebot.Bot
-	db  *sql.DB
+	bot      *telebot.Bot
+	db       *sql.DB
+	instance string // شناسه این نمونه ربات در scheduled_runs
 }
 
 // NewScheduler - ایجاد نمونه جدید scheduler
 func NewScheduler(bot *telebot.Bot, db *sql.DB) *Scheduler {
+	host, _ := os.Hostname()
 	return &Scheduler{
-		bot: bot,
-		db:  db,
+		bot:      bot,
+		db:       db,
+		instance: fmt.Sprintf("%s-%d", host, os.Getpid()),
 	}
 }
 
@@ -44,105 +71,140 @@ func (s *Scheduler) Start() {
 }
 
 // checkAndPostContent - بررسی و انتشار محتوا
+//
+// نوبت هر کانال از next_run_at خوانده می‌شود؛ پیش از انتشار، نوبت بعدی با مقایسه مقدار قبلی
+// ثبت می‌شود تا هر نوبت فقط یک بار برداشته شود و تیک کند یا جاافتاده نوبت را از دست ندهد.
+// چند نمونه هم‌زمان ربات با قفل Redis هر کانال، توکن حصار و جدول scheduled_runs
+// (یکتا بر اساس کانال و نوبت) هماهنگ می‌شوند تا هیچ نوبتی دو بار منتشر نشود.
 func (s *Scheduler) checkAndPostContent() {
 	now := time.Now()
-	currentTime := now.Format("15:04")
-
-	log.Printf("🔍 بررسی زمان‌بندی برای ساعت: %s", currentTime)
 
-	// دریافت تمام کانال‌های فعال
-	activeChannels, err := s.getActiveChannels()
+	dueChannels, err := models.ListDueChannels(s.db, now)
 	if err != nil {
-		log.Printf("❌ خطا در دریافت کانال‌های فعال: %v", err)
+		log.Printf("❌ خطا در دریافت کانال‌های سررسید: %v", err)
 		return
 	}
 
-	for _, channel := range activeChannels {
-		if channel.ScheduleTime == currentTime {
-			go s.processChannelContent(channel)
+	for _, channel := range dueChannels {
+		slot, due, next, err := planChannelRun(channel.Schedule, channel.NextRunAt, now, schedulerSettings.CatchupGrace)
+		if err != nil {
+			log.Printf("❌ خطا در زمان‌بندی کانال %s: %v", channel.ChannelTitle, err)
+			continue
 		}
+
+		// قفل کانال در Redis؛ کانالی که نمونه دیگر (یا تیک قبلی) در حال انتشار آن است رد می‌شود
+		owner, locked, err := database.AcquireLock(channelLockName(channel.ID), channelRunLockTTL)
+		if err != nil {
+			log.Printf("❌ خطا در گرفتن قفل کانال %s: %v", channel.ChannelTitle, err)
+			continue
+		}
+		if !locked {
+			continue
+		}
+
+		claimed, err := models.AdvanceChannelRun(s.db, channel.ID, channel.NextRunAt, next)
+		if err != nil {
+			log.Printf("❌ خطا در ثبت نوبت بعدی کانال %s: %v", channel.ChannelTitle, err)
+		}
+		if err != nil || !claimed || !due {
+			s.releaseChannelLock(channel.ID, owner)
+			continue
+		}
+		go s.runChannelSlot(channel, slot, owner)
 	}
 }
 
-// ChannelConfig - ساختار کانال (مشابه handlers/channel.go)
-type ChannelConfig struct {
-	ID           int64     `json:"id"`
-	OwnerID      int64     `json:"owner_id"`
-	ChannelID    string    `json:"channel_id"`
-	ChannelTitle string    `json:"channel_title"`
-	Prompt       string    `json:"prompt"`
-	ScheduleTime string    `json:"schedule_time"`
-	PostsPerBatch int      `json:"posts_per_batch"`
-	IsActive     bool      `json:"is_active"`
-	CreatedAt    time.Time `json:"created_at"`
+// planChannelRun تعیین نوبت سررسید کانال و نوبت بعدی آن
+//
+// از نوبت‌های جاافتاده فقط آخرین نوبتی که حداکثر grace عقب افتاده اجرا می‌شود و
+// نوبت‌های قدیمی‌تر رد می‌شوند. نوبت محاسبه‌نشده (NULL) فقط محاسبه می‌شود و نوبت مانده
+// از زمان‌بندی‌ای که پاک شده اجرا نمی‌شود.
+func planChannelRun(sched models.ChannelSchedule, nextRunAt sql.NullTime, now time.Time, grace time.Duration) (slot time.Time, due bool, next time.Time, err error) {
+	next, err = sched.Next(now)
+	if err != nil || next.IsZero() || !nextRunAt.Valid {
+		return time.Time{}, false, next, err
+	}
+
+	slot = nextRunAt.Time
+	if cutoff := now.Add(-grace); slot.Before(cutoff) {
+		if slot, err = sched.Next(cutoff.Add(-time.Nanosecond)); err != nil {
+			return time.Time{}, false, next, err
+		}
+		log.Printf("⏭️ نوبت‌های انتشار پیش از %s رد شدند (خارج از پنجره جبران)", cutoff.Format("2006-01-02 15:04"))
+	}
+	if slot.IsZero() || slot.After(now) {
+		return time.Time{}, false, next, nil
+	}
+
+	// جلو رفتن تا آخرین نوبت سررسید
+	for {
+		n, err := sched.Next(slot)
+		if err != nil || n.IsZero() || n.After(now) {
+			break
+		}
+		slot = n
+	}
+	return slot, true, next, nil
 }
 
 // getActiveChannels - دریافت کانال‌های فعال از دیتابیس
-func (s *Scheduler) getActiveChannels() ([]ChannelConfig, error) {
-	// TODO: جایگزین با کوئری واقعی هنگامی که جدول channels ایجاد شد
-	// در حال حاضر از نمونه‌های تستی استفاده می‌کنیم
-	var channels []ChannelConfig
+func (s *Scheduler) getActiveChannels() ([]models.ChannelConfig, error) {
+	return models.ListActiveChannels(s.db)
+}
 
-	// این بخش موقتی است - بعداً با جدول واقعی جایگزین می‌شود
-	rows, err := s.db.Query(`
-		SELECT id, owner_id, channel_id, channel_title, prompt, 
-		       schedule_time, posts_per_batch, is_active, created_at
-		FROM channels 
-		WHERE is_active = true
-	`)
-	if err != nil {
-		// اگر جدول وجود ندارد، نمونه‌های تستی برگردان
-		return s.getMockChannels(), nil
+// runChannelSlot - اجرای یک نوبت انتشار کانال با قفل گرفته‌شده و ثبت نتیجه در scheduled_runs
+func (s *Scheduler) runChannelSlot(channel models.ChannelConfig, slot time.Time, lockOwner string) {
+	defer s.releaseChannelLock(channel.ID, lockOwner)
+
+	runID, token, err := models.StartScheduledRun(s.db, channel.ID, slot, s.instance)
+	switch {
+	case errors.Is(err, models.ErrRunAlreadyStarted):
+		log.Printf("⏭️ نوبت %s کانال %s قبلاً اجرا شده است", slot.Format("2006-01-02 15:04"), channel.ChannelTitle)
+		return
+	case err != nil:
+		log.Printf("❌ خطا در ثبت اجرای نوبت کانال %s: %v", channel.ChannelTitle, err)
+		return
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		var channel ChannelConfig
-		err := rows.Scan(
-			&channel.ID, &channel.OwnerID, &channel.ChannelID,
-			&channel.ChannelTitle, &channel.Prompt, &channel.ScheduleTime,
-			&channel.PostsPerBatch, &channel.IsActive, &channel.CreatedAt,
-		)
-		if err != nil {
-			continue
+	posted, err := s.processChannelContent(channel, slot, runID, token)
+
+	status := models.RunSucceeded
+	errText := ""
+	if err != nil {
+		errText = err.Error()
+		switch {
+		case errors.Is(err, errRunFenced):
+			status = models.RunFenced
+		case posted == 0:
+			status = models.RunFailed
+		default:
+			status = models.RunPartial
 		}
-		channels = append(channels, channel)
 	}
-
-	return channels, nil
+	if err := models.FinishScheduledRun(s.db, runID, status, posted, errText); err != nil {
+		log.Printf("❌ خطا در ثبت نتیجه نوبت کانال %s: %v", channel.ChannelTitle, err)
+	}
 }
 
-// getMockChannels - کانال‌های نمونه (موقتی)
-func (s *Scheduler) getMockChannels() []ChannelConfig {
-	// این تابع موقتی است و بعداً حذف می‌شود
-	return []ChannelConfig{
-		{
-			ID:           1,
-			OwnerID:      269758292,
-			ChannelID:    "@test_channel",
-			ChannelTitle: "کانال تست",
-			Prompt:       "تولید محتوای آموزشی در مورد برنامه‌نویسی و تکنولوژی",
-			ScheduleTime: "09:00",
-			PostsPerBatch: 1,
-			IsActive:     true,
-			CreatedAt:    time.Now(),
-		},
+// releaseChannelLock - آزاد کردن قفل انتشار کانال
+func (s *Scheduler) releaseChannelLock(channelID int, owner string) {
+	if err := database.ReleaseLock(channelLockName(channelID), owner); err != nil {
+		log.Printf("❌ خطا در آزاد کردن قفل کانال %d: %v", channelID, err)
 	}
 }
 
-// processChannelContent - پردازش محتوای یک کانال
-func (s *Scheduler) processChannelContent(channel ChannelConfig) {
-	log.Printf("🎯 شروع تولید محتوا برای کانال: %s", channel.ChannelTitle)
+// channelLockName نام قفل انتشار یک کانال
+func channelLockName(channelID int) string {
+	return fmt.Sprintf("channel_run:%d", channelID)
+}
 
-	// دریافت API Key مالک کانال
-	apiKey, err := models.GetActiveAPIKey(s.db, channel.OwnerID)
-	if err != nil || apiKey == nil {
-		s.notifyOwner(channel.OwnerID, 
-			"❌ خطا در تولید محتوای خودکار\n" +
-			"دلیل: API Key تنظیم نشده است\n" +
-			"کانال: " + channel.ChannelTitle)
-		return
-	}
+// processChannelContent - پردازش محتوای یک کانال برای نوبت slot
+//
+// ابتدا پیش‌نویس‌های تأییدشده منتشر می‌شوند و باقی پست‌های نوبت تولید می‌شوند: با انتشار مستقیم
+// همان لحظه منتشر و در غیر این صورت به صف پیش‌نویس و تأیید مالک فرستاده می‌شوند.
+// تعداد پست‌های منتشرشده و آخرین خطا برگردانده می‌شود.
+func (s *Scheduler) processChannelContent(channel models.ChannelConfig, slot time.Time, runID, token int64) (int, error) {
+	log.Printf("🎯 شروع تولید محتوا برای کانال: %s (نوبت %s)", channel.ChannelTitle, slot.Format("2006-01-02 15:04 MST"))
 
 	// بررسی ادمین بودن ربات در کانال
 	isAdmin, err := s.checkBotAdminStatus(channel.ChannelID)
@@ -151,71 +213,183 @@ func (s *Scheduler) processChannelContent(channel ChannelConfig) {
 			"❌ خطا در تولید محتوای خودکار\n" +
 			"دلیل: ربات در کانال ادمین نیست\n" +
 			"کانال: " + channel.ChannelTitle)
-		return
+		return 0, errors.New("ربات در کانال ادمین نیست")
 	}
 
-	// تولید محتوا
-	for i := 0; i < channel.PostsPerBatch; i++ {
-		content, tokensUsed, err := s.generateChannelContent(apiKey.APIKey, channel.Prompt)
-		if err != nil {
-			log.Printf("❌ خطا در تولید محتوا برای کانال %s: %v", channel.ChannelTitle, err)
-			s.notifyOwner(channel.OwnerID,
-				"❌ خطا در تولید محتوای خودکار\n" +
-				"دلیل: " + err.Error() + "\n" +
-				"کانال: " + channel.ChannelTitle)
-			continue
+	// ثبت آمار انتشار کانال (حتی اگر نوبت نیمه‌کاره متوقف شود)
+	posted := 0
+	defer func() {
+		if posted == 0 {
+			return
+		}
+		if err := models.RecordChannelPosts(s.db, channel.ID, posted); err != nil {
+			log.Printf("❌ خطا در ثبت آمار کانال %s: %v", channel.ChannelTitle, err)
 		}
+	}()
 
-		// انتشار محتوا در کانال
-		err = s.postToChannel(channel.ChannelID, content)
-		if err != nil {
-			log.Printf("❌ خطا در انتشار محتوا در کانال %s: %v", channel.ChannelTitle, err)
-			s.notifyOwner(channel.OwnerID,
-				"❌ خطا در انتشار محتوای خودکار\n" +
-				"دلیل: " + err.Error() + "\n" +
-				"کانال: " + channel.ChannelTitle)
+	var lastErr error
+
+	// ۱. انتشار پیش‌نویس‌های تأییدشده مالک
+	drafts, err := models.ListApprovedDrafts(s.db, channel.ID, channel.PostsPerBatch)
+	if err != nil {
+		log.Printf("❌ خطا در دریافت پیش‌نویس‌های کانال %s: %v", channel.ChannelTitle, err)
+		lastErr = err
+	}
+	for i, d := range drafts {
+		if i > 0 {
+			time.Sleep(2 * time.Second)
+		}
+		if err := s.publishPost(channel, token, d.Content); err != nil {
+			if errors.Is(err, errRunFenced) {
+				return posted, err
+			}
+			lastErr = err
 			continue
 		}
-
-		// ثبت مصرف توکن
-		if tokensUsed > 0 {
-			cost := CalculateCost(tokensUsed, true) // کاربران VIP هستند
-			models.RecordTokenUsage(s.db, channel.OwnerID, tokensUsed, cost)
+		if err := models.MarkDraftPublished(s.db, d.ID, runID); err != nil {
+			log.Printf("❌ خطا در ثبت انتشار پیش‌نویس %d: %v", d.ID, err)
 		}
+		posted++
+	}
 
-		log.Printf("✅ محتوا با موفقیت در کانال %s منتشر شد (%d توکن)", 
-			channel.ChannelTitle, tokensUsed)
-
-		// تأثیر بین پست‌ها
-		if i < channel.PostsPerBatch-1 {
-			time.Sleep(2 * time.Second)
+	// ۲. تولید باقی پست‌های نوبت
+	if remaining := channel.PostsPerBatch - len(drafts); remaining > 0 {
+		var err error
+		if channel.AutoPublish {
+			var n int
+			n, err = s.generateAndPublish(channel, token, remaining)
+			posted += n
+		} else {
+			err = s.generateDrafts(channel, runID, remaining)
 		}
+		if errors.Is(err, errRunFenced) {
+			return posted, err
+		}
+		if err != nil {
+			lastErr = err
+		}
+	}
+
+	if posted == 0 {
+		return 0, lastErr
 	}
 
 	// اطلاع‌رسانی موفقیت
 	s.notifyOwner(channel.OwnerID,
 		"✅ محتوای خودکار با موفقیت منتشر شد\n" +
 		"کانال: " + channel.ChannelTitle + "\n" +
-		"تعداد پست: " + fmt.Sprintf("%d", channel.PostsPerBatch))
+		"تعداد پست: " + fmt.Sprintf("%d", posted))
+	return posted, lastErr
 }
 
-// generateChannelContent - تولید محتوا برای کانال
-func (s *Scheduler) generateChannelContent(apiKey, prompt string) (string, int, error) {
-	systemPrompt := fmt.Sprintf(
-		"تو یک تولیدکننده محتوای حرفه‌ای برای کانال‌های تلگرام هستی.\n" +
-		"محتوایی تولید کن که:\n" +
-		"- جذاب و مفید باشد\n" +
-		"- حدود ۲۰۰-۳۰۰ کلمه باشد\n" +
-		"- برای انتشار در کانال مناسب باشد\n" +
-		"- دارای ساختار منظم\n" +
-		"- حاوی نکات کاربردی\n\n" +
-		"دستورالعمل خاص: %s",
-		prompt,
-	)
+// generateAndPublish - تولید و انتشار مستقیم count پست
+func (s *Scheduler) generateAndPublish(channel models.ChannelConfig, token int64, count int) (int, error) {
+	posted := 0
+	var lastErr error
+	for i := 0; i < count; i++ {
+		content, err := GenerateChannelPost(s.db, channel.OwnerID, channel.Prompt)
+		if err != nil {
+			s.notifyGenerationError(channel, err)
+			if errors.Is(err, ErrNoChannelKeys) || errors.Is(err, ErrChannelQuotaExceeded) {
+				return posted, err
+			}
+			lastErr = err
+			continue
+		}
+
+		if err := s.publishPost(channel, token, content); err != nil {
+			if errors.Is(err, errRunFenced) {
+				return posted, err
+			}
+			lastErr = err
+			continue
+		}
+		posted++
 
-	userMessage := "لطفاً یک پست جذاب برای کانل تلگرام تولید کن."
+		// تأخیر بین پست‌ها
+		if i < count-1 {
+			time.Sleep(2 * time.Second)
+		}
+	}
+	return posted, lastErr
+}
 
-	return GenerateChannelContent(apiKey, userMessage, 250) // حدود ۲۵۰ کلمه
+// generateDrafts - تولید count پیش‌نویس (تا سقف صف) و ارسال آن‌ها برای تأیید مالک
+func (s *Scheduler) generateDrafts(channel models.ChannelConfig, runID int64, count int) error {
+	pending, approved, err := models.CountQueuedDrafts(s.db, channel.ID)
+	if err != nil {
+		return err
+	}
+	if room := models.ChannelDraftQueueMax - pending - approved; count > room {
+		count = room
+	}
+	if count <= 0 {
+		log.Printf("📥 صف پیش‌نویس کانال %s پر است", channel.ChannelTitle)
+		return nil
+	}
+
+	var lastErr error
+	for i := 0; i < count; i++ {
+		content, err := GenerateChannelPost(s.db, channel.OwnerID, channel.Prompt)
+		if err != nil {
+			s.notifyGenerationError(channel, err)
+			if errors.Is(err, ErrNoChannelKeys) || errors.Is(err, ErrChannelQuotaExceeded) {
+				return err
+			}
+			lastErr = err
+			continue
+		}
+
+		draft, err := models.CreateChannelDraft(s.db, channel.ID, content, runID)
+		if err != nil {
+			log.Printf("❌ خطا در ثبت پیش‌نویس کانال %s: %v", channel.ChannelTitle, err)
+			lastErr = err
+			continue
+		}
+
+		text, markup := DraftReviewMessage(draft)
+		if _, err := s.bot.Send(&telebot.User{ID: channel.OwnerID}, text, markup); err != nil {
+			log.Printf("❌ خطا در ارسال پیش‌نویس %d به کاربر %d: %v", draft.ID, channel.OwnerID, err)
+		}
+	}
+	return lastErr
+}
+
+// publishPost - انتشار یک پست پس از بررسی توکن حصار
+func (s *Scheduler) publishPost(channel models.ChannelConfig, token int64, content string) error {
+	// نمونه‌ای که قفلش منقضی شده و نمونه دیگری کانال را در دست گرفته منتشر نمی‌کند
+	if valid, err := models.FencingTokenValid(s.db, channel.ID, token); err != nil || !valid {
+		log.Printf("⛔ انتشار در کانال %s متوقف شد: توکن حصار %d منسوخ است", channel.ChannelTitle, token)
+		return errRunFenced
+	}
+
+	if err := s.postToChannel(channel.ChannelID, content); err != nil {
+		log.Printf("❌ خطا در انتشار محتوا در کانال %s: %v", channel.ChannelTitle, err)
+		s.notifyOwner(channel.OwnerID,
+			"❌ خطا در انتشار محتوای خودکار\n" +
+			"دلیل: " + err.Error() + "\n" +
+			"کانال: " + channel.ChannelTitle)
+		return err
+	}
+
+	log.Printf("✅ محتوا با موفقیت در کانال %s منتشر شد", channel.ChannelTitle)
+	return nil
+}
+
+// notifyGenerationError - اطلاع خطای تولید محتوا به مالک کانال
+func (s *Scheduler) notifyGenerationError(channel models.ChannelConfig, err error) {
+	log.Printf("❌ خطا در تولید محتوا برای کانال %s: %v", channel.ChannelTitle, err)
+	if errors.Is(err, ErrChannelQuotaExceeded) {
+		s.notifyOwner(channel.OwnerID,
+			"⚠️ تولید محتوای خودکار متوقف شد\n" +
+			"دلیل: سقف مصرف روزانه شما تمام شده است\n" +
+			"کانال: " + channel.ChannelTitle)
+		return
+	}
+	s.notifyOwner(channel.OwnerID,
+		"❌ خطا در تولید محتوای خودکار\n" +
+		"دلیل: " + err.Error() + "\n" +
+		"کانال: " + channel.ChannelTitle)
 }
 
 // postToChannel - انتشار محتوا در کانال
@@ -396,7 +570,11 @@ func (s *Scheduler) GetSchedulerStatus() string {
 	if len(activeChannels) > 0 {
 		status += "📋 کانال‌های فعال:\n"
 		for _, channel := range activeChannels {
-			status += fmt.Sprintf("• %s - %s\n", channel.ChannelTitle, channel.ScheduleTime)
+			next := "در حال محاسبه"
+			if channel.NextRunAt.Valid {
+				next = channel.NextRunAt.Time.Format("2006-01-02 15:04")
+			}
+			status += fmt.Sprintf("• %s - %s\n", channel.ChannelTitle, next)
 		}
 	}
 
@@ -0,0 +1,123 @@
+package services
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"telegram-bot-manager/models"
+)
+
+func TestPlanChannelRun(t *testing.T) {
+	at := func(day, hour, min int) time.Time {
+		return time.Date(2026, time.October, day, hour, min, 0, 0, time.UTC)
+	}
+	valid := func(t time.Time) sql.NullTime { return sql.NullTime{Time: t, Valid: true} }
+
+	hourly := models.ChannelSchedule{Kind: models.ScheduleInterval, Interval: 60, Timezone: "UTC"}
+	daily := models.ChannelSchedule{Kind: models.ScheduleDaily, Slots: []string{"09:00"}, Timezone: "UTC"}
+
+	tests := []struct {
+		name      string
+		sched     models.ChannelSchedule
+		nextRunAt sql.NullTime
+		now       time.Time
+		grace     time.Duration
+		wantDue   bool
+		wantSlot  time.Time
+		wantNext  time.Time
+	}{
+		{
+			name:     "first run is only planned",
+			sched:    hourly,
+			now:      at(18, 10, 30),
+			grace:    time.Hour,
+			wantNext: at(18, 11, 0),
+		},
+		{
+			name:      "slot not reached yet",
+			sched:     hourly,
+			nextRunAt: valid(at(18, 11, 0)),
+			now:       at(18, 10, 30),
+			grace:     time.Hour,
+			wantNext:  at(18, 11, 0),
+		},
+		{
+			name:      "slot due now",
+			sched:     hourly,
+			nextRunAt: valid(at(18, 10, 0)),
+			now:       at(18, 10, 0),
+			grace:     time.Hour,
+			wantDue:   true,
+			wantSlot:  at(18, 10, 0),
+			wantNext:  at(18, 11, 0),
+		},
+		{
+			name:      "missed slots collapse to the latest",
+			sched:     hourly,
+			nextRunAt: valid(at(18, 8, 0)),
+			now:       at(18, 10, 30),
+			grace:     3 * time.Hour,
+			wantDue:   true,
+			wantSlot:  at(18, 10, 0),
+			wantNext:  at(18, 11, 0),
+		},
+		{
+			name:      "slots before grace are skipped",
+			sched:     hourly,
+			nextRunAt: valid(at(17, 9, 0)),
+			now:       at(18, 10, 30),
+			grace:     2 * time.Hour,
+			wantDue:   true,
+			wantSlot:  at(18, 10, 0),
+			wantNext:  at(18, 11, 0),
+		},
+		{
+			name:      "slot exactly at grace edge runs",
+			sched:     daily,
+			nextRunAt: valid(at(18, 9, 0)),
+			now:       at(18, 11, 0),
+			grace:     2 * time.Hour,
+			wantDue:   true,
+			wantSlot:  at(18, 9, 0),
+			wantNext:  at(19, 9, 0),
+		},
+		{
+			name:      "slot just outside grace is dropped",
+			sched:     daily,
+			nextRunAt: valid(at(18, 9, 0)),
+			now:       at(18, 11, 0),
+			grace:     2*time.Hour - time.Minute,
+			wantNext:  at(19, 9, 0),
+		},
+		{
+			name:      "long outage with nothing inside grace",
+			sched:     daily,
+			nextRunAt: valid(at(16, 9, 0)),
+			now:       at(18, 12, 0),
+			grace:     time.Hour,
+			wantNext:  at(19, 9, 0),
+		},
+		{
+			name:      "empty schedule",
+			sched:     models.ChannelSchedule{Kind: models.ScheduleDaily, Timezone: "UTC"},
+			nextRunAt: valid(at(18, 9, 0)),
+			now:       at(18, 10, 0),
+			grace:     time.Hour,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slot, due, next, err := planChannelRun(tt.sched, tt.nextRunAt, tt.now, tt.grace)
+			if err != nil {
+				t.Fatalf("planChannelRun: %v", err)
+			}
+			if due != tt.wantDue || !slot.Equal(tt.wantSlot) {
+				t.Errorf("slot, due = %v, %v; want %v, %v", slot, due, tt.wantSlot, tt.wantDue)
+			}
+			if !next.Equal(tt.wantNext) {
+				t.Errorf("next = %v, want %v", next, tt.wantNext)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"telegram-bot-manager/models"
+)
+
+// ErrStreamStalled - پاسخ تدریجی در مهلت مقرر تکه تازه‌ای نفرستاد
+var ErrStreamStalled = errors.New("پاسخ تدریجی سرویس متوقف ماند")
+
+// StreamHandler دریافت متن کامل تولیدشده تا این لحظه (نه فقط بخش جدید)
+type StreamHandler func(text string)
+
+// StreamingProvider - Providerی که پاسخ را به صورت تدریجی (SSE) ارسال می‌کند
+type StreamingProvider interface {
+	Provider
+	ChatStream(ctx context.Context, req ChatRequest, onDelta func(delta string)) (ChatResult, error)
+}
+
+// SupportsStreaming بررسی پشتیبانی Provider کلید از پاسخ تدریجی
+func SupportsStreaming(key *models.APIKey) bool {
+	provider, err := NewProvider(key)
+	if err != nil {
+		return false
+	}
+	_, ok := provider.(StreamingProvider)
+	return ok
+}
+
+// ChatStream مثل Chat ولی با گزارش تدریجی متن؛ اگر Provider پشتیبانی نکند به Chat برمی‌گردد
+//
+// onText هر بار با کل متن دریافت‌شده تا آن لحظه فراخوانی می‌شود.
+func ChatStream(ctx context.Context, key *models.APIKey, req ChatRequest, onText StreamHandler) (ChatResult, error) {
+	provider, err := NewProvider(key)
+	if err != nil {
+		return ChatResult{}, err
+	}
+
+	streamer, ok := provider.(StreamingProvider)
+	if !ok {
+		return Chat(ctx, key, req)
+	}
+
+	if req.Model == "" {
+		req.Model = modelForKey(key)
+	}
+
+	// پاسخ طولانی تا وقتی تکه‌های تازه می‌رسد قطع نمی‌شود: تا اولین تکه requestTimeout
+	// و پس از آن بین دو تکه streamIdleTimeout صبر می‌شود
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var stalled atomic.Bool
+	watchdog := time.AfterFunc(requestTimeout, func() {
+		stalled.Store(true)
+		cancel()
+	})
+	defer watchdog.Stop()
+
+	var text strings.Builder
+	result, err := streamer.ChatStream(ctx, req, func(delta string) {
+		if delta == "" {
+			return
+		}
+		watchdog.Reset(streamIdleTimeout)
+		text.WriteString(delta)
+		if onText != nil {
+			onText(text.String())
+		}
+	})
+	if err != nil {
+		if stalled.Load() {
+			return ChatResult{}, ErrStreamStalled
+		}
+		return ChatResult{}, err
+	}
+
+	if result.Content == "" {
+		result.Content = text.String()
+	}
+	if result.Model == "" {
+		result.Model = req.Model
+	}
+	estimateUsage(req, &result)
+	return result, nil
+}
+
+// readSSE خواندن رویدادهای server-sent events و ارسال هر رویداد به handle
+//
+// handle نام رویداد (در صورت وجود) و داده آن را دریافت می‌کند؛ برگرداندن false خواندن را متوقف می‌کند.
+func readSSE(r io.Reader, handle func(event, data string) (bool, error)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var event string
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// خط خالی پایان یک رویداد است
+		if line == "" {
+			if len(data) > 0 {
+				more, err := handle(event, strings.Join(data, "\n"))
+				if err != nil || !more {
+					return err
+				}
+			}
+			event, data = "", nil
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, ":"):
+			// کامنت (keep-alive)
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if len(data) > 0 {
+		_, err := handle(event, strings.Join(data, "\n"))
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package utils
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ChartBar - یک ستون نمودار؛ Values مقادیر روی هم قرارگرفته به ترتیب رنگ‌های نمودار هستند
+type ChartBar struct {
+	Label  string // برچسب زیر ستون (فقط ارقام، نقطه، / و حروف K و M)؛ خالی یعنی بدون برچسب
+	Values []float64
+}
+
+// BarChart - نمودار ستونی ساده
+type BarChart struct {
+	Width, Height int
+	Colors        []color.RGBA
+	Bars          []ChartBar
+}
+
+// فاصله ناحیه رسم از لبه‌های تصویر
+const (
+	chartMarginLeft   = 70
+	chartMarginRight  = 20
+	chartMarginTop    = 20
+	chartMarginBottom = 36
+	chartGridLines    = 4
+	chartGlyphScale   = 2
+)
+
+var (
+	chartBackground = color.RGBA{255, 255, 255, 255}
+	chartGrid       = color.RGBA{230, 230, 235, 255}
+	chartAxis       = color.RGBA{90, 90, 100, 255}
+)
+
+// RenderBarChart رسم نمودار ستونی به صورت PNG (بدون وابستگی خارجی)
+func RenderBarChart(chart BarChart) ([]byte, error) {
+	img := image.NewRGBA(image.Rect(0, 0, chart.Width, chart.Height))
+	draw.Draw(img, img.Bounds(), &image.Uniform{chartBackground}, image.Point{}, draw.Src)
+
+	plot := image.Rect(chartMarginLeft, chartMarginTop, chart.Width-chartMarginRight, chart.Height-chartMarginBottom)
+
+	maxValue := 0.0
+	for _, b := range chart.Bars {
+		total := 0.0
+		for _, v := range b.Values {
+			total += v
+		}
+		maxValue = math.Max(maxValue, total)
+	}
+	step := niceStep(maxValue / chartGridLines)
+	top := step * chartGridLines
+
+	// خطوط راهنما و برچسب محور عمودی
+	for i := 0; i <= chartGridLines; i++ {
+		y := plot.Max.Y - int(float64(plot.Dy())*float64(i)/chartGridLines)
+		fillRect(img, image.Rect(plot.Min.X, y, plot.Max.X, y+1), chartGrid)
+		label := FormatCompact(step * float64(i))
+		drawText(img, label, plot.Min.X-8-textWidth(label), y-glyphHeight*chartGlyphScale/2, chartAxis)
+	}
+
+	// ستون‌ها
+	if n := len(chart.Bars); n > 0 {
+		slot := float64(plot.Dx()) / float64(n)
+		barWidth := int(math.Max(1, slot*0.7))
+		for i, b := range chart.Bars {
+			x := plot.Min.X + int(slot*float64(i)+(slot-float64(barWidth))/2)
+			base := plot.Max.Y
+			for j, v := range b.Values {
+				if v <= 0 || j >= len(chart.Colors) {
+					continue
+				}
+				h := int(math.Round(float64(plot.Dy()) * v / top))
+				fillRect(img, image.Rect(x, base-h, x+barWidth, base), chart.Colors[j])
+				base -= h
+			}
+			if b.Label != "" {
+				cx := x + barWidth/2 - textWidth(b.Label)/2
+				drawText(img, b.Label, cx, plot.Max.Y+10, chartAxis)
+			}
+		}
+	}
+
+	// محورها
+	fillRect(img, image.Rect(plot.Min.X, plot.Min.Y, plot.Min.X+1, plot.Max.Y+1), chartAxis)
+	fillRect(img, image.Rect(plot.Min.X, plot.Max.Y, plot.Max.X, plot.Max.Y+1), chartAxis)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// FormatCompact نمایش کوتاه عدد، مثلاً 1.5K یا 2M
+func FormatCompact(v float64) string {
+	switch {
+	case v >= 1000000:
+		return trimFloat(v/1000000) + "M"
+	case v >= 1000:
+		return trimFloat(v/1000) + "K"
+	}
+	return trimFloat(v)
+}
+
+func trimFloat(v float64) string {
+	s := strconv.FormatFloat(v, 'f', 2, 64)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// niceStep گرد کردن فاصله خطوط راهنما به ۱، ۲ یا ۵ ضرب در توانی از ۱۰
+func niceStep(raw float64) float64 {
+	if raw <= 0 {
+		return 1
+	}
+	magnitude := math.Pow(10, math.Floor(math.Log10(raw)))
+	for _, m := range []float64{1, 2, 5, 10} {
+		if raw <= m*magnitude {
+			return m * magnitude
+		}
+	}
+	return 10 * magnitude
+}
+
+func fillRect(img *image.RGBA, r image.Rectangle, c color.RGBA) {
+	draw.Draw(img, r.Intersect(img.Bounds()), &image.Uniform{c}, image.Point{}, draw.Src)
+}
+
+// قلم بیت‌مپ ۳×۵ برای برچسب‌های عددی نمودار
+const (
+	glyphWidth   = 3
+	glyphHeight  = 5
+	glyphSpacing = 1
+)
+
+var chartGlyphs = map[rune][glyphHeight]string{
+	'0': {"###", "#.#", "#.#", "#.#", "###"},
+	'1': {".#.", "##.", ".#.", ".#.", "###"},
+	'2': {"###", "..#", "###", "#..", "###"},
+	'3': {"###", "..#", "###", "..#", "###"},
+	'4': {"#.#", "#.#", "###", "..#", "..#"},
+	'5': {"###", "#..", "###", "..#", "###"},
+	'6': {"###", "#..", "###", "#.#", "###"},
+	'7': {"###", "..#", ".#.", ".#.", ".#."},
+	'8': {"###", "#.#", "###", "#.#", "###"},
+	'9': {"###", "#.#", "###", "..#", "###"},
+	'.': {"...", "...", "...", "...", ".#."},
+	'/': {"..#", "..#", ".#.", "#..", "#.."},
+	'K': {"#.#", "##.", "#..", "##.", "#.#"},
+	'M': {"#.#", "###", "###", "#.#", "#.#"},
+}
+
+func textWidth(s string) int {
+	n := len([]rune(s))
+	if n == 0 {
+		return 0
+	}
+	return (n*(glyphWidth+glyphSpacing) - glyphSpacing) * chartGlyphScale
+}
+
+// drawText نوشتن متن با قلم بیت‌مپ؛ نویسه‌های ناشناخته به صورت فاصله رد می‌شوند
+func drawText(img *image.RGBA, s string, x, y int, c color.RGBA) {
+	for _, r := range s {
+		if glyph, ok := chartGlyphs[r]; ok {
+			for row, line := range glyph {
+				for col, px := range line {
+					if px != '#' {
+						continue
+					}
+					px0 := x + col*chartGlyphScale
+					py0 := y + row*chartGlyphScale
+					fillRect(img, image.Rect(px0, py0, px0+chartGlyphScale, py0+chartGlyphScale), c)
+				}
+			}
+		}
+		x += (glyphWidth + glyphSpacing) * chartGlyphScale
+	}
+}
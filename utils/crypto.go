@@ -0,0 +1,215 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// طول کلید اصلی و کلید داده (AES-256)
+const MasterKeySize = 32
+
+// Sealed - مقدار رمز‌شده به روش envelope
+//
+// متن با یک کلید داده تصادفی (مخصوص همان ردیف) رمز می‌شود و کلید داده با کلید اصلی؛
+// برای چرخش کلید اصلی فقط کافی است کلید داده دوباره رمز شود.
+type Sealed struct {
+	Ciphertext string // base64(nonce || متن رمز‌شده با کلید داده)
+	WrappedKey string // base64(nonce || کلید داده رمز‌شده با کلید اصلی)
+	KeyVersion int    // نسخه کلید اصلی؛ صفر یعنی مقدار قدیمی رمز‌نشده
+}
+
+// Keyring - کلیدهای اصلی به تفکیک نسخه
+type Keyring struct {
+	current int
+	keys    map[int]cipher.AEAD
+}
+
+// MasterKeys کلیدهای اصلی برنامه (در زمان راه‌اندازی از main تنظیم می‌شود)
+var MasterKeys = &Keyring{}
+
+// ErrUnknownKeyVersion نسخه کلید اصلی ردیف در تنظیمات وجود ندارد
+var ErrUnknownKeyVersion = errors.New("نسخه کلید اصلی در تنظیمات وجود ندارد")
+
+// ConfigureMasterKeys تنظیم کلیدهای اصلی؛ current نسخه‌ای است که برای رمزنگاری جدید استفاده می‌شود
+func ConfigureMasterKeys(current int, keys map[int][]byte) error {
+	ring, err := NewKeyring(current, keys)
+	if err != nil {
+		return err
+	}
+	*MasterKeys = *ring
+	return nil
+}
+
+// NewKeyring ساخت Keyring از کلیدهای خام
+func NewKeyring(current int, keys map[int][]byte) (*Keyring, error) {
+	if current < 1 {
+		return nil, fmt.Errorf("نسخه کلید اصلی باید مثبت باشد")
+	}
+	if _, ok := keys[current]; !ok {
+		return nil, fmt.Errorf("کلید نسخه %d تعریف نشده است", current)
+	}
+
+	ring := &Keyring{current: current, keys: make(map[int]cipher.AEAD, len(keys))}
+	for version, key := range keys {
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, fmt.Errorf("کلید نسخه %d: %v", version, err)
+		}
+		ring.keys[version] = aead
+	}
+	return ring, nil
+}
+
+// CurrentVersion نسخه کلید اصلی فعلی
+func (k *Keyring) CurrentVersion() int {
+	return k.current
+}
+
+// Seal رمزنگاری متن با یک کلید داده جدید
+func (k *Keyring) Seal(plaintext string) (Sealed, error) {
+	master, ok := k.keys[k.current]
+	if !ok {
+		return Sealed{}, fmt.Errorf("کلید اصلی رمزنگاری تنظیم نشده است")
+	}
+
+	dek := make([]byte, MasterKeySize)
+	if _, err := rand.Read(dek); err != nil {
+		return Sealed{}, err
+	}
+	dataCipher, err := newAEAD(dek)
+	if err != nil {
+		return Sealed{}, err
+	}
+
+	ciphertext, err := seal(dataCipher, []byte(plaintext))
+	if err != nil {
+		return Sealed{}, err
+	}
+	wrapped, err := seal(master, dek)
+	if err != nil {
+		return Sealed{}, err
+	}
+
+	return Sealed{Ciphertext: ciphertext, WrappedKey: wrapped, KeyVersion: k.current}, nil
+}
+
+// Open رمزگشایی مقدار رمز‌شده (مقادیر قدیمی نسخه صفر همان‌طور برگردانده می‌شوند)
+func (k *Keyring) Open(s Sealed) (string, error) {
+	if s.KeyVersion == 0 {
+		return s.Ciphertext, nil
+	}
+
+	dataCipher, err := k.unwrap(s)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(dataCipher, s.Ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("خطا در رمزگشایی مقدار: %v", err)
+	}
+	return string(plaintext), nil
+}
+
+// Rewrap رمزنگاری دوباره کلید داده با کلید اصلی فعلی (متن رمز‌شده تغییر نمی‌کند)
+//
+// مقادیر قدیمی رمز‌نشده به طور کامل رمز می‌شوند.
+func (k *Keyring) Rewrap(s Sealed) (Sealed, error) {
+	if s.KeyVersion == 0 {
+		return k.Seal(s.Ciphertext)
+	}
+
+	master, ok := k.keys[s.KeyVersion]
+	if !ok {
+		return Sealed{}, ErrUnknownKeyVersion
+	}
+	dek, err := open(master, s.WrappedKey)
+	if err != nil {
+		return Sealed{}, fmt.Errorf("خطا در رمزگشایی کلید داده: %v", err)
+	}
+
+	wrapped, err := seal(k.keys[k.current], dek)
+	if err != nil {
+		return Sealed{}, err
+	}
+	return Sealed{Ciphertext: s.Ciphertext, WrappedKey: wrapped, KeyVersion: k.current}, nil
+}
+
+// unwrap رمزگشایی کلید داده ردیف
+func (k *Keyring) unwrap(s Sealed) (cipher.AEAD, error) {
+	master, ok := k.keys[s.KeyVersion]
+	if !ok {
+		return nil, ErrUnknownKeyVersion
+	}
+	dek, err := open(master, s.WrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("خطا در رمزگشایی کلید داده: %v", err)
+	}
+	return newAEAD(dek)
+}
+
+// DecodeMasterKey تبدیل کلید base64 به بایت و بررسی طول آن
+func DecodeMasterKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("base64 معتبر نیست")
+	}
+	if len(key) != MasterKeySize {
+		return nil, fmt.Errorf("طول کلید باید %d بایت باشد (فعلی: %d)", MasterKeySize, len(key))
+	}
+	return key, nil
+}
+
+// MaskAPIKey نمایش امن کلید API، مثلاً sk-...abcd
+func MaskAPIKey(key string) string {
+	if key == "" {
+		return "—"
+	}
+
+	prefix := ""
+	for _, p := range []string{"sk-ant-", "sk-proj-", "sk-"} {
+		if strings.HasPrefix(key, p) {
+			prefix = p
+			break
+		}
+	}
+
+	rest := []rune(strings.TrimPrefix(key, prefix))
+	if len(rest) <= 8 {
+		return prefix + "****"
+	}
+	return prefix + "..." + string(rest[len(rest)-4:])
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal رمزنگاری با nonce تصادفی و خروجی base64(nonce || ciphertext)
+func seal(aead cipher.AEAD, plaintext []byte) (string, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, plaintext, nil)), nil
+}
+
+func open(aead cipher.AEAD, encoded string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, fmt.Errorf("داده رمز‌شده کوتاه است")
+	}
+	nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, nil)
+}
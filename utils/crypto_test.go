@@ -0,0 +1,233 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, MasterKeySize)
+}
+
+func mustKeyring(t *testing.T, current int, keys map[int][]byte) *Keyring {
+	t.Helper()
+	ring, err := NewKeyring(current, keys)
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+	return ring
+}
+
+func TestSealOpenRoundTrip(t *testing.T) {
+	ring := mustKeyring(t, 1, map[int][]byte{1: testKey(1)})
+
+	tests := []struct {
+		name      string
+		plaintext string
+	}{
+		{"empty", ""},
+		{"openai key", "sk-proj-abcdefghijklmnopqrstuvwxyz0123456789"},
+		{"anthropic key", "sk-ant-REDACTED"},
+		{"unicode", "کلید آزمایشی 🔑"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sealed, err := ring.Seal(tt.plaintext)
+			if err != nil {
+				t.Fatalf("Seal: %v", err)
+			}
+			if sealed.KeyVersion != 1 {
+				t.Errorf("KeyVersion = %d, want 1", sealed.KeyVersion)
+			}
+			if tt.plaintext != "" && sealed.Ciphertext == tt.plaintext {
+				t.Errorf("ciphertext equals plaintext")
+			}
+
+			got, err := ring.Open(sealed)
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			if got != tt.plaintext {
+				t.Errorf("Open = %q, want %q", got, tt.plaintext)
+			}
+		})
+	}
+}
+
+func TestSealUsesFreshDataKey(t *testing.T) {
+	ring := mustKeyring(t, 1, map[int][]byte{1: testKey(1)})
+
+	a, err := ring.Seal("sk-same")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ring.Seal("sk-same")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Ciphertext == b.Ciphertext || a.WrappedKey == b.WrappedKey {
+		t.Errorf("two seals of the same value must differ")
+	}
+}
+
+func TestOpenErrors(t *testing.T) {
+	ring := mustKeyring(t, 1, map[int][]byte{1: testKey(1)})
+	other := mustKeyring(t, 1, map[int][]byte{1: testKey(2)})
+
+	sealed, err := ring.Seal("sk-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tamper := func(encoded string) string {
+		data, _ := base64.StdEncoding.DecodeString(encoded)
+		data[len(data)-1] ^= 0xff
+		return base64.StdEncoding.EncodeToString(data)
+	}
+
+	tests := []struct {
+		name    string
+		ring    *Keyring
+		sealed  Sealed
+		want    string
+		wantErr error
+		anyErr  bool
+	}{
+		{name: "legacy plaintext row", ring: ring, sealed: Sealed{Ciphertext: "sk-legacy"}, want: "sk-legacy"},
+		{name: "unknown version", ring: ring, sealed: Sealed{Ciphertext: sealed.Ciphertext, WrappedKey: sealed.WrappedKey, KeyVersion: 7}, wantErr: ErrUnknownKeyVersion},
+		{name: "wrong master key", ring: other, sealed: sealed, anyErr: true},
+		{name: "tampered ciphertext", ring: ring, sealed: Sealed{Ciphertext: tamper(sealed.Ciphertext), WrappedKey: sealed.WrappedKey, KeyVersion: 1}, anyErr: true},
+		{name: "tampered data key", ring: ring, sealed: Sealed{Ciphertext: sealed.Ciphertext, WrappedKey: tamper(sealed.WrappedKey), KeyVersion: 1}, anyErr: true},
+		{name: "short ciphertext", ring: ring, sealed: Sealed{Ciphertext: "AAAA", WrappedKey: sealed.WrappedKey, KeyVersion: 1}, anyErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.ring.Open(tt.sealed)
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("err = %v, want %v", err, tt.wantErr)
+				}
+			case tt.anyErr:
+				if err == nil {
+					t.Errorf("Open succeeded with %q, want error", got)
+				}
+			default:
+				if err != nil || got != tt.want {
+					t.Errorf("Open = %q, %v; want %q", got, err, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestRewrapRotation(t *testing.T) {
+	oldRing := mustKeyring(t, 1, map[int][]byte{1: testKey(1)})
+	rotating := mustKeyring(t, 2, map[int][]byte{1: testKey(1), 2: testKey(2)})
+	newRing := mustKeyring(t, 2, map[int][]byte{2: testKey(2)})
+
+	sealed, err := oldRing.Seal("sk-rotate-me")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		input  Sealed
+		plain  string
+		sameCT bool // متن رمز‌شده فقط با کلید داده موجود ثابت می‌ماند
+	}{
+		{"encrypted row", sealed, "sk-rotate-me", true},
+		{"legacy plaintext row", Sealed{Ciphertext: "sk-legacy"}, "sk-legacy", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rewrapped, err := rotating.Rewrap(tt.input)
+			if err != nil {
+				t.Fatalf("Rewrap: %v", err)
+			}
+			if rewrapped.KeyVersion != 2 {
+				t.Errorf("KeyVersion = %d, want 2", rewrapped.KeyVersion)
+			}
+			if tt.sameCT && rewrapped.Ciphertext != tt.input.Ciphertext {
+				t.Errorf("ciphertext changed during rewrap")
+			}
+
+			// پس از چرخش، کلید قدیمی دیگر لازم نیست
+			got, err := newRing.Open(rewrapped)
+			if err != nil || got != tt.plain {
+				t.Errorf("Open after rotation = %q, %v; want %q", got, err, tt.plain)
+			}
+		})
+	}
+
+	if _, err := newRing.Rewrap(sealed); !errors.Is(err, ErrUnknownKeyVersion) {
+		t.Errorf("Rewrap without old key: err = %v, want %v", err, ErrUnknownKeyVersion)
+	}
+}
+
+func TestNewKeyringValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		current int
+		keys    map[int][]byte
+	}{
+		{"zero version", 0, map[int][]byte{0: testKey(1)}},
+		{"missing current", 2, map[int][]byte{1: testKey(1)}},
+		{"short key", 1, map[int][]byte{1: []byte("short")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewKeyring(tt.current, tt.keys); err == nil {
+				t.Errorf("NewKeyring succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestDecodeMasterKey(t *testing.T) {
+	valid := base64.StdEncoding.EncodeToString(testKey(3))
+
+	tests := []struct {
+		name    string
+		input   string
+		wantErr bool
+	}{
+		{"valid", valid, false},
+		{"surrounding whitespace", "  " + valid + "\n", false},
+		{"not base64", "%%%", true},
+		{"wrong length", base64.StdEncoding.EncodeToString([]byte("too short")), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := DecodeMasterKey(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !bytes.Equal(key, testKey(3)) {
+				t.Errorf("decoded key mismatch")
+			}
+		})
+	}
+}
+
+func TestMaskAPIKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"", "—"},
+		{"sk-short", "sk-****"},
+		{"sk-abcdefghijklmnop", "sk-...mnop"},
+		{"sk-proj-abcdefghijklmnop", "sk-proj-...mnop"},
+		{"sk-ant-api03-abcdefghijkl", "sk-ant-...ijkl"},
+		{"local-token-123456789", "...6789"},
+	}
+	for _, tt := range tests {
+		if got := MaskAPIKey(tt.key); got != tt.want {
+			t.Errorf("MaskAPIKey(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package utils
+
+import "strings"
+
+// NormalizeDigits تبدیل ارقام فارسی و عربی به ارقام انگلیسی و حذف جداکننده‌های هزارگان
+func NormalizeDigits(s string) string {
+	var b strings.Builder
+	for _, r := range strings.TrimSpace(s) {
+		switch {
+		case r >= '۰' && r <= '۹':
+			b.WriteRune('0' + (r - '۰'))
+		case r >= '٠' && r <= '٩':
+			b.WriteRune('0' + (r - '٠'))
+		case r == ',' || r == '،' || r == '٬':
+			// جداکننده هزارگان
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}